@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// adminClient sends requests to the admin API of a running helper, with the
+// flags shared by the subcommands using it
+type adminClient struct {
+	address    string
+	token      string
+	kubeconfig string
+	// forward reaches the helper in the cluster if address is empty, nil
+	// if the address is required
+	forward *portForward
+}
+
+// addFlags registers the flags of the client
+func (c *adminClient) addFlags(flags *pflag.FlagSet) {
+	address, usage := "http://localhost:8080", "Base URL of the running rollout helper"
+	if c.forward != nil {
+		address, usage = "", "Base URL of the running rollout helper, port-forwarded to a pod of --selector if empty"
+		c.forward.addFlags(flags)
+	}
+	flags.StringVar(&c.address, "address", address, usage)
+	flags.StringVar(&c.token, "token", "", "Bearer token for the admin API, defaults to the token of the current kubeconfig context")
+	flags.StringVar(&c.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file the token is taken from")
+}
+
+// close stops the port-forward, if any
+func (c *adminClient) close() {
+	if c.forward != nil {
+		c.forward.close()
+	}
+}
+
+// do sends a request to path and returns the response if its status is
+// one of expected, the caller has to close its body
+func (c *adminClient) do(method, path string, expected ...int) (*http.Response, error) {
+	address := c.address
+	if address == "" && c.forward != nil {
+		var err error
+		if address, err = c.forward.start(c.kubeconfig); err != nil {
+			return nil, err
+		}
+	}
+
+	token := c.token
+	if token == "" {
+		var err error
+		if token, err = kubeconfigToken(c.kubeconfig); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(address, "/")+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach rollout helper: %w", err)
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// loadKubeconfig returns the configuration of the current context of the
+// kubeconfig at path, or of $KUBECONFIG or ~/.kube/config if path is empty
+func loadKubeconfig(path string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return restConfig, nil
+}
+
+// kubeconfigToken returns the bearer token of the current context, e.g.
+// after `oc login`
+func kubeconfigToken(path string) (string, error) {
+	restConfig, err := loadKubeconfig(path)
+	if err != nil {
+		return "", err
+	}
+	if restConfig.BearerToken != "" {
+		return restConfig.BearerToken, nil
+	}
+	if restConfig.BearerTokenFile != "" {
+		data, err := os.ReadFile(restConfig.BearerTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", errors.New("the current kubeconfig context has no bearer token, pass one with --token")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"text/tabwriter"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/state"
+)
+
+// runAdopt takes over silences created by hand or with amtool for nodes, so
+// the helper manages and deletes them like the silences it created itself
+func runAdopt(args []string) {
+	fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+	var urls stringList
+	fs.Var(&urls, "alertmanager-url", "AlertManager URL, may be repeated or comma-separated")
+	mode := fs.String("alertmanager-mode", string(alertmanager.ModeFailover), "How multiple AlertManager URLs are used: failover or broadcast")
+	tlsOptions := tlsFlags(fs)
+	proxyURL := proxyFlag(fs)
+	httpOptions := httpFlags(fs)
+	tenancy := tenancyFlags(fs)
+	tokenPath := fs.String("alertmanager-token-file", "", "Path to a file with the AlertManager token, defaults to ALERTMNGR_TOKEN")
+	kubeconfigPath := fs.String("kubeconfig", "", "Path to kubeconfig file")
+	nodeName := fs.String("node", "", "Only adopt silences of this node")
+	creator := fs.String("created-by", "", "Only adopt silences created by this user")
+	comment := fs.String("comment-regex", "", "Only adopt silences whose comment matches this regular expression")
+	configMap := fs.String("state-configmap", "", "State ConfigMap of the helper, adopted silences are recorded in it")
+	namespace := fs.String("state-namespace", "", "Namespace of the state ConfigMap, defaults to the current namespace")
+	dryRun := fs.Bool("dry-run", false, "Only list the silences which would be adopted")
+	fs.Parse(args)
+
+	if len(urls) == 0 {
+		fmt.Fprintln(os.Stderr, "--alertmanager-url is required")
+		os.Exit(2)
+	}
+	amMode, err := alertmanager.ParseMode(*mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --alertmanager-mode: %v\n", err)
+		os.Exit(2)
+	}
+
+	filter := alertmanager.AdoptFilter{CreatedBy: *creator, Nodes: map[string]bool{}}
+	if *comment != "" {
+		if filter.Comment, err = regexp.Compile(*comment); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --comment-regex: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	ctx := context.Background()
+	clientset, err := newClientset(*kubeconfigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list nodes: %v\n", err)
+		os.Exit(1)
+	}
+	for _, node := range nodes.Items {
+		if *nodeName == "" || node.Name == *nodeName {
+			filter.Nodes[node.Name] = true
+		}
+	}
+
+	client := alertmanager.NewClient(urls, os.Getenv("ALERTMNGR_TOKEN"))
+	client.SetMode(amMode)
+	if *tokenPath != "" {
+		if err := client.SetTokenFile(*tokenPath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read token: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := client.SetHTTPOptions(*httpOptions); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid AlertManager HTTP options: %v\n", err)
+		os.Exit(2)
+	}
+	if err := tenancy.apply(client); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --alertmanager-header: %v\n", err)
+		os.Exit(2)
+	}
+	if tlsOptions.Enabled() {
+		if err := client.SetTLS(*tlsOptions); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to configure TLS: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *proxyURL != "" {
+		if err := client.SetProxy(*proxyURL); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --alertmanager-proxy-url: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	silences, err := client.GetSilences(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get silences: %v\n", err)
+		os.Exit(1)
+	}
+
+	candidates := alertmanager.FindAdoptable(silences, filter)
+	if len(candidates) == 0 {
+		fmt.Println("No silences to adopt")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSILENCE\tCREATED BY\tENDS AT\tRESULT")
+	adopted := make(state.Silences)
+	failed := 0
+	for _, candidate := range candidates {
+		silence := candidate.Silence
+		result := "would adopt"
+		if !*dryRun {
+			id, err := client.AdoptSilence(ctx, silence, candidate.Node)
+			if err != nil {
+				result = fmt.Sprintf("failed: %v", err)
+				failed++
+			} else {
+				result = "adopted as " + id
+				adopted[candidate.Node] = append(adopted[candidate.Node], id)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", candidate.Node, silence.ID, valueOr(silence.CreatedBy, "-"), silence.EndsAt, result)
+	}
+	w.Flush()
+
+	if *configMap != "" && len(adopted) > 0 {
+		ns := *namespace
+		if ns == "" {
+			ns = state.CurrentNamespace()
+		}
+		if err := recordAdopted(ctx, state.NewConfigMapStore(clientset, ns, *configMap), adopted); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to record adopted silences: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// recordAdopted adds the adopted silences to the persisted state so they
+// aren't expired as orphans when the helper restores it
+func recordAdopted(ctx context.Context, store state.Store, adopted state.Silences) error {
+	persisted, _, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	for node, ids := range adopted {
+		persisted[node] = append(persisted[node], ids...)
+	}
+	return store.Save(ctx, persisted)
+}
+
+func valueOr(value *string, fallback string) string {
+	if value == nil || *value == "" {
+		return fallback
+	}
+	return *value
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/alertmanager"
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/watcher"
+)
+
+// latencyRecorder collects durations from concurrent goroutines
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	errors  int
+}
+
+func (r *latencyRecorder) record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, d)
+	if err != nil {
+		r.errors++
+	}
+}
+
+func (r *latencyRecorder) percentile(p float64) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), r.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func (r *latencyRecorder) count() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.samples), r.errors
+}
+
+// timedTransport records the latency of every Alertmanager call
+type timedTransport struct {
+	next     http.RoundTripper
+	recorder *latencyRecorder
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		t.recorder.record(time.Since(start), fmt.Errorf("unexpected status code: %d", resp.StatusCode))
+	} else {
+		t.recorder.record(time.Since(start), err)
+	}
+	return resp, err
+}
+
+// runBench drives the silence pipeline against a fake Alertmanager and a
+// fake node source and reports throughput, latency and memory usage
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	nodeCount := fs.Int("nodes", 100, "Number of fake nodes")
+	churn := fs.String("churn", "50/min", "Rate of node state changes, e.g. 50/min or 5/s")
+	duration := fs.Duration("duration", 2*time.Minute, "How long to run the benchmark")
+	interval := fs.Duration("poll-interval", time.Second, "Interval between node state checks")
+	amLatency := fs.Duration("am-latency", 0, "Latency added to every fake Alertmanager request")
+	amConcurrency := fs.Int("alertmanager-concurrency", alertmanager.DefaultRequestLimits.Concurrency, "Maximum Alertmanager requests in flight, 0 is unbounded")
+	amRateLimit := fs.Float64("alertmanager-rate-limit", alertmanager.DefaultRequestLimits.RatePerSecond, "Average Alertmanager requests per second, 0 is unlimited")
+	verbose := fs.Bool("verbose", false, "Keep the helper's logs on stderr")
+	fs.Parse(args)
+
+	churnPeriod, err := parseRate(*churn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --churn: %v\n", err)
+		os.Exit(2)
+	}
+
+	if !*verbose {
+		klog.SetLogger(logr.Discard())
+	}
+
+	am := amfake.NewServer(*amLatency)
+	defer am.Close()
+
+	objects := make([]k8sruntime.Object, 0, *nodeCount)
+	for i := 0; i < *nodeCount; i++ {
+		objects = append(objects, &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("bench-node-%d", i),
+				Annotations: map[string]string{
+					watcher.MachineConfigStateAnnotation: watcher.MachineConfigStateDone,
+				},
+			},
+		})
+	}
+	clientset := fake.NewSimpleClientset(objects...)
+	// The fake clientset denies access reviews, grant them like a correctly set up cluster
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		return true, &authorizationv1.SelfSubjectAccessReview{Status: authorizationv1.SubjectAccessReviewStatus{Allowed: true}}, nil
+	})
+
+	amCalls := &latencyRecorder{}
+	amClient := alertmanager.NewClient([]string{am.URL()}, "")
+	amClient.SetTransport(&timedTransport{next: http.DefaultTransport, recorder: amCalls})
+	limits := alertmanager.RequestLimits{Concurrency: *amConcurrency, RatePerSecond: *amRateLimit, Burst: alertmanager.DefaultRequestLimits.Burst}
+	if err := limits.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid request limits: %v\n", err)
+		os.Exit(2)
+	}
+	amClient.SetRequestLimits(limits)
+	silenceManager := alertmanager.NewSilenceManager(amClient, clientset, &config.Config{}, nil, alertmanager.Options{SilenceDuration: 90 * time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	silenceManager.Start(ctx)
+
+	nodeWatcher := watcher.NewWatcher(clientset, *interval)
+	nodeWatcher.Start(ctx)
+
+	events := &latencyRecorder{}
+	go func() {
+		for state := range nodeWatcher.StateChannel() {
+			start := time.Now()
+			err := silenceManager.HandleNodeState(ctx, state.Name, state.IsRolling, alertmanager.KindOf(state))
+			events.record(time.Since(start), err)
+		}
+	}()
+
+	go churnNodes(ctx, clientset, *nodeCount, churnPeriod)
+
+	var peakHeap uint64
+	var mem runtime.MemStats
+	sampler := time.NewTicker(time.Second)
+	defer sampler.Stop()
+
+	fmt.Printf("Running benchmark: nodes=%d churn=%s duration=%s\n", *nodeCount, *churn, *duration)
+	started := time.Now()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-sampler.C:
+			runtime.ReadMemStats(&mem)
+			if mem.HeapAlloc > peakHeap {
+				peakHeap = mem.HeapAlloc
+			}
+		}
+	}
+	elapsed := time.Since(started)
+	runtime.ReadMemStats(&mem)
+
+	eventCount, eventErrors := events.count()
+	callCount, callErrors := amCalls.count()
+	fmt.Printf("State events:        %d (%.2f/s), %d failed\n", eventCount, float64(eventCount)/elapsed.Seconds(), eventErrors)
+	fmt.Printf("Event handling:      p50=%s p95=%s p99=%s\n", events.percentile(0.5), events.percentile(0.95), events.percentile(0.99))
+	fmt.Printf("Alertmanager calls:  %d (%.2f/s), %d failed\n", callCount, float64(callCount)/elapsed.Seconds(), callErrors)
+	fmt.Printf("Alertmanager call:   p50=%s p95=%s p99=%s\n", amCalls.percentile(0.5), amCalls.percentile(0.95), amCalls.percentile(0.99))
+	fmt.Printf("Active silences:     %d\n", am.ActiveSilences())
+	fmt.Printf("Heap:                current=%dMiB peak=%dMiB sys=%dMiB\n", mem.HeapAlloc>>20, peakHeap>>20, mem.Sys>>20)
+	fmt.Printf("Goroutines:          %d\n", runtime.NumGoroutine())
+}
+
+// churnNodes flips the machine-config state of a random node once per period
+func churnNodes(ctx context.Context, client kubernetes.Interface, nodeCount int, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			name := fmt.Sprintf("bench-node-%d", rand.Intn(nodeCount))
+			node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				continue
+			}
+
+			if node.Annotations[watcher.MachineConfigStateAnnotation] == watcher.MachineConfigStateWorking {
+				node.Annotations[watcher.MachineConfigStateAnnotation] = watcher.MachineConfigStateDone
+			} else {
+				node.Annotations[watcher.MachineConfigStateAnnotation] = watcher.MachineConfigStateWorking
+			}
+			client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		}
+	}
+}
+
+// parseRate converts a rate like "50/min" into the period between two events
+func parseRate(rate string) (time.Duration, error) {
+	count, unit, ok := strings.Cut(rate, "/")
+	if !ok {
+		return 0, fmt.Errorf("expected <count>/<unit>, got %q", rate)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count %q", count)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s", "sec":
+		per = time.Second
+	case "m", "min":
+		per = time.Minute
+	case "h", "hour":
+		per = time.Hour
+	default:
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+	return per / time.Duration(n), nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/config/scheme"
+	"rollout-helper/internal/watcher"
+)
+
+// runCleanup expires the silences of the helper whose nodes are done rolling
+// or were deleted, independently of a running helper, e.g. from a CronJob in
+// case the helper is down or stuck
+func runCleanup(args []string) {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	var urls stringList
+	fs.Var(&urls, "alertmanager-url", "AlertManager URL, may be repeated or comma-separated")
+	mode := fs.String("alertmanager-mode", string(alertmanager.ModeFailover), "How multiple AlertManager URLs are used: failover or broadcast")
+	tlsOptions := tlsFlags(fs)
+	proxyURL := proxyFlag(fs)
+	httpOptions := httpFlags(fs)
+	tenancy := tenancyFlags(fs)
+	tokenPath := fs.String("alertmanager-token-file", "", "Path to a file with the AlertManager token, defaults to ALERTMNGR_TOKEN")
+	kubeconfigPath := fs.String("kubeconfig", "", "Path to kubeconfig file")
+	configPath := fs.String("config", "", "Path to the configuration file of the helper, for its rollingTaints")
+	taintList := fs.String("rolling-taints", "", "Comma-separated taint keys marking a node as rolling, each optionally followed by :<effect>. Overrides rollingTaints of the configuration file")
+	kured := fs.String("kured-annotation", watcher.DefaultKuredAnnotation, "Annotation kured sets on nodes it reboots. Empty disables kured detection")
+	minReady := fs.Duration("min-ready", 30*time.Minute, "How long a node has to be Ready before its silences are expired")
+	unsilenceDelay := fs.Duration("unsilence-delay", 0, "The --unsilence-delay of the helper, silences of nodes Ready for less are kept like the helper does")
+	dryRun := fs.Bool("dry-run", false, "Only list the silences which would be expired")
+	fs.Parse(args)
+
+	if len(urls) == 0 {
+		fmt.Fprintln(os.Stderr, "--alertmanager-url is required")
+		os.Exit(2)
+	}
+	amMode, err := alertmanager.ParseMode(*mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --alertmanager-mode: %v\n", err)
+		os.Exit(2)
+	}
+
+	taints := watcher.DefaultRollingTaints
+	cfg := &config.Config{}
+	if *configPath != "" {
+		if cfg, err = scheme.Load(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+		if len(cfg.RollingTaints) > 0 {
+			taints = cfg.RollingTaints
+		}
+	}
+	if *taintList != "" {
+		if taints, err = config.ParseTaints(*taintList); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --rolling-taints: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	ctx := context.Background()
+	clientset, err := newClientset(*kubeconfigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Without the nodes every silence would look like one of a deleted node
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list nodes: %v\n", err)
+		os.Exit(1)
+	}
+	updating, err := updatingPools(ctx, *kubeconfigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// A node is Ready before the MCO is done with it, so the helper keeps its
+	// silences at least as long after it became Ready
+	ready := *minReady
+	if *unsilenceDelay > ready {
+		ready = *unsilenceDelay
+	}
+	now := time.Now()
+	settled := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		// Nodes of an updating pool may be silenced ahead of their update
+		settled[node.Name] = watcher.Settled(&node, taints, *kured, ready, now) == "" && !updating[watcher.NodePool(&node)]
+	}
+
+	client := alertmanager.NewClient(urls, os.Getenv("ALERTMNGR_TOKEN"))
+	client.SetMode(amMode)
+	if *tokenPath != "" {
+		if err := client.SetTokenFile(*tokenPath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read token: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := client.SetHTTPOptions(*httpOptions); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid AlertManager HTTP options: %v\n", err)
+		os.Exit(2)
+	}
+	if err := tenancy.apply(client, cfg.Tenants()...); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --alertmanager-header: %v\n", err)
+		os.Exit(2)
+	}
+	if tlsOptions.Enabled() {
+		if err := client.SetTLS(*tlsOptions); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to configure TLS: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *proxyURL != "" {
+		if err := client.SetProxy(*proxyURL); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --alertmanager-proxy-url: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	silences, err := client.OwnedSilences(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get silences: %v\n", err)
+		os.Exit(1)
+	}
+
+	stale := alertmanager.FindStale(silences, settled)
+	if len(stale) == 0 {
+		fmt.Println("No silences to expire")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSILENCE\tKIND\tREASON\tRESULT")
+	failed := 0
+	for _, silence := range stale {
+		reason := "node done"
+		if silence.Deleted {
+			reason = "node deleted"
+		}
+		result := "would expire"
+		if !*dryRun {
+			if err := client.DeleteSilenceID(ctx, silence.Silence.ID); err != nil {
+				result = fmt.Sprintf("failed: %v", err)
+				failed++
+			} else {
+				result = "expired"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", silence.Node, silence.Silence.ID, orNone(string(silence.Kind)), reason, result)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// updatingPools returns the MachineConfigPools whose machines aren't all
+// updated, none on clusters without the MCO
+func updatingPools(ctx context.Context, kubeconfigPath string) (map[string]bool, error) {
+	client, err := newDynamicClient(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(watcher.MachineConfigPoolResource).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MachineConfigPools: %w", err)
+	}
+
+	updating := make(map[string]bool)
+	for _, item := range list.Items {
+		total, _, _ := unstructured.NestedInt64(item.Object, "status", "machineCount")
+		updated, _, _ := unstructured.NestedInt64(item.Object, "status", "updatedMachineCount")
+		if updated < total {
+			updating[item.GetName()] = true
+		}
+	}
+	return updating, nil
+}
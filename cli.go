@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// newRootCommand returns the command line of the binary. Without a
+// subcommand it runs the helper with the flags of flag.CommandLine
+func newRootCommand(startedAt time.Time) *cobra.Command {
+	flag.Var(&alertManagerURL, "alertmanager-url", "AlertManager URL, may be repeated or comma-separated, multiple URLs are used as set by --alertmanager-mode")
+	flag.Var(&lifecycleHeaders, "lifecycle-webhook-header", "Header of lifecycle webhook requests as \"Name: value\", may be repeated or comma-separated. Values are expanded from the environment")
+	klog.InitFlags(nil)
+
+	root := &cobra.Command{
+		Use:          "rollout-helper",
+		Short:        "Silences the alerts of OpenShift nodes while they roll",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			runHelper(startedAt, cmd.Flags().Changed)
+		},
+	}
+	root.Flags().AddGoFlagSet(flag.CommandLine)
+
+	// Every subcommand of the admin API has the flags of its own client
+	for _, newCommand := range []func(*adminClient) *cobra.Command{newStatusCommand, newSilenceCommand, newUnsilenceCommand, newForceUnsilenceCommand, newHistoryCommand} {
+		client := &adminClient{}
+		cmd := newCommand(client)
+		client.addFlags(cmd.Flags())
+		root.AddCommand(cmd)
+	}
+	root.AddCommand(
+		flagSetCommand("bench", "Benchmark the silence pipeline against a fake Alertmanager", runBench),
+		flagSetCommand("explain-policy", "Print the effective silence policies of a node", runExplainPolicy),
+		flagSetCommand("lint-policies", "Check the silence policies of a configuration file for common mistakes", runLintPolicies),
+		flagSetCommand("adopt", "Take over silences created by hand for nodes", runAdopt),
+		flagSetCommand("cleanup", "Expire the silences of nodes which are done rolling, e.g. from a CronJob", runCleanup),
+		flagSetCommand("cloud-agent", "Publish the planned host maintenance of the node in its annotations", runCloudAgent),
+		flagSetCommand("sign-annotation", "Print the signature annotation authorizing an annotation", runSignAnnotation),
+		newConfigCommand(),
+	)
+	return root
+}
+
+// newConfigCommand groups the subcommands handling the configuration file
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the configuration file",
+		Args:  cobra.NoArgs,
+	}
+	cmd.AddCommand(
+		flagSetCommand("migrate", "Upgrade a configuration file to the latest version", runConfigMigrate),
+	)
+	return cmd
+}
+
+// flagSetCommand wraps a subcommand which parses its arguments with its own
+// flag.FlagSet, e.g. `rollout-helper bench --help` prints its flags
+func flagSetCommand(name, short string, run func(args []string)) *cobra.Command {
+	return &cobra.Command{
+		Use:                name,
+		Short:              short,
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			run(args)
+		},
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/cloud"
+	"rollout-helper/internal/logging"
+)
+
+// runCloudAgent polls the instance metadata service of the node it runs on
+// for planned host maintenance and publishes it in the node's annotations,
+// so the helper silences the node before the host goes down. It's run as a
+// DaemonSet, see manifests/cloud-agent.yaml
+func runCloudAgent(args []string) {
+	fs := flag.NewFlagSet("cloud-agent", flag.ExitOnError)
+	providerName := fs.String("provider", "", "Cloud provider whose metadata service is polled: "+strings.Join(cloud.ProviderNames(), ", "))
+	nodeName := fs.String("node", os.Getenv("NODE_NAME"), "Name of the node the agent runs on, defaults to NODE_NAME")
+	interval := fs.Duration("interval", time.Minute, "How often the metadata service is polled")
+	kubeconfigPath := fs.String("kubeconfig", "", "Path to kubeconfig file")
+	logFormat := fs.String("log-format", logging.FormatText, "Format of the logs: text or json")
+	keysFile := fs.String("keys-file", "", "Path to a file with \"<group> <key>\" lines to sign the annotations with, for helpers run with --annotation-keys-file")
+	group := fs.String("group", "", "Group of --keys-file to sign as, defaults to its only group")
+	klog.InitFlags(fs)
+	fs.Parse(args)
+
+	if err := logging.Setup(*logFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --log-format: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *nodeName == "" {
+		fmt.Fprintln(os.Stderr, "--node or NODE_NAME is required")
+		os.Exit(2)
+	}
+	provider, err := cloud.NewProvider(*providerName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --provider: %v\n", err)
+		os.Exit(2)
+	}
+	var signer *maintenanceSigner
+	if *keysFile != "" {
+		signingGroup, signingKey, err := loadSigningKey(*keysFile, *group)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --keys-file: %v\n", err)
+			os.Exit(2)
+		}
+		signer = &maintenanceSigner{group: signingGroup, key: signingKey}
+	}
+	clientset, err := newClientset(*kubeconfigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	klog.Infof("Polling %s for planned maintenance of node %s every %s", provider.Name(), *nodeName, *interval)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	published := ""
+	for {
+		maintenance, err := provider.Scheduled(ctx)
+		switch {
+		case err != nil:
+			// Keep the published maintenance until the service can be reached again
+			klog.Errorf("Failed to get planned maintenance from %s: %v", provider.Name(), err)
+		default:
+			key := maintenanceKey(maintenance)
+			if key == published {
+				break
+			}
+			if err := publishMaintenance(ctx, clientset, *nodeName, maintenance, signer); err != nil {
+				klog.Errorf("Failed to annotate node %s: %v", *nodeName, err)
+				break
+			}
+			if maintenance != nil {
+				klog.Infof("Planned maintenance %s of node %s starts at %s", maintenance.Description, *nodeName, maintenance.Start.Format(time.RFC3339))
+			} else if published != "" {
+				klog.Infof("No planned maintenance of node %s anymore", *nodeName)
+			}
+			published = key
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintenanceKey identifies a maintenance to only patch the node on changes
+func maintenanceKey(maintenance *cloud.Maintenance) string {
+	if maintenance == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s/%s/%s", maintenance.Start.UTC(), maintenance.End.UTC(), maintenance.Description)
+}
+
+// maintenanceSigner signs the maintenance annotations for the helper's
+// --annotation-keys-file
+type maintenanceSigner struct {
+	group string
+	key   []byte
+}
+
+// sign adds the signatures of the annotations which decide when the node is
+// rolling, removed along with them
+func (s *maintenanceSigner) sign(nodeName string, annotations map[string]interface{}) {
+	object := authz.Object{Kind: "Node", Name: nodeName}
+	for _, key := range []string{cloud.MaintenanceAnnotation, cloud.MaintenanceEndAnnotation} {
+		value, ok := annotations[key].(string)
+		if !ok {
+			annotations[key+authz.SignatureSuffix] = nil
+			continue
+		}
+		annotations[key+authz.SignatureSuffix] = authz.Sign(s.group, s.key, object, key, value)
+	}
+}
+
+// publishMaintenance sets the maintenance annotations of a node, they're
+// removed if maintenance is nil. They're signed if signer isn't nil
+func publishMaintenance(ctx context.Context, client kubernetes.Interface, nodeName string, maintenance *cloud.Maintenance, signer *maintenanceSigner) error {
+	annotations := cloud.Annotations(maintenance)
+	if signer != nil {
+		signer.sign(nodeName, annotations)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode patch: %w", err)
+	}
+	_, err = client.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
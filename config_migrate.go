@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"rollout-helper/internal/config/scheme"
+)
+
+// runConfigMigrate upgrades a configuration file to the latest version, in
+// place unless --stdout is set
+func runConfigMigrate(args []string) {
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to the configuration file to migrate")
+	stdout := fs.Bool("stdout", false, "Print the migrated file instead of replacing it")
+	fs.Parse(args)
+
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "--config is required")
+		os.Exit(2)
+	}
+
+	info, err := os.Stat(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read config: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read config: %v\n", err)
+		os.Exit(1)
+	}
+	migrated, version, err := scheme.Migrate(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *stdout {
+		os.Stdout.Write(migrated)
+		return
+	}
+	if version == scheme.LatestVersion {
+		fmt.Printf("%s already has version %s\n", *configPath, version)
+		return
+	}
+	if err := os.WriteFile(*configPath, migrated, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Migrated %s from %s to %s\n", *configPath, version, scheme.LatestVersion)
+}
@@ -0,0 +1,245 @@
+//go:build e2e
+
+// Package e2e runs the node watcher and the silence manager against an API
+// server started by envtest and an in-memory Alertmanager, and checks that
+// the annotations and taints of nodes start and end their silences. It's run
+// by hack/e2e.sh, which provides the API server binaries
+package e2e
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"rollout-helper/internal/alertmanager"
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/watcher"
+)
+
+const (
+	// renderedConfig and updatedConfig are the rendered configs of the worker
+	// pool before and during an update
+	renderedConfig = "rendered-worker-a"
+	updatedConfig  = "rendered-worker-b"
+)
+
+// clientset and am are the API server and Alertmanager shared by the
+// scenarios, every scenario rolls a node of its own
+var (
+	clientset kubernetes.Interface
+	am        *amfake.Server
+)
+
+// scenario rolls a node of its own. roll and finish change the node to start
+// and to end its rollout
+type scenario struct {
+	name string
+	// setup configures the watcher before it's started, optional
+	setup  func(w *watcher.Watcher)
+	roll   func(node *corev1.Node)
+	finish func(node *corev1.Node)
+	// ignored is set if the rollout must not be silenced, finish isn't used
+	ignored bool
+}
+
+func TestMCOWorking(t *testing.T) {
+	run(t, scenario{
+		name:   "mco-working",
+		roll:   setAnnotation(watcher.MachineConfigStateAnnotation, watcher.MachineConfigStateWorking),
+		finish: setAnnotation(watcher.MachineConfigStateAnnotation, watcher.MachineConfigStateDone),
+	})
+}
+
+func TestRollingTaint(t *testing.T) {
+	run(t, scenario{
+		name: "rolling-taint",
+		roll: func(node *corev1.Node) {
+			node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{Key: watcher.DefaultRollingTaints[0].Key, Effect: corev1.TaintEffectNoSchedule})
+		},
+		finish: func(node *corev1.Node) {
+			node.Spec.Taints = nil
+		},
+	})
+}
+
+func TestKuredReboot(t *testing.T) {
+	run(t, scenario{
+		name:   "kured-reboot",
+		roll:   setAnnotation(watcher.DefaultKuredAnnotation, "true"),
+		finish: removeAnnotation(watcher.DefaultKuredAnnotation),
+	})
+}
+
+func TestPreRolling(t *testing.T) {
+	run(t, scenario{
+		name:   "pre-rolling",
+		setup:  func(w *watcher.Watcher) { w.SetPreRolling(true) },
+		roll:   setAnnotation(watcher.DesiredConfigAnnotation, updatedConfig),
+		finish: setAnnotation(watcher.CurrentConfigAnnotation, updatedConfig),
+	})
+}
+
+func TestIgnoreAnnotation(t *testing.T) {
+	run(t, scenario{
+		name: "ignore-annotation",
+		roll: func(node *corev1.Node) {
+			node.Annotations[watcher.IgnoreAnnotation] = "true"
+			node.Annotations[watcher.MachineConfigStateAnnotation] = watcher.MachineConfigStateWorking
+		},
+		ignored: true,
+	})
+}
+
+func setAnnotation(key, value string) func(node *corev1.Node) {
+	return func(node *corev1.Node) {
+		node.Annotations[key] = value
+	}
+}
+
+func removeAnnotation(key string) func(node *corev1.Node) {
+	return func(node *corev1.Node) {
+		delete(node.Annotations, key)
+	}
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		klog.SetLogger(logr.Discard())
+	}
+
+	// The binaries are found through KUBEBUILDER_ASSETS
+	testEnv := &envtest.Environment{}
+	restConfig, err := testEnv.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start the API server: %v\n", err)
+		os.Exit(1)
+	}
+	clientset = kubernetes.NewForConfigOrDie(restConfig)
+	am = amfake.NewServer(0)
+
+	code := m.Run()
+	am.Close()
+	testEnv.Stop()
+	os.Exit(code)
+}
+
+// run creates the node of a scenario, starts a helper and rolls the node
+func run(t *testing.T, s scenario) {
+	ctx := context.Background()
+	name := "e2e-" + s.name
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				watcher.MachineConfigStateAnnotation: watcher.MachineConfigStateDone,
+				watcher.CurrentConfigAnnotation:      renderedConfig,
+				watcher.DesiredConfigAnnotation:      renderedConfig,
+			},
+		},
+	}
+	if _, err := clientset.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer clientset.CoreV1().Nodes().Delete(ctx, name, metav1.DeleteOptions{})
+
+	client := alertmanager.NewClient([]string{am.URL()}, "")
+	manager := alertmanager.NewSilenceManager(client, clientset, &config.Config{}, nil, alertmanager.Options{SilenceDuration: time.Hour})
+	defer manager.Shutdown(ctx, alertmanager.ShutdownDelete)
+	// The scenarios poll the watcher themselves
+	nodeWatcher := watcher.NewWatcher(clientset, time.Minute)
+	// Changes are reported on the next poll, the scenarios don't flap
+	nodeWatcher.SetSettleTime(0)
+	if s.setup != nil {
+		s.setup(nodeWatcher)
+	}
+
+	update(t, name, s.roll)
+	if s.ignored {
+		if changed, ok := next(t, nodeWatcher, name); ok {
+			t.Fatalf("Expected no state change, got %+v", changed)
+		}
+		if tracked := manager.Silences()[name]; len(tracked) > 0 {
+			t.Fatalf("%d silences were created", len(tracked))
+		}
+		return
+	}
+
+	changed, ok := next(t, nodeWatcher, name)
+	if !ok || !changed.IsRolling {
+		t.Fatalf("Expected the node to be rolling, got %+v", changed)
+	}
+	if err := manager.HandleNodeState(ctx, name, true, alertmanager.KindOf(changed)); err != nil {
+		t.Fatalf("Failed to silence the node: %v", err)
+	}
+	var ids []string
+	active := am.ActiveSilenceIDs()
+	for _, silence := range manager.Silences()[name] {
+		if !active[silence.ID] {
+			t.Fatalf("Silence %s isn't active", silence.ID)
+		}
+		ids = append(ids, silence.ID)
+	}
+	if len(ids) == 0 {
+		t.Fatal("No silences were created")
+	}
+
+	update(t, name, s.finish)
+	changed, ok = next(t, nodeWatcher, name)
+	if !ok || changed.IsRolling {
+		t.Fatalf("Expected the node to be done, got %+v", changed)
+	}
+	if err := manager.HandleNodeState(ctx, name, false, alertmanager.KindOf(changed)); err != nil {
+		t.Fatalf("Failed to unsilence the node: %v", err)
+	}
+	active = am.ActiveSilenceIDs()
+	for _, id := range ids {
+		if active[id] {
+			t.Errorf("Silence %s is still active", id)
+		}
+	}
+}
+
+// update applies change to the node
+func update(t *testing.T, name string, change func(node *corev1.Node)) {
+	t.Helper()
+	ctx := context.Background()
+	node, err := clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get node: %v", err)
+	}
+	change(node)
+	if _, err := clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Failed to update node: %v", err)
+	}
+}
+
+// next polls the nodes once and returns the state change of the node, if
+// any. Changes of other nodes are skipped
+func next(t *testing.T, w *watcher.Watcher, name string) (watcher.NodeState, bool) {
+	t.Helper()
+	if err := w.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	for {
+		select {
+		case changed := <-w.StateChannel():
+			if changed.Name == name {
+				return changed, true
+			}
+		default:
+			return watcher.NodeState{}, false
+		}
+	}
+}
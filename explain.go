@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/config/scheme"
+	"rollout-helper/internal/policy"
+	"rollout-helper/internal/scope"
+	"rollout-helper/internal/watcher"
+)
+
+// runExplainPolicy prints the effective silence policies of a node and the
+// layer every matcher and duration was inherited from
+func runExplainPolicy(args []string) {
+	fs := flag.NewFlagSet("explain-policy", flag.ExitOnError)
+	nodeName := fs.String("node", "", "Name of the node to explain the policies of")
+	configPath := fs.String("config", "", "Path to the configuration file with silence policies")
+	kubeconfigPath := fs.String("kubeconfig", "", "Path to kubeconfig file")
+	defaultDuration := fs.Duration("silence-duration", 90*time.Minute, "Default duration of created silences")
+	withCRD := fs.Bool("silence-policy-crd", false, "Include the policies declared by RolloutSilencePolicy objects")
+	namespaceList := fs.String("namespaces", "", "Comma-separated namespaces the pods of the node are listed in for templates, all if empty")
+	authOptions := authzFlags(fs)
+	fs.Parse(args)
+
+	if *nodeName == "" {
+		fmt.Fprintln(os.Stderr, "--node is required")
+		os.Exit(2)
+	}
+
+	authorizer, err := authOptions.Authorizer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid annotation authorization: %v\n", err)
+		os.Exit(2)
+	}
+
+	cfg := &config.Config{}
+	if *configPath != "" {
+		loaded, err := scheme.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+		cfg = loaded
+	}
+
+	ctx := context.Background()
+	if *withCRD {
+		declared, err := declaredPolicies(ctx, *kubeconfigPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg = cfg.WithPolicies(declared)
+	}
+
+	clientset, err := newClientset(*kubeconfigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	node, err := clientset.CoreV1().Nodes().Get(ctx, *nodeName, metav1.GetOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get node %s: %v\n", *nodeName, err)
+		os.Exit(1)
+	}
+
+	pool := watcher.NodePool(node)
+	if pool == "" {
+		pool = "<unknown>"
+	}
+	fmt.Printf("Node: %s\nPool: %s\n\n", node.Name, pool)
+
+	policies, err := alertmanager.ResolveNodePolicies(cfg, node, authorizer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to resolve policies: %v\n", err)
+		os.Exit(1)
+	}
+	if len(policies) == 0 {
+		fmt.Println("No policies apply to this node")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "POLICY\tMATCHER\tVALUE\tSOURCE")
+	data := alertmanager.NewTemplateData(ctx, clientset, scope.Parse(*namespaceList), node)
+	for _, policy := range policies {
+		duration, source := *defaultDuration, "default"
+		if policy.Duration != nil {
+			duration, source = policy.Duration.Duration, string(policy.DurationSource)
+		}
+		fmt.Fprintf(w, "%s\t<duration>\t%s\t%s\n", policy.Name, duration, source)
+		if policy.CommentTemplate() != nil {
+			comment, err := alertmanager.RenderComment(policy, data)
+			if err != nil {
+				comment = fmt.Sprintf("<%v>", err)
+			}
+			fmt.Fprintf(w, "%s\t<comment>\t%s\t\n", policy.Name, comment)
+		}
+
+		for _, matcher := range policy.Matchers {
+			var value string
+			if rendered, err := alertmanager.RenderMatchers([]config.ResolvedMatcher{matcher}, data); err != nil {
+				value = fmt.Sprintf("<%v>", err)
+			} else {
+				value = *rendered[0].Value
+				if matcher.IsRegex {
+					value = "=~" + value
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", policy.Name, matcher.Name, value, matcher.Source)
+		}
+	}
+	w.Flush()
+}
+
+// declaredPolicies returns the valid policies of all RolloutSilencePolicy objects
+func declaredPolicies(ctx context.Context, kubeconfigPath string) ([]config.Policy, error) {
+	client, err := newDynamicClient(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := policy.List(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list RolloutSilencePolicies: %w", err)
+	}
+
+	policies, invalid := policy.Policies(objects)
+	for name, err := range invalid {
+		fmt.Fprintf(os.Stderr, "ignoring RolloutSilencePolicy %s: %v\n", name, err)
+	}
+	return policies, nil
+}
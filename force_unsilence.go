@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"rollout-helper/internal/server"
+)
+
+// newForceUnsilenceCommand asks a running helper to remove the silences of a
+// node and keep it unsilenced for a while through its admin API with client
+func newForceUnsilenceCommand(client *adminClient) *cobra.Command {
+	var (
+		duration time.Duration
+		cancel   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "force-unsilence <node>",
+		Short: "Remove the silences of a node for a while",
+		Long: `Remove the silences of a node and don't create new ones until --for passed,
+even if it's still rolling, e.g. to see the alerts of a rollout going wrong.
+--cancel ends the override early, silencing the node again if it's still
+rolling.`,
+		Example: `  rollout-helper force-unsilence worker-1 --for 30m
+  rollout-helper force-unsilence worker-1 --cancel`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer client.close()
+			nodeName := args[0]
+			path := "/api/v1/nodes/" + url.PathEscape(nodeName) + "/force-unsilence"
+			if cancel {
+				resp, err := client.do(http.MethodDelete, path, http.StatusNoContent)
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				fmt.Fprintf(cmd.OutOrStdout(), "Override of node %s cancelled\n", nodeName)
+				return nil
+			}
+
+			resp, err := client.do(http.MethodPost, path+"?for="+url.QueryEscape(duration.String()), http.StatusOK)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			var response server.ForceUnsilenceResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Node %s is unsilenced until %s\n", response.Node, response.UnsilencedUntil.Local().Format(time.RFC3339))
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&duration, "for", 30*time.Minute, "How long the node stays unsilenced")
+	cmd.Flags().BoolVar(&cancel, "cancel", false, "End an active override instead, silencing the node again if it's still rolling")
+	return cmd
+}
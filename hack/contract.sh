@@ -0,0 +1,45 @@
+#!/usr/bin/env bash
+# Runs TestContract against every supported Alertmanager version in a
+# throwaway container, e.g.
+#
+#   hack/contract.sh
+#   ALERTMANAGER_VERSIONS="v0.27.0 latest" hack/contract.sh -v
+set -euo pipefail
+
+VERSIONS=${ALERTMANAGER_VERSIONS:-"v0.25.0 v0.26.0 v0.27.0 latest"}
+IMAGE=${ALERTMANAGER_IMAGE:-quay.io/prometheus/alertmanager}
+DOCKER=${DOCKER:-docker}
+
+cd "$(dirname "$0")/.."
+
+failed=()
+for version in $VERSIONS; do
+	echo "=== Alertmanager $version"
+	container=$($DOCKER run -d --rm -p 127.0.0.1::9093 "$IMAGE:$version")
+	trap '$DOCKER rm -f "$container" >/dev/null 2>&1 || true' EXIT
+	port=$($DOCKER port "$container" 9093/tcp | head -n1 | sed 's/.*://')
+	url="http://127.0.0.1:$port"
+
+	ready=false
+	for _ in $(seq 1 30); do
+		if curl -sf "$url/-/ready" >/dev/null; then
+			ready=true
+			break
+		fi
+		sleep 1
+	done
+
+	if ! $ready; then
+		echo "Alertmanager $version didn't become ready"
+		failed+=("$version")
+	elif ! ALERTMANAGER_CONTRACT_URL="$url" go test -count=1 -run '^TestContract$' ./internal/alertmanager "$@"; then
+		failed+=("$version")
+	fi
+	$DOCKER rm -f "$container" >/dev/null
+done
+
+if [ ${#failed[@]} -gt 0 ]; then
+	echo "Contract failed for Alertmanager ${failed[*]}"
+	exit 1
+fi
+echo "Contract passed for Alertmanager $VERSIONS"
@@ -0,0 +1,21 @@
+#!/usr/bin/env bash
+# Runs the e2e scenarios against an API server started by envtest, e.g.
+#
+#   hack/e2e.sh
+#   ENVTEST_K8S_VERSION=1.28.x hack/e2e.sh -run TestRollingTaint -v
+#
+# The API server and etcd binaries are downloaded by setup-envtest, unless
+# KUBEBUILDER_ASSETS already points at them. setup-envtest is taken from the
+# release branch of the controller-runtime in go.mod, later ones may need a
+# newer Go.
+set -euo pipefail
+
+K8S_VERSION=${ENVTEST_K8S_VERSION:-1.29.x}
+SETUP_ENVTEST_VERSION=${SETUP_ENVTEST_VERSION:-release-0.16}
+
+cd "$(dirname "$0")/.."
+if [ -z "${KUBEBUILDER_ASSETS:-}" ]; then
+	KUBEBUILDER_ASSETS=$(go run sigs.k8s.io/controller-runtime/tools/setup-envtest@"$SETUP_ENVTEST_VERSION" use "$K8S_VERSION" --bin-dir bin/envtest -p path)
+	export KUBEBUILDER_ASSETS
+fi
+go test -tags e2e -count=1 ./e2e "$@"
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/server"
+	"rollout-helper/internal/slo"
+)
+
+// historyOptions are the flags of the history subcommand
+type historyOptions struct {
+	client *adminClient
+	node   string
+	since  time.Duration
+	output string
+	// silences lists the silence actions instead of the rollouts
+	silences bool
+}
+
+// newHistoryCommand lists the recent rollouts of nodes and pools recorded by
+// a running helper through its admin API with client
+func newHistoryCommand(client *adminClient) *cobra.Command {
+	options := historyOptions{client: client}
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the recent rollouts of nodes and pools",
+		Long: `List the recent and ongoing rollouts of nodes and pools recorded by a running
+helper. Rollouts are kept for --slo-windows-retention of the helper, and
+survive restarts if it publishes them to --slo-windows-configmap.
+
+With --silences the silence actions taken for nodes are listed instead, they
+are kept for --slo-windows-retention as well, up to --silence-history-size
+per node, and survive restarts with --silence-history-configmap.`,
+		Example: `  rollout-helper history --since 72h --node worker-1
+  rollout-helper history --silences --node worker-1`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer client.close()
+			return runHistory(cmd.OutOrStdout(), options)
+		},
+	}
+	cmd.Flags().StringVar(&options.node, "node", "", "Only list the rollouts of this node and of its pool")
+	cmd.Flags().DurationVar(&options.since, "since", 24*time.Hour, "Only list rollouts which ended within this duration, 0 lists all")
+	cmd.Flags().StringVarP(&options.output, "output", "o", "table", "Output format: table or json")
+	cmd.Flags().BoolVar(&options.silences, "silences", false, "List the silences created, extended and deleted for nodes instead of the rollouts")
+	return cmd
+}
+
+func runHistory(out io.Writer, options historyOptions) error {
+	if err := validateOutput(options.output); err != nil {
+		return err
+	}
+	resp, err := options.client.do(http.MethodGet, "/api/v1/history", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response server.HistoryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if options.silences {
+		return writeSilenceHistory(out, filterSilences(response.Silences, options.node, options.since, time.Now()), options.output)
+	}
+	response.Windows = filterWindows(response.Windows, options.node, options.since, time.Now())
+	response.Silences = nil
+	if options.output == "json" {
+		return writeJSON(out, response)
+	}
+
+	if len(response.Windows) == 0 {
+		fmt.Fprintln(out, "No rollouts were recorded")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCOPE\tNAME\tPOOL\tSTART\tEND\tDURATION\tIMAGE\tKUBELET")
+	for _, window := range response.Windows {
+		end, duration := "-", time.Since(window.Start)
+		if window.End != nil {
+			end, duration = window.End.Local().Format(time.RFC3339), window.End.Sub(window.Start)
+		}
+		image := versionChange(window, func(v *slo.Versions) string { return v.OSImage })
+		kubelet := versionChange(window, func(v *slo.Versions) string { return v.KubeletVersion })
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", window.Scope, window.Name, orNone(window.Pool), window.Start.Local().Format(time.RFC3339), end, duration.Round(time.Second), image, kubelet)
+	}
+	return w.Flush()
+}
+
+// versionChange describes how a version of the node of window changed, e.g.
+// "v1.27.6 -> v1.28.3", or the version alone if it didn't
+func versionChange(window slo.Window, version func(*slo.Versions) string) string {
+	var before, after string
+	if window.Before != nil {
+		before = version(window.Before)
+	}
+	if window.After != nil {
+		after = version(window.After)
+	}
+	switch {
+	case after == "" || after == before:
+		return orNone(before)
+	case before == "":
+		return "? -> " + after
+	}
+	return before + " -> " + after
+}
+
+// filterWindows returns the windows of node and its pool, or all windows if
+// node is empty, which are open or ended within since before now
+func filterWindows(windows []slo.Window, node string, since time.Duration, now time.Time) []slo.Window {
+	pools := make(map[string]bool)
+	for _, window := range windows {
+		if window.Scope == slo.ScopeNode && window.Name == node && window.Pool != "" {
+			pools[window.Pool] = true
+		}
+	}
+
+	filtered := []slo.Window{}
+	for _, window := range windows {
+		if since > 0 && window.End != nil && now.Sub(*window.End) > since {
+			continue
+		}
+		if node != "" && !(window.Scope == slo.ScopeNode && window.Name == node) && !(window.Scope == slo.ScopePool && pools[window.Name]) {
+			continue
+		}
+		filtered = append(filtered, window)
+	}
+	return filtered
+}
+
+// writeSilenceHistory prints the silence actions of nodes in output format
+func writeSilenceHistory(out io.Writer, entries []audit.Entry, output string) error {
+	if output == "json" {
+		return writeJSON(out, entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No silence actions were recorded")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tNODE\tACTION\tKIND\tSILENCE\tUNTIL\tMATCHERS\tMESSAGE")
+	for _, entry := range entries {
+		until := "-"
+		if entry.Until != nil {
+			until = entry.Until.Local().Format(time.RFC3339)
+		}
+		matchers := "-"
+		if len(entry.Matchers) > 0 {
+			matchers = strings.Join(entry.Matchers, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format(time.RFC3339), entry.Node, entry.Action, orNone(entry.Kind), orNone(entry.SilenceID), until, matchers, orNone(entry.Message))
+	}
+	return w.Flush()
+}
+
+// filterSilences returns the silence actions of node, or of all nodes if node
+// is empty, taken within since before now
+func filterSilences(entries []audit.Entry, node string, since time.Duration, now time.Time) []audit.Entry {
+	filtered := []audit.Entry{}
+	for _, entry := range entries {
+		if since > 0 && now.Sub(entry.Time) > since {
+			continue
+		}
+		if node != "" && entry.Node != node {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
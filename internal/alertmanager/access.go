@@ -0,0 +1,151 @@
+package alertmanager
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// accessCheckInterval is how often permissions of denied namespaces are checked again
+const accessCheckInterval = 5 * time.Minute
+
+// NamespaceAccess describes a namespace whose pods can't be listed
+type NamespaceAccess struct {
+	Namespace string    `json:"namespace"`
+	Since     time.Time `json:"since"`
+	Error     string    `json:"error"`
+}
+
+// namespaceAccess tracks namespaces in which listing pods is forbidden, so
+// pod silencing degrades per namespace instead of failing as a whole
+type namespaceAccess struct {
+	mu     sync.Mutex
+	denied map[string]NamespaceAccess
+}
+
+func newNamespaceAccess() *namespaceAccess {
+	return &namespaceAccess{denied: make(map[string]NamespaceAccess)}
+}
+
+// Allowed reports whether pods of the namespace may be listed
+func (a *namespaceAccess) Allowed(namespace string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, denied := a.denied[namespace]
+	return !denied
+}
+
+// Deny marks a namespace as inaccessible after a forbidden error
+func (a *namespaceAccess) Deny(namespace string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, denied := a.denied[namespace]; denied {
+		return
+	}
+	klog.Warningf("Listing pods in namespace %s is forbidden, skipping it until permissions are granted: %v", namespace, err)
+	a.denied[namespace] = NamespaceAccess{Namespace: namespace, Since: time.Now(), Error: err.Error()}
+	metrics.NamespaceAccessible.WithLabelValues(namespace).Set(0)
+}
+
+// Grant marks a namespace as accessible again
+func (a *namespaceAccess) Grant(namespace string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, denied := a.denied[namespace]; denied {
+		klog.Infof("Listing pods in namespace %s is allowed again", namespace)
+		delete(a.denied, namespace)
+	}
+	metrics.NamespaceAccessible.WithLabelValues(namespace).Set(1)
+}
+
+// Denied returns the inaccessible namespaces sorted by name
+func (a *namespaceAccess) Denied() []NamespaceAccess {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	denied := make([]NamespaceAccess, 0, len(a.denied))
+	for _, access := range a.denied {
+		denied = append(denied, access)
+	}
+	sort.Slice(denied, func(i, j int) bool { return denied[i].Namespace < denied[j].Namespace })
+	return denied
+}
+
+// InaccessibleNamespaces returns the namespaces whose pods can't be listed
+func (m *SilenceManager) InaccessibleNamespaces() []NamespaceAccess {
+	return m.access.Denied()
+}
+
+// checkAccess asks the API server whether pods may be listed in each namespace of
+// the pod silence targets in scope
+func (m *SilenceManager) checkAccess(ctx context.Context) {
+	checked := make(map[string]bool)
+	for _, target := range m.podTargets() {
+		if checked[target.namespace] || !m.options.Namespaces.Contains(target.namespace) {
+			continue
+		}
+		checked[target.namespace] = true
+
+		review, err := m.k8sClient.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: target.namespace,
+					Verb:      "list",
+					Resource:  "pods",
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			klog.Errorf("Failed to check access to pods in namespace %s: %v", target.namespace, err)
+			continue
+		}
+
+		if review.Status.Allowed {
+			m.access.Grant(target.namespace)
+		} else {
+			m.access.Deny(target.namespace, forbiddenError{namespace: target.namespace, reason: review.Status.Reason})
+		}
+	}
+	m.syncEvictionWatches()
+}
+
+// forbiddenError is reported for namespaces an access review denied
+type forbiddenError struct {
+	namespace string
+	reason    string
+}
+
+func (e forbiddenError) Error() string {
+	if e.reason == "" {
+		return "list pods in namespace " + e.namespace + " is not allowed"
+	}
+	return "list pods in namespace " + e.namespace + " is not allowed: " + e.reason
+}
+
+// startAccessChecks checks the namespace permissions now and then periodically
+func (m *SilenceManager) startAccessChecks(ctx context.Context) {
+	go func() {
+		m.checkAccess(ctx)
+
+		ticker := time.NewTicker(accessCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.checkAccess(ctx)
+			}
+		}
+	}()
+}
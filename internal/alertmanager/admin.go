@@ -0,0 +1,162 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/state"
+)
+
+// ErrRejected is wrapped by the errors of manual operations which conflict
+// with the state of the node or the helper
+var ErrRejected = errors.New("request rejected")
+
+// SilenceManually creates the silences of a node on request of an operator,
+// e.g. ahead of manual maintenance. They are extended like the silences of a
+// rollout until they're removed or reach MaxSilenceDuration, or deleted
+// after duration unless it's zero. The silences of a node which is already
+// silenced are returned as is, complete is false if some of the silences
+// couldn't be created. Nodes of other instances are rejected
+func (m *SilenceManager) SilenceManually(ctx context.Context, nodeName string, duration time.Duration) ([]TrackedSilence, bool, error) {
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	if err := m.rejectForeign(node); err != nil {
+		return nil, false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held.Load() {
+		return nil, false, fmt.Errorf("%w: %v", ErrRejected, errHeld)
+	}
+	if until, ok := m.unsilencedUntil(nodeName); ok {
+		return nil, false, fmt.Errorf("%w: node %s is force-unsilenced until %s", ErrRejected, nodeName, until.Format(time.RFC3339))
+	}
+	if silences, ok := m.activeSilences.Get(nodeName); ok {
+		return silences, !m.incomplete[nodeName], nil
+	}
+
+	silences, complete := m.createSilences(ctx, nodeName, KindManual)
+	m.setIncomplete(nodeName, !complete)
+	m.activeSilences.Set(nodeName, silences)
+	if duration > 0 {
+		m.manual[nodeName] = time.Now().Add(duration)
+	}
+	m.persist(ctx)
+	klog.InfoS("Silenced node manually", "action", "silence", "node", nodeName, "kind", KindManual, "silences", len(silences), "duration", duration)
+	m.recordEvent(nodeName, reasonSilenceCreated, "Created %d silences on request of an operator", len(silences))
+	return silences, complete, nil
+}
+
+// UnsilenceManually deletes the silences of a node which isn't rolling on
+// request of an operator, found is false if it had none. Rolling nodes are
+// rejected, force-unsilencing them keeps the silences from being recreated
+func (m *SilenceManager) UnsilenceManually(ctx context.Context, nodeName string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held.Load() {
+		return false, fmt.Errorf("%w: %v", ErrRejected, errHeld)
+	}
+	if _, rolling := m.rolling[nodeName]; rolling {
+		return false, fmt.Errorf("%w: node %s is rolling, force-unsilence it instead", ErrRejected, nodeName)
+	}
+	if _, tracked := m.activeSilences.Get(nodeName); !tracked {
+		return false, nil
+	}
+	return true, m.unsilenceNode(ctx, nodeName)
+}
+
+// manualUntil returns when the silences of a node silenced manually for a
+// duration are deleted, the lock must be held
+func (m *SilenceManager) manualUntil(nodeName string) (time.Time, bool) {
+	at, ok := m.manual[nodeName]
+	return at, ok
+}
+
+// restoreManual loads when the manual silences persisted before a restart
+// end, so they're deleted then instead of being collected as garbage
+func (m *SilenceManager) restoreManual(ctx context.Context) {
+	store, ok := m.store.(state.ManualStore)
+	if !ok {
+		return
+	}
+	manual, err := store.LoadManual(ctx)
+	if err != nil {
+		klog.Warningf("Failed to load persisted manual silences: %v", err)
+		return
+	}
+	for node, at := range manual {
+		m.manual[node] = at
+	}
+	m.savedManual = manual
+}
+
+// persistManual saves when the manual silences end if it changed since it
+// was last saved, the lock must be held
+func (m *SilenceManager) persistManual(ctx context.Context) {
+	store, ok := m.store.(state.ManualStore)
+	if !ok {
+		return
+	}
+	manual := make(map[string]time.Time, len(m.manual))
+	for node, at := range m.manual {
+		manual[node] = at.UTC().Truncate(time.Second)
+	}
+	if sameTimes(manual, m.savedManual) {
+		return
+	}
+	if err := store.SaveManual(ctx, manual); err != nil {
+		klog.Errorf("Failed to persist manual silences: %v", err)
+		return
+	}
+	m.savedManual = manual
+}
+
+// sameTimes reports whether a and b map the same nodes to the same times
+func sameTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for node, at := range a {
+		if other, ok := b[node]; !ok || !at.Equal(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// unsilenceManualExpired deletes the silences of nodes silenced manually
+// whose duration passed
+func (m *SilenceManager) unsilenceManualExpired(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for node, at := range m.manual {
+		if now.Before(at) {
+			continue
+		}
+		klog.Infof("Manual silences of node %s ended", node)
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence node %s after its manual silences ended: %v", node, err)
+		}
+	}
+}
+
+// Reconcile compares the silences in Alertmanager with the rolling nodes
+// right away instead of waiting for ReconcileInterval
+func (m *SilenceManager) Reconcile(ctx context.Context) error {
+	if m.held.Load() {
+		return fmt.Errorf("%w: %v", ErrRejected, errHeld)
+	}
+	return m.reconcile(ctx)
+}
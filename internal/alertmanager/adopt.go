@@ -0,0 +1,77 @@
+package alertmanager
+
+import (
+	"net"
+	"regexp"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// adoptionMatchers are the matchers whose value identifies the node a
+// manually created silence belongs to
+var adoptionMatchers = []string{"node", "instance"}
+
+// AdoptFilter selects the manually created silences to adopt
+type AdoptFilter struct {
+	// Nodes are the names of the nodes silences may be adopted for
+	Nodes map[string]bool
+	// CreatedBy only selects silences of this creator if set
+	CreatedBy string
+	// Comment only selects silences whose comment matches if set
+	Comment *regexp.Regexp
+}
+
+// AdoptionCandidate is an existing silence and the node it will be managed for
+type AdoptionCandidate struct {
+	Node    string
+	Silence models.PostableSilence
+}
+
+// FindAdoptable returns the active silences not owned by the helper which
+// match a known node on their node or instance matcher
+func FindAdoptable(silences []models.PostableSilence, filter AdoptFilter) []AdoptionCandidate {
+	var candidates []AdoptionCandidate
+	for _, silence := range silences {
+		if isOwned(silence) || isExpired(silence) {
+			continue
+		}
+		if filter.CreatedBy != "" && (silence.CreatedBy == nil || *silence.CreatedBy != filter.CreatedBy) {
+			continue
+		}
+		if filter.Comment != nil && (silence.Comment == nil || !filter.Comment.MatchString(*silence.Comment)) {
+			continue
+		}
+
+		if node, ok := silenceNode(silence, filter.Nodes); ok {
+			candidates = append(candidates, AdoptionCandidate{Node: node, Silence: silence})
+		}
+	}
+	return candidates
+}
+
+// silenceNode returns the node an equality matcher of the silence refers to.
+// Instance values may carry the scrape port
+func silenceNode(silence models.PostableSilence, nodes map[string]bool) (string, bool) {
+	for _, name := range adoptionMatchers {
+		for _, matcher := range silence.Matchers {
+			if matcher.Name == nil || *matcher.Name != name || matcher.Value == nil {
+				continue
+			}
+			if matcher.IsRegex != nil && *matcher.IsRegex {
+				continue
+			}
+			if matcher.IsEqual != nil && !*matcher.IsEqual {
+				continue
+			}
+
+			value := *matcher.Value
+			if host, _, err := net.SplitHostPort(value); err == nil {
+				value = host
+			}
+			if nodes[value] {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
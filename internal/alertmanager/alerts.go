@@ -0,0 +1,62 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime"
+	amclient "github.com/prometheus/alertmanager/api/v2/client"
+	amalert "github.com/prometheus/alertmanager/api/v2/client/alert"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// FiringAlerts returns the active alerts matching all filters which are
+// neither silenced nor inhibited, e.g. with the filter node="worker-1".
+// In broadcast mode the active endpoint is asked
+func (c *Client) FiringAlerts(ctx context.Context, filters ...string) (models.GettableAlerts, error) {
+	var alerts models.GettableAlerts
+	err := c.do(ctx, "", http.MethodGet, func(api *amclient.AlertmanagerAPI, option func(*runtime.ClientOperation)) error {
+		params := amalert.NewGetAlertsParams().
+			WithActive(boolPtr(true)).
+			WithSilenced(boolPtr(false)).
+			WithInhibited(boolPtr(false)).
+			WithUnprocessed(boolPtr(false)).
+			WithFilter(filters)
+		resp, err := api.Alert.GetAlerts(params, option)
+		if err != nil {
+			return err
+		}
+		alerts = resp.Payload
+		return nil
+	})
+	return alerts, err
+}
+
+// PostAlerts sends alerts to every endpoint, as each Alertmanager of a
+// cluster only notifies about the alerts it received itself. It succeeds if
+// any endpoint accepted them
+func (c *Client) PostAlerts(ctx context.Context, alerts models.PostableAlerts) error {
+	var errs []error
+	for _, endpoint := range c.urls() {
+		err := c.do(ctx, endpoint, http.MethodPost, func(api *amclient.AlertmanagerAPI, option func(*runtime.ClientOperation)) error {
+			_, err := api.Alert.PostAlerts(amalert.NewPostAlertsParams().WithAlerts(alerts), option)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+		}
+	}
+	if len(errs) == len(c.urls()) {
+		return errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		metrics.AlertmanagerPartialFailures.WithLabelValues("alerts").Inc()
+		klog.Warningf("Posting alerts failed on %d endpoints: %v", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
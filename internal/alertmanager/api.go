@@ -0,0 +1,125 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	httptransport "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/strfmt"
+	amclient "github.com/prometheus/alertmanager/api/v2/client"
+
+	"rollout-helper/internal/metrics"
+)
+
+// apiCall performs an operation of the generated Alertmanager API client,
+// which has to pass option on to the operation. It's attempted once per try
+type apiCall func(api *amclient.AlertmanagerAPI, option func(*runtime.ClientOperation)) error
+
+// api returns the generated API client of the endpoint at baseURL
+func (c *Client) api(baseURL string) (*amclient.AlertmanagerAPI, error) {
+	c.apisMu.Lock()
+	defer c.apisMu.Unlock()
+	if api, ok := c.apis[baseURL]; ok {
+		return api, nil
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid Alertmanager URL %q", baseURL)
+	}
+	transport := httptransport.New(u.Host, strings.TrimSuffix(u.Path, "/")+amclient.DefaultBasePath, []string{u.Scheme})
+	api := amclient.New(transport, strfmt.Default)
+	if c.apis == nil {
+		c.apis = make(map[string]*amclient.AlertmanagerAPI)
+	}
+	c.apis[baseURL] = api
+	return api, nil
+}
+
+// attempt sends the requests of a single try to baseURL with the client's
+// HTTP client and credentials, and records their outcome for failover
+type attempt struct {
+	client  *Client
+	ctx     context.Context
+	baseURL string
+	method  string
+	// status is the status code of the last response, zero if none arrived
+	status int
+	// body is the start of the last error response, the generated client
+	// drops the bodies of status codes the API doesn't define
+	body []byte
+}
+
+// maxErrorBody bounds what is kept of an error response for its error
+const maxErrorBody = 4 << 10
+
+func (a *attempt) RoundTrip(req *http.Request) (*http.Response, error) {
+	authorization, err := a.client.auth.header()
+	if err != nil {
+		return nil, err
+	}
+	a.client.setTenantHeaders(a.ctx, req)
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := a.client.httpClient.Do(req)
+	if err != nil {
+		metrics.AlertmanagerRequests.WithLabelValues(a.method, "error").Inc()
+		// A cancelled request says nothing about the endpoint's health
+		if req.Context().Err() == nil {
+			a.client.endpoints.Report(a.baseURL, false)
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	a.status = resp.StatusCode
+	if resp.StatusCode >= http.StatusBadRequest {
+		a.body, _ = io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(a.body), resp.Body), resp.Body}
+	}
+	resp.Body = drainingBody{resp.Body}
+	metrics.AlertmanagerRequests.WithLabelValues(a.method, strconv.Itoa(resp.StatusCode)).Inc()
+	a.client.endpoints.Report(a.baseURL, resp.StatusCode < http.StatusInternalServerError)
+	return resp, nil
+}
+
+// option makes an operation go through the attempt
+func (a *attempt) option(op *runtime.ClientOperation) {
+	op.Context = a.ctx
+	op.Client = &http.Client{Transport: a}
+}
+
+// StatusError is returned when Alertmanager answers with an unexpected status
+// code. Err is the typed error of the generated client, e.g.
+// *silence.GetSilenceNotFound
+type StatusError struct {
+	Code int
+	Err  error
+	// Body is the start of the response, Alertmanager's reason to reject the
+	// request, which a *runtime.APIError doesn't carry
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	var apiErr *runtime.APIError
+	if e.Err == nil || errors.As(e.Err, &apiErr) {
+		if e.Body != "" {
+			return fmt.Sprintf("unexpected status code: %d: %s", e.Code, e.Body)
+		}
+		return fmt.Sprintf("unexpected status code: %d", e.Code)
+	}
+	return fmt.Sprintf("unexpected status code: %d: %s", e.Code, strings.TrimSpace(e.Err.Error()))
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
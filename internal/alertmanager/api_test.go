@@ -0,0 +1,31 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+func TestStatusErrorIncludesBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("[]"))
+			return
+		}
+		// A status code the API doesn't define for the operation
+		http.Error(w, "silence exceeds the tenant's limit", http.StatusUnprocessableEntity)
+	}))
+	defer server.Close()
+
+	client := NewClient([]string{server.URL}, "")
+	_, err := client.CreateSilence(context.Background(), models.Matchers{{Name: stringPtr("node"), Value: stringPtr("worker-1"), IsRegex: boolPtr(false)}}, "worker-1", KindPoolUpdate, time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "silence exceeds the tenant's limit") {
+		t.Errorf("Expected Alertmanager's reason in the error, got %v", err)
+	}
+}
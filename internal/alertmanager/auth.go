@@ -0,0 +1,195 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// authSource provides the Authorization header of Alertmanager requests
+type authSource interface {
+	header() (string, error)
+}
+
+// staticAuth is an Authorization header set once at startup
+type staticAuth string
+
+func (a staticAuth) header() (string, error) {
+	return string(a), nil
+}
+
+// tokenFile reads the token from a file, e.g. a mounted Secret or a projected
+// service account token, and reads it again whenever the file changes
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	value   string
+}
+
+func (t *tokenFile) header() (string, error) {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat token file: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.value != "" && info.ModTime().Equal(t.modTime) {
+		return t.value, nil
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", t.path)
+	}
+
+	// A bare token, as in service account token files, is sent as bearer token
+	if !strings.Contains(token, " ") {
+		token = "Bearer " + token
+	}
+	if t.value != "" {
+		klog.Infof("Reloaded Alertmanager token from %s", t.path)
+	}
+	t.value, t.modTime = token, info.ModTime()
+	return t.value, nil
+}
+
+// SetTokenFile makes the client read its token from path on every request,
+// picking up rotated tokens without a restart
+func (c *Client) SetTokenFile(path string) error {
+	source := &tokenFile{path: path}
+	if _, err := source.header(); err != nil {
+		return err
+	}
+	c.auth = source
+	return nil
+}
+
+// ServiceAccountTokenFile is where the pod's service account token is mounted
+const ServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// serviceAccountTokenTTL is the lifetime requested for audience-bound tokens
+const serviceAccountTokenTTL = time.Hour
+
+// tokenRequestAuth requests service account tokens bound to an audience via
+// the TokenRequest API and requests a new one once 80% of its lifetime passed
+type tokenRequestAuth struct {
+	client         kubernetes.Interface
+	namespace      string
+	serviceAccount string
+	audience       string
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+	expiresAt time.Time
+}
+
+func (t *tokenRequestAuth) header() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.token != "" && now.Before(t.refreshAt) {
+		return "Bearer " + t.token, nil
+	}
+
+	expiration := int64(serviceAccountTokenTTL.Seconds())
+	request, err := t.client.CoreV1().ServiceAccounts(t.namespace).CreateToken(context.Background(), t.serviceAccount, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         []string{t.audience},
+			ExpirationSeconds: &expiration,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		// Keep using the current token while it's valid, the request is retried on the next call
+		if t.token != "" && now.Before(t.expiresAt) {
+			klog.Warningf("Failed to refresh service account token, using the current one until %s: %v", t.expiresAt.Format(time.RFC3339), err)
+			return "Bearer " + t.token, nil
+		}
+		return "", fmt.Errorf("failed to request service account token: %w", err)
+	}
+
+	t.token = request.Status.Token
+	t.expiresAt = request.Status.ExpirationTimestamp.Time
+	if t.expiresAt.IsZero() {
+		t.expiresAt = now.Add(serviceAccountTokenTTL)
+	}
+	t.refreshAt = now.Add(t.expiresAt.Sub(now) * 4 / 5)
+	klog.V(2).Infof("Requested service account token for audience %s, valid until %s", t.audience, t.expiresAt.Format(time.RFC3339))
+	return "Bearer " + t.token, nil
+}
+
+// SetServiceAccountToken authenticates with the pod's service account token,
+// e.g. for an Alertmanager behind kube-rbac-proxy or oauth-proxy. Without an
+// audience the mounted token is used, which the kubelet rotates. With an
+// audience, tokens for it are requested from the API server and refreshed
+// before they expire
+func (c *Client) SetServiceAccountToken(client kubernetes.Interface, namespace, serviceAccount, audience string) error {
+	if audience == "" {
+		return c.SetTokenFile(ServiceAccountTokenFile)
+	}
+
+	source := &tokenRequestAuth{
+		client:         client,
+		namespace:      namespace,
+		serviceAccount: serviceAccount,
+		audience:       audience,
+	}
+	if _, err := source.header(); err != nil {
+		return err
+	}
+	c.auth = source
+	return nil
+}
+
+// CurrentServiceAccount returns the name of the service account the pod runs
+// as, from SERVICE_ACCOUNT_NAME or the subject of the mounted token
+func CurrentServiceAccount() (string, error) {
+	if name := os.Getenv("SERVICE_ACCOUNT_NAME"); name != "" {
+		return name, nil
+	}
+
+	data, err := os.ReadFile(ServiceAccountTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+	parts := strings.Split(strings.TrimSpace(string(data)), ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("service account token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode service account token: %w", err)
+	}
+
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("failed to decode service account token: %w", err)
+	}
+	// The subject has the form system:serviceaccount:<namespace>:<name>
+	subject := strings.Split(claims.Subject, ":")
+	if len(subject) != 4 || subject[0] != "system" || subject[1] != "serviceaccount" {
+		return "", fmt.Errorf("unexpected service account token subject %q", claims.Subject)
+	}
+	return subject[3], nil
+}
@@ -0,0 +1,204 @@
+package alertmanager
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// ErrCircuitOpen is returned without sending the request while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("Alertmanager circuit breaker is open")
+
+// BreakerPolicy controls when requests to Alertmanager stop being sent
+type BreakerPolicy struct {
+	// FailureRatio is the share of failed requests within Window which opens
+	// the circuit, zero disables the breaker
+	FailureRatio float64
+	// MinRequests is how many requests Window needs before the circuit may open
+	MinRequests int
+	// Window is how far back request outcomes are considered
+	Window time.Duration
+	// OpenDuration is how long the circuit stays open before a single
+	// request is let through to test whether Alertmanager recovered
+	OpenDuration time.Duration
+}
+
+// DefaultBreakerPolicy is used unless SetBreakerPolicy is called
+var DefaultBreakerPolicy = BreakerPolicy{
+	FailureRatio: 0.5,
+	MinRequests:  10,
+	Window:       time.Minute,
+	OpenDuration: time.Minute,
+}
+
+// CircuitState is the state of the circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed sends requests as usual
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails requests right away
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single request through to test recovery
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitStatus is the state of the circuit breaker as served by the status APIs
+type CircuitStatus struct {
+	State CircuitState `json:"state"`
+	// Since is when the circuit entered its state, zero if it never left closed
+	Since time.Time `json:"since"`
+	// LastError is the failure which opened the circuit or failed its last test
+	LastError string `json:"lastError,omitempty"`
+}
+
+type outcome struct {
+	at time.Time
+	ok bool
+}
+
+// breaker stops requests to Alertmanager while too many of them fail, so an
+// outage doesn't turn into a stream of retries, failed operations and logs
+type breaker struct {
+	mu       sync.Mutex
+	policy   BreakerPolicy
+	outcomes []outcome
+	state    CircuitState
+	since    time.Time
+	// testing is set while the request testing recovery is in flight
+	testing   bool
+	lastError string
+	// onChange is called without the lock when the circuit opens or closes
+	onChange func(status CircuitStatus)
+}
+
+func newBreaker(policy BreakerPolicy) *breaker {
+	metrics.AlertmanagerCircuitOpen.Set(0)
+	return &breaker{policy: policy, state: CircuitClosed}
+}
+
+// allow returns ErrCircuitOpen if a request must not be sent. Once the
+// circuit was open for OpenDuration the next request is let through alone
+func (b *breaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.since) < b.policy.OpenDuration {
+			metrics.AlertmanagerRequestsRejected.Inc()
+			return ErrCircuitOpen
+		}
+		klog.Infof("Testing whether Alertmanager recovered after the circuit was open for %s", now.Sub(b.since).Round(time.Second))
+		b.setState(CircuitHalfOpen, now)
+		b.testing = true
+	case CircuitHalfOpen:
+		if b.testing {
+			metrics.AlertmanagerRequestsRejected.Inc()
+			return ErrCircuitOpen
+		}
+		b.testing = true
+	}
+	return nil
+}
+
+// report records the outcome of a request which was allowed, err is its
+// failure if any
+func (b *breaker) report(now time.Time, err error) {
+	b.mu.Lock()
+	var changed *CircuitStatus
+	defer func() {
+		b.mu.Unlock()
+		if changed != nil && b.onChange != nil {
+			b.onChange(*changed)
+		}
+	}()
+
+	if b.policy.FailureRatio <= 0 {
+		return
+	}
+	if err != nil {
+		b.lastError = err.Error()
+	}
+
+	if b.state == CircuitHalfOpen {
+		b.testing = false
+		if err != nil {
+			klog.Warningf("Alertmanager is still failing, keeping the circuit open for another %s: %v", b.policy.OpenDuration, err)
+			b.setState(CircuitOpen, now)
+			return
+		}
+		klog.Infof("Alertmanager recovered, closing the circuit")
+		b.setState(CircuitClosed, now)
+		b.outcomes = nil
+		status := b.status()
+		changed = &status
+		return
+	}
+	if b.state != CircuitClosed {
+		return
+	}
+
+	b.outcomes = append(b.outcomes, outcome{at: now, ok: err == nil})
+	cutoff := now.Add(-b.policy.Window)
+	for len(b.outcomes) > 0 && b.outcomes[0].at.Before(cutoff) {
+		b.outcomes = b.outcomes[1:]
+	}
+	failed := 0
+	for _, o := range b.outcomes {
+		if !o.ok {
+			failed++
+		}
+	}
+	if len(b.outcomes) < b.policy.MinRequests || float64(failed) < b.policy.FailureRatio*float64(len(b.outcomes)) {
+		return
+	}
+
+	klog.Errorf("%d of the last %d Alertmanager requests failed, opening the circuit for %s: %s", failed, len(b.outcomes), b.policy.OpenDuration, b.lastError)
+	metrics.AlertmanagerCircuitOpens.Inc()
+	b.setState(CircuitOpen, now)
+	b.outcomes = nil
+	status := b.status()
+	changed = &status
+}
+
+// release gives up testing recovery with a request which was cancelled
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.testing = false
+}
+
+// setState moves the circuit to state, the lock must be held
+func (b *breaker) setState(state CircuitState, now time.Time) {
+	b.state = state
+	b.since = now
+	if state == CircuitClosed {
+		metrics.AlertmanagerCircuitOpen.Set(0)
+		b.lastError = ""
+	} else {
+		metrics.AlertmanagerCircuitOpen.Set(1)
+	}
+}
+
+// status returns the state of the circuit, the lock must be held
+func (b *breaker) status() CircuitStatus {
+	return CircuitStatus{State: b.state, Since: b.since, LastError: b.lastError}
+}
+
+// SetBreakerPolicy replaces the circuit breaker policy of Alertmanager requests
+func (c *Client) SetBreakerPolicy(policy BreakerPolicy) {
+	c.breaker.policy = policy
+}
+
+// Circuit returns the state of the circuit breaker
+func (c *Client) Circuit() CircuitStatus {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.status()
+}
@@ -0,0 +1,232 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// Mode selects how requests are spread over multiple Alertmanager endpoints
+type Mode string
+
+const (
+	// ModeFailover sends requests to the most preferred healthy endpoint
+	ModeFailover Mode = "failover"
+	// ModeBroadcast sends silence operations to every endpoint, for
+	// Alertmanagers which don't share their silences
+	ModeBroadcast Mode = "broadcast"
+)
+
+// ParseMode validates a mode given on the command line
+func ParseMode(mode string) (Mode, error) {
+	switch Mode(mode) {
+	case ModeFailover, ModeBroadcast:
+		return Mode(mode), nil
+	}
+	return "", fmt.Errorf("unknown mode %q, expected %s or %s", mode, ModeFailover, ModeBroadcast)
+}
+
+// In broadcast mode a silence exists once per endpoint. Its ID joins the
+// per-endpoint IDs tagged with the endpoint index, e.g. "0:<id>,1:<id>".
+// Untagged IDs belong to the first endpoint
+const (
+	broadcastIDSeparator  = ","
+	broadcastTagSeparator = ":"
+)
+
+// joinBroadcastID builds a silence ID from the IDs on each endpoint
+func joinBroadcastID(ids map[int]string) string {
+	indexes := make([]int, 0, len(ids))
+	for index := range ids {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	parts := make([]string, 0, len(ids))
+	for _, index := range indexes {
+		parts = append(parts, strconv.Itoa(index)+broadcastTagSeparator+ids[index])
+	}
+	return strings.Join(parts, broadcastIDSeparator)
+}
+
+// splitBroadcastID returns the IDs of a silence on each endpoint
+func splitBroadcastID(id string) map[int]string {
+	ids := make(map[int]string)
+	for _, part := range strings.Split(id, broadcastIDSeparator) {
+		tag, partID, found := strings.Cut(part, broadcastTagSeparator)
+		index, err := strconv.Atoi(tag)
+		if !found || err != nil {
+			ids[0] = part
+			continue
+		}
+		ids[index] = partID
+	}
+	return ids
+}
+
+// tenantPlaceholder is replaced by the tenant of a silence in the external URL
+const tenantPlaceholder = "{tenant}"
+
+// SilenceURL returns the link to a silence in the Alertmanager UI at
+// externalURL. Broadcast silences are linked with their ID on the most
+// preferred endpoint they exist on. A {tenant} in externalURL is replaced by
+// the tenant of the silence, defaultTenant if it has none. Without it only
+// the silences of defaultTenant can be linked, others get an empty URL
+func SilenceURL(externalURL, defaultTenant, id string) string {
+	tenant, id := splitTenantID(id)
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	if strings.Contains(externalURL, tenantPlaceholder) {
+		externalURL = strings.ReplaceAll(externalURL, tenantPlaceholder, url.QueryEscape(tenant))
+	} else if tenant != defaultTenant {
+		return ""
+	}
+	if strings.Contains(id, broadcastTagSeparator) {
+		ids := splitBroadcastID(id)
+		first := -1
+		for index := range ids {
+			if first < 0 || index < first {
+				first = index
+			}
+		}
+		id = ids[first]
+	}
+	return strings.TrimSuffix(externalURL, "/") + "/#/silences/" + id
+}
+
+// idParts returns the IDs a silence is listed under by GetSilences, one per
+// endpoint it exists on in broadcast mode, tagged with its tenant
+func (c *Client) idParts(id string) []string {
+	if c.mode != ModeBroadcast {
+		return []string{id}
+	}
+
+	var parts []string
+	tenant, id := splitTenantID(id)
+	for index, partID := range splitBroadcastID(id) {
+		parts = append(parts, joinTenantID(tenant, joinBroadcastID(map[int]string{index: partID})))
+	}
+	return parts
+}
+
+// broadcast runs op against the endpoints selected by ids, or all endpoints
+// if ids is nil. It succeeds if op succeeds on any endpoint and logs the
+// endpoints it failed on
+func (c *Client) broadcast(operation string, ids map[int]string, op func(index int, url, id string) error) error {
+	var errs []error
+	succeeded := 0
+	for index, ep := range c.endpoints.endpoints {
+		id, ok := ids[index]
+		if ids != nil && !ok {
+			continue
+		}
+		if err := op(index, ep.url, id); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ep.url, err))
+			continue
+		}
+		succeeded++
+	}
+
+	if succeeded == 0 {
+		if len(errs) == 0 {
+			return fmt.Errorf("silence doesn't exist on any configured endpoint")
+		}
+		return errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		metrics.AlertmanagerPartialFailures.WithLabelValues(operation).Inc()
+		klog.Warningf("Silence %s succeeded on %d endpoints but failed on %d: %v", operation, succeeded, len(errs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// broadcastCreate creates the silence on every endpoint which doesn't have a
+// silence with the fingerprint yet
+func (c *Client) broadcastCreate(ctx context.Context, silence models.PostableSilence, fingerprint string) (string, error) {
+	created := make(map[int]string)
+	err := c.broadcast(operationCreate, nil, func(index int, url, _ string) error {
+		if id, reused := c.reuseSilence(ctx, url, silence.Matchers, fingerprint, time.Time(*silence.EndsAt)); reused {
+			klog.Infof("Reusing silence %s on %s", id, url)
+			created[index] = id
+			return nil
+		}
+		id, err := c.postSilence(ctx, url, silence)
+		if err == nil {
+			created[index] = id
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return joinBroadcastID(created), nil
+}
+
+func (c *Client) broadcastExtend(ctx context.Context, silenceID string, endsAt time.Time) (string, error) {
+	ids := splitBroadcastID(silenceID)
+	extended := make(map[int]string)
+	err := c.broadcast(operationExtend, ids, func(index int, url, id string) error {
+		newID, err := c.extendSilence(ctx, url, id, endsAt)
+		if err != nil {
+			// Keep the old ID so the silence can still be deleted
+			extended[index] = id
+			return err
+		}
+		extended[index] = newID
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return joinBroadcastID(extended), nil
+}
+
+func (c *Client) broadcastGet(ctx context.Context, silenceID string) (*models.GettableSilence, error) {
+	var silence *models.GettableSilence
+	err := c.broadcast("get", splitBroadcastID(silenceID), func(_ int, url, id string) error {
+		if silence != nil {
+			return nil
+		}
+		found, err := c.getSilence(ctx, url, id)
+		if err == nil {
+			silence = found
+		}
+		return err
+	})
+	return silence, err
+}
+
+func (c *Client) broadcastDelete(ctx context.Context, silenceID string) error {
+	return c.broadcast(operationDelete, splitBroadcastID(silenceID), func(_ int, url, id string) error {
+		return c.deleteSilence(ctx, url, id)
+	})
+}
+
+// broadcastList lists the silences of all endpoints which keep selects,
+// tagging their IDs with the endpoint they were found on
+func (c *Client) broadcastList(ctx context.Context, keep func(models.PostableSilence) bool) ([]models.PostableSilence, error) {
+	var all []models.PostableSilence
+	err := c.broadcast("list", nil, func(index int, url, _ string) error {
+		silences, err := c.listSilences(ctx, url, nil, keep)
+		if err != nil {
+			return err
+		}
+		for _, silence := range silences {
+			silence.ID = joinBroadcastID(map[int]string{index: silence.ID})
+			all = append(all, silence)
+		}
+		return nil
+	})
+	return all, err
+}
@@ -0,0 +1,25 @@
+package alertmanager
+
+import "testing"
+
+func TestSilenceURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		externalURL string
+		id          string
+		want        string
+	}{
+		{name: "default tenant", externalURL: "https://am.example.com/", id: "abc", want: "https://am.example.com/#/silences/abc"},
+		{name: "other tenant without placeholder", externalURL: "https://am.example.com", id: "team-payments/abc", want: ""},
+		{name: "other tenant", externalURL: "https://am.example.com/{tenant}", id: "team-payments/abc", want: "https://am.example.com/team-payments/#/silences/abc"},
+		{name: "placeholder with default tenant", externalURL: "https://am.example.com/{tenant}/", id: "abc", want: "https://am.example.com/infra/#/silences/abc"},
+		{name: "broadcast", externalURL: "https://am.example.com", id: joinBroadcastID(map[int]string{1: "def", 0: "abc"}), want: "https://am.example.com/#/silences/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SilenceURL(tt.externalURL, "infra", tt.id); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package alertmanager
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// catchUpNote is appended to the comment of catch-up silences
+const catchUpNote = "catch-up for alerts which fired before the rollout was detected"
+
+// catchUpSilence is a short silence with broad matchers, created when the
+// rollout of a node was detected after its alerts started firing
+type catchUpSilence struct {
+	id     string
+	endsAt time.Time
+}
+
+// catchUp silences every alert of a node for CatchUpDuration if some are
+// still firing unsilenced once its silences were created, i.e. the rollout
+// was detected late. The silence is backdated to the first of these alerts,
+// the narrow silences take over when it expires. The lock must be held
+func (m *SilenceManager) catchUp(ctx context.Context, nodeName string, kind SilenceKind) {
+	if m.options.CatchUpDuration <= 0 {
+		return
+	}
+
+	scopes := []*models.Matcher{
+		{Name: stringPtr("node"), Value: stringPtr(nodeName), IsRegex: boolPtr(false)},
+		{Name: stringPtr("instance"), Value: stringPtr(m.instancePattern(ctx, nodeName)), IsRegex: boolPtr(true)},
+	}
+	for _, scope := range scopes {
+		alerts, err := m.amClient.FiringAlerts(ctx, matcherFilter(scope))
+		if err != nil {
+			klog.Errorf("Failed to look up firing alerts of node %s: %v", nodeName, err)
+			return
+		}
+		if len(alerts) == 0 {
+			continue
+		}
+
+		id, err := m.amClient.CreateSilenceSince(ctx, models.Matchers{scope}, nodeName, kind, firedAt(alerts), m.options.CatchUpDuration, catchUpNote)
+		if err != nil {
+			klog.ErrorS(err, "Failed to create catch-up silence", "action", "create", "node", nodeName, "kind", kind)
+			m.recordFailure(nodeName, operationCreate, err)
+			continue
+		}
+		klog.InfoS("Alerts fired before the rollout was detected, silencing all alerts of the node for a while",
+			"action", "catch-up", "node", nodeName, "silenceID", id, "alerts", alertNames(alerts), "duration", m.options.CatchUpDuration)
+		metrics.CatchUpSilences.Inc()
+		m.catchUps[nodeName] = append(m.catchUps[nodeName], catchUpSilence{id: id, endsAt: time.Now().Add(m.options.CatchUpDuration)})
+	}
+}
+
+// deleteCatchUps deletes the catch-up silences of a node which haven't
+// expired yet, the lock must be held
+func (m *SilenceManager) deleteCatchUps(ctx context.Context, nodeName string) {
+	now := time.Now()
+	for _, silence := range m.catchUps[nodeName] {
+		if !silence.endsAt.After(now) {
+			continue
+		}
+		if err := m.amClient.DeleteSilenceID(ctx, silence.id); err != nil {
+			// It expires on its own shortly
+			klog.ErrorS(err, "Failed to delete catch-up silence", "action", "delete", "node", nodeName, "silenceID", silence.id)
+		}
+	}
+	delete(m.catchUps, nodeName)
+}
+
+// firedAt returns when the first of the alerts started firing, now if none
+// has a start
+func firedAt(alerts models.GettableAlerts) time.Time {
+	first := time.Now()
+	for _, alert := range alerts {
+		if alert.StartsAt != nil && time.Time(*alert.StartsAt).Before(first) {
+			first = time.Time(*alert.StartsAt)
+		}
+	}
+	return first
+}
+
+// matcherFilter renders a matcher as a filter of the alerts API
+func matcherFilter(matcher *models.Matcher) string {
+	op := "="
+	if derefBool(matcher.IsRegex) {
+		op = "=~"
+	}
+	return derefString(matcher.Name) + op + strconv.Quote(derefString(matcher.Value))
+}
+
+// alertNames returns the sorted distinct names of alerts
+func alertNames(alerts models.GettableAlerts) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, alert := range alerts {
+		name := alert.Labels["alertname"]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
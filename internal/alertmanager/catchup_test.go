@@ -0,0 +1,45 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/client-go/kubernetes/fake"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/state"
+)
+
+func TestCatchUpBackdated(t *testing.T) {
+	first := strfmt.DateTime(time.Now().Add(-10 * time.Minute))
+	later := strfmt.DateTime(time.Now().Add(-time.Minute))
+	alerts := models.GettableAlerts{
+		{Alert: models.Alert{Labels: models.LabelSet{"alertname": "NodeNotReady"}}, StartsAt: &later},
+		{Alert: models.Alert{Labels: models.LabelSet{"alertname": "KubeletDown"}}, StartsAt: &first},
+	}
+	if got := firedAt(alerts); !got.Equal(time.Time(first)) {
+		t.Errorf("Expected the catch-up silence to start at %s, got %s", time.Time(first), got)
+	}
+}
+
+func TestCatchUpSilenceSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	clientset := fake.NewSimpleClientset(workerNode("worker-1", nil, nil))
+	store := state.NewConfigMapStore(clientset, "rollout-helper", "rollout-helper-state")
+
+	m := newEvictionManager(t, am.URL(), clientset, store, Options{})
+	endsAt := time.Now().Add(5 * time.Minute).UTC().Truncate(time.Second)
+	m.catchUps["worker-1"] = []catchUpSilence{{id: "catch-up", endsAt: endsAt}}
+	m.persistDetached(ctx)
+
+	m = newEvictionManager(t, am.URL(), clientset, store, Options{})
+	restored := m.catchUps["worker-1"]
+	if len(restored) != 1 || restored[0].id != "catch-up" || !restored[0].endsAt.Equal(endsAt) {
+		t.Errorf("Expected the catch-up silence to be restored, got %+v", restored)
+	}
+}
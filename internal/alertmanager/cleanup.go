@@ -0,0 +1,40 @@
+package alertmanager
+
+import (
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// StaleSilence is an active silence of the helper whose node is done rolling
+// or was deleted
+type StaleSilence struct {
+	Node    string
+	Kind    SilenceKind
+	Silence models.PostableSilence
+	// Deleted is set if the node no longer exists
+	Deleted bool
+}
+
+// FindStale returns the active silences of the helper whose node is done,
+// i.e. settled[node] is true, or deleted, i.e. missing from settled. Manual,
+// maintenance window and eviction silences don't end with a rollout, they're
+// only stale once their node was deleted. Nodes whose silences the helper
+// keeps after their rollout, e.g. within its unsilence delay, mustn't be
+// settled
+func FindStale(silences []models.PostableSilence, settled map[string]bool) []StaleSilence {
+	var stale []StaleSilence
+	for _, silence := range silences {
+		if !isOwned(silence) || isExpired(silence) {
+			continue
+		}
+		node, kind, ok := parseComment(silence.Comment)
+		if !ok {
+			continue
+		}
+		done, exists := settled[node]
+		if exists && (!done || kind == KindManual || kind == KindMaintenanceWindow || kind == KindEviction) {
+			continue
+		}
+		stale = append(stale, StaleSilence{Node: node, Kind: kind, Silence: silence, Deleted: !exists})
+	}
+	return stale
+}
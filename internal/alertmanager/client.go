@@ -1,148 +1,572 @@
 package alertmanager
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/go-openapi/runtime"
 	"github.com/go-openapi/strfmt"
+	amclient "github.com/prometheus/alertmanager/api/v2/client"
+	amsilence "github.com/prometheus/alertmanager/api/v2/client/silence"
 	"github.com/prometheus/alertmanager/api/v2/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/tracing"
 )
 
+// maxRetryBackoff caps the wait between two attempts
+const maxRetryBackoff = 30 * time.Second
+
+// RetryPolicy controls how failed Alertmanager requests are repeated
+type RetryPolicy struct {
+	// MaxRetries is the number of attempts after the first one
+	MaxRetries int
+	// InitialBackoff is the wait before the first retry, doubled on each further retry
+	InitialBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used unless SetRetryPolicy is called
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: 500 * time.Millisecond,
+}
+
 type Client struct {
-	baseURL        string
-	authHeader     string
-	httpClient     *http.Client
-	activeSilences sync.Map
+	endpoints  *endpointSet
+	auth       authSource
+	httpClient *http.Client
+	retry      RetryPolicy
+	breaker    *breaker
+	throttle   *throttle
+	mode       Mode
+	// audit records the silences created for nodes, optional
+	audit *audit.Log
+	// extraMatchers are added to every created silence, including the one
+	// excluding the protected alerts
+	extraMatchers models.Matchers
+	protected     *models.Matcher
+	// apis are the generated API clients of the endpoints by base URL
+	apisMu sync.Mutex
+	apis   map[string]*amclient.AlertmanagerAPI
+	// headers are added to every request, tenant is the default tenant
+	headers http.Header
+	tenant  string
+	// tenants are the other tenants silences are listed in
+	tenantsMu sync.Mutex
+	tenants   map[string]bool
 }
 
-func NewClient(baseURL string, authToken string) *Client {
+// NewClient creates a client for the given Alertmanager URLs, in order of
+// preference. Requests go to the first URL and fail over to the next ones
+func NewClient(urls []string, authToken string) *Client {
 	client := &Client{
-		baseURL:    baseURL,
-		authHeader: authToken,
+		endpoints: newEndpointSet(urls),
+		auth:      staticAuth(authToken),
+		retry:     DefaultRetryPolicy,
+		breaker:   newBreaker(DefaultBreakerPolicy),
+		throttle:  newThrottle(DefaultRequestLimits),
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout: DefaultHTTPOptions.Timeout,
 		},
+		mode: ModeFailover,
 	}
 
 	return client
 }
 
-func (c *Client) CreateSilence(ctx context.Context, matchers models.Matchers, nodeName string) error {
-	now := strfmt.DateTime(time.Now())
-	endTime := strfmt.DateTime(time.Now().Add(90 * time.Minute))
+// SetRetryPolicy replaces the retry policy of Alertmanager requests
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy
+}
 
-	silence := models.Silence{
-		Matchers:  matchers,
-		StartsAt:  &now,
-		EndsAt:    &endTime,
-		CreatedBy: stringPtr("rollout-helper"),
-		Comment:   stringPtr(fmt.Sprintf("Silencing alerts for node %s during rollout", nodeName)),
+// SetRequestLimits replaces the limits of the concurrency and rate of
+// Alertmanager requests
+func (c *Client) SetRequestLimits(limits RequestLimits) {
+	c.throttle = newThrottle(limits)
+}
+
+// SetMode selects how requests are spread over the endpoints
+func (c *Client) SetMode(mode Mode) {
+	c.mode = mode
+}
+
+// SetAudit records the silences created or reused for nodes in log
+func (c *Client) SetAudit(log *audit.Log) {
+	c.audit = log
+}
+
+// SetExtraMatchers adds matchers to every silence created from now on, e.g.
+// severity!=critical so critical alerts are never silenced
+func (c *Client) SetExtraMatchers(matchers []config.StaticMatcher) {
+	c.extraMatchers = make(models.Matchers, 0, len(matchers))
+	for _, matcher := range matchers {
+		c.extraMatchers = append(c.extraMatchers, &models.Matcher{
+			Name:    stringPtr(matcher.Name),
+			Value:   stringPtr(matcher.Value),
+			IsRegex: boolPtr(matcher.IsRegex),
+			IsEqual: boolPtr(matcher.Equal()),
+		})
 	}
+}
 
-	body, err := json.Marshal(silence)
-	if err != nil {
-		return fmt.Errorf("failed to marshal silence: %w", err)
+// SetProtectedAlerts excludes the alerts from every silence created from now
+// on with an alertname!~ matcher, so they fire even if a silence's other
+// matchers cover them
+func (c *Client) SetProtectedAlerts(alerts []string) {
+	if len(alerts) == 0 {
+		c.protected = nil
+		return
+	}
+	quoted := make([]string, len(alerts))
+	for i, alert := range alerts {
+		quoted[i] = regexp.QuoteMeta(alert)
 	}
+	c.protected = &models.Matcher{
+		Name:    stringPtr(config.AlertNameLabel),
+		Value:   stringPtr(fmt.Sprintf("(%s)", strings.Join(quoted, "|"))),
+		IsRegex: boolPtr(true),
+		IsEqual: boolPtr(false),
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/v2/silences", c.baseURL), bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+// withExtraMatchers returns matchers with the extra matchers appended
+func (c *Client) withExtraMatchers(matchers models.Matchers) models.Matchers {
+	if len(c.extraMatchers) == 0 && c.protected == nil {
+		return matchers
+	}
+	extended := append(append(models.Matchers(nil), matchers...), c.extraMatchers...)
+	if c.protected != nil {
+		extended = append(extended, c.protected)
 	}
+	return extended
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", c.authHeader)
+// SetTransport replaces the transport used for Alertmanager requests
+func (c *Client) SetTransport(transport http.RoundTripper) {
+	c.httpClient.Transport = transport
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+// createdBy identifies the silences owned by the rollout helper
+const createdBy = "rollout-helper"
+
+const (
+	silenceCommentPrefix = "Silencing alerts for node "
+	silenceCommentSuffix = " during rollout"
+)
+
+// silenceComment returns the comment of silences created for a node, the
+// note of a policy is appended after the kind
+func silenceComment(nodeName string, kind SilenceKind, note string) string {
+	comment := silenceCommentPrefix + nodeName + silenceCommentSuffix
+	if kind != "" {
+		comment += " (" + string(kind) + ")"
+	}
+	if note != "" {
+		comment += ": " + note
 	}
-	defer resp.Body.Close()
+	return comment
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// commentNode returns the node a helper-created silence belongs to, based on its comment
+func commentNode(comment *string) (string, bool) {
+	node, _, ok := parseComment(comment)
+	return node, ok
+}
+
+// parseComment returns the node and kind of a helper-created silence based on
+// its comment. Silences created before kinds were introduced have no kind
+func parseComment(comment *string) (string, SilenceKind, bool) {
+	if comment == nil || !strings.HasPrefix(*comment, silenceCommentPrefix) {
+		return "", "", false
+	}
+	text, _ := splitFingerprint(*comment)
+	node, kind, ok := strings.Cut(strings.TrimPrefix(text, silenceCommentPrefix), silenceCommentSuffix)
+	if !ok || node == "" {
+		return "", "", false
+	}
+	if kind == "" {
+		return node, "", true
 	}
+	if !strings.HasPrefix(kind, " (") {
+		return "", "", false
+	}
+	kind, note, ok := strings.Cut(kind[2:], ")")
+	if !ok || (note != "" && !strings.HasPrefix(note, ": ")) {
+		return "", "", false
+	}
+	return node, SilenceKind(kind), true
+}
 
-	klog.Infof("Created silence for node %s", nodeName)
-	return nil
+// CreateSilence creates a silence of the given kind lasting for duration and
+// returns its ID. If an active silence with the same matchers already exists
+// for the node, e.g. created by a failed attempt or a previous instance, its
+// ID is returned instead
+func (c *Client) CreateSilence(ctx context.Context, matchers models.Matchers, nodeName string, kind SilenceKind, duration time.Duration) (string, error) {
+	return c.CreateSilenceWithNote(ctx, matchers, nodeName, kind, duration, "")
 }
 
-func (c *Client) DeleteSilence(ctx context.Context, nodeName string) error {
-	// Get all silences
-	silences, err := c.GetSilences(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get silences: %w", err)
-	}
-
-	// Find and delete silences created by rollout-helper for this node
-	for _, silence := range silences {
-		if silence.CreatedBy != nil && *silence.CreatedBy == "rollout-helper" {
-			// Check if this silence is for our node, by checking its comment
-			if strings.Contains(*silence.Comment, fmt.Sprintf(" %s ", nodeName)) {
-				silenceID := silence.ID
-				if err := c.DeleteSilenceID(ctx, silenceID); err != nil {
-					return fmt.Errorf("failed to delete silence %s: %w", silenceID, err)
-				}
-			}
+// CreateSilenceWithNote creates a silence like CreateSilence with a note
+// appended to its comment. The note isn't part of the fingerprint, a reused
+// silence keeps the note it was created with
+func (c *Client) CreateSilenceWithNote(ctx context.Context, matchers models.Matchers, nodeName string, kind SilenceKind, duration time.Duration, note string) (id string, err error) {
+	return c.CreateSilenceSince(ctx, matchers, nodeName, kind, time.Now(), duration, note)
+}
+
+// CreateSilenceSince creates a silence like CreateSilenceWithNote starting at
+// startsAt, which may be in the past. It still lasts for duration from now
+func (c *Client) CreateSilenceSince(ctx context.Context, matchers models.Matchers, nodeName string, kind SilenceKind, startsAt time.Time, duration time.Duration, note string) (id string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Client.CreateSilence", trace.WithAttributes(
+		attribute.String("node", nodeName),
+		attribute.String("kind", kind.String()),
+	))
+	defer func() {
+		span.SetAttributes(attribute.String("silence.id", id))
+		tracing.End(span, &err)
+	}()
+
+	tenant := c.tenantOf(ctx)
+	c.addTenant(tenant)
+	matchers = c.withExtraMatchers(matchers)
+
+	startTime := strfmt.DateTime(startsAt)
+	endTime := strfmt.DateTime(time.Now().Add(duration))
+	fingerprint := silenceFingerprint(matchers, nodeName, kind)
+
+	silence := models.PostableSilence{
+		Silence: models.Silence{
+			Matchers:  matchers,
+			StartsAt:  &startTime,
+			EndsAt:    &endTime,
+			CreatedBy: stringPtr(createdBy),
+			Comment:   stringPtr(withFingerprint(silenceComment(nodeName, kind, note), fingerprint)),
+		},
+	}
+
+	if c.mode == ModeBroadcast {
+		id, err = c.broadcastCreate(ctx, silence, fingerprint)
+	} else {
+		var reused bool
+		if id, reused = c.reuseSilence(ctx, "", matchers, fingerprint, time.Time(endTime)); reused {
+			id = joinTenantID(tenant, id)
+			klog.InfoS("Reusing silence", "action", "reuse", "node", nodeName, "kind", kind, "silenceID", id)
+			span.SetAttributes(attribute.Bool("silence.reused", true))
+			metrics.SilencesReused.WithLabelValues(kind.String()).Inc()
+			c.audit.Record(audit.Entry{Node: nodeName, Action: audit.ActionReused, SilenceID: id, Kind: string(kind), Matchers: formatMatchers(matchers)})
+			return id, nil
 		}
+		id, err = c.postSilence(ctx, "", silence)
 	}
+	if err != nil {
+		return "", err
+	}
+	id = joinTenantID(tenant, id)
 
-	return nil
+	klog.InfoS("Created silence", "action", "create", "node", nodeName, "kind", kind, "silenceID", id, "duration", duration)
+	metrics.SilencesCreated.WithLabelValues(kind.String()).Inc()
+	until := time.Time(endTime)
+	c.audit.Record(audit.Entry{Node: nodeName, Action: audit.ActionCreated, SilenceID: id, Kind: string(kind), Matchers: formatMatchers(matchers), Until: &until, Message: note})
+	return id, nil
 }
 
-func (c *Client) DeleteSilenceID(ctx context.Context, silenceID string) error {
-	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/api/v2/silence/%s", c.baseURL, silenceID), nil)
+// ExtendSilence moves the end of an active silence to endsAt. Alertmanager
+// may replace the silence, so the returned ID has to be used from now on
+func (c *Client) ExtendSilence(ctx context.Context, silenceID string, endsAt time.Time) (id string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Client.ExtendSilence", trace.WithAttributes(attribute.String("silence.id", silenceID)))
+	defer tracing.End(span, &err)
+
+	ctx, tenant, tenantID := c.forSilence(ctx, silenceID)
+	if c.mode == ModeBroadcast {
+		id, err = c.broadcastExtend(ctx, tenantID, endsAt)
+	} else {
+		id, err = c.extendSilence(ctx, "", tenantID, endsAt)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	id = joinTenantID(tenant, id)
+
+	klog.InfoS("Extended silence", "action", "extend", "silenceID", id, "endsAt", endsAt.Format(time.RFC3339))
+	return id, nil
+}
 
-	req.Header.Set("Authorization", c.authHeader)
+// AdoptSilence rewrites an existing silence under the helper's identity so it
+// is managed like the silences created for nodeName, and returns its ID
+func (c *Client) AdoptSilence(ctx context.Context, silence models.PostableSilence, nodeName string) (string, error) {
+	silence.CreatedBy = stringPtr(createdBy)
+	silence.Comment = stringPtr(silenceComment(nodeName, KindManual, ""))
 
-	resp, err := c.httpClient.Do(req)
+	ctx, tenant, tenantID := c.forSilence(ctx, silence.ID)
+	silence.ID = tenantID
+	if c.mode != ModeBroadcast {
+		id, err := c.postSilence(ctx, "", silence)
+		return joinTenantID(tenant, id), err
+	}
+
+	adopted := make(map[int]string)
+	err := c.broadcast("adopt", splitBroadcastID(silence.ID), func(index int, url, id string) error {
+		update := silence
+		update.ID = id
+		newID, err := c.postSilence(ctx, url, update)
+		if err == nil {
+			adopted[index] = newID
+		}
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
+	return joinTenantID(tenant, joinBroadcastID(adopted)), nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// PutSilence creates a silence with the given matchers and comment lasting
+// until endsAt, or replaces the silence id if it's set, and returns its ID.
+// Alertmanager may replace the silence when its matchers change. Unlike
+// CreateSilence, existing silences aren't reused
+func (c *Client) PutSilence(ctx context.Context, id string, matchers models.Matchers, comment string, endsAt time.Time) (string, error) {
+	tenant := c.tenantOf(ctx)
+	if id != "" {
+		ctx, tenant, id = c.forSilence(ctx, id)
 	}
+	c.addTenant(tenant)
 
-	klog.Infof("Deleted silence %s", silenceID)
+	now := strfmt.DateTime(time.Now())
+	end := strfmt.DateTime(endsAt)
+	silence := models.PostableSilence{
+		ID: id,
+		Silence: models.Silence{
+			Matchers:  c.withExtraMatchers(matchers),
+			StartsAt:  &now,
+			EndsAt:    &end,
+			CreatedBy: stringPtr(createdBy),
+			Comment:   stringPtr(comment),
+		},
+	}
+
+	if c.mode != ModeBroadcast {
+		newID, err := c.postSilence(ctx, "", silence)
+		return joinTenantID(tenant, newID), err
+	}
+
+	// A new silence is created on every endpoint, an existing one where it exists
+	var ids map[int]string
+	if id != "" {
+		ids = splitBroadcastID(id)
+	}
+	put := make(map[int]string)
+	err := c.broadcast(operationCreate, ids, func(index int, url, partID string) error {
+		update := silence
+		update.ID = partID
+		newID, err := c.postSilence(ctx, url, update)
+		if err == nil {
+			put[index] = newID
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return joinTenantID(tenant, joinBroadcastID(put)), nil
+}
+
+// extendSilence moves the end of a silence on a single endpoint
+func (c *Client) extendSilence(ctx context.Context, target, silenceID string, endsAt time.Time) (string, error) {
+	existing, err := c.getSilence(ctx, target, silenceID)
+	if err != nil {
+		return "", err
+	}
+
+	end := strfmt.DateTime(endsAt)
+	silence := models.PostableSilence{
+		ID:      silenceID,
+		Silence: existing.Silence,
+	}
+	silence.EndsAt = &end
+	return c.postSilence(ctx, target, silence)
+}
+
+// postSilence creates or updates a silence on target, or the active endpoint
+// if target is empty, and returns its ID
+func (c *Client) postSilence(ctx context.Context, target string, silence models.PostableSilence) (string, error) {
+	var id string
+	err := c.do(ctx, target, http.MethodPost, func(api *amclient.AlertmanagerAPI, option func(*runtime.ClientOperation)) error {
+		resp, err := api.Silence.PostSilences(amsilence.NewPostSilencesParams().WithSilence(&silence), option)
+		if err != nil {
+			return err
+		}
+		if resp.Payload == nil || resp.Payload.SilenceID == "" {
+			return errors.New("no silence ID in the response")
+		}
+		id = resp.Payload.SilenceID
+		return nil
+	})
+	return id, err
+}
+
+// GetSilence fetches a single silence from Alertmanager
+func (c *Client) GetSilence(ctx context.Context, silenceID string) (*models.GettableSilence, error) {
+	ctx, _, tenantID := c.forSilence(ctx, silenceID)
+	if c.mode == ModeBroadcast {
+		return c.broadcastGet(ctx, tenantID)
+	}
+	return c.getSilence(ctx, "", tenantID)
+}
+
+func (c *Client) getSilence(ctx context.Context, target, silenceID string) (*models.GettableSilence, error) {
+	var silence *models.GettableSilence
+	err := c.do(ctx, target, http.MethodGet, func(api *amclient.AlertmanagerAPI, option func(*runtime.ClientOperation)) error {
+		resp, err := api.Silence.GetSilence(amsilence.NewGetSilenceParams().WithSilenceID(strfmt.UUID(silenceID)), option)
+		if err != nil {
+			return err
+		}
+		silence = resp.Payload
+		return nil
+	})
+	return silence, err
+}
+
+func (c *Client) DeleteSilenceID(ctx context.Context, silenceID string) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Client.DeleteSilence", trace.WithAttributes(attribute.String("silence.id", silenceID)))
+	defer tracing.End(span, &err)
+
+	ctx, _, tenantID := c.forSilence(ctx, silenceID)
+	if c.mode == ModeBroadcast {
+		err = c.broadcastDelete(ctx, tenantID)
+	} else {
+		err = c.deleteSilence(ctx, "", tenantID)
+	}
+	if err != nil {
+		return err
+	}
+
+	klog.InfoS("Deleted silence", "action", "delete", "silenceID", silenceID)
 	return nil
 }
 
-// GetSilences fetches all silences from Alertmanager
+func (c *Client) deleteSilence(ctx context.Context, target, silenceID string) error {
+	return c.do(ctx, target, http.MethodDelete, func(api *amclient.AlertmanagerAPI, option func(*runtime.ClientOperation)) error {
+		_, err := api.Silence.DeleteSilence(amsilence.NewDeleteSilenceParams().WithSilenceID(strfmt.UUID(silenceID)), option)
+		return err
+	})
+}
+
+// GetSilences fetches all silences from Alertmanager, of every known tenant
 func (c *Client) GetSilences(ctx context.Context) ([]models.PostableSilence, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/v2/silences", c.baseURL), nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	return c.listTenants(ctx, func(ctx context.Context) ([]models.PostableSilence, error) {
+		if c.mode == ModeBroadcast {
+			return c.broadcastList(ctx, nil)
+		}
+		return c.listSilences(ctx, "", nil, nil)
+	})
+}
+
+// do performs call against target, or the active Alertmanager endpoint if
+// target is empty, retrying failed attempts with exponential backoff. method
+// labels the requests in metrics and traces. Nothing is sent while the circuit
+// breaker is open
+func (c *Client) do(ctx context.Context, target, method string, call apiCall) error {
+	if err := c.breaker.allow(time.Now()); err != nil {
+		return err
+	}
+	status, err := c.doWithRetries(ctx, target, method, call)
+	switch {
+	case ctx.Err() != nil:
+		// A cancelled request says nothing about Alertmanager's health
+		c.breaker.release()
+	case isRetryable(status, err):
+		c.breaker.report(time.Now(), err)
+	default:
+		c.breaker.report(time.Now(), nil)
+	}
+	return err
+}
+
+// doWithRetries performs call, retrying failed attempts with exponential backoff
+func (c *Client) doWithRetries(ctx context.Context, target, method string, call apiCall) (int, error) {
+	backoff := c.retry.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		status, err := c.send(ctx, target, method, call)
+		if !isRetryable(status, err) || attempt >= c.retry.MaxRetries || ctx.Err() != nil {
+			return status, err
+		}
+
+		wait := withJitter(backoff)
+		metrics.AlertmanagerRetries.WithLabelValues(method).Inc()
+		klog.V(2).Infof("Retrying %s request in %s (attempt %d/%d): %v", method, wait, attempt+1, c.retry.MaxRetries, err)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt+1), attribute.String("wait", wait.String())))
+
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("failed to send request: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
 	}
+}
 
-	req.Header.Set("Authorization", c.authHeader)
+// send performs a single attempt of call against target or the active
+// endpoint and returns the status code of the response, zero if none arrived.
+// Unexpected status codes are returned as StatusError
+func (c *Client) send(ctx context.Context, target, method string, call apiCall) (status int, err error) {
+	baseURL := target
+	if baseURL == "" {
+		baseURL = c.endpoints.Active()
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "alertmanager "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("server.address", baseURL),
+	))
+	defer tracing.End(span, &err)
 
-	resp, err := c.httpClient.Do(req)
+	api, err := c.api(baseURL)
+	if err != nil {
+		return 0, err
+	}
+	release, err := c.throttle.wait(ctx, baseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return 0, err
 	}
-	defer resp.Body.Close()
+	defer release()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	try := &attempt{client: c, ctx: ctx, baseURL: baseURL, method: method}
+	err = call(api, try.option)
+	if try.status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", try.status))
 	}
+	if err != nil && (try.status < 200 || try.status > 299) && try.status != 0 {
+		err = &StatusError{Code: try.status, Err: err, Body: strings.TrimSpace(string(try.body))}
+	}
+	return try.status, err
+}
 
-	var silences []models.PostableSilence
-	if err := json.NewDecoder(resp.Body).Decode(&silences); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// isRetryable reports whether a failed attempt may succeed when repeated,
+// i.e. no response arrived or Alertmanager is overloaded or failing
+func isRetryable(status int, err error) bool {
+	if err == nil {
+		return false
 	}
+	return status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
 
-	return silences, nil
+// withJitter returns a random duration between half and the full backoff
+func withJitter(backoff time.Duration) time.Duration {
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
 }
 
 // Helper functions for pointer types
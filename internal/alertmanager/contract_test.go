@@ -0,0 +1,245 @@
+package alertmanager_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/alertmanager"
+)
+
+// contractURLEnv is the environment variable with the URL of the Alertmanager
+// the contract is verified against, the test is skipped without it
+const contractURLEnv = "ALERTMANAGER_CONTRACT_URL"
+
+// TestContract verifies that a real Alertmanager behaves the way the client
+// relies on: silence CRUD, matcher semantics and error responses. It's run
+// against every supported Alertmanager version by hack/contract.sh and CI,
+// its silences are expired afterwards
+func TestContract(t *testing.T) {
+	url := os.Getenv(contractURLEnv)
+	if url == "" {
+		t.Skipf("%s isn't set", contractURLEnv)
+	}
+	if !testing.Verbose() {
+		klog.SetLogger(logr.Discard())
+	}
+
+	client := alertmanager.NewClient([]string{url}, os.Getenv("ALERTMNGR_TOKEN"))
+	// Errors are part of the contract, report them as returned by Alertmanager
+	client.SetRetryPolicy(alertmanager.RetryPolicy{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	node := fmt.Sprintf("rollout-helper-contract-%d", time.Now().Unix())
+	// cleanup are the IDs of the silences expired at the end of the run
+	var cleanup []string
+	defer func() {
+		for _, id := range cleanup {
+			// Expired silences can't be expired again, only active ones are left to clean up
+			if silence, err := client.GetSilence(ctx, id); err == nil && silence.Status != nil && *silence.Status.State != "expired" {
+				if err := client.DeleteSilenceID(ctx, id); err != nil {
+					t.Errorf("Failed to expire silence %s: %v", id, err)
+				}
+			}
+		}
+	}()
+
+	// Subtests run in order and share the silence of the create subtest
+	var id string
+	requireSilence := func(t *testing.T) {
+		t.Helper()
+		if id == "" {
+			t.Skip("Requires create")
+		}
+	}
+	create := func(t *testing.T, matchers models.Matchers) string {
+		t.Helper()
+		created, err := client.CreateSilence(ctx, matchers, node, alertmanager.KindManual, 10*time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to create silence: %v", err)
+		}
+		cleanup = append(cleanup, created)
+		return created
+	}
+
+	t.Run("create", func(t *testing.T) {
+		created := create(t, contractMatchers(node))
+		if created == "" {
+			t.Fatal("No silence ID returned")
+		}
+		id = created
+	})
+
+	t.Run("get", func(t *testing.T) {
+		requireSilence(t)
+		silence, err := client.GetSilence(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get silence: %v", err)
+		}
+		if silence.Status == nil || *silence.Status.State != "active" {
+			t.Fatalf("Expected an active silence, got %+v", silence.Status)
+		}
+		if silence.CreatedBy == nil || *silence.CreatedBy != "rollout-helper" {
+			t.Fatalf("createdBy wasn't kept: %v", silence.CreatedBy)
+		}
+		// Nodes, kinds and fingerprints are parsed from the comment, it has to round-trip verbatim
+		if silence.Comment == nil || !strings.Contains(*silence.Comment, node) || !strings.Contains(*silence.Comment, "[fp:") {
+			t.Fatalf("Comment wasn't kept: %v", silence.Comment)
+		}
+		expectMatchers(t, contractMatchers(node), silence.Matchers)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		requireSilence(t)
+		silences, err := client.GetSilences(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list silences: %v", err)
+		}
+		for _, silence := range silences {
+			if silence.ID == id {
+				if silence.EndsAt == nil {
+					t.Fatal("Listed silence has no endsAt")
+				}
+				expectMatchers(t, contractMatchers(node), silence.Matchers)
+				return
+			}
+		}
+		t.Fatalf("Silence %s isn't listed", id)
+	})
+
+	t.Run("create-idempotent", func(t *testing.T) {
+		requireSilence(t)
+		if again := create(t, contractMatchers(node)); again != id {
+			t.Fatalf("Created duplicate %s of silence %s", again, id)
+		}
+	})
+
+	// Policies rely on regex and negative matchers
+	t.Run("matchers", func(t *testing.T) {
+		matchers := models.Matchers{
+			matcher("node", node, false, true),
+			matcher("severity", "info", false, false),
+			matcher("namespace", "openshift-.*", true, false),
+		}
+		silence, err := client.GetSilence(ctx, create(t, matchers))
+		if err != nil {
+			t.Fatalf("Failed to get silence: %v", err)
+		}
+		expectMatchers(t, matchers, silence.Matchers)
+	})
+
+	t.Run("extend", func(t *testing.T) {
+		requireSilence(t)
+		endsAt := time.Now().Add(20 * time.Minute).Truncate(time.Second)
+		extended, err := client.ExtendSilence(ctx, id, endsAt)
+		if err != nil {
+			t.Fatalf("Failed to extend silence: %v", err)
+		}
+		if extended != id {
+			// Older Alertmanagers replace the silence instead of updating it in place
+			cleanup = append(cleanup, extended)
+			id = extended
+		}
+
+		silence, err := client.GetSilence(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get silence: %v", err)
+		}
+		if silence.EndsAt == nil || !time.Time(*silence.EndsAt).Equal(endsAt) {
+			t.Fatalf("Expected endsAt %s, got %v", endsAt.Format(time.RFC3339), silence.EndsAt)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		requireSilence(t)
+		if err := client.DeleteSilenceID(ctx, id); err != nil {
+			t.Fatalf("Failed to expire silence: %v", err)
+		}
+		silence, err := client.GetSilence(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get silence: %v", err)
+		}
+		if silence.Status == nil || *silence.Status.State != "expired" {
+			t.Fatalf("Expected an expired silence, got %+v", silence.Status)
+		}
+	})
+
+	t.Run("error-not-found", func(t *testing.T) {
+		_, err := client.GetSilence(ctx, "00000000-0000-0000-0000-000000000000")
+		expectStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("error-invalid-matcher", func(t *testing.T) {
+		matchers := models.Matchers{matcher("node", "(", true, true)}
+		created, err := client.CreateSilence(ctx, matchers, node, alertmanager.KindManual, 10*time.Minute)
+		if err == nil {
+			cleanup = append(cleanup, created)
+		}
+		expectStatus(t, err, http.StatusBadRequest)
+	})
+}
+
+// contractMatchers returns the matchers of the silence created by the checks
+func contractMatchers(node string) models.Matchers {
+	return models.Matchers{
+		matcher("node", node, false, true),
+		matcher("alertname", "KubeNodeNotReady|KubeNodeUnreachable", true, true),
+	}
+}
+
+func matcher(name, value string, isRegex, isEqual bool) *models.Matcher {
+	return &models.Matcher{Name: &name, Value: &value, IsRegex: &isRegex, IsEqual: &isEqual}
+}
+
+// expectStatus verifies that a request was rejected with the status code
+func expectStatus(t *testing.T, err error, code int) {
+	t.Helper()
+	var statusErr *alertmanager.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != code {
+		t.Fatalf("Expected status code %d, got %v", code, err)
+	}
+}
+
+// expectMatchers compares matchers regardless of their order, Alertmanager sorts them
+func expectMatchers(t *testing.T, want, got models.Matchers) {
+	t.Helper()
+	format := func(matchers models.Matchers) map[string]bool {
+		formatted := make(map[string]bool, len(matchers))
+		for _, m := range matchers {
+			isEqual := m.IsEqual == nil || *m.IsEqual
+			isRegex := m.IsRegex != nil && *m.IsRegex
+			op := "="
+			switch {
+			case isEqual && isRegex:
+				op = "=~"
+			case !isEqual && isRegex:
+				op = "!~"
+			case !isEqual:
+				op = "!="
+			}
+			formatted[*m.Name+op+*m.Value] = true
+		}
+		return formatted
+	}
+
+	wantSet, gotSet := format(want), format(got)
+	if len(wantSet) != len(gotSet) {
+		t.Fatalf("Expected matchers %v, got %v", wantSet, gotSet)
+	}
+	for m := range wantSet {
+		if !gotSet[m] {
+			t.Fatalf("Expected matchers %v, got %v", wantSet, gotSet)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package alertmanager
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"rollout-helper/internal/config"
+)
+
+// PodTarget is a DaemonSet whose pods on a rolling node are silenced
+type PodTarget struct {
+	Namespace string
+	DaemonSet string
+	// Selector is the label selector of the DaemonSet's pods
+	Selector string
+}
+
+// declaredPolicies holds the policies and pod targets declared by
+// RolloutSilencePolicy objects
+type declaredPolicies struct {
+	mu       sync.RWMutex
+	policies []config.Policy
+	targets  []daemonSetIdent
+	// owners maps the names of the policies to the object declaring them
+	owners map[string]*corev1.ObjectReference
+}
+
+// SetDeclared replaces the policies and pod targets declared outside the
+// configuration file. Events about the silences of a policy are also recorded
+// on its owner. The policies must be compiled with config.CompilePolicies
+func (m *SilenceManager) SetDeclared(policies []config.Policy, targets []PodTarget, owners map[string]*corev1.ObjectReference) {
+	idents := make([]daemonSetIdent, 0, len(targets))
+	for _, target := range targets {
+		idents = append(idents, daemonSetIdent{
+			namespace: target.Namespace,
+			dsName:    target.DaemonSet,
+			label:     target.Selector,
+		})
+	}
+
+	m.declared.mu.Lock()
+	m.declared.policies = policies
+	m.declared.targets = idents
+	m.declared.owners = owners
+	m.declared.mu.Unlock()
+	m.syncEvictionWatches()
+}
+
+// policyOwner returns the object which declares a policy, nil for the
+// policies of the configuration file
+func (m *SilenceManager) policyOwner(policyName string) *corev1.ObjectReference {
+	m.declared.mu.RLock()
+	defer m.declared.mu.RUnlock()
+	return m.declared.owners[policyName]
+}
+
+// Config returns the effective configuration, with the declared policies
+func (m *SilenceManager) Config() *config.Config {
+	return m.currentConfig()
+}
+
+// currentConfig returns the configuration file merged with the declared policies
+func (m *SilenceManager) currentConfig() *config.Config {
+	m.declared.mu.RLock()
+	defer m.declared.mu.RUnlock()
+
+	cfg := m.config
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if len(m.declared.policies) == 0 {
+		return cfg
+	}
+	return cfg.WithPolicies(m.declared.policies)
+}
+
+// configuredTargets returns the built-in and declared pod targets, which
+// unlike discovered ones may name pods which don't exist
+func (m *SilenceManager) configuredTargets() []daemonSetIdent {
+	m.declared.mu.RLock()
+	defer m.declared.mu.RUnlock()
+
+	var targets []daemonSetIdent
+	if !m.options.DisableBuiltinTargets {
+		targets = append(targets, podSilenceTargets...)
+	}
+	return appendTargets(targets, m.declared.targets)
+}
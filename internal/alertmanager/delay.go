@@ -0,0 +1,49 @@
+package alertmanager
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// delayUnsilence keeps the silences of a node which finished rolling until
+// UnsilenceDelay passed, so alerts still firing for a few scrape intervals
+// after the rollout stay silenced. It reports false if the silences should be
+// deleted right away, the lock must be held
+func (m *SilenceManager) delayUnsilence(nodeName string) bool {
+	if m.options.UnsilenceDelay <= 0 {
+		return false
+	}
+	if _, tracked := m.activeSilences.Get(nodeName); !tracked {
+		return false
+	}
+
+	at := time.Now().Add(m.options.UnsilenceDelay)
+	m.delayed[nodeName] = at
+	klog.InfoS("Node finished rolling, delaying the deletion of its silences", "action", "delay", "node", nodeName, "duration", m.options.UnsilenceDelay)
+	return true
+}
+
+// delayedUntil returns when the silences of a node which finished rolling
+// are deleted, the lock must be held
+func (m *SilenceManager) delayedUntil(nodeName string) (time.Time, bool) {
+	at, ok := m.delayed[nodeName]
+	return at, ok
+}
+
+// unsilenceDelayed deletes the silences of nodes whose delay passed
+func (m *SilenceManager) unsilenceDelayed(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for node, at := range m.delayed {
+		if now.Before(at) {
+			continue
+		}
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence node %s after its delay: %v", node, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package alertmanager
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/state"
+)
+
+// Reasons of the persisted detached silences
+const (
+	detachedRelocation = "relocation"
+	detachedEviction   = "eviction"
+	detachedCatchUp    = "catch-up"
+)
+
+// detachedSilences returns the silences which aren't tracked with the
+// silences of their node and haven't expired yet, sorted by ID. The lock must
+// be held
+func (m *SilenceManager) detachedSilences(now time.Time) []state.DetachedSilence {
+	var silences []state.DetachedSilence
+	for _, silence := range m.relocations {
+		if silence.endsAt.After(now) {
+			silences = append(silences, state.DetachedSilence{ID: silence.id, Node: silence.node, Reason: detachedRelocation, EndsAt: silence.endsAt})
+		}
+	}
+	for _, evicted := range m.evictions {
+		if !evicted.endsAt.After(now) {
+			continue
+		}
+		for _, id := range evicted.ids {
+			silences = append(silences, state.DetachedSilence{ID: id, Node: evicted.node, Reason: detachedEviction, Target: evicted.daemonSet, EndsAt: evicted.endsAt})
+		}
+	}
+	for node, catchUps := range m.catchUps {
+		for _, silence := range catchUps {
+			if silence.endsAt.After(now) {
+				silences = append(silences, state.DetachedSilence{ID: silence.id, Node: node, Reason: detachedCatchUp, EndsAt: silence.endsAt})
+			}
+		}
+	}
+	for i := range silences {
+		silences[i].EndsAt = silences[i].EndsAt.UTC().Truncate(time.Second)
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].ID < silences[j].ID })
+	return silences
+}
+
+// restoreDetached loads the persisted detached silences which haven't
+// expired yet, so they aren't expired as orphans
+func (m *SilenceManager) restoreDetached(ctx context.Context) {
+	store, ok := m.store.(state.DetachedStore)
+	if !ok {
+		return
+	}
+	silences, err := store.LoadDetached(ctx)
+	if err != nil {
+		klog.Warningf("Failed to load persisted detached silences: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, silence := range silences {
+		if !silence.EndsAt.After(now) {
+			continue
+		}
+		switch silence.Reason {
+		case detachedRelocation:
+			m.relocations = append(m.relocations, relocationSilence{id: silence.ID, node: silence.Node, endsAt: silence.EndsAt})
+		case detachedEviction:
+			// Replacements are silenced again, the silences of pods silenced before are reused
+			m.trackEviction(silence.Node, silence.Target, silence.EndsAt).addID(silence.ID)
+		case detachedCatchUp:
+			m.catchUps[silence.Node] = append(m.catchUps[silence.Node], catchUpSilence{id: silence.ID, endsAt: silence.EndsAt})
+		default:
+			klog.Warningf("Ignoring persisted silence %s with unknown reason %q", silence.ID, silence.Reason)
+		}
+	}
+	m.savedDetached = m.detachedSilences(now)
+}
+
+// persistDetached saves the detached silences if they changed since they
+// were last saved, the lock must be held
+func (m *SilenceManager) persistDetached(ctx context.Context) {
+	store, ok := m.store.(state.DetachedStore)
+	if !ok {
+		return
+	}
+	silences := m.detachedSilences(time.Now())
+	if sameDetached(silences, m.savedDetached) {
+		return
+	}
+	if err := store.SaveDetached(ctx, silences); err != nil {
+		klog.Errorf("Failed to persist detached silences: %v", err)
+		return
+	}
+	m.savedDetached = silences
+}
+
+// sameDetached reports whether a and b, sorted by ID, record the same silences
+func sameDetached(a, b []state.DetachedSilence) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Node != b[i].Node || a[i].Reason != b[i].Reason || a[i].Target != b[i].Target || !a[i].EndsAt.Equal(b[i].EndsAt) {
+			return false
+		}
+	}
+	return true
+}
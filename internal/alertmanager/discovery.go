@@ -0,0 +1,121 @@
+package alertmanager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/authz"
+)
+
+const (
+	// SilenceDaemonSetAnnotation opts a DaemonSet into having its pods silenced on rolling nodes
+	SilenceDaemonSetAnnotation = "rollout-helper.snappcloud.io/silence"
+	// discoveryInterval is how often annotated DaemonSets are discovered
+	discoveryInterval = 5 * time.Minute
+)
+
+// discoveredTargets holds the DaemonSets found by discovery
+type discoveredTargets struct {
+	mu      sync.RWMutex
+	targets []daemonSetIdent
+}
+
+func (d *discoveredTargets) get() []daemonSetIdent {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.targets
+}
+
+func (d *discoveredTargets) set(targets []daemonSetIdent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.targets = targets
+}
+
+// podTargets returns the built-in, declared and discovered daemonsets whose pods are silenced
+func (m *SilenceManager) podTargets() []daemonSetIdent {
+	return appendTargets(m.configuredTargets(), m.discovered.get())
+}
+
+// appendTargets adds the targets which aren't in targets yet
+func appendTargets(targets []daemonSetIdent, more []daemonSetIdent) []daemonSetIdent {
+	for _, target := range more {
+		// Built-in targets may be declared or annotated as well
+		if !containsTarget(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func containsTarget(targets []daemonSetIdent, target daemonSetIdent) bool {
+	for _, existing := range targets {
+		if existing.namespace == target.namespace && existing.label == target.label {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverDaemonSets lists the DaemonSets annotated for silencing in the
+// namespaces in scope
+func (m *SilenceManager) discoverDaemonSets(ctx context.Context) {
+	daemonSets, err := m.options.Namespaces.ListDaemonSets(ctx, m.k8sClient, metav1.ListOptions{})
+	if err != nil {
+		// Keep the previously discovered targets
+		klog.Errorf("Failed to discover daemonsets: %v", err)
+		return
+	}
+
+	var targets []daemonSetIdent
+	for _, ds := range daemonSets.Items {
+		if ds.Annotations[SilenceDaemonSetAnnotation] != "true" {
+			continue
+		}
+		object := authz.Object{Kind: "DaemonSet", Namespace: ds.Namespace, Name: ds.Name}
+		if err := authz.Check(m.options.Authorizer, object, ds.Annotations, SilenceDaemonSetAnnotation); err != nil {
+			klog.Warningf("Ignoring daemonset %s/%s: %v", ds.Namespace, ds.Name, err)
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+		if err != nil || selector.Empty() {
+			klog.Errorf("Ignoring daemonset %s/%s with invalid selector: %v", ds.Namespace, ds.Name, err)
+			continue
+		}
+		targets = append(targets, daemonSetIdent{
+			namespace: ds.Namespace,
+			dsName:    ds.Name,
+			label:     selector.String(),
+		})
+	}
+
+	if len(targets) != len(m.discovered.get()) {
+		klog.Infof("Discovered %d daemonsets annotated with %s", len(targets), SilenceDaemonSetAnnotation)
+	}
+	m.discovered.set(targets)
+	m.syncEvictionWatches()
+}
+
+// startDiscovery discovers annotated DaemonSets now and then periodically
+func (m *SilenceManager) startDiscovery(ctx context.Context) {
+	m.discoverDaemonSets(ctx)
+
+	go func() {
+		ticker := time.NewTicker(discoveryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.discoverDaemonSets(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,177 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+const (
+	// failoverThreshold is the number of consecutive failures after which
+	// requests move to the next endpoint
+	failoverThreshold = 3
+	// healthCheckInterval is how often all endpoints are probed
+	healthCheckInterval = 30 * time.Second
+)
+
+type endpoint struct {
+	url     string
+	healthy bool
+}
+
+// endpointSet keeps the configured Alertmanager endpoints in order of
+// preference and picks the one requests are sent to. The first endpoint is
+// the primary, the others are used when it fails repeatedly
+type endpointSet struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	active    int
+	failures  int
+}
+
+func newEndpointSet(urls []string) *endpointSet {
+	set := &endpointSet{}
+	for _, url := range urls {
+		set.endpoints = append(set.endpoints, &endpoint{url: url, healthy: true})
+		metrics.AlertmanagerEndpointUp.WithLabelValues(url).Set(1)
+		metrics.AlertmanagerEndpointActive.WithLabelValues(url).Set(0)
+	}
+	metrics.AlertmanagerEndpointActive.WithLabelValues(set.endpoints[0].url).Set(1)
+	return set
+}
+
+// Active returns the base URL requests should currently be sent to
+func (s *endpointSet) Active() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endpoints[s.active].url
+}
+
+// Report records the outcome of a request sent to url
+func (s *endpointSet) Report(url string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.endpoints[s.active].url != url {
+		return
+	}
+	if ok {
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if s.failures >= failoverThreshold && len(s.endpoints) > 1 {
+		s.endpoints[s.active].healthy = false
+		metrics.AlertmanagerEndpointUp.WithLabelValues(url).Set(0)
+		s.switchTo(s.next())
+	}
+}
+
+// next returns the first healthy endpoint after the active one, in order of
+// preference, or simply the following one if none is known to be healthy
+func (s *endpointSet) next() int {
+	for i := 1; i < len(s.endpoints); i++ {
+		candidate := (s.active + i) % len(s.endpoints)
+		if s.endpoints[candidate].healthy {
+			return candidate
+		}
+	}
+	return (s.active + 1) % len(s.endpoints)
+}
+
+// switchTo makes the endpoint at index active, the lock must be held
+func (s *endpointSet) switchTo(index int) {
+	if index == s.active {
+		return
+	}
+
+	from, to := s.endpoints[s.active].url, s.endpoints[index].url
+	klog.Warningf("Switching Alertmanager endpoint from %s to %s", from, to)
+	metrics.AlertmanagerEndpointActive.WithLabelValues(from).Set(0)
+	metrics.AlertmanagerEndpointActive.WithLabelValues(to).Set(1)
+	metrics.AlertmanagerFailovers.Inc()
+
+	s.active = index
+	s.failures = 0
+}
+
+// setHealth records the result of a health check and fails back to the most
+// preferred healthy endpoint
+func (s *endpointSet) setHealth(index int, healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endpoints[index].healthy = healthy
+	if healthy {
+		metrics.AlertmanagerEndpointUp.WithLabelValues(s.endpoints[index].url).Set(1)
+	} else {
+		metrics.AlertmanagerEndpointUp.WithLabelValues(s.endpoints[index].url).Set(0)
+	}
+
+	for i, ep := range s.endpoints {
+		if ep.healthy {
+			if i < s.active || !s.endpoints[s.active].healthy {
+				s.switchTo(i)
+			}
+			return
+		}
+	}
+}
+
+// checkHealth probes every endpoint once
+func (c *Client) checkHealth(ctx context.Context) {
+	for i, ep := range c.endpoints.endpoints {
+		c.endpoints.setHealth(i, c.probe(ctx, ep.url) == nil)
+	}
+}
+
+func (c *Client) probe(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/-/healthy", url), nil)
+	if err != nil {
+		return err
+	}
+	authorization, err := c.auth.header()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Start periodically health checks the endpoints when more than one is configured
+func (c *Client) Start(ctx context.Context) {
+	if len(c.endpoints.endpoints) < 2 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.checkHealth(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,223 @@
+package alertmanager
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/state"
+)
+
+const reasonRolloutEscalated = "RolloutEscalated"
+
+// escalateRollouts deletes the silences of nodes which have been rolling
+// longer than MaxRolloutDuration, so their alerts fire, and records them in
+// escalated so they aren't silenced again until their rollout ends. Maintenance
+// windows and manual silences aren't rollouts and are kept. The lock must be held
+func (m *SilenceManager) escalateRollouts(ctx context.Context, now time.Time) {
+	if m.options.MaxRolloutDuration <= 0 {
+		return
+	}
+	escalated := false
+	for node := range m.rolling {
+		if _, ok := m.maintenanceUntil(node); ok {
+			continue
+		}
+		if _, ok := m.escalatedSince(node); ok {
+			continue
+		}
+		startedAt, ok := m.rollouts[node]
+		if !ok || now.Sub(startedAt) < m.options.MaxRolloutDuration {
+			continue
+		}
+
+		m.escalated[node] = now
+		escalated = true
+		metrics.RolloutsEscalated.Inc()
+		klog.InfoS("Rollout exceeded the maximum duration, deleting the silences of the node", "action", "escalate", "node", node, "startedAt", startedAt.Format(time.RFC3339))
+		if m.options.Recorder != nil {
+			m.options.Recorder.Eventf(nodeRef(node), corev1.EventTypeWarning, reasonRolloutEscalated, "Rolling since %s, longer than %s: silences deleted until the rollout ends", startedAt.Format(time.RFC3339), m.options.MaxRolloutDuration)
+		}
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			// Left to the reconciliation and the garbage collection
+			klog.ErrorS(err, "Failed to delete the silences of the escalated node", "action", "escalate", "node", node)
+		}
+	}
+	if escalated {
+		// Nodes without silences, e.g. force-unsilenced ones, aren't persisted by unsilenceNode
+		m.persist(ctx)
+	}
+}
+
+// startRollout records when the rollout of a node started, unless it's known
+// from before a restart. Silences restored from Alertmanager time it by their
+// start. The lock must be held
+func (m *SilenceManager) startRollout(nodeName string) {
+	if _, ok := m.rollouts[nodeName]; ok {
+		return
+	}
+	if startedAt, ok := m.activeSilences.StartedAt(nodeName); ok {
+		m.rollouts[nodeName] = startedAt
+		return
+	}
+	m.rollouts[nodeName] = time.Now()
+}
+
+// restoreRollouts loads the rollouts persisted before a restart, so an
+// escalated rollout, whose silences are gone, stays escalated and isn't timed
+// again, and finished nodes are still verified before their silences are
+// deleted. The lock must be held
+func (m *SilenceManager) restoreRollouts(ctx context.Context) {
+	store, ok := m.store.(state.RolloutStore)
+	if !ok {
+		return
+	}
+	rollouts, err := store.LoadRollouts(ctx)
+	if err != nil {
+		klog.Warningf("Failed to load persisted rollouts: %v", err)
+		return
+	}
+	for node, rollout := range rollouts {
+		// Nodes which finished rolling have no start
+		if startedAt, ok := m.rollouts[node]; !rollout.StartedAt.IsZero() && (!ok || rollout.StartedAt.Before(startedAt)) {
+			m.rollouts[node] = rollout.StartedAt
+		}
+		if rollout.EscalatedAt != nil {
+			m.escalated[node] = *rollout.EscalatedAt
+		}
+		// Without the checks configured anymore the garbage collection unsilences the node
+		if rollout.VerifyingSince != nil && m.options.Verifier != nil {
+			m.verifying[node] = *rollout.VerifyingSince
+		}
+		if rollout.TargetsSince != nil && m.targetsTimeout() > 0 {
+			m.targets[node] = *rollout.TargetsSince
+		}
+	}
+	m.savedRollouts = rollouts
+	if len(rollouts) > 0 {
+		klog.Infof("Restored the rollouts of %d nodes", len(rollouts))
+	}
+}
+
+// PruneRollouts forgets the rollouts and escalations of nodes the watcher
+// polled as not rolling, e.g. restored after a restart although the rollout
+// ended while the helper was down, so a new rollout of the node is silenced
+// and timed again. Nodes still tracked as rolling are left to their queued
+// change. It's meant to be called after every poll of the watcher
+func (m *SilenceManager) PruneRollouts(ctx context.Context, rolling map[string]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held.Load() {
+		return
+	}
+	pruned := false
+	for node := range m.rollouts {
+		if _, ok := m.rolling[node]; ok || rolling[node] {
+			continue
+		}
+		klog.V(2).Infof("Forgetting the rollout of node %s, it isn't rolling", node)
+		delete(m.rollouts, node)
+		delete(m.escalated, node)
+		pruned = true
+	}
+	for node := range m.escalated {
+		if _, ok := m.rolling[node]; ok || rolling[node] {
+			continue
+		}
+		delete(m.escalated, node)
+		pruned = true
+	}
+	if pruned {
+		m.persist(ctx)
+	}
+}
+
+// persistRollouts saves the rollouts and the finished nodes being verified
+// or waiting for their scrape targets if they changed since they were last
+// saved, the lock must be held
+func (m *SilenceManager) persistRollouts(ctx context.Context) {
+	store, ok := m.store.(state.RolloutStore)
+	if !ok || m.held.Load() {
+		return
+	}
+	rollouts := make(map[string]state.Rollout, len(m.rollouts))
+	for node, startedAt := range m.rollouts {
+		rollout := state.Rollout{StartedAt: startedAt.UTC().Truncate(time.Second)}
+		if at, ok := m.escalated[node]; ok {
+			rollout.EscalatedAt = persistedTime(at)
+		}
+		rollouts[node] = rollout
+	}
+	for node, since := range m.verifying {
+		rollout := rollouts[node]
+		rollout.VerifyingSince = persistedTime(since)
+		rollouts[node] = rollout
+	}
+	for node, since := range m.targets {
+		rollout := rollouts[node]
+		rollout.TargetsSince = persistedTime(since)
+		rollouts[node] = rollout
+	}
+	if sameRollouts(rollouts, m.savedRollouts) {
+		return
+	}
+	if err := store.SaveRollouts(ctx, rollouts); err != nil {
+		klog.Errorf("Failed to persist rollouts: %v", err)
+		return
+	}
+	m.savedRollouts = rollouts
+}
+
+// persistedTime returns t as it's persisted, in UTC to the second
+func persistedTime(t time.Time) *time.Time {
+	t = t.UTC().Truncate(time.Second)
+	return &t
+}
+
+// sameRollouts reports whether a and b record the same rollouts
+func sameRollouts(a, b map[string]state.Rollout) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for node, rollout := range a {
+		other, ok := b[node]
+		if !ok || !rollout.StartedAt.Equal(other.StartedAt) {
+			return false
+		}
+		if !sameTime(rollout.EscalatedAt, other.EscalatedAt) || !sameTime(rollout.VerifyingSince, other.VerifyingSince) || !sameTime(rollout.TargetsSince, other.TargetsSince) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameTime reports whether a and b are both unset or the same time
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Escalated returns the rolling nodes whose silences were deleted after
+// MaxRolloutDuration and when
+func (m *SilenceManager) Escalated() map[string]time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	escalated := make(map[string]time.Time, len(m.escalated))
+	for node, at := range m.escalated {
+		escalated[node] = at
+	}
+	return escalated
+}
+
+// escalatedSince returns when the rollout of a node was escalated, the lock must be held
+func (m *SilenceManager) escalatedSince(nodeName string) (time.Time, bool) {
+	since, ok := m.escalated[nodeName]
+	return since, ok
+}
@@ -0,0 +1,149 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/state"
+	"rollout-helper/internal/verify"
+)
+
+func TestEscalationSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	clientset := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}})
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		return true, &authorizationv1.SelfSubjectAccessReview{Status: authorizationv1.SubjectAccessReviewStatus{Allowed: true}}, nil
+	})
+	store := state.NewConfigMapStore(clientset, "rollout-helper", "rollout-helper-state")
+	options := Options{SilenceDuration: time.Hour, MaxRolloutDuration: time.Hour}
+	start := func() *SilenceManager {
+		return NewSilenceManager(NewClient([]string{am.URL()}, ""), clientset, &config.Config{}, store, options)
+	}
+
+	m := start()
+	if err := m.HandleNodeState(ctx, "worker-0", true, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to silence the rolling node: %v", err)
+	}
+	if am.ActiveSilences() == 0 {
+		t.Fatal("Expected silences for the rolling node")
+	}
+	m.mu.Lock()
+	startedAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	m.rollouts["worker-0"] = startedAt
+	m.escalateRollouts(ctx, time.Now())
+	m.mu.Unlock()
+	if am.ActiveSilences() != 0 {
+		t.Fatalf("Expected the silences of the escalated node to be deleted, %d are active", am.ActiveSilences())
+	}
+
+	// The node still rolls when the restarted helper's watcher reports it
+	m = start()
+	if err := m.HandleNodeState(ctx, "worker-0", true, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to handle the rolling node: %v", err)
+	}
+	if am.ActiveSilences() != 0 {
+		t.Fatalf("Expected the escalated node to stay unsilenced after a restart, %d silences are active", am.ActiveSilences())
+	}
+	if _, ok := m.Escalated()["worker-0"]; !ok {
+		t.Error("Expected the node to stay escalated after a restart")
+	}
+	m.mu.Lock()
+	restored := m.rollouts["worker-0"]
+	m.mu.Unlock()
+	if !restored.Equal(startedAt) {
+		t.Errorf("Expected the rollout to be timed from %s, got %s", startedAt, restored)
+	}
+
+	if err := m.HandleNodeState(ctx, "worker-0", false, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to handle the finished node: %v", err)
+	}
+	m.mu.Lock()
+	m.persist(ctx)
+	m.mu.Unlock()
+	rollouts, err := store.LoadRollouts(ctx)
+	if err != nil {
+		t.Fatalf("Failed to load the rollouts: %v", err)
+	}
+	if len(rollouts) != 0 {
+		t.Errorf("Expected the finished rollout to be forgotten, got %v", rollouts)
+	}
+}
+
+func TestRestoredRolloutsArePruned(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	clientset := fake.NewSimpleClientset()
+	store := state.NewConfigMapStore(clientset, "rollout-helper", "rollout-helper-state")
+	escalatedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	if err := store.SaveRollouts(ctx, map[string]state.Rollout{
+		"worker-0": {StartedAt: escalatedAt.Add(-time.Hour), EscalatedAt: &escalatedAt},
+	}); err != nil {
+		t.Fatalf("Failed to save the rollouts: %v", err)
+	}
+
+	// Without a garbage collection, the watcher's poll prunes the rollout
+	options := Options{SilenceDuration: time.Hour, MaxRolloutDuration: time.Hour}
+	m := NewSilenceManager(NewClient([]string{am.URL()}, ""), clientset, &config.Config{}, store, options)
+	if _, ok := m.Escalated()["worker-0"]; !ok {
+		t.Fatal("Expected the persisted escalation to be restored")
+	}
+
+	// The node finished rolling while the helper was down and isn't polled as rolling
+	m.PruneRollouts(ctx, map[string]bool{"worker-1": true})
+	if len(m.Escalated()) != 0 {
+		t.Errorf("Expected the escalation of a node which isn't rolling to be dropped, got %v", m.Escalated())
+	}
+	rollouts, err := store.LoadRollouts(ctx)
+	if err != nil {
+		t.Fatalf("Failed to load the rollouts: %v", err)
+	}
+	if len(rollouts) != 0 {
+		t.Errorf("Expected the stale rollout to be forgotten, got %v", rollouts)
+	}
+}
+
+func TestVerificationSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	clientset := fake.NewSimpleClientset(workerNode("worker-1", nil, nil))
+	store := state.NewConfigMapStore(clientset, "rollout-helper", "rollout-helper-state")
+	options := Options{Verifier: verify.NewVerifier(clientset, verify.Options{})}
+
+	m := newEvictionManager(t, am.URL(), clientset, store, options)
+	if err := m.HandleNodeState(ctx, "worker-1", true, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to silence the node: %v", err)
+	}
+	if err := m.HandleNodeState(ctx, "worker-1", false, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to handle the end of the rollout: %v", err)
+	}
+	since, ok := m.Verifying()["worker-1"]
+	if !ok {
+		t.Fatal("Expected the node to be verified after its rollout")
+	}
+
+	// The restarted helper still verifies the node instead of collecting its silences
+	m = newEvictionManager(t, am.URL(), clientset, store, options)
+	if restored, ok := m.Verifying()["worker-1"]; !ok || !restored.Equal(since.UTC().Truncate(time.Second)) {
+		t.Fatalf("Expected the verification started at %s to be restored, got %v", since, m.Verifying())
+	}
+	if !m.keepsSilences("worker-1") {
+		t.Error("Expected the node being verified to keep its silences after a restart")
+	}
+	if _, rolling := m.rollouts["worker-1"]; rolling {
+		t.Error("Expected the finished node not to be restored as rolling")
+	}
+}
@@ -0,0 +1,143 @@
+package alertmanager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/notify"
+)
+
+// Reasons of the events recorded on nodes
+const (
+	reasonSilenceCreated  = notify.ReasonSilenceCreated
+	reasonSilenceExtended = notify.ReasonSilenceExtended
+	reasonSilenceDeleted  = notify.ReasonSilenceDeleted
+	reasonSilenceFailed   = notify.ReasonSilenceFailed
+)
+
+// Silence operations reported in metrics and events
+const (
+	operationCreate = "create"
+	operationDelete = "delete"
+	operationExtend = "extend"
+)
+
+// nodeRef references a node for events. Like the kubelet, the node name is
+// used as UID so events show up in `oc describe node`
+func nodeRef(nodeName string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind: "Node",
+		Name: nodeName,
+		UID:  types.UID(nodeName),
+	}
+}
+
+// NodeError is the last silence operation which failed for a node
+type NodeError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// nodeErrors keeps the last failure of every node until its silences are deleted
+type nodeErrors struct {
+	mu     sync.Mutex
+	errors map[string]NodeError
+}
+
+func (e *nodeErrors) set(nodeName string, err NodeError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.errors == nil {
+		e.errors = make(map[string]NodeError)
+	}
+	e.errors[nodeName] = err
+}
+
+func (e *nodeErrors) clear(nodeName string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.errors, nodeName)
+}
+
+// LastErrors returns the last failed silence operation of nodes whose silences weren't deleted since
+func (m *SilenceManager) LastErrors() map[string]NodeError {
+	m.failures.mu.Lock()
+	defer m.failures.mu.Unlock()
+
+	errors := make(map[string]NodeError, len(m.failures.errors))
+	for node, err := range m.failures.errors {
+		errors[node] = err
+	}
+	return errors
+}
+
+// recordFailure surfaces a silence operation which failed after all retries.
+// While the circuit breaker is open only the node's last error is updated,
+// the outage was already reported once by circuitChanged
+func (m *SilenceManager) recordFailure(nodeName, operation string, err error) {
+	metrics.SilenceOperationFailures.WithLabelValues(operation).Inc()
+	m.failures.set(nodeName, NodeError{Message: fmt.Sprintf("failed to %s silence: %v", operation, err), Time: time.Now()})
+	m.options.Audit.Record(audit.Entry{Node: nodeName, Action: audit.ActionFailed, Message: fmt.Sprintf("failed to %s silence: %v", operation, err)})
+	if errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	if m.options.Recorder != nil {
+		m.options.Recorder.Eventf(nodeRef(nodeName), corev1.EventTypeWarning, reasonSilenceFailed, "Failed to %s silence: %v", operation, err)
+	}
+	m.options.Notifier.Notify(notify.Event{
+		Kind:    notify.KindSilenceFailed,
+		Node:    nodeName,
+		Message: fmt.Sprintf("Failed to %s silence: %v", operation, err),
+	})
+	m.options.Lifecycle.Fire(notify.LifecycleEvent{
+		Reason:  reasonSilenceFailed,
+		Node:    nodeName,
+		Message: fmt.Sprintf("Failed to %s silence: %v", operation, err),
+	})
+}
+
+// circuitChanged notifies about Alertmanager becoming unavailable or recovering
+func (m *SilenceManager) circuitChanged(status CircuitStatus) {
+	if status.State == CircuitClosed {
+		m.options.Notifier.Notify(notify.Event{
+			Kind:    notify.KindAlertmanagerRecovered,
+			Message: "Alertmanager requests succeed again, silences are managed as usual",
+		})
+		return
+	}
+	m.options.Notifier.Notify(notify.Event{
+		Kind:    notify.KindAlertmanagerUnavailable,
+		Message: fmt.Sprintf("Too many Alertmanager requests failed, silences can't be created, extended or deleted until it recovers: %s", status.LastError),
+	})
+}
+
+// recordPolicyEvent records an event about a silence of a policy on the
+// object which declared it, if any
+func (m *SilenceManager) recordPolicyEvent(policyName, eventType, reason, messageFmt string, args ...interface{}) {
+	if m.options.Recorder == nil || policyName == "" {
+		return
+	}
+	if owner := m.policyOwner(policyName); owner != nil {
+		m.options.Recorder.Eventf(owner, eventType, reason, messageFmt, args...)
+	}
+}
+
+// recordEvent records a normal silence lifecycle event on a node and posts
+// it to the lifecycle webhook
+func (m *SilenceManager) recordEvent(nodeName, reason, messageFmt string, args ...interface{}) {
+	if m.options.Recorder != nil {
+		m.options.Recorder.Eventf(nodeRef(nodeName), corev1.EventTypeNormal, reason, messageFmt, args...)
+	}
+	m.options.Lifecycle.Fire(notify.LifecycleEvent{
+		Reason:  reason,
+		Node:    nodeName,
+		Message: fmt.Sprintf(messageFmt, args...),
+	})
+}
@@ -0,0 +1,48 @@
+package alertmanager
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+)
+
+func TestPolicyEventsRecordedOnOwner(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	recorder := record.NewFakeRecorder(20)
+	recorder.IncludeObject = true
+	m := newEvictionManager(t, am.URL(), fake.NewSimpleClientset(workerNode("worker-1", nil, nil)), nil, Options{Recorder: recorder})
+
+	policies := []config.Policy{{Name: "ingress", Matchers: []config.Matcher{{Name: "node", Value: "{{ .NodeName }}"}}}}
+	if err := config.CompilePolicies(policies); err != nil {
+		t.Fatal(err)
+	}
+	owner := &corev1.ObjectReference{APIVersion: "rollout-helper.snappcloud.io/v1alpha1", Kind: "RolloutSilencePolicy", Name: "team-a"}
+	m.SetDeclared(policies, nil, map[string]*corev1.ObjectReference{"ingress": owner})
+
+	if err := m.HandleNodeState(ctx, "worker-1", true, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to silence the node: %v", err)
+	}
+	if err := m.HandleNodeState(ctx, "worker-1", false, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to unsilence the node: %v", err)
+	}
+
+	var reasons []string
+	for len(recorder.Events) > 0 {
+		event := <-recorder.Events
+		if strings.Contains(event, "kind=RolloutSilencePolicy") {
+			reasons = append(reasons, strings.Fields(event)[1])
+		}
+	}
+	if strings.Join(reasons, ",") != reasonSilenceCreated+","+reasonSilenceDeleted {
+		t.Errorf("Expected the creation and deletion of the policy's silence to be recorded on its object, got %v", reasons)
+	}
+}
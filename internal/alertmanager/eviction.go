@@ -0,0 +1,293 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/watcher"
+)
+
+// evictedPods are the pods of a daemonset evicted from a node which isn't
+// rolling, e.g. by a drain outside the MCO, and their replacements. They're
+// silenced until endsAt
+type evictedPods struct {
+	node string
+	// daemonSet is the namespace and name of the daemonset
+	daemonSet string
+	endsAt    time.Time
+	// silenced are the UIDs of the pods silenced so far
+	silenced map[types.UID]bool
+	ids      []string
+}
+
+// podEvent is a pod of a silenced daemonset which was added or changed
+type podEvent struct {
+	target daemonSetIdent
+	pod    *corev1.Pod
+}
+
+// evictionWatches are the pod informers of the silenced daemonsets, they're
+// synced with the targets when those may have changed
+type evictionWatches struct {
+	mu sync.Mutex
+	// ctx is the context the informers run in, nil until they're started
+	ctx context.Context
+	// cancel maps the watched targets to the functions stopping their informers
+	cancel map[daemonSetIdent]context.CancelFunc
+	events chan podEvent
+}
+
+// startEvictionWatches silences the pods of the silenced daemonsets which
+// are evicted from nodes which aren't rolling, until ctx is cancelled
+func (m *SilenceManager) startEvictionWatches(ctx context.Context) {
+	m.watches.mu.Lock()
+	m.watches.ctx = ctx
+	m.watches.cancel = make(map[daemonSetIdent]context.CancelFunc)
+	m.watches.events = make(chan podEvent, 100)
+	m.watches.mu.Unlock()
+	m.syncEvictionWatches()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-m.watches.events:
+				m.handlePodEvent(ctx, event.target, event.pod, time.Now())
+			}
+		}
+	}()
+}
+
+// syncEvictionWatches starts the informers of new targets in accessible
+// namespaces and stops those of targets which are gone or became inaccessible
+func (m *SilenceManager) syncEvictionWatches() {
+	m.watches.mu.Lock()
+	defer m.watches.mu.Unlock()
+	if m.watches.ctx == nil {
+		return
+	}
+
+	wanted := make(map[daemonSetIdent]bool)
+	for _, target := range m.podTargets() {
+		if m.options.Namespaces.Contains(target.namespace) && m.access.Allowed(target.namespace) {
+			wanted[target] = true
+		}
+	}
+	for target, cancel := range m.watches.cancel {
+		if !wanted[target] {
+			cancel()
+			delete(m.watches.cancel, target)
+		}
+	}
+	for target := range wanted {
+		if _, ok := m.watches.cancel[target]; !ok {
+			m.watches.cancel[target] = m.watchPods(target)
+		}
+	}
+}
+
+// watchPods starts an informer on the pods of a target which queues the pods
+// it adds or changes, and returns the function stopping it
+func (m *SilenceManager) watchPods(target daemonSetIdent) context.CancelFunc {
+	ctx, cancel := context.WithCancel(m.watches.ctx)
+	pods := m.k8sClient.CoreV1().Pods(target.namespace)
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = target.label
+			return pods.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = target.label
+			return pods.Watch(ctx, options)
+		},
+	}, &corev1.Pod{}, 0, cache.Indexers{})
+
+	informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		if apierrors.IsForbidden(err) {
+			// Watched again once an access check grants the namespace
+			m.access.Deny(target.namespace, err)
+			go m.syncEvictionWatches()
+			return
+		}
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+	queue := func(obj interface{}) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return
+		}
+		select {
+		case m.watches.events <- podEvent{target: target, pod: pod}:
+		case <-ctx.Done():
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    queue,
+		UpdateFunc: func(_, obj interface{}) { queue(obj) },
+	})
+	go informer.Run(ctx.Done())
+	return cancel
+}
+
+// handlePodEvent silences a pod of a target being evicted from a node which
+// isn't rolling, and the pods replacing it on the node until the first
+// silence ends. Pods of rolling nodes are covered by their pod silence, pods
+// of nodes outside Options.NodeSelector or opted out of silencing aren't
+// silenced. The lock isn't held while the node is checked and the silence is
+// created
+func (m *SilenceManager) handlePodEvent(ctx context.Context, target daemonSetIdent, pod *corev1.Pod, now time.Time) {
+	nodeName := pod.Spec.NodeName
+	if nodeName == "" || m.held.Load() {
+		return
+	}
+	key := evictionKey(nodeName, target)
+
+	m.mu.Lock()
+	for key, evicted := range m.evictions {
+		if !evicted.endsAt.After(now) {
+			delete(m.evictions, key)
+		}
+	}
+	_, rolling := m.rolling[nodeName]
+	evicted, tracked := m.evictions[key]
+	endsAt := now.Add(m.options.EvictionSilenceDuration)
+	if tracked {
+		endsAt = evicted.endsAt
+	}
+	silence := !rolling && (tracked && !evicted.silenced[pod.UID] || !tracked && podEvicted(pod))
+	m.mu.Unlock()
+	if !silence || !m.silencesEvictions(ctx, nodeName) {
+		return
+	}
+
+	id, note, err := m.silenceEvicted(ctx, nodeName, target, pod, endsAt.Sub(now))
+
+	m.mu.Lock()
+	if err == nil && m.held.Load() {
+		// Stopped or taken over by another version while the silence was created
+		m.mu.Unlock()
+		if err := m.amClient.DeleteSilenceID(ctx, id); err != nil {
+			klog.ErrorS(err, "Failed to delete eviction silence", "action", "delete", "silenceID", id)
+		}
+		return
+	}
+	defer m.mu.Unlock()
+	if err != nil {
+		klog.ErrorS(err, "Failed to silence evicted pods", "action", "create", "node", nodeName, "pod", pod.Name)
+		m.recordFailure(nodeName, operationCreate, err)
+		return
+	}
+
+	evicted = m.trackEviction(nodeName, target.namespace+"/"+target.dsName, endsAt)
+	evicted.silenced[pod.UID] = true
+	evicted.addID(id)
+	m.persistDetached(ctx)
+	duration := endsAt.Sub(now)
+	klog.InfoS("Silenced evicted daemonset pods", "action", "evict", "node", nodeName, "daemonset", target.namespace+"/"+target.dsName,
+		"pod", pod.Name, "silenceID", id, "duration", duration.Round(time.Second))
+	metrics.EvictionSilences.Inc()
+	m.options.Audit.Record(audit.Entry{Node: nodeName, Action: audit.ActionCreated, SilenceID: id, Kind: string(KindEviction), Until: timePtr(endsAt), Message: note})
+	m.recordEvent(nodeName, reasonSilenceCreated, "Silenced evicted pods for %s, %s: %s", duration.Round(time.Second), note, id)
+}
+
+// silencesEvictions reports whether the evicted pods of a node are silenced
+// by this instance: the node is selected by Options.NodeSelector and didn't
+// opt out of silencing with an authorized ignore annotation
+func (m *SilenceManager) silencesEvictions(ctx context.Context, nodeName string) bool {
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the node of evicted pods", "action", "evict", "node", nodeName)
+		return false
+	}
+	if !m.selectsNode(node) {
+		return false
+	}
+	if node.Annotations[watcher.IgnoreAnnotation] != "true" {
+		return true
+	}
+	object := authz.Object{Kind: "Node", Name: nodeName}
+	if err := authz.Check(m.options.Authorizer, object, node.Annotations, watcher.IgnoreAnnotation); err != nil {
+		klog.Warningf("Ignoring annotation of node %s: %v", nodeName, err)
+		return true
+	}
+	klog.V(2).Infof("Not silencing evicted pods of node %s, it's annotated with %s", nodeName, watcher.IgnoreAnnotation)
+	return false
+}
+
+// trackEviction returns the evicted pods of a daemonset on a node, tracking
+// them until endsAt if they aren't yet. The lock must be held
+func (m *SilenceManager) trackEviction(nodeName, daemonSet string, endsAt time.Time) *evictedPods {
+	key := nodeName + "/" + daemonSet
+	evicted, tracked := m.evictions[key]
+	if !tracked {
+		evicted = &evictedPods{node: nodeName, daemonSet: daemonSet, endsAt: endsAt, silenced: make(map[types.UID]bool)}
+		m.evictions[key] = evicted
+	}
+	return evicted
+}
+
+// addID records a silence of the pods, reused silences are recorded once
+func (e *evictedPods) addID(id string) {
+	for _, existing := range e.ids {
+		if existing == id {
+			return
+		}
+	}
+	e.ids = append(e.ids, id)
+}
+
+// podEvicted reports whether a pod is being evicted through the eviction API,
+// which sets the DisruptionTarget condition
+func podEvicted(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.DisruptionTarget && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func evictionKey(nodeName string, target daemonSetIdent) string {
+	return nodeName + "/" + target.namespace + "/" + target.dsName
+}
+
+// silenceEvicted creates the silence of a pod of a daemonset evicted from a
+// node, or which replaces an evicted one, and returns it with its note
+func (m *SilenceManager) silenceEvicted(ctx context.Context, nodeName string, target daemonSetIdent, pod *corev1.Pod, duration time.Duration) (string, string, error) {
+	matchers := models.Matchers{
+		{Name: stringPtr("namespace"), Value: stringPtr(target.namespace), IsRegex: boolPtr(false)},
+		{Name: stringPtr("pod"), Value: stringPtr(pod.Name), IsRegex: boolPtr(false)},
+	}
+	note := fmt.Sprintf("pods of daemonset %s/%s evicted: %s", target.namespace, target.dsName, pod.Name)
+	id, err := m.amClient.CreateSilenceWithNote(ctx, matchers, nodeName, KindEviction, duration, note)
+	return id, note, err
+}
+
+// evictionIDs returns the silences of evicted pods which haven't expired
+// yet, they aren't tracked with the silences of nodes. The lock must be held
+func (m *SilenceManager) evictionIDs() []string {
+	now := time.Now()
+	var ids []string
+	for _, evicted := range m.evictions {
+		if evicted.endsAt.After(now) {
+			ids = append(ids, evicted.ids...)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,161 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/state"
+	"rollout-helper/internal/watcher"
+)
+
+var exporterTarget = daemonSetIdent{namespace: "monitoring", dsName: "node-exporter", label: "app=node-exporter"}
+
+func exporterPod(name, nodeName string, evicted bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "monitoring", UID: types.UID(name), Labels: map[string]string{"app": "node-exporter"}},
+		Spec:       corev1.PodSpec{NodeName: nodeName},
+	}
+	if evicted {
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue}}
+	}
+	return pod
+}
+
+func workerNode(name string, labels, annotations map[string]string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+}
+
+func newEvictionManager(t *testing.T, amURL string, clientset *fake.Clientset, store state.Store, options Options) *SilenceManager {
+	t.Helper()
+	options.SilenceDuration = time.Hour
+	options.EvictionSilenceDuration = 10 * time.Minute
+	options.DisableBuiltinTargets = true
+	options.DisableInfraSilences = true
+	return NewSilenceManager(NewClient([]string{amURL}, ""), clientset, &config.Config{}, store, options)
+}
+
+func TestEvictionSilences(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	var m *SilenceManager
+	// Node states are handled while a silence is created
+	var locked atomic.Bool
+	target, err := url.Parse(am.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if m.mu.TryLock() {
+				m.mu.Unlock()
+			} else {
+				locked.Store(true)
+			}
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	clientset := fake.NewSimpleClientset(workerNode("worker-1", nil, nil), workerNode("worker-2", nil, nil))
+	m = newEvictionManager(t, server.URL, clientset, nil, Options{})
+	now := time.Now()
+
+	// Pods which aren't evicted aren't silenced
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-a", "worker-1", false), now)
+	if am.ActiveSilences() != 0 {
+		t.Fatalf("Expected no silence for a running pod, %d are active", am.ActiveSilences())
+	}
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-a", "worker-1", true), now)
+	if am.ActiveSilences() != 1 {
+		t.Fatalf("Expected the evicted pod to be silenced, %d silences are active", am.ActiveSilences())
+	}
+	if locked.Load() {
+		t.Error("The lock is held while the eviction silence is created")
+	}
+
+	// The replacement on the same node is silenced until the first silence ends
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-b", "worker-1", false), now.Add(time.Minute))
+	if am.ActiveSilences() != 2 {
+		t.Fatalf("Expected the replacement to be silenced, %d silences are active", am.ActiveSilences())
+	}
+	evicted := m.evictions[evictionKey("worker-1", exporterTarget)]
+	if evicted == nil || len(evicted.ids) != 2 || !evicted.silenced["node-exporter-b"] || !evicted.endsAt.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("Expected the evicted pod and its replacement to be tracked until the first silence ends, got %+v", evicted)
+	}
+
+	// Pods of rolling nodes are covered by their pod silence
+	m.rolling["worker-2"] = KindPoolUpdate
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-c", "worker-2", true), now)
+	if am.ActiveSilences() != 2 {
+		t.Errorf("Expected no silence for a pod evicted from a rolling node, %d are active", am.ActiveSilences())
+	}
+}
+
+func TestEvictionSkipsUnmanagedNodes(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	selector, err := labels.Parse("node-role.kubernetes.io/worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker := map[string]string{"node-role.kubernetes.io/worker": ""}
+	clientset := fake.NewSimpleClientset(
+		workerNode("infra-0", map[string]string{"node-role.kubernetes.io/infra": ""}, nil),
+		workerNode("worker-0", worker, map[string]string{watcher.IgnoreAnnotation: "true"}),
+	)
+	m := newEvictionManager(t, am.URL(), clientset, nil, Options{NodeSelector: selector})
+
+	// Silences of another instance's node would be expired by its reconciliation
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-a", "infra-0", true), time.Now())
+	// The node opted out of silencing
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-b", "worker-0", true), time.Now())
+	if am.ActiveSilences() != 0 || len(m.evictions) != 0 {
+		t.Errorf("Expected no silence for pods of unmanaged nodes, %d are active", am.ActiveSilences())
+	}
+}
+
+func TestEvictionSilenceSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	clientset := fake.NewSimpleClientset(workerNode("worker-1", nil, nil))
+	store := state.NewConfigMapStore(clientset, "rollout-helper", "rollout-helper-state")
+
+	m := newEvictionManager(t, am.URL(), clientset, store, Options{})
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-a", "worker-1", true), time.Now())
+	evicted := am.ActiveSilenceIDs()
+	if len(evicted) != 1 {
+		t.Fatalf("Expected the evicted pod to be silenced, got %v", evicted)
+	}
+
+	m = newEvictionManager(t, am.URL(), clientset, store, Options{})
+	if err := m.reconcile(ctx); err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	for id := range evicted {
+		if !am.ActiveSilenceIDs()[id] {
+			t.Errorf("Expected the eviction silence %s to survive a restart", id)
+		}
+	}
+	// The replacement of the evicted pod is still silenced after the restart
+	m.handlePodEvent(ctx, exporterTarget, exporterPod("node-exporter-b", "worker-1", false), time.Now())
+	if am.ActiveSilences() != 2 {
+		t.Errorf("Expected the replacement to be silenced after a restart, %d silences are active", am.ActiveSilences())
+	}
+}
@@ -0,0 +1,144 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// CoveringSilence is a silence of the helper which covers an alert
+type CoveringSilence struct {
+	ID   string      `json:"id"`
+	Kind SilenceKind `json:"kind,omitempty"`
+	// Policy is the silence policy or built-in template the silence was created from
+	Policy string `json:"policy,omitempty"`
+	// Node is the rolling node the silence was created for
+	Node string `json:"node"`
+	// RolloutStartedAt is when the node's first silence of the rollout was created
+	RolloutStartedAt time.Time `json:"rolloutStartedAt"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	Matchers         []string  `json:"matchers"`
+	// Assumed are the labels the silence matches on which weren't given, it
+	// only covers the alert if they match as well
+	Assumed []string `json:"assumed,omitempty"`
+}
+
+// Explain returns the tracked silences which cover an alert with the given
+// labels, e.g. alertname and node. Matchers on labels which aren't given
+// are assumed to match, so partial labels still find the candidates
+func (m *SilenceManager) Explain(ctx context.Context, labels map[string]string) ([]CoveringSilence, error) {
+	silences, err := m.amClient.OwnedSilences(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get silences: %w", err)
+	}
+	active := make(map[string]models.PostableSilence)
+	for _, silence := range silences {
+		if isOwned(silence) && !isExpired(silence) {
+			active[silence.ID] = silence
+		}
+	}
+
+	covering := []CoveringSilence{}
+	for node, tracked := range m.activeSilences.Entries() {
+		startedAt, _ := m.activeSilences.StartedAt(node)
+		for _, silence := range tracked {
+			// Broadcast silences have the same matchers on every endpoint
+			var found *models.PostableSilence
+			for _, part := range m.amClient.idParts(silence.ID) {
+				if s, ok := active[part]; ok {
+					found = &s
+					break
+				}
+			}
+			if found == nil {
+				continue
+			}
+
+			covers, assumed := matchLabels(found.Matchers, labels)
+			if !covers {
+				continue
+			}
+			covering = append(covering, CoveringSilence{
+				ID:               silence.ID,
+				Kind:             silence.Kind,
+				Policy:           silence.Policy,
+				Node:             node,
+				RolloutStartedAt: startedAt,
+				ExpiresAt:        time.Time(*found.EndsAt),
+				Matchers:         formatMatchers(found.Matchers),
+				Assumed:          assumed,
+			})
+		}
+	}
+	// Silences without assumptions are the likely answer
+	sort.Slice(covering, func(i, j int) bool {
+		if len(covering[i].Assumed) != len(covering[j].Assumed) {
+			return len(covering[i].Assumed) < len(covering[j].Assumed)
+		}
+		return covering[i].ID < covering[j].ID
+	})
+	return covering, nil
+}
+
+// matchLabels reports whether none of the matchers contradicts the labels,
+// and returns the names of the matchers whose label isn't given
+func matchLabels(matchers models.Matchers, labels map[string]string) (bool, []string) {
+	var assumed []string
+	for _, matcher := range matchers {
+		if matcher == nil {
+			continue
+		}
+		name := derefString(matcher.Name)
+		value, ok := labels[name]
+		if !ok {
+			assumed = append(assumed, name)
+			continue
+		}
+		if !matcherMatches(matcher, value) {
+			return false, nil
+		}
+	}
+	return true, assumed
+}
+
+// matcherMatches evaluates a matcher against a label value like Alertmanager,
+// regular expressions are anchored
+func matcherMatches(matcher *models.Matcher, value string) bool {
+	matches := derefString(matcher.Value) == value
+	if derefBool(matcher.IsRegex) {
+		re, err := regexp.Compile("^(?:" + derefString(matcher.Value) + ")$")
+		if err != nil {
+			return false
+		}
+		matches = re.MatchString(value)
+	}
+	if matcher.IsEqual != nil && !*matcher.IsEqual {
+		return !matches
+	}
+	return matches
+}
+
+// formatMatchers renders matchers in the PromQL-like notation of the Alertmanager UI
+func formatMatchers(matchers models.Matchers) []string {
+	formatted := make([]string, 0, len(matchers))
+	for _, matcher := range matchers {
+		if matcher == nil {
+			continue
+		}
+		op := "="
+		if matcher.IsEqual != nil && !*matcher.IsEqual {
+			op = "!"
+		}
+		if derefBool(matcher.IsRegex) {
+			op += "~"
+		} else if op == "!" {
+			op += "="
+		}
+		formatted = append(formatted, fmt.Sprintf("%s%s%q", derefString(matcher.Name), op, derefString(matcher.Value)))
+	}
+	return formatted
+}
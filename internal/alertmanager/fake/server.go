@@ -0,0 +1,293 @@
+// Package fake provides an in-memory Alertmanager implementing the subset of
+// the v2 silences and alerts API used by the rollout helper
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/pkg/labels"
+)
+
+const (
+	silenceStateActive  = "active"
+	silenceStateExpired = "expired"
+)
+
+// Server is a fake Alertmanager backed by an httptest.Server
+type Server struct {
+	server *httptest.Server
+	// Latency is added to every request to simulate a loaded Alertmanager
+	latency time.Duration
+
+	mu       sync.Mutex
+	silences map[string]*models.GettableSilence
+	alerts   models.PostableAlerts
+
+	requests atomic.Int64
+}
+
+// NewServer starts a fake Alertmanager, latency is added to every request
+func NewServer(latency time.Duration) *Server {
+	s := &Server{
+		latency:  latency,
+		silences: make(map[string]*models.GettableSilence),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/silences", s.handleSilences)
+	mux.HandleFunc("/api/v2/silence/", s.handleSilence)
+	mux.HandleFunc("/api/v2/alerts", s.handleAlerts)
+	mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	s.server = httptest.NewServer(mux)
+
+	return s
+}
+
+// URL returns the base URL of the fake Alertmanager
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Requests returns the number of requests served so far
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// ActiveSilences returns the number of silences which are not expired
+func (s *Server) ActiveSilences() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, silence := range s.silences {
+		if *silence.Status.State == silenceStateActive {
+			count++
+		}
+	}
+	return count
+}
+
+// ActiveSilenceIDs returns the IDs of the silences which are not expired
+func (s *Server) ActiveSilenceIDs() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[string]bool)
+	for id, silence := range s.silences {
+		if *silence.Status.State == silenceStateActive {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// Alerts returns the alerts posted so far, in order
+func (s *Server) Alerts() models.PostableAlerts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append(models.PostableAlerts(nil), s.alerts...)
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	time.Sleep(s.latency)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var alerts models.PostableAlerts
+	if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+		http.Error(w, fmt.Sprintf("invalid alerts: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alerts = append(s.alerts, alerts...)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleSilences(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	time.Sleep(s.latency)
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listSilences(w, r)
+	case http.MethodPost:
+		s.postSilence(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listSilences(w http.ResponseWriter, r *http.Request) {
+	var filters []*labels.Matcher
+	for _, filter := range r.URL.Query()["filter"] {
+		matcher, err := labels.ParseMatcher(filter)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad matcher in filter: %v", err), http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, matcher)
+	}
+
+	s.mu.Lock()
+	silences := make(models.GettableSilences, 0, len(s.silences))
+	for _, silence := range s.silences {
+		if matchesFilters(silence, filters) {
+			silences = append(silences, silence)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, silences)
+}
+
+// matchesFilters reports whether the silence has a matcher with the name,
+// type and value of every filter, like Alertmanager 0.26
+func matchesFilters(silence *models.GettableSilence, filters []*labels.Matcher) bool {
+	for _, filter := range filters {
+		found := false
+		for _, matcher := range silence.Matchers {
+			if *matcher.Name == filter.Name && matchType(matcher) == filter.Type && *matcher.Value == filter.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchType returns the type of a silence matcher, which is equal unless set otherwise
+func matchType(matcher *models.Matcher) labels.MatchType {
+	isRegex := matcher.IsRegex != nil && *matcher.IsRegex
+	isEqual := matcher.IsEqual == nil || *matcher.IsEqual
+	switch {
+	case isRegex && isEqual:
+		return labels.MatchRegexp
+	case isRegex:
+		return labels.MatchNotRegexp
+	case !isEqual:
+		return labels.MatchNotEqual
+	}
+	return labels.MatchEqual
+}
+
+func (s *Server) postSilence(w http.ResponseWriter, r *http.Request) {
+	var silence models.PostableSilence
+	if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+		http.Error(w, fmt.Sprintf("invalid silence: %v", err), http.StatusBadRequest)
+		return
+	}
+	if silence.StartsAt == nil || silence.EndsAt == nil || len(silence.Matchers) == 0 {
+		http.Error(w, "silence must have matchers, startsAt and endsAt", http.StatusBadRequest)
+		return
+	}
+	for _, matcher := range silence.Matchers {
+		// Like Alertmanager, reject matchers with invalid regular expressions
+		if matcher.IsRegex != nil && *matcher.IsRegex && matcher.Value != nil {
+			if _, err := regexp.Compile("^(?:" + *matcher.Value + ")$"); err != nil {
+				http.Error(w, fmt.Sprintf("invalid silence: invalid regex for matcher %v: %v", matcher.Name, err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := silence.ID
+	if id != "" {
+		// Updating an existing silence, like Alertmanager only active ones can be updated in place
+		existing, ok := s.silences[id]
+		if !ok {
+			http.Error(w, fmt.Sprintf("silence %s not found", id), http.StatusNotFound)
+			return
+		}
+		if *existing.Status.State != silenceStateActive {
+			id = ""
+		}
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	now := strfmt.DateTime(time.Now())
+	s.silences[id] = &models.GettableSilence{
+		ID:        stringPtr(id),
+		Status:    &models.SilenceStatus{State: stringPtr(silenceStateActive)},
+		UpdatedAt: &now,
+		Silence:   silence.Silence,
+	}
+
+	writeJSON(w, map[string]string{"silenceID": id})
+}
+
+func (s *Server) handleSilence(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	time.Sleep(s.latency)
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	silence, ok := s.silences[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("silence %s not found", id), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, silence)
+		return
+	case http.MethodDelete:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Alertmanager refuses to expire a silence twice
+	if *silence.Status.State == silenceStateExpired {
+		http.Error(w, fmt.Sprintf("silence %s already expired", id), http.StatusInternalServerError)
+		return
+	}
+
+	now := strfmt.DateTime(time.Now())
+	silence.Status.State = stringPtr(silenceStateExpired)
+	silence.EndsAt = &now
+	silence.UpdatedAt = &now
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func stringPtr(s string) *string { return &s }
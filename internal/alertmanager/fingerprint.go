@@ -0,0 +1,111 @@
+package alertmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+)
+
+// The fingerprint is appended to the comment as " [fp:<hex>]"
+const (
+	fingerprintPrefix = " [fp:"
+	fingerprintSuffix = "]"
+)
+
+// silenceFingerprint identifies a silence by its matchers, node and kind, so
+// the same silence isn't created twice across retries, restarts and failovers
+func silenceFingerprint(matchers models.Matchers, nodeName string, kind SilenceKind) string {
+	// Matchers are hashed in a canonical order, Alertmanager doesn't keep it
+	parts := make([]string, 0, len(matchers))
+	for _, matcher := range matchers {
+		if matcher == nil {
+			continue
+		}
+		isEqual := matcher.IsEqual == nil || *matcher.IsEqual
+		parts = append(parts, strings.Join([]string{
+			derefString(matcher.Name),
+			derefString(matcher.Value),
+			strconv.FormatBool(derefBool(matcher.IsRegex)),
+			strconv.FormatBool(isEqual),
+		}, "\x00"))
+	}
+	sort.Strings(parts)
+
+	hash := sha256.New()
+	hash.Write([]byte(nodeName + "\x00" + string(kind) + "\x00"))
+	hash.Write([]byte(strings.Join(parts, "\x01")))
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// withFingerprint appends a fingerprint to a silence comment
+func withFingerprint(comment, fingerprint string) string {
+	return comment + fingerprintPrefix + fingerprint + fingerprintSuffix
+}
+
+// splitFingerprint removes the fingerprint from a comment and returns both,
+// the fingerprint is empty for silences created before fingerprints
+func splitFingerprint(comment string) (string, string) {
+	i := strings.LastIndex(comment, fingerprintPrefix)
+	if i < 0 || !strings.HasSuffix(comment, fingerprintSuffix) {
+		return comment, ""
+	}
+	return comment[:i], comment[i+len(fingerprintPrefix) : len(comment)-len(fingerprintSuffix)]
+}
+
+// findSilence returns an active helper-owned silence with the fingerprint on
+// target, or the active endpoint if target is empty. Only the silences with
+// the same matchers are requested
+func (c *Client) findSilence(ctx context.Context, target string, matchers models.Matchers, fingerprint string) (models.PostableSilence, bool, error) {
+	silences, err := c.listSilences(ctx, target, matchers, isActiveOwned)
+	if err != nil {
+		return models.PostableSilence{}, false, err
+	}
+	for _, silence := range silences {
+		if silence.Comment == nil {
+			continue
+		}
+		if _, fp := splitFingerprint(*silence.Comment); fp == fingerprint {
+			return silence, true, nil
+		}
+	}
+	return models.PostableSilence{}, false, nil
+}
+
+// reuseSilence looks up an existing silence with the fingerprint, extended
+// to endsAt if it ends earlier. Lookup and extension failures are logged and
+// a new silence is created, duplicates are cleaned up with the node's other
+// silences
+func (c *Client) reuseSilence(ctx context.Context, target string, matchers models.Matchers, fingerprint string, endsAt time.Time) (string, bool) {
+	silence, found, err := c.findSilence(ctx, target, matchers, fingerprint)
+	if err != nil {
+		klog.Warningf("Failed to look up silence %s, creating it: %v", fingerprint, err)
+		return "", false
+	}
+	if !found || (silence.EndsAt != nil && !time.Time(*silence.EndsAt).Before(endsAt)) {
+		return silence.ID, found
+	}
+	id, err := c.extendSilence(ctx, target, silence.ID, endsAt)
+	if err != nil {
+		klog.Warningf("Failed to extend silence %s to reuse it, creating another: %v", silence.ID, err)
+		return "", false
+	}
+	return id, true
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefBool(b *bool) bool {
+	return b != nil && *b
+}
@@ -0,0 +1,47 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+)
+
+func TestReusedSilenceExtended(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	client := NewClient([]string{am.URL()}, "")
+	matchers := models.Matchers{{Name: stringPtr("node"), Value: stringPtr("worker-0"), IsRegex: boolPtr(false)}}
+
+	short, err := client.CreateSilence(ctx, matchers, "worker-0", KindPoolUpdate, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create silence: %v", err)
+	}
+	long, err := client.CreateSilence(ctx, matchers, "worker-0", KindPoolUpdate, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create silence: %v", err)
+	}
+	if am.ActiveSilences() != 1 {
+		t.Fatalf("Expected silence %s to be reused, %d silences are active", short, am.ActiveSilences())
+	}
+	silence, err := client.GetSilence(ctx, long)
+	if err != nil {
+		t.Fatalf("Failed to get silence: %v", err)
+	}
+	if endsAt := time.Time(*silence.EndsAt); endsAt.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("Expected the reused silence to be extended to the requested end, it ends at %s", endsAt.Format(time.RFC3339))
+	}
+
+	// Silences ending later are reused as they are
+	again, err := client.CreateSilence(ctx, matchers, "worker-0", KindPoolUpdate, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create silence: %v", err)
+	}
+	if again != long || am.ActiveSilences() != 1 {
+		t.Errorf("Expected silence %s to be reused, got %s", long, again)
+	}
+}
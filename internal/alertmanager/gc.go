@@ -0,0 +1,83 @@
+package alertmanager
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// startGarbageCollection deletes the silences of nodes which aren't rolling
+// every GCInterval until ctx is cancelled
+func (m *SilenceManager) startGarbageCollection(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.options.GCInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.collectGarbage(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+// keepsSilences reports whether a node which may have silences still needs
+// them: it's rolling, in a maintenance window, being verified, waiting for its
+// scrape targets, within the delay after its rollout or manually silenced.
+// The lock must be held
+func (m *SilenceManager) keepsSilences(nodeName string) bool {
+	if _, ok := m.rolling[nodeName]; ok {
+		return true
+	}
+	if _, ok := m.maintenanceUntil(nodeName); ok {
+		return true
+	}
+	if _, ok := m.verifyingSince(nodeName); ok {
+		return true
+	}
+	if _, ok := m.targetsSince(nodeName); ok {
+		return true
+	}
+	if _, ok := m.delayedUntil(nodeName); ok {
+		return true
+	}
+	_, ok := m.manualUntil(nodeName)
+	return ok
+}
+
+// collectGarbage unsilences tracked nodes which don't need their silences,
+// e.g. nodes which finished rolling while the helper was down and aren't
+// reported as done, unless they were tracked within GCGracePeriod. Untracked
+// silences are expired by the reconciliation
+func (m *SilenceManager) collectGarbage(ctx context.Context, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The watcher reports the rolling nodes within the grace period after a start
+	if m.held.Load() || now.Sub(m.started) < m.options.GCGracePeriod {
+		return
+	}
+
+	for node, silences := range m.activeSilences.Entries() {
+		startedAt, ok := m.activeSilences.StartedAt(node)
+		if !ok || m.keepsSilences(node) || now.Sub(startedAt) < m.options.GCGracePeriod {
+			continue
+		}
+		// Manual silences without a duration are kept until they're removed
+		if hasKind(silences, KindManual) {
+			continue
+		}
+		klog.InfoS("Collecting the silences of a node which isn't rolling", "action", "gc", "node", node, "silences", len(silences))
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.ErrorS(err, "Failed to collect the silences of a node", "action", "gc", "node", node)
+			continue
+		}
+		metrics.SilencesCollected.WithLabelValues("not_rolling").Add(float64(len(silences)))
+	}
+}
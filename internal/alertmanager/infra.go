@@ -0,0 +1,230 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/config"
+)
+
+// infraComponent is a platform component with only a few replicas, whose
+// own alerts fire while the node hosting one of them rolls
+type infraComponent struct {
+	name      string
+	namespace string
+	selector  labels.Selector
+	// scopes are the alerts firing while one of the replicas is gone, by the
+	// label identifying the component in them
+	scopes []infraScope
+}
+
+// infraScope are alerts of a component matched by one of their labels, the
+// names of the component's pods on the node if value is empty
+type infraScope struct {
+	label  string
+	value  string
+	alerts []string
+}
+
+// infraComponents are the platform components silenced when a rolling node hosts one of their pods
+var infraComponents = []infraComponent{
+	{
+		name:      "prometheus-k8s",
+		namespace: "openshift-monitoring",
+		selector:  mustParseSelector("app.kubernetes.io/name=prometheus,prometheus=k8s"),
+		scopes: []infraScope{
+			{label: "pod", alerts: []string{"KubePodNotReady", "ThanosSidecarNoConnectionToStartedPrometheus"}},
+			{label: "service", value: "prometheus-k8s", alerts: []string{"TargetDown"}},
+			{label: "statefulset", value: "prometheus-k8s", alerts: []string{"KubeStatefulSetReplicasMismatch"}},
+		},
+	},
+	{
+		name:      "alertmanager-main",
+		namespace: "openshift-monitoring",
+		selector:  mustParseSelector("app.kubernetes.io/name=alertmanager,alertmanager=main"),
+		scopes: []infraScope{
+			{label: "pod", alerts: []string{"KubePodNotReady", "AlertmanagerMembersInconsistent"}},
+			{label: "service", value: "alertmanager-main", alerts: []string{"TargetDown"}},
+			{label: "statefulset", value: "alertmanager-main", alerts: []string{"KubeStatefulSetReplicasMismatch"}},
+		},
+	},
+	{
+		name:      "thanos-querier",
+		namespace: "openshift-monitoring",
+		selector:  mustParseSelector("app.kubernetes.io/name=thanos-query"),
+		scopes: []infraScope{
+			{label: "pod", alerts: []string{"KubePodNotReady"}},
+			{label: "service", value: "thanos-querier", alerts: []string{"TargetDown"}},
+			{label: "deployment", value: "thanos-querier", alerts: []string{"KubeDeploymentReplicasMismatch"}},
+		},
+	},
+	{
+		name:      "image-registry",
+		namespace: "openshift-image-registry",
+		selector:  mustParseSelector("docker-registry=default"),
+		scopes: []infraScope{
+			{label: "pod", alerts: []string{"KubePodNotReady"}},
+			{label: "service", value: "image-registry", alerts: []string{"TargetDown"}},
+			{label: "deployment", value: "image-registry", alerts: []string{"KubeDeploymentReplicasMismatch"}},
+		},
+	},
+	{
+		name:      "router-default",
+		namespace: "openshift-ingress",
+		selector:  mustParseSelector("ingresscontroller.operator.openshift.io/deployment-ingresscontroller=default"),
+		scopes: []infraScope{
+			{label: "pod", alerts: []string{"KubePodNotReady", "HAProxyDown"}},
+			{label: "service", value: "router-internal-default", alerts: []string{"TargetDown"}},
+			{label: "deployment", value: "router-default", alerts: []string{"KubeDeploymentReplicasMismatch"}},
+		},
+	},
+}
+
+func mustParseSelector(selector string) labels.Selector {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		panic(fmt.Sprintf("invalid selector %q: %v", selector, err))
+	}
+	return parsed
+}
+
+// colocatedInfra returns the names of the pods of each infra component on
+// the node, components without a pod on it are left out
+func (m *SilenceManager) colocatedInfra(ctx context.Context, nodeName string) (map[string][]string, error) {
+	var pods *corev1.PodList
+	var err error
+	if m.options.Namespaces.All() {
+		pods, err = m.k8sClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
+		})
+	}
+	if !m.options.Namespaces.All() || apierrors.IsForbidden(err) {
+		// Fall back to the namespaces of the components which may be listed
+		pods, err = m.listInfraNamespaces(ctx, nodeName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of node %s: %w", nodeName, err)
+	}
+
+	colocated := make(map[string][]string)
+	for _, component := range infraComponents {
+		for _, pod := range pods.Items {
+			if pod.Namespace == component.namespace && component.selector.Matches(labels.Set(pod.Labels)) {
+				colocated[component.name] = append(colocated[component.name], pod.Name)
+			}
+		}
+	}
+	return colocated, nil
+}
+
+// listInfraNamespaces lists the pods of the node in the namespaces of the
+// infra components in scope only
+func (m *SilenceManager) listInfraNamespaces(ctx context.Context, nodeName string) (*corev1.PodList, error) {
+	list := &corev1.PodList{}
+	listed := make(map[string]bool)
+	for _, component := range infraComponents {
+		if listed[component.namespace] || !m.options.Namespaces.Contains(component.namespace) || !m.access.Allowed(component.namespace) {
+			continue
+		}
+		listed[component.namespace] = true
+		pods, err := m.k8sClient.CoreV1().Pods(component.namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
+		})
+		if apierrors.IsForbidden(err) {
+			m.access.Deny(component.namespace, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, pods.Items...)
+	}
+	return list, nil
+}
+
+// CreateInfraSilences silences the alerts of the platform components with a
+// replica on the node, one silence per component and label scoping their
+// alerts, so the replicas on other nodes keep alerting
+func (m *SilenceManager) CreateInfraSilences(ctx context.Context, nodeName string, kind SilenceKind) ([]TrackedSilence, error) {
+	if m.options.DisableInfraSilences {
+		return nil, nil
+	}
+	colocated, err := m.colocatedInfra(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	if len(colocated) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(colocated))
+	for name := range colocated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	klog.Infof("Node %s hosts %s, silencing their alerts", nodeName, strings.Join(names, ", "))
+
+	var silences []TrackedSilence
+	failed, total := 0, 0
+	duration := m.templateDuration(config.TemplateInfra)
+	for _, component := range infraComponents {
+		pods, ok := colocated[component.name]
+		if !ok {
+			continue
+		}
+		for _, scope := range component.scopes {
+			total++
+			id, err := m.amClient.CreateSilence(ctx, infraMatchers(component, scope, pods), nodeName, kind, duration)
+			if err != nil {
+				klog.Errorf("failed to create infra silence for %s %s on node %s: %v", component.name, scope.label, nodeName, err)
+				m.recordFailure(nodeName, operationCreate, err)
+				failed++
+				continue
+			}
+			silences = append(silences, track(id, kind, config.TemplateInfra, duration))
+		}
+	}
+	if failed > 0 {
+		return silences, fmt.Errorf("failed to create %d of %d infra silences", failed, total)
+	}
+	return silences, nil
+}
+
+// infraMatchers matches the alerts of a scope of a component, by the names
+// of its pods on the node or by the label naming the component
+func infraMatchers(component infraComponent, scope infraScope, pods []string) models.Matchers {
+	value, isRegex := scope.value, false
+	if value == "" {
+		quoted := make([]string, len(pods))
+		for i, pod := range pods {
+			quoted[i] = regexp.QuoteMeta(pod)
+		}
+		value, isRegex = fmt.Sprintf("(%s)", strings.Join(quoted, "|")), true
+	}
+	return models.Matchers{
+		{
+			Name:    stringPtr("namespace"),
+			Value:   stringPtr(component.namespace),
+			IsRegex: boolPtr(false),
+		},
+		{
+			Name:    stringPtr("alertname"),
+			Value:   stringPtr(fmt.Sprintf("(%s)", strings.Join(scope.alerts, "|"))),
+			IsRegex: boolPtr(true),
+		},
+		{
+			Name:    stringPtr(scope.label),
+			Value:   stringPtr(value),
+			IsRegex: boolPtr(isRegex),
+		},
+	}
+}
@@ -0,0 +1,162 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// Suppression is how the alerts of rolling nodes are suppressed
+type Suppression string
+
+const (
+	// SuppressionSilences creates silences for the alerts of rolling nodes
+	SuppressionSilences Suppression = "silences"
+	// SuppressionInhibition posts a NodeRolling alert per rolling node, which
+	// inhibits the alerts of the node by an inhibition rule
+	SuppressionInhibition Suppression = "inhibition"
+)
+
+// ParseSuppression validates a suppression mode given on the command line
+func ParseSuppression(suppression string) (Suppression, error) {
+	switch Suppression(suppression) {
+	case SuppressionSilences, SuppressionInhibition:
+		return Suppression(suppression), nil
+	}
+	return "", fmt.Errorf("unknown suppression mode %q, expected %s or %s", suppression, SuppressionSilences, SuppressionInhibition)
+}
+
+// InhibitionAlertName is the name of the alert posted for rolling nodes in
+// inhibition mode, an inhibition rule mutes the alerts of the node while it fires
+const InhibitionAlertName = "NodeRolling"
+
+const (
+	// inhibitionResendInterval is how often the alerts of rolling nodes are
+	// posted again, Alertmanager resolves alerts which aren't
+	inhibitionResendInterval = time.Minute
+	// inhibitionTimeout is when a posted alert resolves unless it's posted
+	// again, e.g. after the helper was removed
+	inhibitionTimeout = 5 * time.Minute
+)
+
+// inhibition is the alert of a rolling node
+type inhibition struct {
+	kind     SilenceKind
+	startsAt time.Time
+}
+
+// Inhibitor suppresses the alerts of rolling nodes with a NodeRolling alert
+// per node instead of silences. The inhibition rule is configured in
+// Alertmanager, the alerts resolve on their own when they're no longer posted
+type Inhibitor struct {
+	client *Client
+
+	mu      sync.Mutex
+	rolling map[string]inhibition
+}
+
+// NewInhibitor creates an inhibitor posting alerts with client
+func NewInhibitor(client *Client) *Inhibitor {
+	return &Inhibitor{
+		client:  client,
+		rolling: make(map[string]inhibition),
+	}
+}
+
+// HandleNodeState starts firing the alert of a node which started rolling and
+// resolves it when the node stopped rolling or was deleted
+func (i *Inhibitor) HandleNodeState(ctx context.Context, nodeName string, isRolling bool, kind SilenceKind) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	current, ok := i.rolling[nodeName]
+	if isRolling {
+		if ok && current.kind == kind {
+			return nil
+		}
+		if !ok {
+			current.startsAt = now
+		}
+		current.kind = kind
+		i.rolling[nodeName] = current
+		metrics.InhibitedNodes.Set(float64(len(i.rolling)))
+		klog.InfoS("Inhibiting the alerts of node", "action", "inhibit", "node", nodeName, "kind", kind)
+		return i.post(ctx, map[string]inhibition{nodeName: current}, now.Add(inhibitionTimeout))
+	}
+
+	if !ok {
+		return nil
+	}
+	delete(i.rolling, nodeName)
+	metrics.InhibitedNodes.Set(float64(len(i.rolling)))
+	klog.InfoS("Resolved the inhibition of node", "action", "uninhibit", "node", nodeName)
+	// An alert ending now is resolved right away
+	return i.post(ctx, map[string]inhibition{nodeName: current}, now)
+}
+
+// Start posts the alerts of rolling nodes again every minute until ctx is
+// cancelled. They aren't resolved on shutdown, a restarting helper takes
+// them over and a removed one lets them time out
+func (i *Inhibitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(inhibitionResendInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				i.resend(ctx)
+			}
+		}
+	}()
+}
+
+func (i *Inhibitor) resend(ctx context.Context) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.rolling) == 0 {
+		return
+	}
+	if err := i.post(ctx, i.rolling, time.Now().Add(inhibitionTimeout)); err != nil && !errors.Is(err, ErrCircuitOpen) {
+		klog.Errorf("Failed to post the alerts of %d rolling nodes: %v", len(i.rolling), err)
+	}
+}
+
+// post sends the alerts of nodes ending at endsAt, the lock must be held
+func (i *Inhibitor) post(ctx context.Context, nodes map[string]inhibition, endsAt time.Time) error {
+	alerts := make(models.PostableAlerts, 0, len(nodes))
+	for node, current := range nodes {
+		alerts = append(alerts, &models.PostableAlert{
+			Alert: models.Alert{
+				Labels: models.LabelSet{
+					"alertname": InhibitionAlertName,
+					"node":      node,
+					"severity":  "none",
+				},
+			},
+			// The kind isn't a label, the alert would be replaced when it changes
+			Annotations: models.LabelSet{
+				"kind":    current.kind.String(),
+				"summary": fmt.Sprintf("Node %s is rolling (%s), its alerts are inhibited", node, current.kind),
+			},
+			StartsAt: strfmt.DateTime(current.startsAt),
+			EndsAt:   strfmt.DateTime(endsAt),
+		})
+	}
+	if err := i.client.PostAlerts(ctx, alerts); err != nil {
+		return fmt.Errorf("failed to post %s alerts: %w", InhibitionAlertName, err)
+	}
+	return nil
+}
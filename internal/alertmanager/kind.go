@@ -0,0 +1,50 @@
+package alertmanager
+
+import (
+	"rollout-helper/internal/watcher"
+)
+
+// SilenceKind is the cause a silence was created for
+type SilenceKind string
+
+const (
+	// KindNodeReboot silences a node tainted for a reboot outside of a pool update
+	KindNodeReboot SilenceKind = "NodeReboot"
+	// KindDrain silences a node drained by the MCO without a new config
+	KindDrain SilenceKind = "Drain"
+	// KindPoolUpdate silences a node while the MCO applies a new config
+	KindPoolUpdate SilenceKind = "PoolUpdate"
+	// KindMachineReplacement silences a node whose Machine is deleted or provisioned by the Machine API
+	KindMachineReplacement SilenceKind = "MachineReplacement"
+	// KindMaintenanceWindow silences a node during a scheduled maintenance
+	KindMaintenanceWindow SilenceKind = "MaintenanceWindow"
+	// KindManual silences were created by an operator and adopted
+	KindManual SilenceKind = "Manual"
+	// KindEviction silences the pods of daemonsets evicted from a node which isn't rolling
+	KindEviction SilenceKind = "Eviction"
+)
+
+// silenceKinds lists all kinds, silences restored without a kind are reported as unknown
+var silenceKinds = []SilenceKind{KindNodeReboot, KindDrain, KindPoolUpdate, KindMachineReplacement, KindMaintenanceWindow, KindManual, KindEviction, ""}
+
+// String returns the kind as used in metric labels
+func (k SilenceKind) String() string {
+	if k == "" {
+		return "Unknown"
+	}
+	return string(k)
+}
+
+// KindOf returns the kind of the silences created for a rolling node
+func KindOf(state watcher.NodeState) SilenceKind {
+	switch {
+	case state.MachinePhase != "":
+		return KindMachineReplacement
+	case state.Updating:
+		return KindPoolUpdate
+	case state.Drain != watcher.DrainNone:
+		return KindDrain
+	default:
+		return KindNodeReboot
+	}
+}
@@ -0,0 +1,113 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime"
+	amclient "github.com/prometheus/alertmanager/api/v2/client"
+	amsilence "github.com/prometheus/alertmanager/api/v2/client/silence"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/pkg/labels"
+)
+
+// Alertmanager can't page through silences or select them by creator, every
+// list returns all silences including the expired ones it still retains. The
+// response is decoded one silence at a time so only the selected ones are
+// kept in memory, and lookups of a known silence narrow it with filter=
+
+// OwnedSilences fetches the active silences created by the helper, of every
+// known tenant
+func (c *Client) OwnedSilences(ctx context.Context) ([]models.PostableSilence, error) {
+	return c.listTenants(ctx, func(ctx context.Context) ([]models.PostableSilence, error) {
+		if c.mode == ModeBroadcast {
+			return c.broadcastList(ctx, isActiveOwned)
+		}
+		return c.listSilences(ctx, "", nil, isActiveOwned)
+	})
+}
+
+// isActiveOwned selects the helper's silences which haven't expired
+func isActiveOwned(silence models.PostableSilence) bool {
+	return isOwned(silence) && !isExpired(silence)
+}
+
+// listSilences lists the silences on target, or the active endpoint if target
+// is empty, which keep selects, all if it's nil. With matchers only silences
+// with exactly these matchers are requested
+func (c *Client) listSilences(ctx context.Context, target string, matchers models.Matchers, keep func(models.PostableSilence) bool) ([]models.PostableSilence, error) {
+	var silences []models.PostableSilence
+	err := c.do(ctx, target, http.MethodGet, func(api *amclient.AlertmanagerAPI, option func(*runtime.ClientOperation)) error {
+		params := amsilence.NewGetSilencesParams().WithFilter(silenceFilter(matchers))
+		resp, err := api.Silence.GetSilences(params, option, func(op *runtime.ClientOperation) {
+			op.Reader = &silenceStream{next: op.Reader, keep: keep}
+		})
+		if err != nil {
+			return err
+		}
+		silences = make([]models.PostableSilence, 0, len(resp.Payload))
+		for _, silence := range resp.Payload {
+			silences = append(silences, models.PostableSilence{ID: derefString(silence.ID), Silence: silence.Silence})
+		}
+		return nil
+	})
+	return silences, err
+}
+
+// silenceStream decodes a listing of silences one at a time, keeping those
+// which keep selects. Other responses are read by next
+type silenceStream struct {
+	next runtime.ClientResponseReader
+	keep func(models.PostableSilence) bool
+}
+
+func (s *silenceStream) ReadResponse(response runtime.ClientResponse, consumer runtime.Consumer) (interface{}, error) {
+	if response.Code() != http.StatusOK {
+		return s.next.ReadResponse(response, consumer)
+	}
+
+	decoder := json.NewDecoder(response.Body())
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return nil, fmt.Errorf("failed to decode response: expected a list of silences")
+	}
+	result := amsilence.NewGetSilencesOK()
+	for decoder.More() {
+		var silence models.GettableSilence
+		if err := decoder.Decode(&silence); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		if s.keep == nil || s.keep(models.PostableSilence{ID: derefString(silence.ID), Silence: silence.Silence}) {
+			result.Payload = append(result.Payload, &silence)
+		}
+	}
+	return result, nil
+}
+
+// silenceFilter returns the filters selecting the silences with the same
+// matchers, Alertmanager compares their name, type and raw value. Nothing is
+// filtered if a matcher can't be expressed
+func silenceFilter(matchers models.Matchers) []string {
+	var filters []string
+	for _, matcher := range matchers {
+		if matcher.Name == nil || matcher.Value == nil || matcher.IsRegex == nil {
+			return nil
+		}
+		matchType := labels.MatchEqual
+		switch equal := matcher.IsEqual == nil || *matcher.IsEqual; {
+		case *matcher.IsRegex && equal:
+			matchType = labels.MatchRegexp
+		case *matcher.IsRegex:
+			matchType = labels.MatchNotRegexp
+		case !equal:
+			matchType = labels.MatchNotEqual
+		}
+		filter, err := labels.NewMatcher(matchType, *matcher.Name, *matcher.Value)
+		if err != nil {
+			return nil
+		}
+		filters = append(filters, filter.String())
+	}
+	return filters
+}
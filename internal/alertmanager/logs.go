@@ -0,0 +1,50 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/config"
+)
+
+// CreateLogSilence silences the alerts the Loki ruler evaluates from the
+// logs of a node, if log alerts are configured
+func (m *SilenceManager) CreateLogSilence(ctx context.Context, nodeName string, kind SilenceKind) (string, error) {
+	logs := m.currentConfig().LogAlerts
+	if logs == nil {
+		return "", nil
+	}
+
+	matchers := models.Matchers{
+		{
+			Name:    stringPtr(logs.Label()),
+			Value:   stringPtr(nodeName),
+			IsRegex: boolPtr(false),
+		},
+	}
+	if logs.Filenames != "" {
+		matchers = append(matchers, &models.Matcher{
+			Name:    stringPtr("filename"),
+			Value:   stringPtr(logs.Filenames),
+			IsRegex: boolPtr(true),
+		})
+	}
+	if logs.Alertnames != "" {
+		matchers = append(matchers, &models.Matcher{
+			Name:    stringPtr("alertname"),
+			Value:   stringPtr(logs.Alertnames),
+			IsRegex: boolPtr(true),
+		})
+	}
+
+	id, err := m.amClient.CreateSilence(ctx, matchers, nodeName, kind, m.templateDuration(config.TemplateLogs))
+	if err != nil {
+		klog.Errorf("failed to create log alert silence for node %s: %v", nodeName, err)
+		m.recordFailure(nodeName, operationCreate, err)
+		return "", fmt.Errorf("failed to create silence for log alerts: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,115 @@
+package alertmanager
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Reasons of the maintenance events recorded on nodes
+const (
+	reasonMaintenanceStarted = "MaintenanceStarted"
+	reasonMaintenanceEnded   = "MaintenanceEnded"
+)
+
+// Maintenance is the active maintenance window of a node
+type Maintenance struct {
+	// Window is the namespace and name of the MaintenanceWindow
+	Window string    `json:"window"`
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+// SetMaintenance silences the nodes in an active maintenance window and
+// deletes the silences of nodes whose window ended, unless they are rolling.
+// Existing nodes outside Options.NodeSelector are left to their instance
+func (m *SilenceManager) SetMaintenance(ctx context.Context, nodes map[string]Maintenance) {
+	if m.options.NodeSelector != nil {
+		foreign, err := m.foreignNodes(ctx)
+		if err != nil {
+			klog.Errorf("Failed to select the nodes under maintenance: %v", err)
+			return
+		}
+		selected := make(map[string]Maintenance, len(nodes))
+		for node, window := range nodes {
+			if !foreign[node] {
+				selected[node] = window
+			}
+		}
+		nodes = selected
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held.Load() {
+		// Reconciled from scratch once mutations resume
+		m.maintenance = nil
+		return
+	}
+
+	previous := m.maintenance
+	m.maintenance = nodes
+
+	for node, window := range nodes {
+		if _, ok := previous[node]; ok {
+			continue
+		}
+		klog.Infof("Node %s is under maintenance by %s until %s", node, window.Window, window.Until.Format(time.RFC3339))
+		m.recordEvent(node, reasonMaintenanceStarted, "Maintenance window %s until %s: %s", window.Window, window.Until.Format(time.RFC3339), window.Reason)
+		if until, ok := m.unsilencedUntil(node); ok {
+			klog.Infof("Node %s is force-unsilenced until %s, not creating silences", node, until.Format(time.RFC3339))
+			continue
+		}
+		if err := m.silenceNode(ctx, node, KindMaintenanceWindow); err != nil {
+			klog.Errorf("Failed to silence node %s for maintenance: %v", node, err)
+		}
+	}
+
+	for node, silences := range m.activeSilences.Entries() {
+		if _, ok := nodes[node]; ok {
+			continue
+		}
+		if _, rolling := m.rolling[node]; rolling {
+			continue
+		}
+		// Maintenance silences restored after a restart have no previous window
+		if _, ended := previous[node]; !ended && !hasKind(silences, KindMaintenanceWindow) {
+			continue
+		}
+
+		klog.Infof("Maintenance of node %s ended", node)
+		m.recordEvent(node, reasonMaintenanceEnded, "Maintenance window ended")
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence node %s after maintenance: %v", node, err)
+		}
+	}
+}
+
+// Maintenance returns the nodes in an active maintenance window
+func (m *SilenceManager) Maintenance() map[string]Maintenance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make(map[string]Maintenance, len(m.maintenance))
+	for node, window := range m.maintenance {
+		nodes[node] = window
+	}
+	return nodes
+}
+
+// maintenanceUntil returns the end of the node's maintenance window, the lock must be held
+func (m *SilenceManager) maintenanceUntil(nodeName string) (time.Time, bool) {
+	window, ok := m.maintenance[nodeName]
+	return window.Until, ok
+}
+
+func hasKind(silences []TrackedSilence, kind SilenceKind) bool {
+	for _, silence := range silences {
+		if silence.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -2,130 +2,923 @@ package alertmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/alertmanager/api/v2/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/notify"
+	"rollout-helper/internal/prometheus"
+	"rollout-helper/internal/scope"
+	"rollout-helper/internal/state"
+	"rollout-helper/internal/tracing"
+	"rollout-helper/internal/verify"
 )
 
+// renewBefore is how long before expiry the silences of rolling nodes are extended
+const renewBefore = 15 * time.Minute
+
+// Options tune the lifecycle of the silences created by the manager
+type Options struct {
+	// SilenceDuration is how long silences last unless overridden per template
+	SilenceDuration time.Duration
+	// MaxSilenceDuration caps how long the silences of a single rollout are
+	// extended, zero disables extending
+	MaxSilenceDuration time.Duration
+	// MaxRolloutDuration is how long a node may roll before its silences are
+	// deleted and not created again until its rollout ends, zero disables it
+	MaxRolloutDuration time.Duration
+	// Recorder emits events on nodes whose silences couldn't be managed, optional
+	Recorder record.EventRecorder
+	// Notifier is notified of silence operations which failed, optional
+	Notifier *notify.Pipeline
+	// Lifecycle is posted the lifecycle events of silences, optional
+	Lifecycle *notify.LifecycleWebhook
+	// DiscoverDaemonSets also silences the pods of DaemonSets annotated with SilenceDaemonSetAnnotation
+	DiscoverDaemonSets bool
+	// DisableBuiltinTargets only silences the pods of declared and discovered DaemonSets
+	DisableBuiltinTargets bool
+	// DisableInfraSilences doesn't silence the alerts of platform components hosted by rolling nodes
+	DisableInfraSilences bool
+	// NodeSelector selects the nodes whose silences are managed, nil for all
+	// nodes. Silences of other nodes are left to the instances managing them
+	NodeSelector labels.Selector
+	// Workloads selects the namespaces whose workload alerts are silenced
+	// while they have pods on a rolling node, nil disables it
+	Workloads *WorkloadSelector
+	// UnsilenceDelay is how long silences are kept after a node finished rolling
+	UnsilenceDelay time.Duration
+	// Verifier checks nodes which finished rolling are healthy before their
+	// silences are deleted, optional
+	Verifier *verify.Verifier
+	// VerifyTimeout is how long a node may fail verification before its
+	// silences are deleted anyway
+	VerifyTimeout time.Duration
+	// Prometheus is queried for the scrape targets of nodes which finished
+	// rolling, optional
+	Prometheus *prometheus.Client
+	// TargetsTimeout is how long the silences of a node which finished
+	// rolling are kept until its scrape targets are up, zero disables waiting
+	TargetsTimeout time.Duration
+	// Instances records the helper instances sharing the state store, optional.
+	// Mutations are held off while an older instance of another version runs
+	Instances state.Registry
+	// Instance identifies this helper in Instances
+	Instance state.Instance
+	// Rollback keeps a script expiring all tracked silences, optional
+	Rollback []state.RollbackWriter
+	// Audit records the silence actions taken for nodes, optional. Silences
+	// are recorded when created by the client, see Client.SetAudit
+	Audit *audit.Log
+	// ReconcileInterval is how often the silences in Alertmanager are
+	// compared with the rolling nodes, zero disables it
+	ReconcileInterval time.Duration
+	// Authorizer verifies who set the annotations changing what is silenced,
+	// optional. They're all honored without it
+	Authorizer authz.Authorizer
+	// GCInterval is how often the silences of nodes which aren't rolling are
+	// deleted, zero disables it
+	GCInterval time.Duration
+	// GCGracePeriod is how long silences and the tracked silences of nodes
+	// are kept before they're collected, and how long after a start nothing
+	// is collected
+	GCGracePeriod time.Duration
+	// CatchUpDuration is how long all alerts of a node are silenced if some
+	// fired before its rollout was detected, zero disables it
+	CatchUpDuration time.Duration
+	// PoolSilences covers the built-in node silences of the rolling Linux
+	// nodes of a MachineConfigPool with a single silence
+	PoolSilences bool
+	// CriticalPodSilenceDuration is how long pods with CriticalPodAnnotation
+	// are silenced on the node they're moved to from a rolling node, zero
+	// disables it
+	CriticalPodSilenceDuration time.Duration
+	// EvictionSilenceDuration is how long the pods of the silenced
+	// daemonsets evicted from a node which isn't rolling are silenced, with
+	// their replacements, zero disables it
+	EvictionSilenceDuration time.Duration
+	// Namespaces restricts the pods and daemonsets which are listed, for
+	// namespace-scoped permissions. Targets in other namespaces are skipped
+	Namespaces scope.Namespaces
+}
+
 type SilenceManager struct {
-	amClient       *Client
-	activeSilences sync.Map
+	// mu serializes node state handling and silence renewal
+	mu       sync.Mutex
+	amClient *Client
+	// activeSilences maps node names to the IDs of their silences
+	activeSilences *silenceStore
 	k8sClient      kubernetes.Interface
+	config         *config.Config
+	store          state.Store
+	options        Options
+	// access tracks namespaces whose pods can't be listed
+	access *namespaceAccess
+	// rolling maps the nodes last reported as rolling to the kind of their silences
+	rolling map[string]SilenceKind
+	// unsilenced maps force-unsilenced nodes to the end of their override
+	unsilenced map[string]time.Time
+	discovered discoveredTargets
+	declared   declaredPolicies
+	// maintenance maps the nodes in an active maintenance window to the window
+	maintenance map[string]Maintenance
+	failures    nodeErrors
+	// delayed maps nodes which finished rolling to when their silences are deleted
+	delayed map[string]time.Time
+	// verifying maps nodes which finished rolling to when their verification started
+	verifying map[string]time.Time
+	// targets maps nodes which finished rolling to since when they wait for their scrape targets
+	targets map[string]time.Time
+	// manual maps nodes silenced manually for a duration to when their silences are deleted
+	manual map[string]time.Time
+	// savedManual are the manual silence ends last persisted
+	savedManual map[string]time.Time
+	// escalated maps the rolling nodes whose silences were deleted after
+	// MaxRolloutDuration to when they were
+	escalated map[string]time.Time
+	// rollouts maps the rolling nodes to when their rollout started
+	rollouts map[string]time.Time
+	// savedRollouts are the rollouts last persisted
+	savedRollouts map[string]state.Rollout
+	// held is set while an instance of another version manages the silences
+	held atomic.Bool
+	// stopped is set once Shutdown flushed the silences, held stays set from then on
+	stopped bool
+	// incomplete are the tracked nodes some of whose silences couldn't be created
+	incomplete map[string]bool
+	// catchUps are the catch-up silences of rolling nodes
+	catchUps map[string][]catchUpSilence
+	// critical maps rolling nodes to their critical pods which weren't moved yet
+	critical map[string][]criticalPod
+	// relocations are the silences of critical pods moved off rolling nodes
+	relocations []relocationSilence
+	// savedDetached are the relocation silences last persisted
+	savedDetached []state.DetachedSilence
+	// evictions maps a node and daemonset to the silences of its evicted pods
+	evictions map[string]*evictedPods
+	// watches are the pod informers looking for evictions
+	watches evictionWatches
+	// pools maps pools to the node silence shared by their rolling nodes
+	pools map[string]*poolSilence
+	// started is when the manager was created
+	started time.Time
 }
 
-func NewSilenceManager(client *Client, k8sClient kubernetes.Interface) *SilenceManager {
+// NewSilenceManager creates a manager and restores the silences it created
+// before a restart, from store if set, otherwise from Alertmanager
+func NewSilenceManager(client *Client, k8sClient kubernetes.Interface, cfg *config.Config, store state.Store, options Options) *SilenceManager {
 	manager := &SilenceManager{
-		amClient:  client,
-		k8sClient: k8sClient,
+		amClient:       client,
+		activeSilences: newSilenceStore(maxTrackedNodes),
+		k8sClient:      k8sClient,
+		config:         cfg,
+		store:          store,
+		options:        options,
+		access:         newNamespaceAccess(),
+		rolling:        make(map[string]SilenceKind),
+		unsilenced:     make(map[string]time.Time),
+		delayed:        make(map[string]time.Time),
+		verifying:      make(map[string]time.Time),
+		targets:        make(map[string]time.Time),
+		manual:         make(map[string]time.Time),
+		escalated:      make(map[string]time.Time),
+		rollouts:       make(map[string]time.Time),
+		incomplete:     make(map[string]bool),
+		catchUps:       make(map[string][]catchUpSilence),
+		critical:       make(map[string][]criticalPod),
+		pools:          make(map[string]*poolSilence),
+		evictions:      make(map[string]*evictedPods),
+		started:        time.Now(),
 	}
 
-	// Load existing silences
+	client.breaker.onChange = manager.circuitChanged
+
 	ctx := context.Background()
-	silences, err := client.GetSilences(ctx)
+	if options.Instances != nil {
+		// Restoring expires orphaned silences, which may be another version's
+		manager.checkVersions(ctx)
+		if manager.held.Load() {
+			return manager
+		}
+	}
+	manager.load(ctx)
+	return manager
+}
+
+// load restores the silences created before a restart, from the store if
+// set, otherwise from Alertmanager
+func (m *SilenceManager) load(ctx context.Context) {
+	// Restored first, restoring the silences persists the state
+	m.restoreRollouts(ctx)
+	m.restoreDetached(ctx)
+	m.restoreManual(ctx)
+	if m.store != nil {
+		persisted, found, err := m.store.Load(ctx)
+		if err != nil {
+			klog.Warningf("Failed to load persisted silence state: %v", err)
+		} else if found {
+			m.restoreState(ctx, persisted)
+			return
+		}
+	}
+
+	m.loadExistingSilences(ctx)
+	m.persist(ctx)
+}
+
+// restoreState loads the persisted node to silence mapping, dropping silences
+// which are no longer active and expiring helper-owned silences it doesn't know
+func (m *SilenceManager) restoreState(ctx context.Context, persisted state.Silences) {
+	// Silences are only listed in the tenants the helper knows about
+	for _, ids := range persisted {
+		for _, id := range ids {
+			tenant, _ := splitTenantID(id)
+			m.amClient.AddTenants(tenant)
+		}
+	}
+	silences, err := m.ownedSilences(ctx)
+	if err != nil {
+		// Trust the persisted state, it is verified again on the next restart
+		klog.Warningf("Failed to verify persisted silences: %v", err)
+		for node, ids := range persisted {
+			silences := make([]TrackedSilence, 0, len(ids))
+			for _, id := range ids {
+				// The kind is only known from the silence itself
+				silences = append(silences, track(id, "", "", m.options.SilenceDuration))
+			}
+			m.activeSilences.Set(node, silences)
+		}
+		return
+	}
+
+	// Active helper-owned silences by ID
+	active := make(map[string]models.PostableSilence)
+	for _, silence := range silences {
+		if isOwned(silence) && !isExpired(silence) {
+			active[silence.ID] = silence
+		}
+	}
+
+	known := make(map[string]bool)
+	for node, ids := range persisted {
+		restored := 0
+		for _, id := range ids {
+			// A broadcast silence is active while it's active on any endpoint
+			var found *models.PostableSilence
+			for _, part := range m.amClient.idParts(id) {
+				known[part] = true
+				if silence, ok := active[part]; ok && found == nil {
+					found = &silence
+				}
+			}
+			if found != nil {
+				tracked := m.restored(*found)
+				tracked.ID = id
+				m.activeSilences.Add(node, tracked, time.Time(*found.StartsAt))
+				restored++
+			}
+		}
+		if restored == 0 {
+			klog.Infof("Dropping state for node %s, none of its silences are active", node)
+			continue
+		}
+		klog.Infof("Restored %d silences for node %s", restored, node)
+	}
+
+	m.restorePools(silences)
+	for _, silence := range m.pools {
+		for _, part := range m.amClient.idParts(silence.id) {
+			known[part] = true
+		}
+	}
+	for _, silence := range m.detachedSilences(time.Now()) {
+		for _, part := range m.amClient.idParts(silence.ID) {
+			known[part] = true
+		}
+	}
+
+	for id := range active {
+		if known[id] {
+			continue
+		}
+		if err := m.amClient.DeleteSilenceID(ctx, id); err != nil {
+			klog.ErrorS(err, "Failed to delete orphaned silence", "action", "delete", "silenceID", id)
+		} else {
+			klog.InfoS("Deleted orphaned silence", "action", "delete", "silenceID", id)
+		}
+	}
+
+	m.persist(ctx)
+}
+
+// loadExistingSilences rebuilds the node to silence mapping from the silences in Alertmanager
+func (m *SilenceManager) loadExistingSilences(ctx context.Context) {
+	silences, err := m.ownedSilences(ctx)
 	if err != nil {
 		klog.Warningf("Failed to load existing silences: %v", err)
-	} else {
-		for _, silence := range silences {
-			// Store silences created by rollout-helper
-			if silence.CreatedBy != nil && *silence.CreatedBy == "rollout-helper" {
-
-				// Delete alert if expired
-				if silence.EndsAt != nil && time.Now().After(time.Time(*silence.EndsAt)) {
-					if err := client.DeleteSilenceID(ctx, silence.ID); err != nil {
-						klog.Errorf("Failed to delete expired silence %s: %v", silence.ID, err)
-					} else {
-						klog.Infof("Deleted expired silence %s", silence.ID)
-					}
+		return
+	}
+
+	for _, silence := range silences {
+		// Expired silences are garbage collected by Alertmanager itself
+		if !isOwned(silence) || isExpired(silence) {
+			continue
+		}
+
+		if node, ok := commentNode(silence.Comment); ok {
+			m.activeSilences.Add(node, m.restored(silence), time.Time(*silence.StartsAt))
+			klog.Infof("Loaded existing silence %s for node %s", silence.ID, node)
+		}
+	}
+	m.restorePools(silences)
+}
+
+// deleteNodeSilences is the fallback when the tracked IDs of a node are
+// unknown or couldn't be deleted, it looks the node's active silences up in
+// Alertmanager and deletes them
+func (m *SilenceManager) deleteNodeSilences(ctx context.Context, nodeName string) error {
+	silences, err := m.amClient.OwnedSilences(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get silences: %w", err)
+	}
+
+	for _, silence := range silences {
+		if !isOwned(silence) || isExpired(silence) {
+			continue
+		}
+		if node, ok := commentNode(silence.Comment); !ok || node != nodeName {
+			continue
+		}
+		if err := m.amClient.DeleteSilenceID(ctx, silence.ID); err != nil {
+			return fmt.Errorf("failed to delete silence %s: %w", silence.ID, err)
+		}
+	}
+	return nil
+}
+
+// persist saves the current node to silence mapping if a store is configured
+// and rewrites the rollback script
+func (m *SilenceManager) persist(ctx context.Context) {
+	// The state belongs to the instance managing the silences
+	if m.held.Load() {
+		return
+	}
+	m.writeRollback(ctx)
+	if m.store == nil {
+		return
+	}
+
+	if err := m.store.Save(ctx, m.activeSilences.Snapshot()); err != nil {
+		klog.Errorf("Failed to persist silence state: %v", err)
+	}
+	m.persistRollouts(ctx)
+	m.persistDetached(ctx)
+	m.persistManual(ctx)
+}
+
+// Start periodically extends the silences of nodes which are still rolling,
+// drops nodes whose silences have expired and validates the pod selectors
+func (m *SilenceManager) Start(ctx context.Context) {
+	if m.options.DiscoverDaemonSets {
+		m.startDiscovery(ctx)
+	}
+	m.startAccessChecks(ctx)
+	m.startSelectorValidation(ctx)
+	if m.options.Instances != nil {
+		m.startVersionGuard(ctx)
+	}
+	if m.options.ReconcileInterval > 0 {
+		m.startReconciler(ctx)
+	}
+	if m.options.CriticalPodSilenceDuration > 0 {
+		m.startRelocations(ctx)
+	}
+	if m.options.EvictionSilenceDuration > 0 {
+		m.startEvictionWatches(ctx)
+	}
+	if m.options.GCInterval > 0 {
+		m.startGarbageCollection(ctx)
+	}
+	if m.options.Verifier != nil {
+		m.startVerification(ctx)
+	}
+	if m.options.Prometheus != nil && m.options.TargetsTimeout > 0 {
+		m.startTargetChecks(ctx)
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if m.held.Load() {
 					continue
 				}
+				m.renewSilences(ctx)
+				m.expireOverrides(ctx)
+				m.unsilenceDelayed(ctx)
+				m.unsilenceManualExpired(ctx)
+				if m.activeSilences.Cleanup() > 0 {
+					m.persist(ctx)
+				}
+			}
+		}
+	}()
+}
 
-				// Load alert if not expired
-				for _, matcher := range silence.Matchers {
-					if matcher.Name != nil && *matcher.Name == "node" && matcher.Value != nil {
-						manager.activeSilences.Store(*matcher.Value, true)
-						klog.Infof("Loaded existing silence for node %s", *matcher.Value)
-					}
+// renewSilences extends the silences of tracked nodes that are about to
+// expire by their duration, up to MaxSilenceDuration after the rollout
+// started, the end of the node's maintenance window or the end of the delay
+// after its rollout
+func (m *SilenceManager) renewSilences(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "SilenceManager.RenewSilences")
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	changed := false
+	m.escalateRollouts(ctx, now)
+	m.renewPools(ctx, now)
+	for node, entry := range m.activeSilences.Expiring(now.Add(renewBefore)) {
+		limit, ok := m.renewLimit(node, entry.startedAt)
+		if !ok {
+			continue
+		}
+
+		silences := make([]TrackedSilence, 0, len(entry.silences))
+		for _, silence := range entry.silences {
+			if m.isPoolSilence(silence.ID) {
+				// Renewed with its pool
+				silences = append(silences, silence)
+				continue
+			}
+			endsAt := now.Add(silence.Duration)
+			if endsAt.After(limit) {
+				endsAt = limit
+			}
+			if !silence.ExpiresAt.Before(now.Add(renewBefore)) || !endsAt.After(silence.ExpiresAt) {
+				silences = append(silences, silence)
+				continue
+			}
+
+			newID, err := m.amClient.ExtendSilence(ctx, silence.ID, endsAt)
+			if err != nil {
+				if !errors.Is(err, ErrCircuitOpen) {
+					klog.ErrorS(err, "Failed to extend silence", "action", "extend", "node", node, "silenceID", silence.ID)
 				}
+				m.recordFailure(node, operationExtend, err)
+				if !errors.Is(err, ErrCircuitOpen) {
+					m.recordPolicyEvent(silence.Policy, corev1.EventTypeWarning, reasonSilenceFailed, "Failed to extend silence %s of policy %s for node %s: %v", silence.ID, silence.Policy, node, err)
+				}
+				silences = append(silences, silence)
+				continue
 			}
+			silences = append(silences, TrackedSilence{ID: newID, Kind: silence.Kind, Policy: silence.Policy, Duration: silence.Duration, ExpiresAt: endsAt})
+			changed = true
+			m.recordEvent(node, reasonSilenceExtended, "Extended silence %s until %s", newID, endsAt.Format(time.RFC3339))
+			m.recordPolicyEvent(silence.Policy, corev1.EventTypeNormal, reasonSilenceExtended, "Extended silence %s of policy %s for node %s until %s", newID, silence.Policy, node, endsAt.Format(time.RFC3339))
+			m.options.Audit.Record(audit.Entry{Node: node, Action: audit.ActionExtended, SilenceID: newID, Kind: string(silence.Kind), Until: timePtr(endsAt)})
+		}
+
+		if !m.activeSilences.Extend(node, silences) {
+			klog.V(2).Infof("Node %s is no longer tracked, not extending its silences", node)
 		}
 	}
 
-	return manager
+	if changed {
+		m.persist(ctx)
+	}
 }
 
-func (m *SilenceManager) HandleNodeState(ctx context.Context, nodeName string, isRolling bool) error {
+// renewLimit returns until when the silences of a tracked node are extended:
+// the end of its maintenance window, of its verification, of waiting for its
+// scrape targets, of the delay after its rollout or of its manual silence,
+// otherwise MaxSilenceDuration after its rollout started. ok is false if they
+// aren't extended
+func (m *SilenceManager) renewLimit(node string, startedAt time.Time) (time.Time, bool) {
+	if until, ok := m.maintenanceUntil(node); ok {
+		return until, true
+	}
+	if since, ok := m.verifyingSince(node); ok {
+		return since.Add(m.options.VerifyTimeout + m.targetsTimeout() + m.options.UnsilenceDelay), true
+	}
+	if since, ok := m.targetsSince(node); ok {
+		return since.Add(m.options.TargetsTimeout + m.options.UnsilenceDelay), true
+	}
+	if at, ok := m.delayedUntil(node); ok {
+		return at, true
+	}
+	if at, ok := m.manualUntil(node); ok {
+		return at, true
+	}
+	if m.options.MaxSilenceDuration <= 0 {
+		return time.Time{}, false
+	}
+	return startedAt.Add(m.options.MaxSilenceDuration), true
+}
+
+// Circuit returns the state of the circuit breaker of Alertmanager requests
+func (m *SilenceManager) Circuit() CircuitStatus {
+	return m.amClient.Circuit()
+}
+
+// Silences returns the silences currently tracked per node
+func (m *SilenceManager) Silences() map[string][]TrackedSilence {
+	return m.activeSilences.Entries()
+}
+
+// HandleNodeState silences a node which started rolling with silences of the
+// given kind, and removes the silences of a node which stopped rolling
+func (m *SilenceManager) HandleNodeState(ctx context.Context, nodeName string, isRolling bool, kind SilenceKind) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "SilenceManager.HandleNodeState", trace.WithAttributes(
+		attribute.String("node", nodeName),
+		attribute.Bool("rolling", isRolling),
+		attribute.String("kind", kind.String()),
+	))
+	defer tracing.End(span, &err)
+
+	// The span includes waiting for the lock, e.g. behind a slow renewal
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if isRolling {
-		_, exist := m.activeSilences.Load(nodeName)
-		if exist {
-			klog.Infof("Alert already exist for Node %s: Ignoring", nodeName)
+		m.rolling[nodeName] = kind
+		m.startRollout(nodeName)
+		// Rolling again within the delay, the silences are still in place
+		delete(m.delayed, nodeName)
+		delete(m.verifying, nodeName)
+		delete(m.targets, nodeName)
+		// The rollout takes over the manual silences
+		delete(m.manual, nodeName)
+		if m.held.Load() {
+			return nil
+		}
+		// The silences of the node may exist already and not be persisted again
+		m.persistRollouts(ctx)
+		m.persistManual(ctx)
+		if until, ok := m.unsilencedUntil(nodeName); ok {
+			klog.Infof("Node %s is force-unsilenced until %s, not creating silences", nodeName, until.Format(time.RFC3339))
+			return nil
+		}
+		if since, ok := m.escalatedSince(nodeName); ok {
+			klog.Infof("Rollout of node %s was escalated at %s, not creating silences", nodeName, since.Format(time.RFC3339))
 			return nil
 		}
+		return m.silenceNode(ctx, nodeName, kind)
+	}
+
+	// Remove silence when node is done rolling
+	delete(m.rolling, nodeName)
+	delete(m.escalated, nodeName)
+	delete(m.rollouts, nodeName)
+	if m.held.Load() {
+		return nil
+	}
+	if until, ok := m.maintenanceUntil(nodeName); ok {
+		klog.Infof("Node %s is under maintenance until %s, keeping its silences", nodeName, until.Format(time.RFC3339))
+		return nil
+	}
+	if m.verifyRollout(nodeName) || m.waitForTargets(nodeName) || m.delayUnsilence(nodeName) {
+		m.persistRollouts(ctx)
+		return nil
+	}
+	return m.unsilenceNode(ctx, nodeName)
+}
+
+// HandleNodeDeleted deletes the silences of a node which was deleted while
+// rolling right away, without waiting for UnsilenceDelay, and forgets it
+func (m *SilenceManager) HandleNodeDeleted(ctx context.Context, nodeName string) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "SilenceManager.HandleNodeDeleted", trace.WithAttributes(attribute.String("node", nodeName)))
+	defer tracing.End(span, &err)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held.Load() {
+		delete(m.rolling, nodeName)
+		delete(m.rollouts, nodeName)
+		return nil
+	}
+	if !m.forgetNode(nodeName) {
+		m.persistRollouts(ctx)
+		return nil
+	}
+	metrics.NodesDeleted.Inc()
+	return m.unsilenceNode(ctx, nodeName)
+}
+
+// forgetNode drops the state kept for a deleted node, it returns false if
+// the node is selected by a maintenance window, which may select nodes before
+// they join the cluster. The lock must be held
+func (m *SilenceManager) forgetNode(nodeName string) bool {
+	delete(m.rolling, nodeName)
+	delete(m.escalated, nodeName)
+	delete(m.rollouts, nodeName)
+	delete(m.verifying, nodeName)
+	delete(m.targets, nodeName)
+	delete(m.unsilenced, nodeName)
+	delete(m.critical, nodeName)
+	if _, ok := m.maintenanceUntil(nodeName); ok {
+		return false
+	}
+	klog.Infof("Node %s was deleted, deleting its silences", nodeName)
+	return true
+}
+
+// silenceNode creates the silences of a node which started rolling, the lock must be held
+func (m *SilenceManager) silenceNode(ctx context.Context, nodeName string, kind SilenceKind) error {
+	_, exist := m.activeSilences.Get(nodeName)
+	if exist {
+		klog.Infof("Alert already exist for Node %s: Ignoring", nodeName)
+		return nil
+	}
+
+	// Create silence when node starts rolling
+	silences, complete := m.createSilences(ctx, nodeName, kind)
+	m.setIncomplete(nodeName, !complete)
+	m.catchUp(ctx, nodeName, kind)
+	m.trackCriticalPods(ctx, nodeName)
+
+	m.activeSilences.Set(nodeName, silences)
+	m.persist(ctx)
+	klog.InfoS("Silenced node", "action", "silence", "node", nodeName, "kind", kind, "silences", len(silences))
+	if len(silences) > 0 {
+		m.recordEvent(nodeName, reasonSilenceCreated, "Created %d %s silences: %s", len(silences), kind, strings.Join(silenceIDs(silences), ", "))
+	}
+	return nil
+}
 
-		// Create silence when node starts rolling
-		m.CreateNodeSilence(ctx, nodeName)
-		m.CreateInstanceSilence(ctx, nodeName)
-		m.CreatePodSilence(ctx, nodeName)
+// createSilences creates all silences of a rolling node. Silences which
+// already exist are reused, complete is false if any of them failed
+func (m *SilenceManager) createSilences(ctx context.Context, nodeName string, kind SilenceKind) (silences []TrackedSilence, complete bool) {
+	ctx, span := tracing.Tracer().Start(ctx, "SilenceManager.CreateSilences", trace.WithAttributes(attribute.String("node", nodeName)))
+	defer func() {
+		span.SetAttributes(attribute.Int("silences", len(silences)), attribute.Bool("complete", complete))
+		span.End()
+	}()
 
-		m.activeSilences.Store(nodeName, true)
-		klog.Infof("Created silence for node %s", nodeName)
-	} else {
-		// Remove silence when node is done rolling
-		if _, exists := m.activeSilences.LoadAndDelete(nodeName); exists {
-			if err := m.amClient.DeleteSilence(ctx, nodeName); err != nil {
-				return fmt.Errorf("failed to delete silence for node %s: %w", nodeName, err)
+	// The groups are independent, their requests share the client's pool.
+	// They run on workers, which leave the manager's state to this goroutine
+	windows := m.isWindowsNode(ctx, nodeName)
+	var join *poolJoin
+	var joinID string
+	var joinErr error
+	if pool := m.silencePool(ctx, nodeName); pool != "" {
+		join = m.prepareJoin(pool, nodeName, kind)
+	}
+	builtin := func(template, id string, err error) ([]TrackedSilence, error) {
+		if err != nil || id == "" {
+			return nil, err
+		}
+		return []TrackedSilence{track(id, kind, template, m.templateDuration(template))}, nil
+	}
+	groups := []func() ([]TrackedSilence, error){
+		func() ([]TrackedSilence, error) {
+			if join != nil {
+				// Recorded once the workers are done
+				joinID, joinErr = join.send(ctx, m)
+				return nil, joinErr
+			}
+			id, err := m.CreateNodeSilence(ctx, nodeName, kind, windows)
+			return builtin(config.TemplateNode, id, err)
+		},
+		func() ([]TrackedSilence, error) {
+			id, err := m.CreateInstanceSilence(ctx, nodeName, kind, windows)
+			return builtin(config.TemplateInstance, id, err)
+		},
+		func() ([]TrackedSilence, error) {
+			id, err := m.CreatePodSilence(ctx, nodeName, kind)
+			if err != nil {
+				klog.Errorf("Failed to create pod silence for node %s: %v", nodeName, err)
+				m.recordFailure(nodeName, operationCreate, err)
 			}
-			klog.Infof("Removed silence for node %s", nodeName)
+			return builtin(config.TemplatePod, id, err)
+		},
+		func() ([]TrackedSilence, error) {
+			id, err := m.CreateLogSilence(ctx, nodeName, kind)
+			return builtin(config.TemplateLogs, id, err)
+		},
+		func() ([]TrackedSilence, error) {
+			silences, err := m.CreateInfraSilences(ctx, nodeName, kind)
+			if err != nil {
+				klog.Errorf("Failed to create infra silences for node %s: %v", nodeName, err)
+			}
+			return silences, err
+		},
+		func() ([]TrackedSilence, error) {
+			id, err := m.CreateWorkloadSilence(ctx, nodeName, kind)
+			if err != nil {
+				klog.Errorf("Failed to create workload silence for node %s: %v", nodeName, err)
+				m.recordFailure(nodeName, operationCreate, err)
+			}
+			return builtin(config.TemplateWorkload, id, err)
+		},
+		func() ([]TrackedSilence, error) {
+			silences, err := m.CreatePolicySilences(ctx, nodeName, kind)
+			if err != nil {
+				klog.Errorf("Failed to create policy silences for node %s: %v", nodeName, err)
+			}
+			return silences, err
+		},
+	}
+
+	created := make([][]TrackedSilence, len(groups))
+	errs := make([]error, len(groups))
+	tasks := make([]func(), len(groups))
+	for i, group := range groups {
+		i, group := i, group
+		tasks[i] = func() { created[i], errs[i] = group() }
+	}
+	m.amClient.throttle.parallel(tasks)
+	if join != nil {
+		silence, err := m.finishJoin(ctx, join, joinID, joinErr)
+		if err == nil {
+			created[0] = []TrackedSilence{silence}
+		}
+	}
+
+	// Partially created groups are kept, in the order of the groups
+	complete = true
+	for i := range groups {
+		if errs[i] != nil {
+			complete = false
 		}
+		silences = append(silences, created[i]...)
 	}
+	return silences, complete
+}
+
+// unsilenceNode deletes the silences of a node, the lock must be held
+func (m *SilenceManager) unsilenceNode(ctx context.Context, nodeName string) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "SilenceManager.UnsilenceNode", trace.WithAttributes(attribute.String("node", nodeName)))
+	defer tracing.End(span, &err)
+
+	delete(m.delayed, nodeName)
+	delete(m.verifying, nodeName)
+	delete(m.targets, nodeName)
+	delete(m.manual, nodeName)
+	delete(m.incomplete, nodeName)
+	m.deleteCatchUps(ctx, nodeName)
+	delete(m.critical, nodeName)
+	shared := make(map[string]bool)
+	for _, silence := range m.pools {
+		shared[silence.id] = true
+	}
+	m.leavePool(ctx, nodeName)
+	policies := make(map[string]string)
+	if tracked, ok := m.activeSilences.Get(nodeName); ok {
+		for _, silence := range tracked {
+			policies[silence.ID] = silence.Policy
+		}
+	}
+	ids, exists := m.activeSilences.Delete(nodeName)
+	if !exists {
+		return nil
+	}
+	m.persist(ctx)
+
+	reconcile := len(ids) == 0
+	for _, id := range ids {
+		if shared[id] {
+			// Deleted by leavePool with the pool's last member
+			continue
+		}
+		if err := m.amClient.DeleteSilenceID(ctx, id); err != nil {
+			klog.ErrorS(err, "Failed to delete silence", "action", "delete", "node", nodeName, "silenceID", id)
+			reconcile = true
+			continue
+		}
+		m.options.Audit.Record(audit.Entry{Node: nodeName, Action: audit.ActionDeleted, SilenceID: id})
+		m.recordPolicyEvent(policies[id], corev1.EventTypeNormal, reasonSilenceDeleted, "Deleted silence %s of policy %s for node %s", id, policies[id], nodeName)
+	}
+	if reconcile {
+		if err := m.deleteNodeSilences(ctx, nodeName); err != nil {
+			m.recordFailure(nodeName, operationDelete, err)
+			return fmt.Errorf("failed to delete silence for node %s: %w", nodeName, err)
+		}
+		m.options.Audit.Record(audit.Entry{Node: nodeName, Action: audit.ActionDeleted, Message: "deleted the silences found in Alertmanager"})
+	}
+	klog.InfoS("Unsilenced node", "action", "unsilence", "node", nodeName)
+	m.failures.clear(nodeName)
+	m.recordEvent(nodeName, reasonSilenceDeleted, "Deleted the silences of the rollout")
 	return nil
 }
 
+// templateDuration returns the silence duration of a built-in template
+func (m *SilenceManager) templateDuration(template string) time.Duration {
+	return m.currentConfig().SilenceDuration(template, m.options.SilenceDuration)
+}
+
+// restored tracks a silence found in Alertmanager, its original duration is
+// unknown so it's renewed by the global duration
+func (m *SilenceManager) restored(silence models.PostableSilence) TrackedSilence {
+	_, kind, _ := parseComment(silence.Comment)
+	return TrackedSilence{
+		ID:        silence.ID,
+		Kind:      kind,
+		Duration:  m.options.SilenceDuration,
+		ExpiresAt: time.Time(*silence.EndsAt),
+	}
+}
+
+// track records a silence which was just created from policy, a silence
+// policy or built-in template
+func track(id string, kind SilenceKind, policy string, duration time.Duration) TrackedSilence {
+	return TrackedSilence{
+		ID:        id,
+		Kind:      kind,
+		Policy:    policy,
+		Duration:  duration,
+		ExpiresAt: time.Now().Add(duration),
+	}
+}
+
+// isOwned reports whether the silence was created by the rollout helper
+func isOwned(silence models.PostableSilence) bool {
+	return silence.CreatedBy != nil && *silence.CreatedBy == createdBy
+}
+
+func isExpired(silence models.PostableSilence) bool {
+	return silence.EndsAt != nil && time.Now().After(time.Time(*silence.EndsAt))
+}
+
 type daemonSetIdent struct {
 	namespace string
 	dsName    string
 	label     string
 }
 
-func (m *SilenceManager) CreatePodSilence(ctx context.Context, nodeName string) error {
-	dsList := []daemonSetIdent{
-		{ // CiliumScrapingTargetDown
-			"kube-system",
-			"cilium",
-			"k8s-app=cilium",
-		},
-		{ // DnsScrapingTargetDown
-			"openshift-dns",
-			"dns",
-			"app=openshift-dns",
-		},
-		{ // ScrapingTargetDown collector
-			"openshift-logging",
-			"collector",
-			"component=collector",
-		},
-		{ // ScrapingTargetDown fluent-bit
-			"snappcloud-logging",
-			"flunet-bit",
-			"app.kubernetes.io/name=fluentbit",
-		},
-	}
+// podSilenceTargets are the daemonsets whose pods on a rolling node are silenced
+var podSilenceTargets = []daemonSetIdent{
+	{ // CiliumScrapingTargetDown
+		"kube-system",
+		"cilium",
+		"k8s-app=cilium",
+	},
+	{ // DnsScrapingTargetDown
+		"openshift-dns",
+		"dns",
+		"app=openshift-dns",
+	},
+	{ // ScrapingTargetDown collector
+		"openshift-logging",
+		"collector",
+		"component=collector",
+	},
+	{ // ScrapingTargetDown fluent-bit
+		"snappcloud-logging",
+		"fluent-bit",
+		"app.kubernetes.io/name=fluentbit",
+	},
+}
 
+func (m *SilenceManager) CreatePodSilence(ctx context.Context, nodeName string, kind SilenceKind) (string, error) {
 	// Collect all pod names and namespaces
 	var podNames []string
 	var namespaces []string
 
-	for _, dsIdent := range dsList {
+	for _, dsIdent := range m.podTargets() {
+		if !m.options.Namespaces.Contains(dsIdent.namespace) {
+			klog.V(2).Infof("Skipping daemonset %s/%s, its namespace is out of scope", dsIdent.namespace, dsIdent.dsName)
+			continue
+		}
+		if !m.access.Allowed(dsIdent.namespace) {
+			klog.V(2).Infof("Skipping daemonset %s/%s, listing pods in its namespace is forbidden", dsIdent.namespace, dsIdent.dsName)
+			continue
+		}
+
 		// List pods for this daemonset on the specified node
 		pods, err := m.k8sClient.CoreV1().Pods(dsIdent.namespace).List(ctx, metav1.ListOptions{
 			FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
 			LabelSelector: dsIdent.label,
 		})
+		if apierrors.IsForbidden(err) {
+			m.access.Deny(dsIdent.namespace, err)
+			continue
+		}
 		if err != nil {
 			klog.Errorf("Failed to list pods for daemonset %s/%s: %v", dsIdent.namespace, dsIdent.dsName, err)
 			continue
@@ -139,7 +932,7 @@ func (m *SilenceManager) CreatePodSilence(ctx context.Context, nodeName string)
 
 	if len(podNames) == 0 {
 		klog.Infof("No pods found for node %s", nodeName)
-		return nil
+		return "", nil
 	}
 
 	// Create a single silence for all pods
@@ -156,20 +949,26 @@ func (m *SilenceManager) CreatePodSilence(ctx context.Context, nodeName string)
 		},
 	}
 
-	if err := m.amClient.CreateSilence(ctx, matchers, nodeName); err != nil {
-		return fmt.Errorf("failed to create silence for pods: %w", err)
+	id, err := m.amClient.CreateSilence(ctx, matchers, nodeName, kind, m.templateDuration(config.TemplatePod))
+	if err != nil {
+		return "", fmt.Errorf("failed to create silence for pods: %w", err)
 	}
 
 	klog.Infof("Created silence for %d pods on node %s", len(podNames), nodeName)
-	return nil
+	return id, nil
 }
 
-func (m *SilenceManager) CreateInstanceSilence(ctx context.Context, nodeName string) error {
-	// Define services that need to be silenced
-	alertServices := []string{
-		"node-exporter",
-		"kubernetes-cadvisor",
-		"kubelet",
+// instanceServices are the jobs silenced by the instance silence of a Linux node
+var instanceServices = []string{
+	"node-exporter",
+	"kubernetes-cadvisor",
+	"kubelet",
+}
+
+func (m *SilenceManager) CreateInstanceSilence(ctx context.Context, nodeName string, kind SilenceKind, windows bool) (string, error) {
+	alertServices := instanceServices
+	if windows {
+		alertServices = windowsInstanceServices
 	}
 
 	// Create a single regex pattern that matches all services
@@ -178,8 +977,8 @@ func (m *SilenceManager) CreateInstanceSilence(ctx context.Context, nodeName str
 	matchers := models.Matchers{
 		{
 			Name:    stringPtr("instance"),
-			Value:   stringPtr(nodeName),
-			IsRegex: boolPtr(false),
+			Value:   stringPtr(m.instancePattern(ctx, nodeName)),
+			IsRegex: boolPtr(true),
 		},
 		{
 			Name:    stringPtr("alertname"),
@@ -192,19 +991,43 @@ func (m *SilenceManager) CreateInstanceSilence(ctx context.Context, nodeName str
 			IsRegex: boolPtr(true),
 		},
 	}
-	if err := m.amClient.CreateSilence(ctx, matchers, nodeName); err != nil {
-		klog.Errorf("failed to create silence for instance %s: %w", nodeName, err)
+	id, err := m.amClient.CreateSilence(ctx, matchers, nodeName, kind, m.templateDuration(config.TemplateInstance))
+	if err != nil {
+		klog.Errorf("failed to create silence for instance %s: %v", nodeName, err)
+		m.recordFailure(nodeName, operationCreate, err)
 	}
-	return nil
+	return id, err
 }
 
-func (m *SilenceManager) CreateNodeSilence(ctx context.Context, nodeName string) error {
-	_, exist := m.activeSilences.Load(nodeName)
-	if exist {
-		klog.Infof("Alert already exist for Node %s: Ignoring", nodeName)
-		return nil
+// instancePattern matches the instance label of targets on the node, see
+// prometheus.InstancePattern. Nodes which can't be looked up are matched by
+// name only
+func (m *SilenceManager) instancePattern(ctx context.Context, nodeName string) string {
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Warningf("Failed to get node %s, silencing its instances by name only: %v", nodeName, err)
+		node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	}
+	return prometheus.InstancePattern(node)
+}
+
+func (m *SilenceManager) CreateNodeSilence(ctx context.Context, nodeName string, kind SilenceKind, windows bool) (string, error) {
+	node := &models.Matcher{
+		Name:    stringPtr("node"),
+		Value:   stringPtr(nodeName),
+		IsRegex: boolPtr(false),
+	}
+	id, err := m.amClient.CreateSilence(ctx, nodeSilenceMatchers(node, windows), nodeName, kind, m.templateDuration(config.TemplateNode))
+	if err != nil {
+		klog.Errorf("failed to create silence for node %s: %v", nodeName, err)
+		m.recordFailure(nodeName, operationCreate, err)
 	}
+	return id, err
+}
 
+// nodeSilenceMatchers returns the matchers of the built-in node silence for
+// the nodes selected by node
+func nodeSilenceMatchers(node *models.Matcher, windows bool) models.Matchers {
 	alertNames := []string{
 		"KubeNodeNotReady",
 		"KubeNodeUnreachable",
@@ -222,17 +1045,16 @@ func (m *SilenceManager) CreateNodeSilence(ctx context.Context, nodeName string)
 		"crio",
 		"kubelet",
 	}
+	if windows {
+		alertServices = windowsNodeServices
+	}
 
 	// Create a single regex pattern that matches all services
 	alertPattern := fmt.Sprintf("(%s)", strings.Join(alertNames, "|"))
 	servicesPattern := fmt.Sprintf("(%s)", strings.Join(alertServices, "|"))
 
-	matchers := models.Matchers{
-		{
-			Name:    stringPtr("node"),
-			Value:   stringPtr(nodeName),
-			IsRegex: boolPtr(false),
-		},
+	return models.Matchers{
+		node,
 		{
 			Name:    stringPtr("alertname"),
 			Value:   stringPtr(alertPattern),
@@ -244,8 +1066,4 @@ func (m *SilenceManager) CreateNodeSilence(ctx context.Context, nodeName string)
 			IsRegex: boolPtr(true),
 		},
 	}
-	if err := m.amClient.CreateSilence(ctx, matchers, nodeName); err != nil {
-		klog.Errorf("failed to create silence for node %s: %w", nodeName, err)
-	}
-	return nil
 }
@@ -0,0 +1,80 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ownedSilences fetches the active silences of the helper except those of
+// existing nodes outside Options.NodeSelector, which belong to the instance
+// managing these nodes. Silences of deleted nodes are kept, any instance may
+// clean them up
+func (m *SilenceManager) ownedSilences(ctx context.Context) ([]models.PostableSilence, error) {
+	silences, err := m.amClient.OwnedSilences(ctx)
+	if err != nil || m.options.NodeSelector == nil {
+		return silences, err
+	}
+	foreign, err := m.foreignNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := silences[:0]
+	for _, silence := range silences {
+		if !isForeign(silence, foreign) {
+			kept = append(kept, silence)
+		}
+	}
+	return kept, nil
+}
+
+// foreignNodes returns the existing nodes which aren't selected by Options.NodeSelector
+func (m *SilenceManager) foreignNodes(ctx context.Context) (map[string]bool, error) {
+	nodes, err := m.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	foreign := make(map[string]bool)
+	for _, node := range nodes.Items {
+		if !m.options.NodeSelector.Matches(labels.Set(node.Labels)) {
+			foreign[node.Name] = true
+		}
+	}
+	return foreign, nil
+}
+
+// selectsNode reports whether a node is managed by this instance, all nodes
+// are without Options.NodeSelector
+func (m *SilenceManager) selectsNode(node *corev1.Node) bool {
+	return m.options.NodeSelector == nil || m.options.NodeSelector.Matches(labels.Set(node.Labels))
+}
+
+// rejectForeign returns an error wrapping ErrRejected if a node belongs to
+// another instance, whose reconciliation would expire its silences
+func (m *SilenceManager) rejectForeign(node *corev1.Node) error {
+	if m.selectsNode(node) {
+		return nil
+	}
+	return fmt.Errorf("%w: node %s isn't selected by the node selector of this instance", ErrRejected, node.Name)
+}
+
+// isForeign reports whether a silence is one of a node in foreign, or a pool
+// silence covering one
+func isForeign(silence models.PostableSilence, foreign map[string]bool) bool {
+	if node, ok := commentNode(silence.Comment); ok {
+		return foreign[node]
+	}
+	if _, _, members, ok := parsePoolComment(silence.Comment); ok {
+		for _, member := range members {
+			if foreign[member] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// MaxForceUnsilence caps how long a node can be force-unsilenced
+const MaxForceUnsilence = 24 * time.Hour
+
+// ForceUnsilence deletes the silences of a node and doesn't create new ones
+// for it until the returned time, even if the node is still rolling. Nodes
+// which don't exist are rejected with the NotFound error of the API server,
+// nodes of other instances with ErrRejected
+func (m *SilenceManager) ForceUnsilence(ctx context.Context, nodeName string, duration time.Duration) (time.Time, error) {
+	if duration <= 0 || duration > MaxForceUnsilence {
+		return time.Time{}, fmt.Errorf("duration must be between 0 and %s", MaxForceUnsilence)
+	}
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	if err := m.rejectForeign(node); err != nil {
+		return time.Time{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held.Load() {
+		return time.Time{}, errHeld
+	}
+	until := time.Now().Add(duration)
+	m.unsilenced[nodeName] = until
+
+	if _, tracked := m.activeSilences.Get(nodeName); tracked {
+		err = m.unsilenceNode(ctx, nodeName)
+	} else {
+		// Also remove silences created before a restart or evicted from the store
+		err = m.deleteNodeSilences(ctx, nodeName)
+	}
+	if err != nil {
+		return until, fmt.Errorf("failed to delete silences of node %s: %w", nodeName, err)
+	}
+
+	klog.InfoS("Node is force-unsilenced", "action", "force-unsilence", "node", nodeName, "until", until.Format(time.RFC3339))
+	if m.options.Recorder != nil {
+		m.options.Recorder.Eventf(nodeRef(nodeName), corev1.EventTypeNormal, "ForceUnsilenced", "Silences removed and not recreated until %s", until.Format(time.RFC3339))
+	}
+	return until, nil
+}
+
+// CancelForceUnsilence ends the override of a node early, silencing it again
+// if it's still rolling. It returns false if the node wasn't force-unsilenced
+func (m *SilenceManager) CancelForceUnsilence(ctx context.Context, nodeName string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.unsilenced[nodeName]; !ok {
+		return false, nil
+	}
+	if m.held.Load() {
+		return true, errHeld
+	}
+	return true, m.endOverride(ctx, nodeName)
+}
+
+// ForceUnsilenced returns the nodes which are force-unsilenced and until when
+func (m *SilenceManager) ForceUnsilenced() map[string]time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unsilenced := make(map[string]time.Time, len(m.unsilenced))
+	for node, until := range m.unsilenced {
+		unsilenced[node] = until
+	}
+	return unsilenced
+}
+
+// unsilencedUntil returns the end of the node's override, the lock must be held
+func (m *SilenceManager) unsilencedUntil(nodeName string) (time.Time, bool) {
+	until, ok := m.unsilenced[nodeName]
+	if !ok || time.Now().After(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// expireOverrides ends the overrides whose window passed
+func (m *SilenceManager) expireOverrides(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for node, until := range m.unsilenced {
+		if now.After(until) {
+			if err := m.endOverride(ctx, node); err != nil {
+				klog.Errorf("Failed to silence node %s after its override ended: %v", node, err)
+			}
+		}
+	}
+}
+
+// endOverride drops the override of a node and silences it again if it's
+// still rolling or under maintenance, the lock must be held
+func (m *SilenceManager) endOverride(ctx context.Context, nodeName string) error {
+	delete(m.unsilenced, nodeName)
+	klog.InfoS("Force-unsilence of node ended", "action", "force-unsilence-end", "node", nodeName)
+	if kind, rolling := m.rolling[nodeName]; rolling {
+		if _, ok := m.escalatedSince(nodeName); ok {
+			return nil
+		}
+		return m.silenceNode(ctx, nodeName, kind)
+	}
+	if _, ok := m.maintenanceUntil(nodeName); ok {
+		return m.silenceNode(ctx, nodeName, KindMaintenanceWindow)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/state"
+)
+
+func TestForceUnsilenceUnknownNode(t *testing.T) {
+	m := &SilenceManager{
+		k8sClient:  fake.NewSimpleClientset(),
+		unsilenced: make(map[string]time.Time),
+	}
+
+	_, err := m.ForceUnsilence(context.Background(), "worker-9", time.Hour)
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("Expected a NotFound error, got %v", err)
+	}
+	if len(m.unsilenced) > 0 {
+		t.Errorf("Expected no override for an unknown node, got %v", m.unsilenced)
+	}
+}
+
+func TestForeignNodeRejected(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "infra-0", Labels: map[string]string{"node-role.kubernetes.io/infra": ""}}}
+	selector, err := labels.Parse("node-role.kubernetes.io/worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &SilenceManager{
+		k8sClient:      fake.NewSimpleClientset(node),
+		options:        Options{NodeSelector: selector},
+		activeSilences: newSilenceStore(maxTrackedNodes),
+		unsilenced:     make(map[string]time.Time),
+		manual:         make(map[string]time.Time),
+	}
+
+	if _, err := m.ForceUnsilence(ctx, "infra-0", time.Hour); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected force-unsilencing a node of another instance to be rejected, got %v", err)
+	}
+	if _, _, err := m.SilenceManually(ctx, "infra-0", time.Hour); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected silencing a node of another instance to be rejected, got %v", err)
+	}
+	if len(m.unsilenced) > 0 || len(m.manual) > 0 {
+		t.Errorf("Expected no state for a node of another instance, got %v and %v", m.unsilenced, m.manual)
+	}
+
+	// Maintenance windows may select it, but its instance silences it
+	m.SetMaintenance(ctx, map[string]Maintenance{"infra-0": {Window: "default/patching", Until: time.Now().Add(time.Hour)}})
+	if len(m.Maintenance()) != 0 {
+		t.Errorf("Expected the node of another instance not to be under maintenance, got %v", m.Maintenance())
+	}
+}
+
+func TestManualSilenceSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	clientset := fake.NewSimpleClientset(workerNode("worker-1", nil, nil))
+	store := state.NewConfigMapStore(clientset, "rollout-helper", "rollout-helper-state")
+
+	m := newEvictionManager(t, am.URL(), clientset, store, Options{})
+	if _, _, err := m.SilenceManually(ctx, "worker-1", time.Hour); err != nil {
+		t.Fatalf("Failed to silence the node: %v", err)
+	}
+	until := m.manual["worker-1"].UTC().Truncate(time.Second)
+
+	m = newEvictionManager(t, am.URL(), clientset, store, Options{})
+	if restored, ok := m.manualUntil("worker-1"); !ok || !restored.Equal(until) {
+		t.Fatalf("Expected the manual silences to end at %s after a restart, got %s", until, restored)
+	}
+	if !m.keepsSilences("worker-1") {
+		t.Error("Expected the manual silences to be kept after a restart")
+	}
+}
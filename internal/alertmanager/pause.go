@@ -0,0 +1,181 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/watcher"
+)
+
+// PausedAnnotation is set on the MachineConfigPools paused by the helper, to
+// the time and the alerts which paused them
+const PausedAnnotation = "rollout-helper.snappcloud.io/paused"
+
+const reasonRolloutPaused = "RolloutPaused"
+
+// PauseOptions select the alerts which pause the MachineConfigPools being updated
+type PauseOptions struct {
+	// Filters are the matchers of the alerts which count, e.g. severity="critical"
+	Filters []string
+	// Threshold is how many of the alerts have to fire unsilenced
+	Threshold int
+	// Interval is how often the alerts are checked
+	Interval time.Duration
+}
+
+// Validate checks the filters are matchers Alertmanager accepts
+func (o PauseOptions) Validate() error {
+	if len(o.Filters) == 0 {
+		return errors.New("at least one alert filter is required")
+	}
+	for _, filter := range o.Filters {
+		if _, err := labels.ParseMatcher(filter); err != nil {
+			return fmt.Errorf("invalid alert filter %q: %w", filter, err)
+		}
+	}
+	if o.Threshold < 1 {
+		return errors.New("the alert threshold must be at least 1")
+	}
+	if o.Interval <= 0 {
+		return errors.New("the check interval must be positive")
+	}
+	return nil
+}
+
+// PoolPauser pauses the MachineConfigPools being updated while alerts fire
+// which the silences of the rollout don't cover, so a rollout breaking the
+// cluster stops before it reaches more nodes. Pools are never resumed by the
+// helper, that's left to an operator
+type PoolPauser struct {
+	amClient *Client
+	client   dynamic.Interface
+	recorder record.EventRecorder
+	options  PauseOptions
+}
+
+// NewPoolPauser creates a pauser, recorder is optional
+func NewPoolPauser(amClient *Client, client dynamic.Interface, recorder record.EventRecorder, options PauseOptions) *PoolPauser {
+	return &PoolPauser{
+		amClient: amClient,
+		client:   client,
+		recorder: recorder,
+		options:  options,
+	}
+}
+
+// Start checks the alerts every Interval until ctx is cancelled
+func (p *PoolPauser) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.check(ctx); err != nil && !errors.Is(err, ErrCircuitOpen) {
+					klog.Errorf("Failed to check whether to pause MachineConfigPools: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// check pauses the pools being updated if enough alerts fire unsilenced
+func (p *PoolPauser) check(ctx context.Context) error {
+	pools, err := p.client.Resource(watcher.MachineConfigPoolResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list MachineConfigPools: %w", err)
+	}
+	var updating []unstructured.Unstructured
+	for _, pool := range pools.Items {
+		if poolUpdating(&pool) {
+			updating = append(updating, pool)
+		}
+	}
+	if len(updating) == 0 {
+		return nil
+	}
+
+	// Alerts of the rolling nodes are silenced, the ones left fire for a reason
+	alerts, err := p.amClient.FiringAlerts(ctx, p.options.Filters...)
+	if err != nil {
+		return fmt.Errorf("failed to get firing alerts: %w", err)
+	}
+	if len(alerts) < p.options.Threshold {
+		return nil
+	}
+
+	names := alertNames(alerts)
+	var errs []error
+	for _, pool := range updating {
+		if err := p.pause(ctx, &pool, len(alerts), names); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pause sets spec.paused of the pool and records why
+func (p *PoolPauser) pause(ctx context.Context, pool *unstructured.Unstructured, count int, names []string) error {
+	reason := fmt.Sprintf("%d alerts firing at %s: %s", count, time.Now().UTC().Format(time.RFC3339), strings.Join(names, ", "))
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{PausedAnnotation: reason},
+		},
+		"spec": map[string]interface{}{"paused": true},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := p.client.Resource(watcher.MachineConfigPoolResource).Patch(ctx, pool.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to pause MachineConfigPool %s: %w", pool.GetName(), err)
+	}
+
+	metrics.PoolsPaused.WithLabelValues(pool.GetName()).Inc()
+	klog.InfoS("Paused the update of the MachineConfigPool", "action", "pause", "pool", pool.GetName(), "alerts", names, "count", count)
+	if p.recorder != nil {
+		p.recorder.Eventf(&corev1.ObjectReference{
+			APIVersion: pool.GetAPIVersion(),
+			Kind:       pool.GetKind(),
+			Name:       pool.GetName(),
+			UID:        pool.GetUID(),
+		}, corev1.EventTypeWarning, reasonRolloutPaused, "Paused the update, %s", reason)
+	}
+	return nil
+}
+
+// poolUpdating reports whether the MCO is updating a pool which isn't paused
+func poolUpdating(pool *unstructured.Unstructured) bool {
+	if paused, _, _ := unstructured.NestedBool(pool.Object, "spec", "paused"); paused {
+		return false
+	}
+	total, _, _ := unstructured.NestedInt64(pool.Object, "status", "machineCount")
+	updated, _, _ := unstructured.NestedInt64(pool.Object, "status", "updatedMachineCount")
+	if updated < total {
+		return true
+	}
+	conditions, _, _ := unstructured.NestedSlice(pool.Object, "status", "conditions")
+	for _, condition := range conditions {
+		fields, ok := condition.(map[string]interface{})
+		if ok && fields["type"] == "Updating" && fields["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
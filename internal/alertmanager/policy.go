@@ -0,0 +1,211 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/scope"
+	"rollout-helper/internal/watcher"
+)
+
+// TemplateData is the data passed to matcher value and comment templates
+type TemplateData struct {
+	Node *corev1.Node
+	// NodeName is the name of the rolling node
+	NodeName string
+	// NodeIP is the node's first InternalIP, e.g. for instance="{{ .NodeIP }}:9100"
+	NodeIP string
+	// PoolName is the MachineConfigPool of the node, empty if unknown
+	PoolName string
+
+	pods func() []string
+}
+
+// NewTemplateData returns the template data of a node. The names of the
+// node's pods in namespaces are listed with client the first time a template
+// uses them
+func NewTemplateData(ctx context.Context, client kubernetes.Interface, namespaces scope.Namespaces, node *corev1.Node) TemplateData {
+	data := TemplateData{
+		Node:     node,
+		NodeName: node.Name,
+		NodeIP:   nodeIP(node),
+		PoolName: watcher.NodePool(node),
+	}
+
+	var names []string
+	listed := false
+	data.pods = func() []string {
+		if listed {
+			return names
+		}
+		listed = true
+		pods, err := namespaces.ListPods(ctx, client, metav1.ListOptions{FieldSelector: "spec.nodeName=" + node.Name})
+		if err != nil {
+			klog.Errorf("Failed to list pods of node %s for templates: %v", node.Name, err)
+			return nil
+		}
+		for _, pod := range pods.Items {
+			names = append(names, pod.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	return data
+}
+
+// PodNames returns the sorted names of the pods on the node, e.g. for
+// pod=~"{{ join .PodNames "|" }}"
+func (d TemplateData) PodNames() []string {
+	if d.pods == nil {
+		return nil
+	}
+	return d.pods()
+}
+
+// nodeIP returns the first InternalIP of a node, empty if it has none
+func nodeIP(node *corev1.Node) string {
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			return address.Address
+		}
+	}
+	return ""
+}
+
+// ResolveNodePolicies returns the effective policies of a node after applying
+// the overrides of its pool and its policies annotation, which is only
+// honored if authorizer accepts it
+func ResolveNodePolicies(cfg *config.Config, node *corev1.Node, authorizer authz.Authorizer) ([]config.ResolvedPolicy, error) {
+	var nodePolicies []config.Policy
+	if annotation, ok := node.Annotations[config.NodePoliciesAnnotation]; ok {
+		object := authz.Object{Kind: "Node", Name: node.Name}
+		if err := authz.Check(authorizer, object, node.Annotations, config.NodePoliciesAnnotation); err != nil {
+			return nil, err
+		}
+		policies, err := config.ParsePolicies(annotation)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", config.NodePoliciesAnnotation, err)
+		}
+		nodePolicies = policies
+	}
+	return cfg.ResolvePolicies(watcher.NodePool(node), nodePolicies), nil
+}
+
+// CreatePolicySilences creates one silence per effective policy of the node,
+// rendering the matcher values against the rolling node. The silences which
+// were created are returned even if others failed
+func (m *SilenceManager) CreatePolicySilences(ctx context.Context, nodeName string, kind SilenceKind) ([]TrackedSilence, error) {
+	cfg := m.currentConfig()
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+
+	policies, err := ResolveNodePolicies(cfg, node, m.options.Authorizer)
+	if err != nil {
+		// Fall back to the cluster and pool layers rather than silencing nothing
+		klog.Errorf("Ignoring node policies of %s: %v", nodeName, err)
+		policies = cfg.ResolvePolicies(watcher.NodePool(node), nil)
+	}
+
+	var silences []TrackedSilence
+	failed := 0
+	data := NewTemplateData(ctx, m.k8sClient, m.options.Namespaces, node)
+	for _, policy := range policies {
+		matchers, err := RenderMatchers(policy.Matchers, data)
+		if err != nil {
+			klog.Errorf("Skipping policy %s for node %s: %v", policy.Name, nodeName, err)
+			continue
+		}
+		if alert := protectedAlert(cfg, matchers); alert != "" {
+			klog.Errorf("Skipping policy %s for node %s: it would silence the protected alert %s", policy.Name, nodeName, alert)
+			continue
+		}
+		note, err := RenderComment(policy, data)
+		if err != nil {
+			// The comment is informational, the silence is still needed
+			klog.Errorf("Ignoring comment of policy %s for node %s: %v", policy.Name, nodeName, err)
+		}
+
+		duration := m.options.SilenceDuration
+		if policy.Duration != nil {
+			duration = policy.Duration.Duration
+		}
+
+		id, err := m.amClient.CreateSilenceWithNote(WithTenant(ctx, policy.Tenant), matchers, nodeName, kind, duration, note)
+		if err != nil {
+			klog.Errorf("failed to create silence for policy %s on node %s: %v", policy.Name, nodeName, err)
+			m.recordFailure(nodeName, operationCreate, err)
+			if !errors.Is(err, ErrCircuitOpen) {
+				m.recordPolicyEvent(policy.Name, corev1.EventTypeWarning, reasonSilenceFailed, "Failed to create silence of policy %s for node %s: %v", policy.Name, nodeName, err)
+			}
+			failed++
+			continue
+		}
+		silences = append(silences, track(id, kind, policy.Name, duration))
+		m.recordPolicyEvent(policy.Name, corev1.EventTypeNormal, reasonSilenceCreated, "Created silence %s of policy %s for node %s", id, policy.Name, nodeName)
+	}
+	if failed > 0 {
+		return silences, fmt.Errorf("failed to create %d of %d policy silences", failed, len(policies))
+	}
+	return silences, nil
+}
+
+// RenderMatchers renders the matcher value templates into Alertmanager matchers
+func RenderMatchers(resolved []config.ResolvedMatcher, data TemplateData) (models.Matchers, error) {
+	matchers := make(models.Matchers, 0, len(resolved))
+	for _, matcher := range resolved {
+		var value strings.Builder
+		if err := matcher.Template().Execute(&value, data); err != nil {
+			return nil, fmt.Errorf("failed to render matcher %s: %w", matcher.Name, err)
+		}
+
+		// An empty value would silence far more than intended, e.g. when
+		// the referenced label is missing on this node
+		if value.Len() == 0 {
+			return nil, fmt.Errorf("matcher %s rendered to an empty value", matcher.Name)
+		}
+
+		matchers = append(matchers, &models.Matcher{
+			Name:    stringPtr(matcher.Name),
+			Value:   stringPtr(value.String()),
+			IsRegex: boolPtr(matcher.IsRegex),
+		})
+	}
+	return matchers, nil
+}
+
+// RenderComment renders the comment template of a policy, empty if it has none
+func RenderComment(policy config.ResolvedPolicy, data TemplateData) (string, error) {
+	if policy.CommentTemplate() == nil {
+		return "", nil
+	}
+	var comment strings.Builder
+	if err := policy.CommentTemplate().Execute(&comment, data); err != nil {
+		return "", fmt.Errorf("failed to render comment: %w", err)
+	}
+	// Comments are single line, the node and kind are parsed from them
+	return strings.Join(strings.Fields(comment.String()), " "), nil
+}
+
+// protectedAlert returns the protected alert of cfg the rendered matchers of
+// a policy cover by their alertname, empty if none
+func protectedAlert(cfg *config.Config, matchers models.Matchers) string {
+	for _, matcher := range matchers {
+		if alert := cfg.Protected(derefString(matcher.Name), derefString(matcher.Value), derefBool(matcher.IsRegex)); alert != "" {
+			return alert
+		}
+	}
+	return ""
+}
@@ -0,0 +1,362 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/watcher"
+)
+
+// poolCommentPrefix starts the comment of pool silences, which lists the
+// nodes they cover so they can be restored after a restart
+const poolCommentPrefix = "Silencing alerts for pool "
+
+// poolSilence is the built-in node silence shared by the rolling nodes of a
+// MachineConfigPool with Options.PoolSilences. Every member tracks it like
+// its own silences, but it's only renewed and deleted here
+type poolSilence struct {
+	id        string
+	kind      SilenceKind
+	members   map[string]bool
+	expiresAt time.Time
+}
+
+// poolComment returns the comment of the silence of a pool's members
+func poolComment(pool string, kind SilenceKind, members []string) string {
+	comment := poolCommentPrefix + pool + silenceCommentSuffix
+	if kind != "" {
+		comment += " (" + string(kind) + ")"
+	}
+	return comment + ": nodes " + strings.Join(members, ", ")
+}
+
+// parsePoolComment returns the pool, kind and members of a pool silence
+func parsePoolComment(comment *string) (pool string, kind SilenceKind, members []string, ok bool) {
+	if comment == nil || !strings.HasPrefix(*comment, poolCommentPrefix) {
+		return "", "", nil, false
+	}
+	text, list, ok := strings.Cut(strings.TrimPrefix(*comment, poolCommentPrefix), ": nodes ")
+	if !ok {
+		return "", "", nil, false
+	}
+	pool, rest, ok := strings.Cut(text, silenceCommentSuffix)
+	if !ok || pool == "" {
+		return "", "", nil, false
+	}
+	if strings.HasPrefix(rest, " (") && strings.HasSuffix(rest, ")") {
+		kind = SilenceKind(rest[2 : len(rest)-1])
+	}
+	return pool, kind, strings.Split(list, ", "), true
+}
+
+// sortedMembers returns the names of the pool's members in order
+func (p *poolSilence) sortedMembers() []string {
+	members := make([]string, 0, len(p.members))
+	for member := range p.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// silencePool returns the pool whose silence covers the node silence of a
+// rolling node, empty if it gets its own. Windows nodes have other services,
+// nodes of an unknown pool nothing to share
+func (m *SilenceManager) silencePool(ctx context.Context, nodeName string) string {
+	if !m.options.PoolSilences {
+		return ""
+	}
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Warningf("Failed to get node %s, creating its own node silence: %v", nodeName, err)
+		return ""
+	}
+	if watcher.IsWindows(node) {
+		return ""
+	}
+	return watcher.NodePool(node)
+}
+
+// poolJoin is a rolling node joining the silence of its pool. It's prepared
+// and finished with the lock held, the silence is sent in between by a
+// worker of createSilences which mustn't touch the pools
+type poolJoin struct {
+	pool     string
+	nodeName string
+	silence  *poolSilence
+	// id, kind and members are those of the silence to send
+	id       string
+	kind     SilenceKind
+	members  []string
+	endsAt   time.Time
+	duration time.Duration
+}
+
+// prepareJoin adds a rolling node to the members of the silence of its pool,
+// the lock must be held
+func (m *SilenceManager) prepareJoin(pool, nodeName string, kind SilenceKind) *poolJoin {
+	silence, ok := m.pools[pool]
+	if !ok {
+		silence = &poolSilence{kind: kind, members: make(map[string]bool)}
+		m.pools[pool] = silence
+	}
+	silence.members[nodeName] = true
+
+	duration := m.templateDuration(config.TemplateNode)
+	endsAt := time.Now().Add(duration)
+	if silence.expiresAt.After(endsAt) {
+		endsAt = silence.expiresAt
+	}
+	return &poolJoin{
+		pool:     pool,
+		nodeName: nodeName,
+		silence:  silence,
+		id:       silence.id,
+		kind:     silence.kind,
+		members:  silence.sortedMembers(),
+		endsAt:   endsAt,
+		duration: duration,
+	}
+}
+
+// send creates or updates the silence of the pool, it's safe without the lock
+func (j *poolJoin) send(ctx context.Context, m *SilenceManager) (string, error) {
+	return m.sendPoolSilence(ctx, j.id, j.kind, j.pool, j.members, j.endsAt)
+}
+
+// finishJoin records the silence a join sent, or its failure, and returns the
+// silence to track for the node. The lock must be held
+func (m *SilenceManager) finishJoin(ctx context.Context, join *poolJoin, id string, err error) (TrackedSilence, error) {
+	if err != nil {
+		klog.Errorf("failed to add node %s to the silence of pool %s: %v", join.nodeName, join.pool, err)
+		m.recordFailure(join.nodeName, operationCreate, err)
+		// Kept as a member, the reconciliation adds it again
+		return TrackedSilence{}, err
+	}
+	m.applyPoolSilence(ctx, join.pool, join.silence, id, join.endsAt, join.members)
+	silence := join.silence
+	m.options.Audit.Record(audit.Entry{Node: join.nodeName, Action: audit.ActionCreated, SilenceID: silence.id, Kind: string(silence.kind), Until: timePtr(silence.expiresAt), Message: "joined the silence of pool " + join.pool})
+	return TrackedSilence{ID: silence.id, Kind: silence.kind, Policy: config.TemplateNode, Duration: join.duration, ExpiresAt: silence.expiresAt}, nil
+}
+
+// leavePool removes a node which stopped rolling from the silence of its
+// pool, which is deleted with its last member. The lock must be held
+func (m *SilenceManager) leavePool(ctx context.Context, nodeName string) {
+	for pool, silence := range m.pools {
+		if !silence.members[nodeName] {
+			continue
+		}
+		delete(silence.members, nodeName)
+
+		if len(silence.members) > 0 {
+			if err := m.putPoolSilence(ctx, pool, silence, silence.expiresAt); err != nil {
+				// The node stays silenced until the next change of the pool
+				klog.Errorf("failed to remove node %s from the silence of pool %s: %v", nodeName, pool, err)
+				m.recordFailure(nodeName, operationDelete, err)
+			}
+			return
+		}
+
+		delete(m.pools, pool)
+		metrics.PoolSilenceMembers.DeleteLabelValues(pool)
+		if silence.id == "" {
+			return
+		}
+		if err := m.amClient.DeleteSilenceID(ctx, silence.id); err != nil {
+			klog.ErrorS(err, "Failed to delete pool silence", "action", "delete", "pool", pool, "silenceID", silence.id)
+			m.recordFailure(nodeName, operationDelete, err)
+			return
+		}
+		klog.InfoS("Deleted pool silence", "action", "delete", "pool", pool, "silenceID", silence.id)
+		return
+	}
+}
+
+// putPoolSilence creates or updates the silence of a pool to match its
+// members until endsAt, and moves the members to its new ID if Alertmanager
+// replaced it. The lock must be held
+func (m *SilenceManager) putPoolSilence(ctx context.Context, pool string, silence *poolSilence, endsAt time.Time) error {
+	members := silence.sortedMembers()
+	id, err := m.sendPoolSilence(ctx, silence.id, silence.kind, pool, members, endsAt)
+	if err != nil {
+		return err
+	}
+	m.applyPoolSilence(ctx, pool, silence, id, endsAt, members)
+	return nil
+}
+
+// sendPoolSilence creates or updates the silence of a pool in Alertmanager
+// and returns its ID, it doesn't touch the pools
+func (m *SilenceManager) sendPoolSilence(ctx context.Context, id string, kind SilenceKind, pool string, members []string, endsAt time.Time) (string, error) {
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		names = append(names, regexp.QuoteMeta(member))
+	}
+	node := &models.Matcher{
+		Name:    stringPtr("node"),
+		Value:   stringPtr("(" + strings.Join(names, "|") + ")"),
+		IsRegex: boolPtr(true),
+	}
+	matchers := nodeSilenceMatchers(node, false)
+	comment := poolComment(pool, kind, members)
+
+	updated, err := m.amClient.PutSilence(ctx, id, matchers, comment, endsAt)
+	var statusErr *StatusError
+	if id != "" && errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		// Deleted by hand or garbage collected after it expired
+		updated, err = m.amClient.PutSilence(ctx, "", matchers, comment, endsAt)
+	}
+	return updated, err
+}
+
+// applyPoolSilence records the silence sent for a pool, and moves the
+// members to its new ID if Alertmanager replaced it. The lock must be held
+func (m *SilenceManager) applyPoolSilence(ctx context.Context, pool string, silence *poolSilence, id string, endsAt time.Time, members []string) {
+	previous := silence.id
+	silence.id = id
+	silence.expiresAt = endsAt
+	metrics.PoolSilenceMembers.WithLabelValues(pool).Set(float64(len(members)))
+	klog.InfoS("Updated pool silence", "action", "pool", "pool", pool, "silenceID", id, "nodes", len(members), "endsAt", endsAt.Format(time.RFC3339))
+	if previous == "" {
+		return
+	}
+
+	for _, member := range members {
+		tracked, ok := m.activeSilences.Get(member)
+		if !ok {
+			continue
+		}
+		for i := range tracked {
+			if tracked[i].ID == previous {
+				tracked[i].ID = id
+				tracked[i].ExpiresAt = endsAt
+			}
+		}
+		m.activeSilences.Extend(member, tracked)
+	}
+	m.persist(ctx)
+}
+
+// isPoolSilence reports whether a tracked silence is the silence of a pool,
+// the lock must be held
+func (m *SilenceManager) isPoolSilence(id string) bool {
+	for _, silence := range m.pools {
+		if silence.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// renewPools extends the pool silences about to expire by the node silence
+// duration, up to the latest renewal limit of their members. The lock must
+// be held
+func (m *SilenceManager) renewPools(ctx context.Context, now time.Time) {
+	for pool, silence := range m.pools {
+		if silence.id == "" || !silence.expiresAt.Before(now.Add(renewBefore)) {
+			continue
+		}
+
+		var limit time.Time
+		for member := range silence.members {
+			startedAt, ok := m.activeSilences.StartedAt(member)
+			if !ok {
+				continue
+			}
+			if until, ok := m.renewLimit(member, startedAt); ok && until.After(limit) {
+				limit = until
+			}
+		}
+		endsAt := now.Add(m.templateDuration(config.TemplateNode))
+		if endsAt.After(limit) {
+			endsAt = limit
+		}
+		if !endsAt.After(silence.expiresAt) {
+			continue
+		}
+
+		if err := m.putPoolSilence(ctx, pool, silence, endsAt); err != nil {
+			if !errors.Is(err, ErrCircuitOpen) {
+				klog.ErrorS(err, "Failed to extend pool silence", "action", "extend", "pool", pool, "silenceID", silence.id)
+			}
+			for member := range silence.members {
+				m.recordFailure(member, operationExtend, err)
+			}
+		}
+	}
+}
+
+// restorePools rebuilds the pool silences from the active silences in
+// Alertmanager after a restart, and tracks them for their members which are
+// tracked. The lock must be held
+func (m *SilenceManager) restorePools(silences []models.PostableSilence) {
+	m.pools = make(map[string]*poolSilence)
+	for _, found := range silences {
+		if !isOwned(found) || isExpired(found) {
+			continue
+		}
+		pool, kind, members, ok := parsePoolComment(found.Comment)
+		if !ok {
+			continue
+		}
+		// A broadcast silence is listed once per endpoint
+		silence, ok := m.pools[pool]
+		if ok {
+			if m.amClient.mode == ModeBroadcast {
+				silence.id = joinBroadcastID(mergeIDs(splitBroadcastID(silence.id), splitBroadcastID(found.ID)))
+			}
+			continue
+		}
+		silence = &poolSilence{id: found.ID, kind: kind, members: make(map[string]bool), expiresAt: time.Time(*found.EndsAt)}
+		for _, member := range members {
+			silence.members[member] = true
+		}
+		m.pools[pool] = silence
+	}
+
+	for pool, silence := range m.pools {
+		for member := range silence.members {
+			tracked, ok := m.activeSilences.Get(member)
+			if ok && containsID(tracked, silence.id) {
+				continue
+			}
+			m.activeSilences.Add(member, TrackedSilence{
+				ID:        silence.id,
+				Kind:      silence.kind,
+				Policy:    config.TemplateNode,
+				Duration:  m.templateDuration(config.TemplateNode),
+				ExpiresAt: silence.expiresAt,
+			}, time.Now())
+		}
+		metrics.PoolSilenceMembers.WithLabelValues(pool).Set(float64(len(silence.members)))
+		klog.Infof("Restored silence %s of pool %s with %d nodes", silence.id, pool, len(silence.members))
+	}
+}
+
+func mergeIDs(a, b map[int]string) map[int]string {
+	for index, id := range b {
+		a[index] = id
+	}
+	return a
+}
+
+func containsID(silences []TrackedSilence, id string) bool {
+	for _, silence := range silences {
+		if silence.ID == id {
+			return true
+		}
+	}
+	return false
+}
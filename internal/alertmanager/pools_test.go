@@ -0,0 +1,53 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/watcher"
+)
+
+func TestPoolSilenceSharedByMembers(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	node := func(name string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{watcher.CurrentConfigAnnotation: "rendered-worker-0123"},
+		}}
+	}
+	clientset := fake.NewSimpleClientset(node("worker-0"), node("worker-1"))
+	options := Options{SilenceDuration: time.Hour, PoolSilences: true}
+	m := NewSilenceManager(NewClient([]string{am.URL()}, ""), clientset, &config.Config{}, nil, options)
+
+	for _, name := range []string{"worker-0", "worker-1"} {
+		if err := m.HandleNodeState(ctx, name, true, KindPoolUpdate); err != nil {
+			t.Fatalf("Failed to silence node %s: %v", name, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pool, ok := m.pools["worker"]
+	if !ok || pool.id == "" || len(pool.members) != 2 {
+		t.Fatalf("Expected a silence of pool worker with both nodes, got %+v", pool)
+	}
+	for _, name := range []string{"worker-0", "worker-1"} {
+		found := false
+		tracked, _ := m.activeSilences.Get(name)
+		for _, silence := range tracked {
+			found = found || silence.ID == pool.id
+		}
+		if !found {
+			t.Errorf("Expected node %s to track the pool silence %s, got %+v", name, pool.id, tracked)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// startReconciler compares the silences in Alertmanager with the rolling
+// nodes every ReconcileInterval until ctx is cancelled
+func (m *SilenceManager) startReconciler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.options.ReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.reconcile(ctx); err != nil && !errors.Is(err, ErrCircuitOpen) {
+					klog.Errorf("Failed to reconcile silences: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// setIncomplete records whether some silences of a node couldn't be created
+func (m *SilenceManager) setIncomplete(nodeName string, incomplete bool) {
+	if incomplete {
+		m.incomplete[nodeName] = true
+	} else {
+		delete(m.incomplete, nodeName)
+	}
+}
+
+// reconcile fixes drift between the rolling nodes and their silences: nodes
+// deleted mid-rollout are unsilenced, rolling nodes whose silences are missing
+// or were deleted get them created again, and active helper-owned silences of
+// nodes which are neither rolling nor tracked are expired
+func (m *SilenceManager) reconcile(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held.Load() {
+		return nil
+	}
+
+	m.reconcileDeletedNodes(ctx)
+
+	silences, err := m.ownedSilences(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get silences: %w", err)
+	}
+	active := make(map[string]bool)
+	for _, silence := range silences {
+		if isOwned(silence) && !isExpired(silence) {
+			active[silence.ID] = true
+		}
+	}
+
+	changed := false
+	tracked := m.activeSilences.Entries()
+	for node, kind := range m.rolling {
+		if _, ok := m.unsilencedUntil(node); ok {
+			continue
+		}
+		if _, ok := m.escalatedSince(node); ok {
+			continue
+		}
+		current, ok := tracked[node]
+		if ok && !m.incomplete[node] && m.allActive(current, active) {
+			continue
+		}
+
+		klog.InfoS("Silences of rolling node are missing, creating them again", "action", "recreate", "node", node, "kind", kind)
+		fresh, complete := m.createSilences(ctx, node, kind)
+		m.setIncomplete(node, !complete)
+		merged := m.mergeSilences(current, fresh, active)
+		if !ok || !m.activeSilences.Extend(node, merged) {
+			m.activeSilences.Set(node, merged)
+		}
+		metrics.ReconcileActions.WithLabelValues("recreated").Inc()
+		changed = true
+	}
+
+	m.expireOrphans(ctx, silences, time.Now())
+
+	if changed {
+		m.persist(ctx)
+	}
+	return nil
+}
+
+// expireOrphans expires the active helper-owned silences which aren't
+// tracked, unless their node still needs them or they started within
+// GCGracePeriod, e.g. while their node's state change is being handled.
+// Adopted silences of existing nodes are kept, and pool silences are orphans
+// once no member tracks them. The lock must be held
+func (m *SilenceManager) expireOrphans(ctx context.Context, silences []models.PostableSilence, now time.Time) {
+	known := make(map[string]bool)
+	for _, entries := range m.activeSilences.Entries() {
+		for _, silence := range entries {
+			for _, part := range m.amClient.idParts(silence.ID) {
+				known[part] = true
+			}
+		}
+	}
+	for _, silence := range m.pools {
+		for _, part := range m.amClient.idParts(silence.id) {
+			known[part] = true
+		}
+	}
+	for _, silence := range m.detachedSilences(now) {
+		for _, part := range m.amClient.idParts(silence.ID) {
+			known[part] = true
+		}
+	}
+
+	for _, silence := range silences {
+		if !isOwned(silence) || isExpired(silence) || known[silence.ID] {
+			continue
+		}
+		if silence.StartsAt != nil && now.Sub(time.Time(*silence.StartsAt)) < m.options.GCGracePeriod {
+			continue
+		}
+		node, kind, ok := parseComment(silence.Comment)
+		if ok {
+			// Adopted silences are recorded in the persisted state by the
+			// adopt subcommand, which this instance only loads on restart
+			if m.keepsSilences(node) || (kind == KindManual && m.nodeExists(ctx, node)) {
+				continue
+			}
+		} else if _, _, _, ok := parsePoolComment(silence.Comment); !ok {
+			continue
+		}
+
+		if err := m.amClient.DeleteSilenceID(ctx, silence.ID); err != nil {
+			klog.ErrorS(err, "Failed to expire orphaned silence", "action", "expire", "node", node, "silenceID", silence.ID)
+			continue
+		}
+		klog.InfoS("Expired orphaned silence", "action", "expire", "node", node, "silenceID", silence.ID)
+		metrics.ReconcileActions.WithLabelValues("orphan_expired").Inc()
+	}
+}
+
+// reconcileDeletedNodes unsilences rolling and tracked nodes which no longer
+// exist, the watcher doesn't report them as done. The lock must be held
+func (m *SilenceManager) reconcileDeletedNodes(ctx context.Context) {
+	nodes := make(map[string]bool)
+	for node := range m.rolling {
+		nodes[node] = true
+	}
+	for node := range m.activeSilences.Entries() {
+		nodes[node] = true
+	}
+
+	for node := range nodes {
+		if m.nodeExists(ctx, node) {
+			continue
+		}
+		if !m.forgetNode(node) {
+			continue
+		}
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence deleted node %s: %v", node, err)
+			continue
+		}
+		metrics.ReconcileActions.WithLabelValues("node_deleted").Inc()
+	}
+}
+
+// nodeExists reports whether a node exists, nodes which couldn't be read are assumed to exist
+func (m *SilenceManager) nodeExists(ctx context.Context, nodeName string) bool {
+	_, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	return !apierrors.IsNotFound(err)
+}
+
+// allActive reports whether every tracked silence is active on at least one endpoint
+func (m *SilenceManager) allActive(tracked []TrackedSilence, active map[string]bool) bool {
+	for _, silence := range tracked {
+		if !m.isActive(silence.ID, active) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *SilenceManager) isActive(id string, active map[string]bool) bool {
+	for _, part := range m.amClient.idParts(id) {
+		if active[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSilences keeps the tracked silences which are still active and adds
+// the freshly created ones which aren't tracked yet
+func (m *SilenceManager) mergeSilences(tracked, fresh []TrackedSilence, active map[string]bool) []TrackedSilence {
+	merged := make([]TrackedSilence, 0, len(tracked)+len(fresh))
+	ids := make(map[string]bool)
+	for _, silence := range tracked {
+		if m.isActive(silence.ID, active) {
+			merged = append(merged, silence)
+			ids[silence.ID] = true
+		}
+	}
+	for _, silence := range fresh {
+		if !ids[silence.ID] {
+			merged = append(merged, silence)
+			ids[silence.ID] = true
+		}
+	}
+	return merged
+}
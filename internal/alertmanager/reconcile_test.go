@@ -0,0 +1,48 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/client-go/kubernetes/fake"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+)
+
+func TestOrphansKeptWithinGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	client := NewClient([]string{am.URL()}, "")
+	m := NewSilenceManager(client, fake.NewSimpleClientset(), &config.Config{}, nil, Options{SilenceDuration: time.Hour, GCGracePeriod: time.Minute})
+
+	// Not tracked by the manager, e.g. left behind by a failed deletion
+	matchers := models.Matchers{{Name: stringPtr("node"), Value: stringPtr("worker-9"), IsRegex: boolPtr(false)}}
+	id, err := client.CreateSilence(ctx, matchers, "worker-9", KindPoolUpdate, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create silence: %v", err)
+	}
+	if err := m.reconcile(ctx); err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	if !am.ActiveSilenceIDs()[id] {
+		t.Fatal("Expected an untracked silence within the grace period to be kept")
+	}
+
+	m.expireOrphans(ctx, mustOwnedSilences(t, m), time.Now().Add(time.Minute))
+	if am.ActiveSilenceIDs()[id] {
+		t.Error("Expected an untracked silence older than the grace period to be expired")
+	}
+}
+
+func mustOwnedSilences(t *testing.T, m *SilenceManager) []models.PostableSilence {
+	t.Helper()
+	silences, err := m.ownedSilences(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list silences: %v", err)
+	}
+	return silences
+}
@@ -0,0 +1,289 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/metrics"
+)
+
+// CriticalPodAnnotation marks pods whose startup alerts are silenced on the
+// node they are moved to when they are evicted from a rolling node, e.g. a
+// database with local storage whose probes fail while it catches up
+const CriticalPodAnnotation = "rollout-helper.snappcloud.io/critical"
+
+// criticalPodsObject is the object the critical annotation of the pods of a
+// namespace is signed for, their names aren't known ahead
+func criticalPodsObject(namespace string) authz.Object {
+	return authz.Object{Kind: "Pod", Namespace: namespace, Name: "*"}
+}
+
+// relocationCheckInterval is how often the critical pods of rolling nodes are
+// looked for on other nodes
+const relocationCheckInterval = 20 * time.Second
+
+// criticalPod is a critical pod of a rolling node, identified by its
+// controller as its replacement may have another name
+type criticalPod struct {
+	namespace  string
+	name       string
+	uid        types.UID
+	labels     map[string]string
+	controller types.UID
+	// trackedAt is when the pod was tracked, in whole seconds like creation
+	// timestamps. Pods of the controller created until then are its siblings
+	trackedAt time.Time
+}
+
+// relocationSilence is a short silence of a critical pod on the node it was
+// moved to, node is the rolling node it came from
+type relocationSilence struct {
+	id     string
+	node   string
+	endsAt time.Time
+}
+
+// trackCriticalPods records the critical pods on a node which started
+// rolling, the lock must be held
+func (m *SilenceManager) trackCriticalPods(ctx context.Context, nodeName string) {
+	if m.options.CriticalPodSilenceDuration <= 0 {
+		return
+	}
+
+	pods, err := m.options.Namespaces.ListPods(ctx, m.k8sClient, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
+	})
+	if err != nil {
+		klog.Errorf("Failed to list the critical pods of node %s: %v", nodeName, err)
+		return
+	}
+
+	var critical []criticalPod
+	trackedAt := time.Now().Truncate(time.Second)
+	for _, pod := range pods.Items {
+		if pod.Annotations[CriticalPodAnnotation] != "true" {
+			continue
+		}
+		if err := authz.Check(m.options.Authorizer, criticalPodsObject(pod.Namespace), pod.Annotations, CriticalPodAnnotation); err != nil {
+			klog.Warningf("Ignoring critical pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		// Pods without a controller aren't recreated elsewhere
+		controller := metav1.GetControllerOf(&pod)
+		if controller == nil {
+			klog.Warningf("Critical pod %s/%s on node %s has no controller, it won't be silenced elsewhere", pod.Namespace, pod.Name, nodeName)
+			continue
+		}
+		critical = append(critical, criticalPod{
+			namespace:  pod.Namespace,
+			name:       pod.Name,
+			uid:        pod.UID,
+			labels:     pod.Labels,
+			controller: controller.UID,
+			trackedAt:  trackedAt,
+		})
+	}
+	if len(critical) > 0 {
+		klog.InfoS("Tracking critical pods of rolling node", "node", nodeName, "pods", len(critical))
+		m.critical[nodeName] = critical
+	}
+}
+
+// startRelocations silences the critical pods of rolling nodes once their
+// replacements are scheduled on other nodes, until ctx is cancelled
+func (m *SilenceManager) startRelocations(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(relocationCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !m.held.Load() {
+					m.checkRelocations(ctx)
+				}
+			}
+		}
+	}()
+}
+
+// checkRelocations silences the critical pods which moved since the last
+// check. The pods are looked up and silenced without the lock, so node
+// states are handled meanwhile
+func (m *SilenceManager) checkRelocations(ctx context.Context) {
+	m.mu.Lock()
+	now := time.Now()
+	current := m.relocations[:0]
+	for _, silence := range m.relocations {
+		if silence.endsAt.After(now) {
+			current = append(current, silence)
+		}
+	}
+	m.relocations = current
+
+	critical := make(map[string][]criticalPod, len(m.critical))
+	kinds := make(map[string]SilenceKind, len(m.critical))
+	for nodeName, pods := range m.critical {
+		critical[nodeName] = append([]criticalPod(nil), pods...)
+		kinds[nodeName] = m.rolling[nodeName]
+	}
+	m.mu.Unlock()
+
+	// done are the pods of each node which were silenced or don't need to be
+	done := make(map[string]map[types.UID]bool, len(critical))
+	var created []relocationSilence
+	for nodeName, pods := range critical {
+		done[nodeName] = make(map[types.UID]bool)
+		// The replacements and the pods they replace by namespace
+		moved := make(map[string][]*corev1.Pod)
+		movedFrom := make(map[string][]types.UID)
+		var namespaces []string
+		// Several pods of a controller may have moved, each gets its own replacement
+		claimed := make(map[types.UID]bool)
+		for _, pod := range pods {
+			replacement, replaced := m.replacement(ctx, nodeName, pod, claimed)
+			if replacement != nil {
+				if _, ok := moved[pod.namespace]; !ok {
+					namespaces = append(namespaces, pod.namespace)
+				}
+				moved[pod.namespace] = append(moved[pod.namespace], replacement)
+				movedFrom[pod.namespace] = append(movedFrom[pod.namespace], pod.uid)
+			} else if replaced {
+				done[nodeName][pod.uid] = true
+			}
+		}
+		for _, namespace := range namespaces {
+			silence, ok := m.silenceRelocated(ctx, nodeName, kinds[nodeName], namespace, moved[namespace])
+			if !ok {
+				// Looked up again on the next check
+				continue
+			}
+			created = append(created, silence)
+			for _, uid := range movedFrom[namespace] {
+				done[nodeName][uid] = true
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for nodeName, uids := range done {
+		// The node may have finished or started rolling again meanwhile
+		pods, ok := m.critical[nodeName]
+		if !ok {
+			continue
+		}
+		pending := make([]criticalPod, 0, len(pods))
+		for _, pod := range pods {
+			if !uids[pod.uid] {
+				pending = append(pending, pod)
+			}
+		}
+		if len(pending) == 0 {
+			delete(m.critical, nodeName)
+		} else {
+			m.critical[nodeName] = pending
+		}
+	}
+	if len(created) > 0 {
+		m.relocations = append(m.relocations, created...)
+		m.persist(ctx)
+	}
+}
+
+// replacement returns the replacement of a critical pod if it was scheduled
+// on another node. done is false while the pod wasn't replaced yet, and true
+// without a replacement to silence if it was recreated on the rolling node.
+// Only pods created after the pod was tracked and not claimed by another pod
+// are candidates, the other replicas of its controller already ran
+// elsewhere
+func (m *SilenceManager) replacement(ctx context.Context, nodeName string, pod criticalPod, claimed map[types.UID]bool) (replacement *corev1.Pod, done bool) {
+	replacements, err := m.k8sClient.CoreV1().Pods(pod.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(pod.labels).String(),
+	})
+	if err != nil {
+		klog.Errorf("Failed to look up the replacement of critical pod %s/%s: %v", pod.namespace, pod.name, err)
+		return nil, false
+	}
+
+	for i := range replacements.Items {
+		candidate := &replacements.Items[i]
+		controller := metav1.GetControllerOf(candidate)
+		if candidate.UID == pod.uid || controller == nil || controller.UID != pod.controller || candidate.Spec.NodeName == "" {
+			continue
+		}
+		if !candidate.CreationTimestamp.Time.After(pod.trackedAt) || claimed[candidate.UID] {
+			continue
+		}
+		replacement = candidate
+		break
+	}
+	if replacement == nil {
+		return nil, false
+	}
+	claimed[replacement.UID] = true
+	if replacement.Spec.NodeName == nodeName {
+		// Pinned to the node, e.g. by its local volume, it starts after the rollout
+		klog.V(2).Infof("Critical pod %s/%s was recreated on rolling node %s, not silencing it", pod.namespace, replacement.Name, nodeName)
+		return nil, true
+	}
+	return replacement, true
+}
+
+// silenceRelocated silences the critical pods of a namespace moved off a
+// rolling node since the last check with a single silence, their names
+// batched into a regex. It returns false if the silence couldn't be created
+func (m *SilenceManager) silenceRelocated(ctx context.Context, nodeName string, kind SilenceKind, namespace string, pods []*corev1.Pod) (relocationSilence, bool) {
+	var names, moves []string
+	for _, pod := range pods {
+		names = append(names, regexp.QuoteMeta(pod.Name))
+		moves = append(moves, fmt.Sprintf("%s/%s to node %s", pod.Namespace, pod.Name, pod.Spec.NodeName))
+	}
+
+	matchers := models.Matchers{
+		{Name: stringPtr("namespace"), Value: stringPtr(namespace), IsRegex: boolPtr(false)},
+		{Name: stringPtr("pod"), Value: stringPtr(strings.Join(names, "|")), IsRegex: boolPtr(true)},
+	}
+	duration := m.options.CriticalPodSilenceDuration
+	note := "critical pods moved: " + strings.Join(moves, ", ")
+	id, err := m.amClient.CreateSilenceWithNote(ctx, matchers, nodeName, kind, duration, note)
+	if err != nil {
+		klog.ErrorS(err, "Failed to silence relocated critical pods", "action", "create", "node", nodeName, "pods", len(pods))
+		return relocationSilence{}, false
+	}
+
+	klog.InfoS("Silenced critical pods on the nodes they were moved to", "action", "relocate", "node", nodeName,
+		"pods", len(pods), "silenceID", id, "duration", duration)
+	metrics.CriticalPodSilences.Inc()
+	endsAt := time.Now().Add(duration)
+	m.options.Audit.Record(audit.Entry{Node: nodeName, Action: audit.ActionCreated, SilenceID: id, Until: timePtr(endsAt), Message: "silenced critical pods moved " + strings.Join(moves, ", ")})
+	m.recordEvent(nodeName, reasonSilenceCreated, "Silenced critical pods for %s, moved %s: %s", duration, strings.Join(moves, ", "), id)
+	return relocationSilence{id: id, node: nodeName, endsAt: endsAt}, true
+}
+
+// relocationIDs returns the relocation silences which haven't expired yet,
+// they outlive the rollout of their node. The lock must be held
+func (m *SilenceManager) relocationIDs() []string {
+	now := time.Now()
+	var ids []string
+	for _, silence := range m.relocations {
+		if silence.endsAt.After(now) {
+			ids = append(ids, silence.id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,124 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/state"
+)
+
+func TestReplacementSkipsSiblings(t *testing.T) {
+	ctx := context.Background()
+	trackedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	controller := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db", UID: "db-uid", Controller: boolPtr(true)}
+	pod := func(name, node string, created time.Time) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "team-a",
+				UID:               types.UID(name + "-uid"),
+				Labels:            map[string]string{"app": "db"},
+				OwnerReferences:   []metav1.OwnerReference{controller},
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+		}
+	}
+	clientset := fake.NewSimpleClientset(pod("db-1", "worker-1", trackedAt.Add(-time.Hour)))
+	am := amfake.NewServer(0)
+	defer am.Close()
+	m := NewSilenceManager(NewClient([]string{am.URL()}, ""), clientset, &config.Config{}, nil, Options{SilenceDuration: time.Hour})
+	critical := criticalPod{namespace: "team-a", name: "db-0", uid: "db-0-uid", labels: map[string]string{"app": "db"}, controller: "db-uid", trackedAt: trackedAt}
+
+	if replacement, done := m.replacement(ctx, "worker-0", critical, map[types.UID]bool{}); replacement != nil || done {
+		t.Fatalf("Expected the replica running elsewhere before the rollout not to be a replacement, got %v", replacement)
+	}
+
+	recreated := pod("db-0", "worker-2", trackedAt.Add(30*time.Second))
+	recreated.UID = "db-0-recreated-uid"
+	if _, err := clientset.CoreV1().Pods("team-a").Create(ctx, recreated, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	replacement, done := m.replacement(ctx, "worker-0", critical, map[types.UID]bool{})
+	if replacement == nil || replacement.Spec.NodeName != "worker-2" || !done {
+		t.Fatalf("Expected the pod created on worker-2 after the rollout to be the replacement, got %v", replacement)
+	}
+	if replacement, _ := m.replacement(ctx, "worker-0", critical, map[types.UID]bool{replacement.UID: true}); replacement != nil {
+		t.Errorf("Expected a claimed replacement to be skipped, got %s", replacement.Name)
+	}
+}
+
+func TestRelocationSilenceSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	am := amfake.NewServer(0)
+	defer am.Close()
+	controller := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db", UID: "db-uid", Controller: boolPtr(true)}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "db-0",
+				Namespace:         "team-a",
+				UID:               "db-0-uid",
+				Labels:            map[string]string{"app": "db"},
+				Annotations:       map[string]string{CriticalPodAnnotation: "true"},
+				OwnerReferences:   []metav1.OwnerReference{controller},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+			},
+			Spec: corev1.PodSpec{NodeName: "worker-0"},
+		},
+	)
+	store := state.NewConfigMapStore(clientset, "rollout-helper", "rollout-helper-state")
+	options := Options{SilenceDuration: time.Hour, CriticalPodSilenceDuration: time.Hour}
+	start := func() *SilenceManager {
+		return NewSilenceManager(NewClient([]string{am.URL()}, ""), clientset, &config.Config{}, store, options)
+	}
+
+	m := start()
+	if err := m.HandleNodeState(ctx, "worker-0", true, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to silence the rolling node: %v", err)
+	}
+	if err := clientset.CoreV1().Pods("team-a").Delete(ctx, "db-0", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	replacement := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "db-0",
+			Namespace:         "team-a",
+			UID:               "db-0-recreated-uid",
+			Labels:            map[string]string{"app": "db"},
+			OwnerReferences:   []metav1.OwnerReference{controller},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(time.Minute)),
+		},
+		Spec: corev1.PodSpec{NodeName: "worker-1"},
+	}
+	if _, err := clientset.CoreV1().Pods("team-a").Create(ctx, replacement, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	m.checkRelocations(ctx)
+	if err := m.HandleNodeState(ctx, "worker-0", false, KindPoolUpdate); err != nil {
+		t.Fatalf("Failed to handle the finished node: %v", err)
+	}
+	relocated := am.ActiveSilenceIDs()
+	if len(relocated) != 1 {
+		t.Fatalf("Expected the relocation silence to outlive the rollout, got %v", relocated)
+	}
+
+	m = start()
+	if err := m.reconcile(ctx); err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+	for id := range relocated {
+		if !am.ActiveSilenceIDs()[id] {
+			t.Errorf("Expected the relocation silence %s to survive a restart", id)
+		}
+	}
+}
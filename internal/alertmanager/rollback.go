@@ -0,0 +1,118 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// rollbackHeader explains the script and defines the expire function. Errors
+// are reported but don't stop the script, silences may already be expired
+const rollbackHeader = `#!/bin/sh
+# Expires every silence rollout-helper created, for manual cleanup if the helper
+# can't do it anymore.
+# Generated at %s and rewritten whenever the helper's silences change.
+#
+# Set ALERTMNGR_TOKEN if Alertmanager requires a bearer token and CURL_OPTS for
+# further curl options, e.g. CURL_OPTS=--cacert=/path/to/ca.crt or the extra
+# headers of the helper, then run:
+#   sh rollback.sh
+#
+# With amtool, expire the IDs listed below instead:
+#   amtool silence expire --alertmanager.url=<url> <id>...
+# The fourth argument of expire is the tenant of the silence, if any.
+
+expire() {
+	echo "Expiring silence $2 of node $3 on $1"
+	curl -sS -f -X DELETE ${CURL_OPTS:-} ${ALERTMNGR_TOKEN:+-H "Authorization: Bearer $ALERTMNGR_TOKEN"} ${4:+-H "X-Scope-OrgID: $4"} "$1/api/v2/silence/$2" || echo "Failed to expire silence $2 on $1"
+}
+
+`
+
+// urls returns the configured endpoint URLs in order of preference
+func (c *Client) urls() []string {
+	urls := make([]string, 0, len(c.endpoints.endpoints))
+	for _, ep := range c.endpoints.endpoints {
+		urls = append(urls, ep.url)
+	}
+	return urls
+}
+
+// expireTargets returns the endpoints and IDs a silence has to be expired on.
+// A failover silence may exist on any endpoint which doesn't share silences
+func (c *Client) expireTargets(id string) [][2]string {
+	urls := c.urls()
+	var targets [][2]string
+	if c.mode == ModeBroadcast {
+		parts := splitBroadcastID(id)
+		indexes := make([]int, 0, len(parts))
+		for index := range parts {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			if index < len(urls) {
+				targets = append(targets, [2]string{urls[index], parts[index]})
+			}
+		}
+		return targets
+	}
+	for _, url := range urls {
+		targets = append(targets, [2]string{url, id})
+	}
+	return targets
+}
+
+// rollbackScript returns a shell script expiring the silences of all nodes
+func (c *Client) rollbackScript(silences map[string][]TrackedSilence, now time.Time) []byte {
+	var script bytes.Buffer
+	fmt.Fprintf(&script, rollbackHeader, now.UTC().Format(time.RFC3339))
+
+	nodes := make([]string, 0, len(silences))
+	for node := range silences {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	for _, node := range nodes {
+		fmt.Fprintf(&script, "# node %s\n", node)
+		for _, silence := range silences[node] {
+			tenant, id := splitTenantID(silence.ID)
+			if tenant == "" {
+				tenant = c.tenant
+			}
+			for _, target := range c.expireTargets(id) {
+				fmt.Fprintf(&script, "expire %s %s %s", shellQuote(target[0]), shellQuote(target[1]), shellQuote(node))
+				if tenant != "" {
+					fmt.Fprintf(&script, " %s", shellQuote(tenant))
+				}
+				script.WriteString("\n")
+			}
+		}
+	}
+	return script.Bytes()
+}
+
+// shellQuote quotes a value for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// writeRollback replaces the rollback script with the tracked silences
+func (m *SilenceManager) writeRollback(ctx context.Context) {
+	if len(m.options.Rollback) == 0 {
+		return
+	}
+
+	script := m.amClient.rollbackScript(m.activeSilences.Entries(), time.Now())
+	for _, writer := range m.options.Rollback {
+		if err := writer.Write(ctx, script); err != nil {
+			klog.Errorf("Failed to write the rollback script to %s: %v", writer.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package alertmanager
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// selectorCheckInterval is how often the pod silence targets are validated
+const selectorCheckInterval = 10 * time.Minute
+
+// validateSelectors checks that every pod silence target matches at least one
+// pod in the cluster. A mistyped namespace or selector would otherwise only
+// show up as "No pods found" while a node is rolling. valid holds the result
+// of the previous check, warning events are emitted when a target turns invalid
+func (m *SilenceManager) validateSelectors(ctx context.Context, valid map[daemonSetIdent]bool) {
+	// Discovered daemonsets exist by definition, only built-in and declared ones can be misconfigured
+	for _, target := range m.configuredTargets() {
+		if !m.options.Namespaces.Contains(target.namespace) || !m.access.Allowed(target.namespace) {
+			continue
+		}
+
+		pods, err := m.k8sClient.CoreV1().Pods(target.namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: target.label,
+			Limit:         1,
+		})
+		if apierrors.IsForbidden(err) {
+			m.access.Deny(target.namespace, err)
+			continue
+		}
+		if err != nil {
+			klog.Errorf("Failed to validate pod selector %q of daemonset %s/%s: %v", target.label, target.namespace, target.dsName, err)
+			continue
+		}
+
+		matches := len(pods.Items) > 0
+		gauge := metrics.PodSelectorValid.WithLabelValues(target.namespace, target.dsName)
+		if matches {
+			gauge.Set(1)
+		} else {
+			gauge.Set(0)
+		}
+
+		previous, checked := valid[target]
+		valid[target] = matches
+		if matches || (checked && !previous) {
+			continue
+		}
+
+		klog.Warningf("Pod selector %q of daemonset %s/%s matches no pods, its pods won't be silenced", target.label, target.namespace, target.dsName)
+		if m.options.Recorder != nil {
+			m.options.Recorder.Eventf(&corev1.ObjectReference{
+				Kind:       "DaemonSet",
+				APIVersion: "apps/v1",
+				Namespace:  target.namespace,
+				Name:       target.dsName,
+			}, corev1.EventTypeWarning, "PodSelectorNoMatch", "Pod selector %q matches no pods in namespace %s", target.label, target.namespace)
+		}
+	}
+}
+
+// startSelectorValidation validates the pod silence targets now and then periodically
+func (m *SilenceManager) startSelectorValidation(ctx context.Context) {
+	go func() {
+		valid := make(map[daemonSetIdent]bool)
+		m.validateSelectors(ctx, valid)
+
+		ticker := time.NewTicker(selectorCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.validateSelectors(ctx, valid)
+			}
+		}
+	}()
+}
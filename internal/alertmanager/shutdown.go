@@ -0,0 +1,82 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+// ShutdownAction is what happens to the tracked silences when the helper stops
+type ShutdownAction string
+
+const (
+	// ShutdownKeep persists the silences, the next instance takes them over
+	ShutdownKeep ShutdownAction = "keep"
+	// ShutdownDelete deletes the silences of all tracked nodes, e.g. when the
+	// helper is removed for good
+	ShutdownDelete ShutdownAction = "delete"
+)
+
+// ParseShutdownAction parses the value of the --shutdown-silences flag
+func ParseShutdownAction(value string) (ShutdownAction, error) {
+	switch action := ShutdownAction(value); action {
+	case ShutdownKeep, ShutdownDelete:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown shutdown action %q, expected %s or %s", value, ShutdownKeep, ShutdownDelete)
+}
+
+// Shutdown waits for the operation in progress, keeps or deletes the tracked
+// silences as selected by action and deregisters the instance, so an instance
+// of the next version doesn't have to wait for it to go stale before taking
+// over. Silences aren't modified anymore once it returned
+func (m *SilenceManager) Shutdown(ctx context.Context, action ShutdownAction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A held instance doesn't own the silences, the other version does
+	if !m.held.Load() {
+		switch action {
+		case ShutdownDelete:
+			m.deleteAll(ctx)
+		default:
+			m.persist(ctx)
+		}
+	}
+	// Hold off on the mutations of background loops still running until the
+	// context they were started with is cancelled
+	m.stopped = true
+	m.held.Store(true)
+
+	if m.options.Instances == nil {
+		return
+	}
+	if err := m.options.Instances.Deregister(ctx, m.options.Instance.ID); err != nil {
+		klog.Warningf("Failed to deregister instance %s: %v", m.options.Instance.ID, err)
+	}
+}
+
+// deleteAll deletes the silences of all tracked nodes and the silences of
+// relocated and evicted pods, then persists the empty state. The lock must be held
+func (m *SilenceManager) deleteAll(ctx context.Context) {
+	klog.Infof("Deleting the silences of %d nodes before shutting down", len(m.activeSilences.Entries()))
+	for node := range m.activeSilences.Entries() {
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence node %s: %v", node, err)
+		}
+	}
+	for _, id := range m.relocationIDs() {
+		if err := m.amClient.DeleteSilenceID(ctx, id); err != nil {
+			klog.Errorf("Failed to delete relocation silence %s: %v", id, err)
+		}
+	}
+	m.relocations = nil
+	for _, id := range m.evictionIDs() {
+		if err := m.amClient.DeleteSilenceID(ctx, id); err != nil {
+			klog.Errorf("Failed to delete eviction silence %s: %v", id, err)
+		}
+	}
+	m.evictions = make(map[string]*evictedPods)
+	m.persist(ctx)
+}
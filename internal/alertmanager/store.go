@@ -0,0 +1,280 @@
+package alertmanager
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/state"
+)
+
+// maxTrackedNodes bounds the number of nodes kept in the silence store
+const maxTrackedNodes = 10000
+
+// TrackedSilence is a silence created for a rolling node
+type TrackedSilence struct {
+	ID   string      `json:"id"`
+	Kind SilenceKind `json:"kind,omitempty"`
+	// Policy is the silence policy or built-in template the silence was
+	// created from, unknown for silences restored after a restart
+	Policy string `json:"policy,omitempty"`
+	// Duration is how long the silence is extended by on renewal
+	Duration  time.Duration `json:"-"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+}
+
+type silenceEntry struct {
+	silences []TrackedSilence
+	// startedAt is when the node's first silence started
+	startedAt time.Time
+}
+
+// expiresAt returns when the last silence of the entry expires
+func (e *silenceEntry) expiresAt() time.Time {
+	var latest time.Time
+	for _, silence := range e.silences {
+		if silence.ExpiresAt.After(latest) {
+			latest = silence.ExpiresAt
+		}
+	}
+	return latest
+}
+
+func (e *silenceEntry) ids() []string {
+	return silenceIDs(e.silences)
+}
+
+// silenceIDs returns the IDs of the silences
+func silenceIDs(silences []TrackedSilence) []string {
+	ids := make([]string, 0, len(silences))
+	for _, silence := range silences {
+		ids = append(ids, silence.ID)
+	}
+	return ids
+}
+
+func (e *silenceEntry) copy() silenceEntry {
+	return silenceEntry{
+		silences:  append([]TrackedSilence(nil), e.silences...),
+		startedAt: e.startedAt,
+	}
+}
+
+// silenceStore tracks the silences created for each node. Entries expire
+// together with their last silence so nodes missing a Done transition
+// don't stay tracked forever
+type silenceStore struct {
+	mu         sync.Mutex
+	entries    map[string]*silenceEntry
+	maxEntries int
+	now        func() time.Time
+}
+
+func newSilenceStore(maxEntries int) *silenceStore {
+	return &silenceStore{
+		entries:    make(map[string]*silenceEntry),
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// Get returns the silences tracked for a node
+func (s *silenceStore) Get(node string) ([]TrackedSilence, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[node]
+	if !ok || s.now().After(entry.expiresAt()) {
+		return nil, false
+	}
+	return append([]TrackedSilence(nil), entry.silences...), true
+}
+
+// Set starts tracking the silences of a node which just started rolling
+func (s *silenceStore) Set(node string, silences []TrackedSilence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[node]; !exists && len(s.entries) >= s.maxEntries {
+		s.evictOldest()
+	}
+	s.entries[node] = &silenceEntry{
+		silences:  silences,
+		startedAt: s.now(),
+	}
+	s.updateMetrics()
+}
+
+// Reset forgets all entries, used before loading the state of another instance
+func (s *silenceStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = make(map[string]*silenceEntry)
+	s.updateMetrics()
+}
+
+// Add merges a silence into a node's entry, used when restoring state
+func (s *silenceStore) Add(node string, silence TrackedSilence, startedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[node]
+	if !ok {
+		if len(s.entries) >= s.maxEntries {
+			s.evictOldest()
+		}
+		s.entries[node] = &silenceEntry{
+			silences:  []TrackedSilence{silence},
+			startedAt: startedAt,
+		}
+		s.updateMetrics()
+		return
+	}
+
+	entry.silences = append(entry.silences, silence)
+	if startedAt.Before(entry.startedAt) {
+		entry.startedAt = startedAt
+	}
+	s.updateMetrics()
+}
+
+// Extend replaces the silences of a tracked node, keeping its start
+func (s *silenceStore) Extend(node string, silences []TrackedSilence) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[node]
+	if !ok {
+		return false
+	}
+	entry.silences = silences
+	s.updateMetrics()
+	return true
+}
+
+// Expiring returns copies of the entries with a silence expiring before the given time
+func (s *silenceStore) Expiring(before time.Time) map[string]silenceEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	expiring := make(map[string]silenceEntry)
+	for node, entry := range s.entries {
+		for _, silence := range entry.silences {
+			if silence.ExpiresAt.Before(before) && now.Before(silence.ExpiresAt) {
+				expiring[node] = entry.copy()
+				break
+			}
+		}
+	}
+	return expiring
+}
+
+// Delete removes a node and returns the IDs of the silences it had
+func (s *silenceStore) Delete(node string) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[node]
+	if !ok {
+		return nil, false
+	}
+	delete(s.entries, node)
+	s.updateMetrics()
+	return entry.ids(), true
+}
+
+// Snapshot returns the silence IDs of all tracked nodes
+func (s *silenceStore) Snapshot() state.Silences {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	silences := make(state.Silences, len(s.entries))
+	for node, entry := range s.entries {
+		silences[node] = entry.ids()
+	}
+	return silences
+}
+
+// Entries returns copies of the silences of all tracked nodes
+func (s *silenceStore) Entries() map[string][]TrackedSilence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[string][]TrackedSilence, len(s.entries))
+	for node, entry := range s.entries {
+		entries[node] = append([]TrackedSilence(nil), entry.silences...)
+	}
+	return entries
+}
+
+// StartedAt returns when the rollout of a tracked node started
+func (s *silenceStore) StartedAt(node string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[node]
+	if !ok {
+		return time.Time{}, false
+	}
+	return entry.startedAt, true
+}
+
+// Cleanup drops entries whose silences all expired and returns how many were removed
+func (s *silenceStore) Cleanup() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	removed := 0
+	for node, entry := range s.entries {
+		if now.After(entry.expiresAt()) {
+			delete(s.entries, node)
+			removed++
+			klog.Infof("Silences for node %s expired, no longer tracking it", node)
+		}
+	}
+	if removed > 0 {
+		metrics.SilenceStoreEvictions.WithLabelValues("ttl").Add(float64(removed))
+		s.updateMetrics()
+	}
+	return removed
+}
+
+// evictOldest drops the entry closest to expiry, the lock must be held
+func (s *silenceStore) evictOldest() {
+	var oldest string
+	var oldestExpiry time.Time
+	for node, entry := range s.entries {
+		if expiresAt := entry.expiresAt(); oldest == "" || expiresAt.Before(oldestExpiry) {
+			oldest, oldestExpiry = node, expiresAt
+		}
+	}
+	if oldest != "" {
+		delete(s.entries, oldest)
+		metrics.SilenceStoreEvictions.WithLabelValues("capacity").Inc()
+		klog.Warningf("Silence store is full, no longer tracking node %s", oldest)
+	}
+}
+
+// updateMetrics refreshes the store gauges, the lock must be held
+func (s *silenceStore) updateMetrics() {
+	silences := make(map[SilenceKind]int, len(silenceKinds))
+	metrics.ActiveSilenceInfo.Reset()
+	metrics.ActiveSilenceExpiry.Reset()
+	for node, entry := range s.entries {
+		for _, silence := range entry.silences {
+			silences[silence.Kind]++
+			kind := silence.Kind.String()
+			metrics.ActiveSilenceInfo.WithLabelValues(node, kind, silence.ID, silence.ExpiresAt.UTC().Format(time.RFC3339)).Set(1)
+			metrics.ActiveSilenceExpiry.WithLabelValues(node, kind, silence.ID).Set(float64(silence.ExpiresAt.Unix()))
+		}
+	}
+	metrics.TrackedNodes.Set(float64(len(s.entries)))
+	for _, kind := range silenceKinds {
+		metrics.TrackedSilences.WithLabelValues(kind.String()).Set(float64(silences[kind]))
+	}
+}
@@ -0,0 +1,193 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// StuckAlertName is the name of the alert posted for nodes which have been
+// rolling longer than the stuck threshold. The helper's silences never cover it
+const StuckAlertName = "NodeRolloutStuck"
+
+const (
+	reasonRolloutStuck = "RolloutStuck"
+	// stuckCheckInterval is how often rolling nodes are checked against the
+	// threshold, and the alerts of stuck nodes posted again
+	stuckCheckInterval = time.Minute
+)
+
+// stuckNode is a rolling node watched by the StuckDetector
+type stuckNode struct {
+	pool  string
+	since time.Time
+	stuck bool
+}
+
+// StuckDetector reports nodes which have been rolling longer than a
+// threshold, e.g. because the MCO can't drain them, with a metric, an event
+// and optionally an alert, so they don't hide behind their silences until
+// MaxSilenceDuration
+type StuckDetector struct {
+	threshold time.Duration
+	// client posts the alerts of stuck nodes, nil if they're only reported
+	// by metric and event
+	client   *Client
+	recorder record.EventRecorder
+
+	mu      sync.Mutex
+	rolling map[string]*stuckNode
+	// resolved are the stuck nodes which finished rolling, their alerts are
+	// resolved by the next check
+	resolved map[string]*stuckNode
+}
+
+// NewStuckDetector creates a detector for nodes rolling longer than
+// threshold. client and recorder are optional
+func NewStuckDetector(threshold time.Duration, client *Client, recorder record.EventRecorder) *StuckDetector {
+	return &StuckDetector{
+		threshold: threshold,
+		client:    client,
+		recorder:  recorder,
+		rolling:   make(map[string]*stuckNode),
+		resolved:  make(map[string]*stuckNode),
+	}
+}
+
+// Observe records a node state change without blocking on Alertmanager, it's
+// a no-op on a nil detector. The rollout of a node which was rolling when the
+// helper started is timed from the first observation
+func (d *StuckDetector) Observe(node, pool string, rolling bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.rolling[node]
+	if rolling {
+		if !ok {
+			d.rolling[node] = &stuckNode{pool: pool, since: time.Now()}
+		}
+		// Rolling again before its alert was resolved
+		delete(d.resolved, node)
+		return
+	}
+	if !ok {
+		return
+	}
+	delete(d.rolling, node)
+	if !current.stuck {
+		return
+	}
+	metrics.NodeRolloutStuck.DeleteLabelValues(node, current.pool)
+	klog.InfoS("Stuck rollout of node finished", "node", node, "duration", time.Since(current.since).Round(time.Second))
+	d.resolved[node] = current
+}
+
+// Start checks the rolling nodes every minute until ctx is cancelled
+func (d *StuckDetector) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(stuckCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.check(ctx)
+			}
+		}
+	}()
+}
+
+// check reports the nodes which became stuck since the last check, resolves
+// the alerts of the nodes which finished rolling and posts the alerts of all
+// stuck nodes again, Alertmanager resolves them otherwise
+func (d *StuckDetector) check(ctx context.Context) {
+	now := time.Now()
+	resolved, stuck := d.collect(now)
+
+	// Alertmanager is called without the lock, Observe doesn't wait for it.
+	// An alert ending now is resolved right away
+	if len(resolved) > 0 {
+		if err := d.post(ctx, resolved, now); err != nil && !errors.Is(err, ErrCircuitOpen) {
+			klog.Errorf("Failed to resolve the %s alerts of %d nodes: %v", StuckAlertName, len(resolved), err)
+		}
+	}
+	if len(stuck) > 0 {
+		if err := d.post(ctx, stuck, now.Add(inhibitionTimeout)); err != nil && !errors.Is(err, ErrCircuitOpen) {
+			klog.Errorf("Failed to post the %s alerts of %d nodes: %v", StuckAlertName, len(stuck), err)
+		}
+	}
+}
+
+// collect takes the nodes whose alerts are resolved and returns the stuck
+// nodes, reporting the ones which became stuck
+func (d *StuckDetector) collect(now time.Time) (resolved, stuck map[string]*stuckNode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	resolved = d.resolved
+	d.resolved = make(map[string]*stuckNode)
+	stuck = make(map[string]*stuckNode)
+	for node, current := range d.rolling {
+		rolling := now.Sub(current.since)
+		if rolling < d.threshold {
+			continue
+		}
+		stuck[node] = current
+		if current.stuck {
+			continue
+		}
+		current.stuck = true
+		metrics.NodeRolloutStuck.WithLabelValues(node, current.pool).Set(1)
+		klog.InfoS("Node has been rolling longer than the stuck threshold", "node", node, "pool", current.pool, "duration", rolling.Round(time.Second))
+		if d.recorder != nil {
+			d.recorder.Eventf(nodeRef(node), corev1.EventTypeWarning, reasonRolloutStuck, "Rolling for %s, longer than %s", rolling.Round(time.Second), d.threshold)
+		}
+	}
+	return resolved, stuck
+}
+
+// post sends the alerts of stuck nodes ending at endsAt. The nodes' pool and
+// start don't change, the lock isn't needed
+func (d *StuckDetector) post(ctx context.Context, nodes map[string]*stuckNode, endsAt time.Time) error {
+	if d.client == nil {
+		return nil
+	}
+	alerts := make(models.PostableAlerts, 0, len(nodes))
+	for node, current := range nodes {
+		labels := models.LabelSet{
+			"alertname": StuckAlertName,
+			"node":      node,
+			"severity":  "warning",
+		}
+		if current.pool != "" {
+			labels["pool"] = current.pool
+		}
+		alerts = append(alerts, &models.PostableAlert{
+			Alert: models.Alert{Labels: labels},
+			Annotations: models.LabelSet{
+				"summary": fmt.Sprintf("Node %s has been rolling since %s, longer than %s", node, current.since.UTC().Format(time.RFC3339), d.threshold),
+			},
+			StartsAt: strfmt.DateTime(current.since.Add(d.threshold)),
+			EndsAt:   strfmt.DateTime(endsAt),
+		})
+	}
+	if err := d.client.PostAlerts(ctx, alerts); err != nil {
+		return fmt.Errorf("failed to post %s alerts: %w", StuckAlertName, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	amfake "rollout-helper/internal/alertmanager/fake"
+)
+
+func TestStuckDetectorResolvesOnCheck(t *testing.T) {
+	ctx := context.Background()
+	// A slow Alertmanager would stall Observe if it posted itself
+	am := amfake.NewServer(time.Second)
+	defer am.Close()
+	d := NewStuckDetector(time.Hour, NewClient([]string{am.URL()}, ""), nil)
+
+	d.Observe("worker-0", "worker", true)
+	d.mu.Lock()
+	d.rolling["worker-0"].since = time.Now().Add(-2 * time.Hour)
+	d.mu.Unlock()
+
+	d.check(ctx)
+	alerts := am.Alerts()
+	if len(alerts) != 1 || alerts[0].Labels["node"] != "worker-0" || alerts[0].Labels["pool"] != "worker" {
+		t.Fatalf("expected the stuck alert of worker-0, got %v", alerts)
+	}
+	if endsAt := time.Time(alerts[0].EndsAt); !endsAt.After(time.Now()) {
+		t.Fatalf("expected the stuck alert to be firing, it ends at %s", endsAt)
+	}
+
+	requests := am.Requests()
+	started := time.Now()
+	d.Observe("worker-0", "worker", false)
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Errorf("Observe took %s, it must not wait for Alertmanager", elapsed)
+	}
+	if am.Requests() != requests {
+		t.Errorf("Observe called Alertmanager")
+	}
+
+	d.check(ctx)
+	alerts = am.Alerts()
+	if len(alerts) != 2 {
+		t.Fatalf("expected the resolved alert of worker-0 to be posted, got %d alerts", len(alerts))
+	}
+	if endsAt := time.Time(alerts[1].EndsAt); endsAt.After(time.Now()) {
+		t.Errorf("expected the alert of worker-0 to be resolved, it ends at %s", endsAt)
+	}
+
+	d.check(ctx)
+	if alerts := am.Alerts(); len(alerts) != 2 {
+		t.Errorf("expected the alert to be resolved once, got %d alerts", len(alerts))
+	}
+}
+
+func TestStuckDetectorRollingAgainBeforeResolve(t *testing.T) {
+	am := amfake.NewServer(0)
+	defer am.Close()
+	d := NewStuckDetector(time.Hour, NewClient([]string{am.URL()}, ""), nil)
+
+	d.Observe("worker-0", "worker", true)
+	d.mu.Lock()
+	d.rolling["worker-0"].since = time.Now().Add(-2 * time.Hour)
+	d.mu.Unlock()
+	d.check(context.Background())
+
+	d.Observe("worker-0", "worker", false)
+	d.Observe("worker-0", "worker", true)
+	d.check(context.Background())
+
+	for _, alert := range am.Alerts() {
+		if endsAt := time.Time(alert.EndsAt); !endsAt.After(time.Now()) {
+			t.Errorf("expected no resolved alert for a node rolling again, got one ending at %s", endsAt)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/prometheus"
+	"rollout-helper/internal/watcher"
+)
+
+// targetsInterval is how often the scrape targets of nodes waiting for them are queried
+const targetsInterval = 15 * time.Second
+
+// waitForTargets keeps the silences of a node which finished rolling until
+// Prometheus scrapes the targets of its instance silence again, so their
+// ScrapingTargetDown alerts don't fire right after the rollout. It reports
+// false if there's nothing to wait for, the lock must be held
+func (m *SilenceManager) waitForTargets(nodeName string) bool {
+	if m.options.Prometheus == nil || m.options.TargetsTimeout <= 0 {
+		return false
+	}
+	if _, tracked := m.activeSilences.Get(nodeName); !tracked {
+		return false
+	}
+	if _, ok := m.targets[nodeName]; ok {
+		return true
+	}
+
+	m.targets[nodeName] = time.Now()
+	klog.InfoS("Node finished rolling, waiting for its scrape targets before deleting its silences", "action", "targets", "node", nodeName, "timeout", m.options.TargetsTimeout)
+	return true
+}
+
+// targetsSince returns since when a node waits for its scrape targets, the lock must be held
+func (m *SilenceManager) targetsSince(nodeName string) (time.Time, bool) {
+	since, ok := m.targets[nodeName]
+	return since, ok
+}
+
+// targetsTimeout returns how long nodes wait for their scrape targets, zero
+// if they don't
+func (m *SilenceManager) targetsTimeout() time.Duration {
+	if m.options.Prometheus == nil {
+		return 0
+	}
+	return m.options.TargetsTimeout
+}
+
+// startTargetChecks queries the scrape targets of the nodes waiting for them
+// every targetsInterval until ctx is cancelled
+func (m *SilenceManager) startTargetChecks(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(targetsInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if m.held.Load() {
+					continue
+				}
+				m.checkTargets(ctx)
+			}
+		}
+	}()
+}
+
+// checkTargets unsilences the nodes whose scrape targets are all up again,
+// after UnsilenceDelay if set, and the nodes which waited TargetsTimeout
+func (m *SilenceManager) checkTargets(ctx context.Context) {
+	m.mu.Lock()
+	pending := make(map[string]time.Time, len(m.targets))
+	for node, since := range m.targets {
+		pending[node] = since
+	}
+	m.mu.Unlock()
+
+	// Prometheus is queried without holding off node state changes
+	down := make(map[string][]string, len(pending))
+	for node := range pending {
+		instances, err := m.downTargets(ctx, node)
+		if err != nil {
+			klog.Errorf("Failed to query the scrape targets of node %s: %v", node, err)
+			// Checked again until the timeout
+			instances = []string{"unknown"}
+		}
+		down[node] = instances
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for node, instances := range down {
+		// Rolling again or unsilenced while it was queried
+		if since, ok := m.targets[node]; !ok || !since.Equal(pending[node]) {
+			continue
+		}
+		waited := now.Sub(pending[node]).Round(time.Second)
+		if len(instances) == 0 {
+			delete(m.targets, node)
+			metrics.UnsilenceTargetWaits.WithLabelValues("up").Inc()
+			klog.InfoS("Scrape targets of node are up again", "action", "targets", "node", node, "duration", waited)
+			if m.delayUnsilence(node) {
+				continue
+			}
+		} else {
+			if now.Sub(pending[node]) < m.options.TargetsTimeout {
+				continue
+			}
+			delete(m.targets, node)
+			metrics.UnsilenceTargetWaits.WithLabelValues("timeout").Inc()
+			klog.InfoS("Scrape targets of node are still down, deleting its silences", "action", "targets", "node", node, "duration", waited, "instances", instances)
+		}
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence node %s after waiting for its scrape targets: %v", node, err)
+		}
+	}
+	m.persistRollouts(ctx)
+}
+
+// downTargets returns the instances of the jobs of the instance silence on
+// the node which Prometheus can't scrape. Right after a reboot the targets
+// aren't discovered yet rather than down, jobs without a target on the node
+// are returned as down too
+func (m *SilenceManager) downTargets(ctx context.Context, nodeName string) ([]string, error) {
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node: %w", err)
+	}
+	jobs := instanceServices
+	if watcher.IsWindows(node) {
+		jobs = windowsInstanceServices
+	}
+
+	query := fmt.Sprintf(`up{job=~%q,instance=~%q}`, strings.Join(jobs, "|"), prometheus.InstancePattern(node))
+	samples, err := m.options.Prometheus.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	scraped := make(map[string]bool, len(jobs))
+	var instances []string
+	for _, sample := range samples {
+		scraped[sample.Metric["job"]] = true
+		if sample.Value != 1 {
+			instances = append(instances, sample.Metric["job"]+"/"+sample.Metric["instance"])
+		}
+	}
+	for _, job := range jobs {
+		if !scraped[job] {
+			instances = append(instances, job+"/absent")
+		}
+	}
+	return instances, nil
+}
@@ -0,0 +1,148 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"rollout-helper/internal/prometheus"
+	"rollout-helper/internal/watcher"
+)
+
+// upSample is a sample of the up metric returned by the fake Prometheus
+type upSample struct {
+	job, instance, value string
+}
+
+// newTargetsManager returns a manager querying a fake Prometheus which
+// returns samples, and the queries it received
+func newTargetsManager(t *testing.T, node *corev1.Node, samples ...upSample) (*SilenceManager, *[]string) {
+	t.Helper()
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+		result := make([]map[string]interface{}, 0, len(samples))
+		for _, sample := range samples {
+			result = append(result, map[string]interface{}{
+				"metric": map[string]string{"__name__": "up", "job": sample.job, "instance": sample.instance},
+				"value":  []interface{}{1700000000, sample.value},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"resultType": "vector", "result": result},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := prometheus.NewClient(server.URL, "token")
+	if err != nil {
+		t.Fatalf("Failed to create the Prometheus client: %v", err)
+	}
+	m := &SilenceManager{
+		k8sClient: fake.NewSimpleClientset(node),
+		options:   Options{Prometheus: client},
+	}
+	return m, &queries
+}
+
+func targetsNode(windows bool) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Labels: map[string]string{}},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			{Type: corev1.NodeHostName, Address: "worker-1.example.com"},
+		}},
+	}
+	if windows {
+		node.Labels[watcher.OSLabel] = "windows"
+	}
+	return node
+}
+
+func TestDownTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows bool
+		samples []upSample
+		want    []string
+	}{
+		{
+			name: "all up",
+			samples: []upSample{
+				{"node-exporter", "10.0.0.1:9100", "1"},
+				{"kubernetes-cadvisor", "10.0.0.1:10250", "1"},
+				{"kubelet", "10.0.0.1:10250", "1"},
+			},
+		},
+		{
+			name: "down",
+			samples: []upSample{
+				{"node-exporter", "10.0.0.1:9100", "0"},
+				{"kubernetes-cadvisor", "10.0.0.1:10250", "1"},
+				{"kubelet", "10.0.0.1:10250", "1"},
+			},
+			want: []string{"node-exporter/10.0.0.1:9100"},
+		},
+		{
+			name: "not scraped after a reboot",
+			samples: []upSample{
+				{"kubelet", "10.0.0.1:10250", "1"},
+			},
+			want: []string{"kubernetes-cadvisor/absent", "node-exporter/absent"},
+		},
+		{
+			name: "nothing scraped",
+			want: []string{"kubelet/absent", "kubernetes-cadvisor/absent", "node-exporter/absent"},
+		},
+		{
+			name:    "windows",
+			windows: true,
+			samples: []upSample{
+				{"kubelet", "10.0.0.1:10250", "1"},
+			},
+			want: []string{"windows-exporter/absent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := targetsNode(tt.windows)
+			m, queries := newTargetsManager(t, node, tt.samples...)
+
+			down, err := m.downTargets(context.Background(), node.Name)
+			if err != nil {
+				t.Fatalf("downTargets failed: %v", err)
+			}
+			sort.Strings(down)
+			if strings.Join(down, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected down targets %v, got %v", tt.want, down)
+			}
+
+			if len(*queries) != 1 {
+				t.Fatalf("Expected one query, got %v", *queries)
+			}
+			query := (*queries)[0]
+			if strings.Contains(query, "==") {
+				t.Errorf("Targets which aren't scraped must be queried too, got %s", query)
+			}
+			if !strings.Contains(query, `instance=~"(worker-1|10\\.0\\.0\\.1)(:[0-9]+)?"`) {
+				t.Errorf("Expected the instances of the node in %s", query)
+			}
+		})
+	}
+}
+
+func TestDownTargetsUnknownNode(t *testing.T) {
+	m, _ := newTargetsManager(t, targetsNode(false))
+	if _, err := m.downTargets(context.Background(), "worker-2"); err == nil {
+		t.Error("Expected an error for a node which can't be looked up")
+	}
+}
@@ -0,0 +1,149 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// TenantHeader selects the tenant of requests to multi-tenant Alertmanagers
+// like the ones of Mimir and Cortex
+const TenantHeader = "X-Scope-OrgID"
+
+// Silences of a tenant other than the default one are identified by their
+// tenant and ID, e.g. "team-a/<id>". Tenant names can't contain the separator
+const tenantSeparator = "/"
+
+// joinTenantID builds the ID of a silence of tenant
+func joinTenantID(tenant, id string) string {
+	if tenant == "" || id == "" {
+		return id
+	}
+	return tenant + tenantSeparator + id
+}
+
+// splitTenantID returns the tenant of a silence, empty for the default one,
+// and its ID in the tenant
+func splitTenantID(id string) (string, string) {
+	if tenant, tenantID, found := strings.Cut(id, tenantSeparator); found {
+		return tenant, tenantID
+	}
+	return "", id
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose silences are created in tenant, the
+// default tenant if it's empty
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantOf returns the tenant selected by WithTenant, empty for the default one
+func (c *Client) tenantOf(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	if tenant == c.tenant {
+		return ""
+	}
+	return tenant
+}
+
+// forSilence returns the context to send the requests about a silence with,
+// and its ID in its tenant. The tenant is listed from now on, e.g. for
+// silences restored after a restart
+func (c *Client) forSilence(ctx context.Context, id string) (context.Context, string, string) {
+	tenant, tenantID := splitTenantID(id)
+	c.addTenant(tenant)
+	return WithTenant(ctx, tenant), tenant, tenantID
+}
+
+// SetTenant sets the default tenant sent as X-Scope-OrgID, none if empty
+func (c *Client) SetTenant(tenant string) {
+	c.tenant = tenant
+}
+
+// SetHeaders adds headers given as "Name: value" to every Alertmanager
+// request, e.g. for a tenancy proxy. Values are expanded from the environment
+func (c *Client) SetHeaders(headers []string) error {
+	parsed := make(http.Header, len(headers))
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid header %q, expected Name: value", header)
+		}
+		parsed.Set(strings.TrimSpace(name), os.ExpandEnv(strings.TrimSpace(value)))
+	}
+	c.headers = parsed
+	return nil
+}
+
+// AddTenants adds tenants whose silences are listed with the ones of the
+// default tenant, e.g. the tenants of the configured policies
+func (c *Client) AddTenants(tenants ...string) {
+	for _, tenant := range tenants {
+		c.addTenant(tenant)
+	}
+}
+
+func (c *Client) addTenant(tenant string) {
+	if tenant == "" || tenant == c.tenant {
+		return
+	}
+	c.tenantsMu.Lock()
+	defer c.tenantsMu.Unlock()
+	if c.tenants == nil {
+		c.tenants = make(map[string]bool)
+	}
+	c.tenants[tenant] = true
+}
+
+// extraTenants returns the tenants besides the default one in order
+func (c *Client) extraTenants() []string {
+	c.tenantsMu.Lock()
+	defer c.tenantsMu.Unlock()
+	tenants := make([]string, 0, len(c.tenants))
+	for tenant := range c.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// listTenants runs list for the default tenant and every other known tenant,
+// and tags the IDs of the silences of other tenants with their tenant
+func (c *Client) listTenants(ctx context.Context, list func(ctx context.Context) ([]models.PostableSilence, error)) ([]models.PostableSilence, error) {
+	all, err := list(WithTenant(ctx, ""))
+	if err != nil {
+		return nil, err
+	}
+	for _, tenant := range c.extraTenants() {
+		silences, err := list(WithTenant(ctx, tenant))
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		for _, silence := range silences {
+			silence.ID = joinTenantID(tenant, silence.ID)
+			all = append(all, silence)
+		}
+	}
+	return all, nil
+}
+
+// setTenantHeaders sets the extra headers and the tenant of ctx on req
+func (c *Client) setTenantHeaders(ctx context.Context, req *http.Request) {
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	tenant := c.tenantOf(ctx)
+	if tenant == "" {
+		tenant = c.tenant
+	}
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+}
@@ -0,0 +1,132 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"rollout-helper/internal/metrics"
+)
+
+// RequestLimits bound the load the helper puts on Alertmanager, e.g. when a
+// whole pool starts rolling at once
+type RequestLimits struct {
+	// Concurrency is how many requests are in flight at most, zero is unbounded
+	Concurrency int
+	// RatePerSecond is how many requests are sent to each endpoint per second
+	// on average, zero is unlimited
+	RatePerSecond float64
+	// Burst is how many requests may be sent to an endpoint at once before
+	// the rate applies
+	Burst int
+}
+
+// DefaultRequestLimits are used unless SetRequestLimits is called
+var DefaultRequestLimits = RequestLimits{
+	Concurrency:   4,
+	RatePerSecond: 10,
+	Burst:         20,
+}
+
+// Validate rejects negative limits and a rate without a burst
+func (l RequestLimits) Validate() error {
+	if l.Concurrency < 0 || l.RatePerSecond < 0 || l.Burst < 0 {
+		return fmt.Errorf("request limits must not be negative")
+	}
+	if l.RatePerSecond > 0 && l.Burst < 1 {
+		return fmt.Errorf("a request rate needs a burst of at least 1")
+	}
+	return nil
+}
+
+// throttle holds requests back until a slot of the pool is free and the rate
+// limit of their endpoint allows them
+type throttle struct {
+	limits RequestLimits
+	// slots has a buffer of Concurrency, nil if unbounded
+	slots chan struct{}
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newThrottle(limits RequestLimits) *throttle {
+	t := &throttle{
+		limits:   limits,
+		limiters: make(map[string]*rate.Limiter),
+	}
+	if limits.Concurrency > 0 {
+		t.slots = make(chan struct{}, limits.Concurrency)
+	}
+	return t
+}
+
+// wait blocks until a request may be sent to endpoint and returns the
+// function releasing its slot. The rate is waited for first, so waiting
+// requests don't hold slots
+func (t *throttle) wait(ctx context.Context, endpoint string) (func(), error) {
+	start := time.Now()
+	defer func() {
+		metrics.AlertmanagerThrottleSeconds.Add(time.Since(start).Seconds())
+	}()
+
+	if limiter := t.limiter(endpoint); limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+	}
+	if t.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case t.slots <- struct{}{}:
+		return func() { <-t.slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to send request: %w", ctx.Err())
+	}
+}
+
+// limiter returns the rate limiter of endpoint, nil if the rate is unlimited
+func (t *throttle) limiter(endpoint string) *rate.Limiter {
+	if t.limits.RatePerSecond <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limiter, ok := t.limiters[endpoint]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(t.limits.RatePerSecond), t.limits.Burst)
+		t.limiters[endpoint] = limiter
+	}
+	return limiter
+}
+
+// parallel runs tasks on a pool of as many workers as requests may be in
+// flight and waits for them. Tasks sending more requests than that still
+// queue in wait, the pool keeps them from piling up there
+func (t *throttle) parallel(tasks []func()) {
+	workers := t.limits.Concurrency
+	if workers <= 0 || workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	queue := make(chan func())
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				task()
+			}
+		}()
+	}
+	for _, task := range tasks {
+		queue <- task
+	}
+	close(queue)
+	wg.Wait()
+}
@@ -0,0 +1,83 @@
+package alertmanager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configure how the client verifies Alertmanager and authenticates to it
+type TLSOptions struct {
+	// CAFile holds the CAs trusted in addition to the system ones
+	CAFile string
+	// CertFile and KeyFile hold the client certificate for mTLS
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables verification of the server certificate
+	InsecureSkipVerify bool
+}
+
+// Enabled reports whether any TLS option is set
+func (o TLSOptions) Enabled() bool {
+	return o.CAFile != "" || o.CertFile != "" || o.KeyFile != "" || o.InsecureSkipVerify
+}
+
+// Config builds the TLS configuration. The client certificate is read again
+// on every handshake so rotated certificates are picked up without a restart
+func (o TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key file must be set together")
+	}
+	if o.CertFile != "" {
+		// Fail early on a broken key pair instead of on the first request
+		if _, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+	return config, nil
+}
+
+// SetTLS configures TLS for requests to Alertmanager
+func (c *Client) SetTLS(options TLSOptions) error {
+	config, err := options.Config()
+	if err != nil {
+		return err
+	}
+
+	// Keeps a proxy set before
+	transport, err := c.httpTransport()
+	if err != nil {
+		return err
+	}
+	transport.TLSClientConfig = config
+	c.SetTransport(transport)
+	return nil
+}
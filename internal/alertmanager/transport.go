@@ -0,0 +1,95 @@
+package alertmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPOptions tune the connections to Alertmanager
+type HTTPOptions struct {
+	// Timeout bounds a single attempt of a request, including reading the response
+	Timeout time.Duration
+	// MaxIdleConns is how many idle connections are kept open per endpoint
+	// for later requests, zero closes every connection after its request
+	MaxIdleConns int
+	// IdleConnTimeout is how long an idle connection is kept open, zero keeps it
+	IdleConnTimeout time.Duration
+	// KeepAlive is the interval of TCP keep-alive probes on open connections,
+	// negative disables them
+	KeepAlive time.Duration
+}
+
+// DefaultHTTPOptions keep enough connections open for the default request
+// concurrency, so bursts of silences don't open new connections
+var DefaultHTTPOptions = HTTPOptions{
+	Timeout:         10 * time.Second,
+	MaxIdleConns:    DefaultRequestLimits.Concurrency * 2,
+	IdleConnTimeout: 90 * time.Second,
+	KeepAlive:       30 * time.Second,
+}
+
+// Validate checks that the options can be applied
+func (o HTTPOptions) Validate() error {
+	if o.Timeout <= 0 {
+		return errors.New("the timeout must be positive")
+	}
+	if o.MaxIdleConns < 0 {
+		return errors.New("the idle connections can't be negative")
+	}
+	if o.IdleConnTimeout < 0 {
+		return errors.New("the idle connection timeout can't be negative")
+	}
+	return nil
+}
+
+// SetHTTPOptions replaces the timeout and connection settings of the requests
+// to Alertmanager
+func (c *Client) SetHTTPOptions(options HTTPOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	transport, err := c.httpTransport()
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: options.KeepAlive}
+	transport.DialContext = dialer.DialContext
+	transport.DisableKeepAlives = options.MaxIdleConns == 0
+	transport.MaxIdleConnsPerHost = options.MaxIdleConns
+	transport.IdleConnTimeout = options.IdleConnTimeout
+	c.SetTransport(transport)
+	c.httpClient.Timeout = options.Timeout
+	return nil
+}
+
+// httpTransport returns a copy of the client's transport to be modified, the
+// default transport honoring the proxy environment variables if none is set
+func (c *Client) httpTransport() (*http.Transport, error) {
+	switch transport := c.httpClient.Transport.(type) {
+	case nil:
+		return http.DefaultTransport.(*http.Transport).Clone(), nil
+	case *http.Transport:
+		return transport.Clone(), nil
+	default:
+		return nil, fmt.Errorf("unsupported transport %T", transport)
+	}
+}
+
+// drainingBody reads what's left of a response before closing it, so its
+// connection can be reused. Unread error bodies are short
+type drainingBody struct {
+	io.ReadCloser
+}
+
+// maxDrain bounds what is read of a response nobody read to its end
+const maxDrain = 64 << 10
+
+func (b drainingBody) Close() error {
+	io.Copy(io.Discard, io.LimitReader(b.ReadCloser, maxDrain))
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,146 @@
+package alertmanager
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/verify"
+)
+
+const (
+	reasonRolloutVerified           = "RolloutVerified"
+	reasonRolloutVerificationFailed = "RolloutVerificationFailed"
+	// verifyInterval is how often the nodes being verified are checked
+	verifyInterval = 15 * time.Second
+)
+
+// verifyRollout keeps the silences of a node which finished rolling until
+// the Verifier found it healthy. It reports false if there's nothing to
+// verify, the lock must be held
+func (m *SilenceManager) verifyRollout(nodeName string) bool {
+	if m.options.Verifier == nil {
+		return false
+	}
+	if _, tracked := m.activeSilences.Get(nodeName); !tracked {
+		return false
+	}
+	if _, ok := m.verifying[nodeName]; ok {
+		return true
+	}
+
+	m.verifying[nodeName] = time.Now()
+	klog.InfoS("Node finished rolling, verifying it before deleting its silences", "action", "verify", "node", nodeName, "timeout", m.options.VerifyTimeout)
+	return true
+}
+
+// verifyingSince returns when the verification of a node started, the lock must be held
+func (m *SilenceManager) verifyingSince(nodeName string) (time.Time, bool) {
+	since, ok := m.verifying[nodeName]
+	return since, ok
+}
+
+// startVerification checks the nodes being verified every verifyInterval
+// until ctx is cancelled
+func (m *SilenceManager) startVerification(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(verifyInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if m.held.Load() {
+					continue
+				}
+				m.verifyNodes(ctx)
+			}
+		}
+	}()
+}
+
+// verifyNodes runs the checks of the nodes being verified. Healthy nodes go
+// on to wait for their scrape targets and the delay after their rollout,
+// nodes still failing after VerifyTimeout are reported and unsilenced so
+// their alerts fire
+func (m *SilenceManager) verifyNodes(ctx context.Context) {
+	m.mu.Lock()
+	pending := make(map[string]time.Time, len(m.verifying))
+	for node, since := range m.verifying {
+		pending[node] = since
+	}
+	m.mu.Unlock()
+
+	// The checks query the API server and Prometheus, node state changes
+	// aren't held off meanwhile
+	results := make(map[string][]verify.Failure, len(pending))
+	for node := range pending {
+		results[node] = m.options.Verifier.Verify(ctx, node)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for node, failures := range results {
+		// Rolling again or unsilenced while it was checked
+		if since, ok := m.verifying[node]; !ok || !since.Equal(pending[node]) {
+			continue
+		}
+		if len(failures) == 0 {
+			delete(m.verifying, node)
+			metrics.RolloutVerifications.WithLabelValues("passed").Inc()
+			klog.InfoS("Node passed the verification after its rollout", "action", "verify", "node", node, "duration", now.Sub(pending[node]).Round(time.Second))
+			m.recordEvent(node, reasonRolloutVerified, "Healthy after the rollout, verified in %s", now.Sub(pending[node]).Round(time.Second))
+			if m.waitForTargets(node) || m.delayUnsilence(node) {
+				continue
+			}
+			if err := m.unsilenceNode(ctx, node); err != nil {
+				klog.Errorf("Failed to unsilence node %s after its verification: %v", node, err)
+			}
+			continue
+		}
+
+		reasons := make([]string, 0, len(failures))
+		for _, failure := range failures {
+			reasons = append(reasons, failure.String())
+		}
+		if now.Sub(pending[node]) < m.options.VerifyTimeout {
+			klog.V(2).InfoS("Node didn't pass the verification yet", "node", node, "failures", reasons)
+			continue
+		}
+
+		delete(m.verifying, node)
+		metrics.RolloutVerifications.WithLabelValues("failed").Inc()
+		for _, failure := range failures {
+			metrics.RolloutVerificationFailures.WithLabelValues(failure.Check).Inc()
+		}
+		klog.InfoS("Node failed the verification after its rollout, deleting its silences", "action", "verify", "node", node, "failures", reasons)
+		if m.options.Recorder != nil {
+			m.options.Recorder.Eventf(nodeRef(node), corev1.EventTypeWarning, reasonRolloutVerificationFailed, "Unhealthy %s after the rollout, deleting its silences: %s", m.options.VerifyTimeout, strings.Join(reasons, "; "))
+		}
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence node %s after its failed verification: %v", node, err)
+		}
+	}
+	m.persistRollouts(ctx)
+}
+
+// Verifying returns the nodes which finished rolling and are being verified,
+// and when their verification started
+func (m *SilenceManager) Verifying() map[string]time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	verifying := make(map[string]time.Time, len(m.verifying))
+	for node, since := range m.verifying {
+		verifying[node] = since
+	}
+	return verifying
+}
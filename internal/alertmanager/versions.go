@@ -0,0 +1,121 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/state"
+)
+
+const (
+	// heartbeatInterval is how often the instance records itself in the state store
+	heartbeatInterval = 30 * time.Second
+	// instanceStaleAfter is how long an instance is considered running after its last heartbeat
+	instanceStaleAfter = 2 * time.Minute
+)
+
+// errHeld is returned by requests which would modify silences while held
+var errHeld = errors.New("an instance of another version manages the silences, try again once it's gone")
+
+// holdFor returns the instance of a different version self has to wait for.
+// Of two instances with different versions, the one which started first keeps
+// managing silences, usually the old version during a rolling deploy
+func holdFor(self state.Instance, peers []state.Instance) (state.Instance, bool) {
+	for _, peer := range peers {
+		if peer.Version == self.Version {
+			continue
+		}
+		if peer.StartedAt.Before(self.StartedAt) || (peer.StartedAt.Equal(self.StartedAt) && peer.ID < self.ID) {
+			return peer, true
+		}
+	}
+	return state.Instance{}, false
+}
+
+// checkVersions records the instance in the registry and holds off on
+// mutations while an older instance of another version is running. It's
+// called without the lock
+func (m *SilenceManager) checkVersions(ctx context.Context) {
+	self := m.options.Instance
+	peers, err := m.options.Instances.Heartbeat(ctx, self, instanceStaleAfter)
+	if err != nil {
+		// Keep the previous decision until the registry can be reached again
+		klog.Warningf("Failed to record instance %s: %v", self.ID, err)
+		return
+	}
+
+	peer, hold := holdFor(self, peers)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		// The instance is shutting down, it doesn't take over anymore
+		return
+	}
+
+	switch {
+	case hold && !m.held.Load():
+		klog.Warningf("Instance %s of version %s manages the silences, holding off until it's gone", peer.ID, peer.Version)
+		m.held.Store(true)
+		metrics.MutationsHeld.Set(1)
+	case !hold && m.held.Load():
+		klog.Infof("No instance of another version is running anymore, taking over the silences")
+		m.resume(ctx)
+	}
+}
+
+// resume takes over the silences once the instances of another version are
+// gone. The state they persisted is loaded and reconciled with the node states
+// observed while holding off, the lock must be held
+func (m *SilenceManager) resume(ctx context.Context) {
+	m.held.Store(false)
+	metrics.MutationsHeld.Set(0)
+
+	m.activeSilences.Reset()
+	m.load(ctx)
+
+	for node, kind := range m.rolling {
+		if _, ok := m.unsilencedUntil(node); ok {
+			continue
+		}
+		if _, ok := m.escalatedSince(node); ok {
+			continue
+		}
+		if err := m.silenceNode(ctx, node, kind); err != nil {
+			klog.Errorf("Failed to silence node %s: %v", node, err)
+		}
+	}
+	for node, silences := range m.activeSilences.Entries() {
+		if _, rolling := m.rolling[node]; rolling {
+			continue
+		}
+		// Maintenance silences are reconciled by the next SetMaintenance
+		if hasKind(silences, KindMaintenanceWindow) {
+			continue
+		}
+		klog.Infof("Node %s finished rolling while holding off, deleting its silences", node)
+		if err := m.unsilenceNode(ctx, node); err != nil {
+			klog.Errorf("Failed to unsilence node %s: %v", node, err)
+		}
+	}
+}
+
+// startVersionGuard keeps recording the instance until ctx is cancelled
+func (m *SilenceManager) startVersionGuard(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.checkVersions(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,36 @@
+package alertmanager
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/watcher"
+)
+
+// windowsNodeServices are the jobs silenced by the node silence of a Windows
+// node, which runs the windows_exporter instead of node-exporter and no crio
+var windowsNodeServices = []string{
+	"windows-exporter",
+	"event-exporter",
+	"kube-state-metrics",
+	"kubelet",
+}
+
+// windowsInstanceServices are the jobs silenced by the instance silence of a Windows node
+var windowsInstanceServices = []string{
+	"windows-exporter",
+	"kubelet",
+}
+
+// isWindowsNode reports whether a node is a Windows worker, nodes which can't
+// be looked up get the Linux silences
+func (m *SilenceManager) isWindowsNode(ctx context.Context, nodeName string) bool {
+	node, err := m.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Warningf("Failed to get node %s, assuming it's a Linux node: %v", nodeName, err)
+		return false
+	}
+	return watcher.IsWindows(node)
+}
@@ -0,0 +1,132 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/config"
+)
+
+// DefaultWorkloadAlerts fire for the workloads of tenants while their pods
+// are evicted from a rolling node
+var DefaultWorkloadAlerts = []string{"KubePodNotReady", "KubeDeploymentReplicasMismatch", "KubeStatefulSetReplicasMismatch"}
+
+// DefaultWorkloadExclude are the platform namespaces, covered by the infra
+// silences instead
+var DefaultWorkloadExclude = []string{"openshift", "openshift-*", "kube-*"}
+
+// WorkloadSelector selects the namespaces whose workload alerts are silenced
+// while one of their pods is on a rolling node. Namespaces are matched by
+// shell patterns, e.g. team-*
+type WorkloadSelector struct {
+	// Alerts are the names of the silenced alerts
+	Alerts []string
+	// Include selects namespaces, all if empty
+	Include []string
+	// Exclude drops namespaces selected by Include
+	Exclude []string
+}
+
+// Validate rejects selectors without alerts and invalid patterns
+func (s *WorkloadSelector) Validate() error {
+	if len(s.Alerts) == 0 {
+		return fmt.Errorf("no alerts")
+	}
+	for _, pattern := range append(append([]string(nil), s.Include...), s.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Selected reports whether the alerts of namespace are silenced
+func (s *WorkloadSelector) Selected(namespace string) bool {
+	return (len(s.Include) == 0 || matchesAny(s.Include, namespace)) && !matchesAny(s.Exclude, namespace)
+}
+
+// matchesAny reports whether one of the validated patterns matches value
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// workloadNamespaces returns the selected namespaces of the pods on the
+// node which are still running or about to
+func (m *SilenceManager) workloadNamespaces(ctx context.Context, nodeName string) ([]string, error) {
+	pods, err := m.options.Namespaces.ListPods(ctx, m.k8sClient, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of node %s: %w", nodeName, err)
+	}
+
+	selected := make(map[string]bool)
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if m.options.Workloads.Selected(pod.Namespace) {
+			selected[pod.Namespace] = true
+		}
+	}
+	namespaces := make([]string, 0, len(selected))
+	for namespace := range selected {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// CreateWorkloadSilence silences the workload alerts of the selected
+// namespaces with pods on the node, with a single silence. It's a no-op
+// without Options.Workloads
+func (m *SilenceManager) CreateWorkloadSilence(ctx context.Context, nodeName string, kind SilenceKind) (string, error) {
+	if m.options.Workloads == nil {
+		return "", nil
+	}
+	namespaces, err := m.workloadNamespaces(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+	if len(namespaces) == 0 {
+		return "", nil
+	}
+
+	quoted := make([]string, len(namespaces))
+	for i, namespace := range namespaces {
+		quoted[i] = regexp.QuoteMeta(namespace)
+	}
+	matchers := models.Matchers{
+		{
+			Name:    stringPtr("namespace"),
+			Value:   stringPtr(fmt.Sprintf("(%s)", strings.Join(quoted, "|"))),
+			IsRegex: boolPtr(true),
+		},
+		{
+			Name:    stringPtr("alertname"),
+			Value:   stringPtr(fmt.Sprintf("(%s)", strings.Join(m.options.Workloads.Alerts, "|"))),
+			IsRegex: boolPtr(true),
+		},
+	}
+	id, err := m.amClient.CreateSilence(ctx, matchers, nodeName, kind, m.templateDuration(config.TemplateWorkload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create workload silence: %w", err)
+	}
+
+	klog.Infof("Created workload silence for %d namespaces on node %s", len(namespaces), nodeName)
+	return id, nil
+}
@@ -0,0 +1,198 @@
+// Package audit keeps a bounded history of the silence actions taken for
+// every node, for postmortems asking whether a node was silenced at a time
+package audit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Action is what happened to a silence of a node
+type Action string
+
+const (
+	// ActionCreated is a silence created for the node
+	ActionCreated Action = "created"
+	// ActionReused is an existing silence taken over for the node
+	ActionReused Action = "reused"
+	// ActionExtended is a silence whose end was moved
+	ActionExtended Action = "extended"
+	// ActionDeleted is a silence expired because the node is done
+	ActionDeleted Action = "deleted"
+	// ActionFailed is a silence operation which failed after all retries
+	ActionFailed Action = "failed"
+
+	// publishInterval is how often changed entries are written to the ConfigMap
+	publishInterval = 30 * time.Second
+)
+
+// Entry is a silence action taken for a node
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Node      string    `json:"node"`
+	Action    Action    `json:"action"`
+	SilenceID string    `json:"silenceId,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	// Matchers are the matchers of a created silence, in the notation of the
+	// Alertmanager UI
+	Matchers []string `json:"matchers,omitempty"`
+	// Until is when a created or extended silence ends
+	Until *time.Time `json:"until,omitempty"`
+	// Message is the error of a failed operation, or a note on the action
+	Message string `json:"message,omitempty"`
+}
+
+// Log keeps the last entries of every node for the retention period, and
+// optionally publishes them to a ConfigMap to survive restarts
+type Log struct {
+	perNode   int
+	retention time.Duration
+	configMap *configMapStore
+
+	mu      sync.Mutex
+	entries map[string][]Entry
+	dirty   bool
+}
+
+// NewLog creates a log keeping up to perNode entries of every node, none
+// older than retention
+func NewLog(perNode int, retention time.Duration) *Log {
+	return &Log{
+		perNode:   perNode,
+		retention: retention,
+		entries:   make(map[string][]Entry),
+	}
+}
+
+// Record adds an entry, stamped with the current time unless it has one. It's
+// a no-op on a nil log
+func (l *Log) Record(entry Entry) {
+	if l == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.add(entry)
+	l.dirty = true
+}
+
+// add appends entry to the entries of its node, dropping the oldest beyond
+// perNode. The lock must be held
+func (l *Log) add(entry Entry) {
+	entries := append(l.entries[entry.Node], entry)
+	if len(entries) > l.perNode {
+		entries = append([]Entry(nil), entries[len(entries)-l.perNode:]...)
+	}
+	l.entries[entry.Node] = entries
+}
+
+// Entries returns the entries of all nodes which aren't older than the
+// retention period, oldest first. A nil log has none
+func (l *Log) Entries() []Entry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(time.Now())
+
+	var all []Entry
+	for _, entries := range l.entries {
+		all = append(all, entries...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	return all
+}
+
+// expire drops the entries older than the retention period, the lock must be held
+func (l *Log) expire(now time.Time) {
+	cutoff := now.Add(-l.retention)
+	for node, entries := range l.entries {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.Time.After(cutoff) {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) != len(entries) {
+			l.dirty = true
+		}
+		if len(kept) == 0 {
+			delete(l.entries, node)
+		} else {
+			l.entries[node] = kept
+		}
+	}
+}
+
+// Start loads the entries published before a restart and publishes changes
+// until ctx is cancelled, if a ConfigMap is set
+func (l *Log) Start(ctx context.Context) {
+	if l.configMap == nil {
+		return
+	}
+	l.load(ctx)
+	go func() {
+		ticker := time.NewTicker(publishInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.publish(ctx)
+			}
+		}
+	}()
+}
+
+// load restores the entries from the ConfigMap, before the ones recorded since
+func (l *Log) load(ctx context.Context) {
+	loaded, err := l.configMap.load(ctx)
+	if err != nil {
+		klog.Warningf("Failed to load the silence history from %s: %v", l.configMap.name(), err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recorded := l.entries
+	l.entries = make(map[string][]Entry)
+	for _, entry := range loaded {
+		l.add(entry)
+	}
+	for _, entries := range recorded {
+		for _, entry := range entries {
+			l.add(entry)
+		}
+	}
+}
+
+// publish writes the entries to the ConfigMap if they changed since
+func (l *Log) publish(ctx context.Context) {
+	l.mu.Lock()
+	l.expire(time.Now())
+	if !l.dirty {
+		l.mu.Unlock()
+		return
+	}
+	l.dirty = false
+	l.mu.Unlock()
+
+	if err := l.configMap.save(ctx, l.Entries()); err != nil {
+		klog.Errorf("Failed to publish the silence history to %s: %v", l.configMap.name(), err)
+		// Retried on the next tick
+		l.mu.Lock()
+		l.dirty = true
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// ConfigMapKey holds the entries in the ConfigMap as a JSON list
+const ConfigMapKey = "silences.json"
+
+// configMapStore keeps the entries in a ConfigMap
+type configMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	configMap string
+}
+
+// SetConfigMap publishes the entries to the ConfigMap namespace/name and
+// restores them from it on Start. It must be called before Start
+func (l *Log) SetConfigMap(client kubernetes.Interface, namespace, name string) {
+	l.configMap = &configMapStore{client: client, namespace: namespace, configMap: name}
+}
+
+func (s *configMapStore) name() string {
+	return "configmap " + s.namespace + "/" + s.configMap
+}
+
+func (s *configMapStore) load(ctx context.Context) ([]Entry, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.configMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configmap %s/%s: %w", s.namespace, s.configMap, err)
+	}
+
+	raw, ok := cm.Data[ConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+	var entries []Entry
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return nil, fmt.Errorf("invalid silence history in configmap %s/%s: %w", s.namespace, s.configMap, err)
+	}
+	return entries, nil
+}
+
+func (s *configMapStore) save(ctx context.Context, entries []Entry) error {
+	raw, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal silence history: %w", err)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.configMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.configMap,
+					Namespace: s.namespace,
+				},
+				Data: map[string]string{ConfigMapKey: string(raw)},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[ConfigMapKey] = string(raw)
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,46 @@
+// Package authz decides whether annotations which change what the helper
+// silences may be honored. Nodes and DaemonSets can be annotated by anyone
+// allowed to edit them, e.g. namespace admins for DaemonSets, which must not
+// be enough to suppress alerts cluster-wide
+package authz
+
+import (
+	"fmt"
+
+	"rollout-helper/internal/metrics"
+)
+
+// Object identifies the annotated object
+type Object struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (o Object) String() string {
+	if o.Namespace == "" {
+		return fmt.Sprintf("%s %s", o.Kind, o.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", o.Kind, o.Namespace, o.Name)
+}
+
+// Authorizer verifies who set an annotation
+type Authorizer interface {
+	// Name identifies the authorizer in logs
+	Name() string
+	// Authorize returns an error if the annotation key of the object must be ignored
+	Authorize(object Object, annotations map[string]string, key string) error
+}
+
+// Check authorizes an annotation with authorizer, every annotation is
+// honored if it's nil. Rejected annotations are counted
+func Check(authorizer Authorizer, object Object, annotations map[string]string, key string) error {
+	if authorizer == nil {
+		return nil
+	}
+	if err := authorizer.Authorize(object, annotations, key); err != nil {
+		metrics.AnnotationsRejected.WithLabelValues(key).Inc()
+		return fmt.Errorf("%s annotation of %s rejected by %s: %w", key, object, authorizer.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package authz
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SignatureSuffix is appended to an annotation key for the key of its signature
+const SignatureSuffix = ".signature"
+
+// Signed honors annotations signed with the key of a group. The signature
+// annotation holds "<group>:<HMAC-SHA256>" of the object and the annotation,
+// so it can't be copied to another object or value
+type Signed struct {
+	// keys maps groups to their keys, a group may have several during rotation
+	keys map[string][][]byte
+	// groups are the groups whose signatures are honored, all if empty
+	groups map[string]bool
+}
+
+// LoadKeys reads signing keys from a file with one "<group> <key>" per line,
+// empty lines and lines starting with # are skipped
+func LoadKeys(path string) (map[string][][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keys file: %w", err)
+	}
+	defer file.Close()
+
+	keys := make(map[string][][]byte)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<group> <key>\"", line)
+		}
+		keys[fields[0]] = append(keys[fields[0]], []byte(fields[1]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("keys file has no keys")
+	}
+	return keys, nil
+}
+
+// NewSigned honors annotations signed by one of groups, or by any group with
+// a key if groups is empty
+func NewSigned(keys map[string][][]byte, groups []string) (*Signed, error) {
+	allowed := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		if _, ok := keys[group]; !ok {
+			return nil, fmt.Errorf("group %s has no key", group)
+		}
+		allowed[group] = true
+	}
+	return &Signed{keys: keys, groups: allowed}, nil
+}
+
+func (s *Signed) Name() string {
+	return "signature"
+}
+
+func (s *Signed) Authorize(object Object, annotations map[string]string, key string) error {
+	signature, ok := annotations[key+SignatureSuffix]
+	if !ok {
+		return fmt.Errorf("%s%s annotation is missing", key, SignatureSuffix)
+	}
+	group, sum, ok := strings.Cut(signature, ":")
+	if !ok {
+		return errors.New("signature isn't of the form <group>:<signature>")
+	}
+	if len(s.groups) > 0 && !s.groups[group] {
+		return fmt.Errorf("group %s may not set it", group)
+	}
+	mac, err := hex.DecodeString(sum)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	for _, groupKey := range s.keys[group] {
+		if hmac.Equal(mac, sign(groupKey, object, key, annotations[key])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature doesn't match a key of group %s", group)
+}
+
+// Sign returns the value of the signature annotation of an annotation
+func Sign(group string, groupKey []byte, object Object, key, value string) string {
+	return group + ":" + hex.EncodeToString(sign(groupKey, object, key, value))
+}
+
+func sign(groupKey []byte, object Object, key, value string) []byte {
+	mac := hmac.New(sha256.New, groupKey)
+	fmt.Fprintf(mac, "%s/%s/%s\n%s=%s", object.Kind, object.Namespace, object.Name, key, value)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,109 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	awsEndpoint = "http://169.254.169.254"
+	// awsTimeFormat is the format of the scheduled event times, e.g. "21 Jan 2019 09:00:43 GMT"
+	awsTimeFormat = "2 Jan 2006 15:04:05 GMT"
+)
+
+// AWS reads scheduled events of EC2 instances with IMDSv2
+type AWS struct {
+	client   *http.Client
+	endpoint string
+}
+
+// awsEvent is a scheduled event as returned by IMDS
+type awsEvent struct {
+	Code        string `json:"Code"`
+	Description string `json:"Description"`
+	State       string `json:"State"`
+	NotBefore   string `json:"NotBefore"`
+	NotAfter    string `json:"NotAfter"`
+}
+
+func (p *AWS) Name() string {
+	return "aws"
+}
+
+func (p *AWS) Scheduled(ctx context.Context) (*Maintenance, error) {
+	token, err := p.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.endpoint+"/latest/meta-data/events/maintenance/scheduled", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	body, err := fetch(p.client, req)
+	if err != nil || body == nil {
+		return nil, err
+	}
+
+	var events []awsEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("invalid scheduled events: %w", err)
+	}
+	var maintenances []Maintenance
+	for _, event := range events {
+		// Completed and canceled events stay listed for a while
+		if event.State != "" && event.State != "active" {
+			continue
+		}
+		start, err := time.Parse(awsTimeFormat, event.NotBefore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NotBefore of event %s: %w", event.Code, err)
+		}
+		maintenance := Maintenance{Start: start, Description: event.Code}
+		if end, err := time.Parse(awsTimeFormat, event.NotAfter); err == nil {
+			maintenance.End = end
+		}
+		maintenances = append(maintenances, maintenance)
+	}
+	return earliest(maintenances), nil
+}
+
+// token requests an IMDSv2 session token
+func (p *AWS) token(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", p.endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	body, err := fetch(p.client, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get IMDS token: %w", err)
+	}
+	return string(body), nil
+}
+
+// fetch sends a metadata request and returns the body, nil if it's not found
+func fetch(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,87 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const azureEndpoint = "http://169.254.169.254"
+
+// Azure reads the Scheduled Events of virtual machines
+type Azure struct {
+	client   *http.Client
+	endpoint string
+}
+
+// azureEvents is the Scheduled Events document
+type azureEvents struct {
+	Events []struct {
+		EventType         string   `json:"EventType"`
+		EventStatus       string   `json:"EventStatus"`
+		Resources         []string `json:"Resources"`
+		NotBefore         string   `json:"NotBefore"`
+		DurationInSeconds int      `json:"DurationInSeconds"`
+	} `json:"Events"`
+}
+
+func (p *Azure) Name() string {
+	return "azure"
+}
+
+func (p *Azure) Scheduled(ctx context.Context) (*Maintenance, error) {
+	name, err := p.get(ctx, "/metadata/instance/compute/name?api-version=2021-02-01&format=text")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the VM name: %w", err)
+	}
+	body, err := p.get(ctx, "/metadata/scheduledevents?api-version=2020-07-01")
+	if err != nil || body == nil {
+		return nil, err
+	}
+
+	var document azureEvents
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("invalid scheduled events: %w", err)
+	}
+	var maintenances []Maintenance
+	for _, event := range document.Events {
+		// Events of a scale set list every affected VM
+		if !contains(event.Resources, strings.TrimSpace(string(name))) {
+			continue
+		}
+		// Started events have no NotBefore anymore
+		start := time.Now()
+		if event.NotBefore != "" {
+			if start, err = time.Parse(time.RFC1123, event.NotBefore); err != nil {
+				return nil, fmt.Errorf("invalid NotBefore of event %s: %w", event.EventType, err)
+			}
+		}
+		maintenance := Maintenance{Start: start, Description: event.EventType}
+		if event.DurationInSeconds > 0 {
+			maintenance.End = start.Add(time.Duration(event.DurationInSeconds) * time.Second)
+		}
+		maintenances = append(maintenances, maintenance)
+	}
+	return earliest(maintenances), nil
+}
+
+func (p *Azure) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.endpoint+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+	return fetch(p.client, req)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Package cloud detects planned host maintenance announced by the instance
+// metadata service of cloud providers. It runs on the node itself, the
+// maintenance is published in node annotations the watcher picks up
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaintenanceAnnotation holds the start of the next planned maintenance of the node's host, in RFC 3339
+	MaintenanceAnnotation = "rollout-helper.snappcloud.io/cloud-maintenance"
+	// MaintenanceEndAnnotation holds the end of the maintenance if the provider announces it
+	MaintenanceEndAnnotation = "rollout-helper.snappcloud.io/cloud-maintenance-end"
+	// MaintenanceDescriptionAnnotation describes the maintenance, e.g. the provider's event type
+	MaintenanceDescriptionAnnotation = "rollout-helper.snappcloud.io/cloud-maintenance-description"
+)
+
+// metadataTimeout bounds a single request to the metadata service
+const metadataTimeout = 5 * time.Second
+
+// Maintenance is a planned maintenance of the host of an instance
+type Maintenance struct {
+	Start time.Time
+	// End is zero if the provider doesn't announce it
+	End         time.Time
+	Description string
+}
+
+// Provider reads the planned maintenance of the instance it runs on
+type Provider interface {
+	// Name identifies the provider in flags and logs
+	Name() string
+	// Scheduled returns the earliest planned maintenance, nil if there's none
+	Scheduled(ctx context.Context) (*Maintenance, error)
+}
+
+// providers creates the supported providers by name
+var providers = map[string]func(client *http.Client) Provider{
+	"aws":   func(client *http.Client) Provider { return &AWS{client: client, endpoint: awsEndpoint} },
+	"gcp":   func(client *http.Client) Provider { return &GCP{client: client, endpoint: gcpEndpoint} },
+	"azure": func(client *http.Client) Provider { return &Azure{client: client, endpoint: azureEndpoint} },
+}
+
+// ProviderNames returns the names of the supported providers, sorted
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider creates the provider with the given name
+func NewProvider(name string) (Provider, error) {
+	newProvider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q, expected one of %s", name, strings.Join(ProviderNames(), ", "))
+	}
+	return newProvider(&http.Client{Timeout: metadataTimeout}), nil
+}
+
+// earliest returns the maintenance starting first, nil if there's none
+func earliest(maintenances []Maintenance) *Maintenance {
+	var first *Maintenance
+	for i := range maintenances {
+		if first == nil || maintenances[i].Start.Before(first.Start) {
+			first = &maintenances[i]
+		}
+	}
+	return first
+}
+
+// Annotations returns the node annotations publishing a maintenance, nil
+// values remove them
+func Annotations(maintenance *Maintenance) map[string]interface{} {
+	annotations := map[string]interface{}{
+		MaintenanceAnnotation:            nil,
+		MaintenanceEndAnnotation:         nil,
+		MaintenanceDescriptionAnnotation: nil,
+	}
+	if maintenance == nil {
+		return annotations
+	}
+	annotations[MaintenanceAnnotation] = maintenance.Start.UTC().Format(time.RFC3339)
+	if !maintenance.End.IsZero() {
+		annotations[MaintenanceEndAnnotation] = maintenance.End.UTC().Format(time.RFC3339)
+	}
+	if maintenance.Description != "" {
+		annotations[MaintenanceDescriptionAnnotation] = maintenance.Description
+	}
+	return annotations
+}
@@ -0,0 +1,68 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const gcpEndpoint = "http://metadata.google.internal"
+
+// GCP reads the upcoming maintenance of Compute Engine instances
+type GCP struct {
+	client   *http.Client
+	endpoint string
+}
+
+// gcpMaintenance is the upcoming maintenance as returned by the metadata server
+type gcpMaintenance struct {
+	Type            string `json:"type"`
+	Status          string `json:"maintenance_status"`
+	WindowStartTime string `json:"window_start_time"`
+	WindowEndTime   string `json:"window_end_time"`
+}
+
+func (p *GCP) Name() string {
+	return "gcp"
+}
+
+func (p *GCP) Scheduled(ctx context.Context) (*Maintenance, error) {
+	// A maintenance about to start is only announced here, about a minute ahead
+	event, err := p.get(ctx, "/computeMetadata/v1/instance/maintenance-event")
+	if err != nil {
+		return nil, err
+	}
+	if event := strings.TrimSpace(string(event)); event != "" && event != "NONE" {
+		return &Maintenance{Start: time.Now(), Description: event}, nil
+	}
+
+	body, err := p.get(ctx, "/computeMetadata/v1/instance/upcoming-maintenance")
+	if err != nil || body == nil {
+		return nil, err
+	}
+	var upcoming gcpMaintenance
+	if err := json.Unmarshal(body, &upcoming); err != nil {
+		return nil, fmt.Errorf("invalid upcoming maintenance: %w", err)
+	}
+	start, err := time.Parse(time.RFC3339, upcoming.WindowStartTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window_start_time: %w", err)
+	}
+	maintenance := &Maintenance{Start: start, Description: upcoming.Type}
+	if end, err := time.Parse(time.RFC3339, upcoming.WindowEndTime); err == nil {
+		maintenance.End = end
+	}
+	return maintenance, nil
+}
+
+func (p *GCP) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.endpoint+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return fetch(p.client, req)
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Names of the built-in silence templates
+const (
+	TemplateNode     = "node"
+	TemplateInstance = "instance"
+	TemplatePod      = "pod"
+	TemplateLogs     = "logs"
+	TemplateInfra    = "infra"
+	TemplateWorkload = "workload"
+)
+
+// MinSilenceDuration is the shortest silence duration accepted
+const MinSilenceDuration = 5 * time.Minute
+
+// Config is the optional configuration file of the rollout helper
+type Config struct {
+	// Templates overrides settings of the built-in silence templates
+	Templates map[string]TemplateOverride `json:"templates,omitempty"`
+	// Policies are additional silences created for every rolling node
+	Policies []Policy `json:"policies,omitempty"`
+	// Pools overrides policies for the nodes of a MachineConfigPool
+	Pools map[string]PoolConfig `json:"pools,omitempty"`
+	// RollingTaints are the node taints indicating a rollout, in addition to the MCO state
+	RollingTaints []Taint `json:"rollingTaints,omitempty"`
+	// LogAlerts enables the silence of alerts evaluated by the Loki ruler
+	LogAlerts *LogAlerts `json:"logAlerts,omitempty"`
+	// ExtraMatchers are added to every silence, e.g. severity!=critical so
+	// critical alerts are never silenced
+	ExtraMatchers []StaticMatcher `json:"extraMatchers,omitempty"`
+	// ProtectedAlerts are the names of alerts no silence may cover, e.g. KubeAPIDown
+	ProtectedAlerts []string `json:"protectedAlerts,omitempty"`
+
+	hash uint64
+}
+
+// TemplateOverride changes settings of a built-in silence template
+type TemplateOverride struct {
+	// Duration of the silences created from the template
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// Policy describes one extra silence created while a node is rolling
+type Policy struct {
+	Name     string    `json:"name"`
+	Matchers []Matcher `json:"matchers"`
+	// Duration of the policy's silences, defaults to the global silence duration
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Comment is a Go template like the matcher values, appended to the silence comment
+	Comment string `json:"comment,omitempty"`
+	// Disabled drops a policy inherited from a lower layer
+	Disabled bool `json:"disabled,omitempty"`
+	// Tenant is the Alertmanager tenant the policy's silences are created in,
+	// the default tenant if empty
+	Tenant string `json:"tenant,omitempty"`
+
+	commentTmpl *template.Template
+}
+
+// Matcher is a single silence matcher. Value is a Go template rendered
+// against the rolling node, e.g. {{ .NodeIP }}:9100 or
+// {{ index .Node.Labels "topology.kubernetes.io/zone" }}
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex,omitempty"`
+
+	tmpl *template.Template
+}
+
+// StaticMatcher is a matcher added to silences as is, without templates
+type StaticMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex,omitempty"`
+	// IsEqual false negates the matcher, e.g. severity!=critical. Defaults to true
+	IsEqual *bool `json:"isEqual,omitempty"`
+}
+
+// Equal reports whether the matcher selects matching values rather than the others
+func (m StaticMatcher) Equal() bool {
+	return m.IsEqual == nil || *m.IsEqual
+}
+
+// validateStaticMatchers rejects matchers without a name and invalid regexes
+func validateStaticMatchers(matchers []StaticMatcher) error {
+	for i, matcher := range matchers {
+		if matcher.Name == "" {
+			return fmt.Errorf("matcher #%d has no name", i)
+		}
+		if matcher.IsRegex {
+			if _, err := regexp.Compile(matcher.Value); err != nil {
+				return fmt.Errorf("matcher %s: %w", matcher.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Template returns the parsed value template of the matcher
+func (m *Matcher) Template() *template.Template {
+	return m.tmpl
+}
+
+// Prepare validates a configuration decoded from the file contents in data,
+// parses its templates and records the hash of data. Files are decoded and
+// converted by the scheme package
+func Prepare(cfg *Config, data []byte) (*Config, error) {
+	if err := cfg.compile(); err != nil {
+		return nil, err
+	}
+
+	// 48 bits of the digest fit into a float64 metric without loss
+	sum := sha256.Sum256(data)
+	cfg.hash = binary.BigEndian.Uint64(sum[:8]) >> 16
+	return cfg, nil
+}
+
+// Hash identifies the contents of the loaded file, 0 if none was loaded
+func (c *Config) Hash() uint64 {
+	return c.hash
+}
+
+// WithPolicies returns a copy of the configuration with additional cluster-wide policies
+func (c *Config) WithPolicies(policies []Policy) *Config {
+	merged := *c
+	merged.Policies = append(append([]Policy(nil), c.Policies...), policies...)
+	return &merged
+}
+
+// Tenants returns the Alertmanager tenants of the policies besides the default one
+func (c *Config) Tenants() []string {
+	var tenants []string
+	add := func(policies []Policy) {
+		for _, policy := range policies {
+			if policy.Tenant != "" {
+				tenants = append(tenants, policy.Tenant)
+			}
+		}
+	}
+	add(c.Policies)
+	for _, pool := range c.Pools {
+		add(pool.Policies)
+	}
+	return tenants
+}
+
+// SilenceDuration returns the duration configured for a built-in template,
+// or fallback if it isn't overridden
+func (c *Config) SilenceDuration(template string, fallback time.Duration) time.Duration {
+	if override, ok := c.Templates[template]; ok && override.Duration != nil {
+		return override.Duration.Duration
+	}
+	return fallback
+}
+
+// ValidateDuration rejects silence durations which are too short to cover a rollout step
+func ValidateDuration(d time.Duration) error {
+	if d < MinSilenceDuration {
+		return fmt.Errorf("silence duration %s is shorter than %s", d, MinSilenceDuration)
+	}
+	return nil
+}
+
+// compile validates the templates and policies and parses all matcher templates
+func (c *Config) compile() error {
+	for name, override := range c.Templates {
+		if name != TemplateNode && name != TemplateInstance && name != TemplatePod && name != TemplateLogs && name != TemplateInfra && name != TemplateWorkload {
+			return fmt.Errorf("unknown template %s, expected one of %s, %s, %s, %s, %s, %s", name, TemplateNode, TemplateInstance, TemplatePod, TemplateLogs, TemplateInfra, TemplateWorkload)
+		}
+		if override.Duration != nil {
+			if err := ValidateDuration(override.Duration.Duration); err != nil {
+				return fmt.Errorf("template %s: %w", name, err)
+			}
+		}
+	}
+
+	if err := validateTaints(c.RollingTaints); err != nil {
+		return fmt.Errorf("rollingTaints: %w", err)
+	}
+	if c.LogAlerts != nil {
+		if err := c.LogAlerts.validate(); err != nil {
+			return fmt.Errorf("logAlerts: %w", err)
+		}
+	}
+
+	if err := validateStaticMatchers(c.ExtraMatchers); err != nil {
+		return fmt.Errorf("extraMatchers: %w", err)
+	}
+
+	for _, alert := range c.ProtectedAlerts {
+		if alert == "" {
+			return fmt.Errorf("protectedAlerts: empty alert name")
+		}
+	}
+
+	if err := compilePolicies(c.Policies, true); err != nil {
+		return err
+	}
+	if err := c.validateProtected(c.Policies); err != nil {
+		return err
+	}
+	for pool, poolConfig := range c.Pools {
+		if err := compilePolicies(poolConfig.Policies, false); err != nil {
+			return fmt.Errorf("pool %s: %w", pool, err)
+		}
+		if err := c.validateProtected(poolConfig.Policies); err != nil {
+			return fmt.Errorf("pool %s: %w", pool, err)
+		}
+	}
+	return nil
+}
+
+// CompilePolicies validates cluster-wide policies declared outside the
+// configuration file and parses their matcher templates
+func CompilePolicies(policies []Policy) error {
+	return compilePolicies(policies, true)
+}
+
+// compilePolicies validates policies and parses their matcher templates.
+// Overrides of inherited policies may omit the matchers
+func compilePolicies(policies []Policy, requireMatchers bool) error {
+	for i := range policies {
+		policy := &policies[i]
+		if policy.Name == "" {
+			return fmt.Errorf("policy #%d has no name", i)
+		}
+		if requireMatchers && len(policy.Matchers) == 0 {
+			return fmt.Errorf("policy %s has no matchers", policy.Name)
+		}
+		if policy.Duration != nil {
+			if err := ValidateDuration(policy.Duration.Duration); err != nil {
+				return fmt.Errorf("policy %s: %w", policy.Name, err)
+			}
+		}
+		if strings.Contains(policy.Tenant, "/") {
+			return fmt.Errorf("policy %s: tenant %q contains a slash", policy.Name, policy.Tenant)
+		}
+
+		for j := range policy.Matchers {
+			matcher := &policy.Matchers[j]
+			if matcher.Name == "" {
+				return fmt.Errorf("policy %s: matcher #%d has no name", policy.Name, j)
+			}
+
+			tmpl, err := parseTemplate(matcher.Name, matcher.Value)
+			if err != nil {
+				return fmt.Errorf("policy %s: invalid template for matcher %s: %w", policy.Name, matcher.Name, err)
+			}
+			matcher.tmpl = tmpl
+		}
+
+		if policy.Comment != "" {
+			tmpl, err := parseTemplate("comment", policy.Comment)
+			if err != nil {
+				return fmt.Errorf("policy %s: invalid comment template: %w", policy.Name, err)
+			}
+			policy.commentTmpl = tmpl
+		}
+	}
+	return nil
+}
+
+// templateFuncs are available in matcher value and comment templates, in
+// addition to the built-in functions
+var templateFuncs = template.FuncMap{
+	"join":       strings.Join,
+	"regexQuote": regexp.QuoteMeta,
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"text/template"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Layer is the level of the configuration a policy setting was defined at
+type Layer string
+
+// Policy layers, in the order they are applied. Later layers override earlier ones
+const (
+	LayerCluster Layer = "cluster"
+	LayerPool    Layer = "pool"
+	LayerNode    Layer = "node"
+)
+
+// NodePoliciesAnnotation holds node level policy overrides as a YAML or JSON list
+const NodePoliciesAnnotation = "rollout-helper.snappcloud.io/policies"
+
+// PoolConfig holds the settings of a single MachineConfigPool
+type PoolConfig struct {
+	// Policies override cluster-wide policies with the same name or add new ones
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+// ResolvedMatcher is an effective matcher together with the layer it came from
+type ResolvedMatcher struct {
+	Matcher
+	Source Layer
+}
+
+// ResolvedPolicy is a policy after all layers were applied for a node
+type ResolvedPolicy struct {
+	Name     string
+	Source   Layer
+	Matchers []ResolvedMatcher
+	// Duration of the policy's silences, nil uses the global silence duration
+	Duration       *metav1.Duration
+	DurationSource Layer
+	// Tenant of the policy's silences, empty for the default tenant
+	Tenant string
+
+	comment *template.Template
+}
+
+// CommentTemplate returns the parsed comment template of the policy, nil without a comment
+func (p *ResolvedPolicy) CommentTemplate() *template.Template {
+	return p.comment
+}
+
+// ParsePolicies parses and validates node level policies, e.g. from a node annotation
+func ParsePolicies(data string) ([]Policy, error) {
+	var policies []Policy
+	if err := yaml.UnmarshalStrict([]byte(data), &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse policies: %w", err)
+	}
+	if err := compilePolicies(policies, false); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// ResolvePolicies merges the cluster-wide policies with the overrides of the
+// node's pool and the node itself. Policies are merged by name: matchers
+// replace matchers with the same name, a duration replaces the inherited one
+// and a disabled policy is dropped
+func (c *Config) ResolvePolicies(pool string, nodePolicies []Policy) []ResolvedPolicy {
+	var resolved []*ResolvedPolicy
+	apply := func(policies []Policy, layer Layer) {
+		for _, policy := range policies {
+			index := -1
+			for i, existing := range resolved {
+				if existing.Name == policy.Name {
+					index = i
+					break
+				}
+			}
+
+			if policy.Disabled {
+				if index >= 0 {
+					resolved = append(resolved[:index], resolved[index+1:]...)
+				}
+				continue
+			}
+			if index < 0 {
+				resolved = append(resolved, &ResolvedPolicy{Name: policy.Name, Source: layer})
+				index = len(resolved) - 1
+			}
+
+			target := resolved[index]
+			if policy.Duration != nil {
+				target.Duration = policy.Duration
+				target.DurationSource = layer
+			}
+			if policy.Tenant != "" {
+				target.Tenant = policy.Tenant
+			}
+			if policy.commentTmpl != nil {
+				target.comment = policy.commentTmpl
+			}
+			for _, matcher := range policy.Matchers {
+				target.setMatcher(ResolvedMatcher{Matcher: matcher, Source: layer})
+			}
+		}
+	}
+
+	apply(c.Policies, LayerCluster)
+	if poolConfig, ok := c.Pools[pool]; ok && pool != "" {
+		apply(poolConfig.Policies, LayerPool)
+	}
+	apply(nodePolicies, LayerNode)
+
+	policies := make([]ResolvedPolicy, 0, len(resolved))
+	for _, policy := range resolved {
+		// Overrides may name policies which aren't defined on any other layer
+		if len(policy.Matchers) > 0 {
+			policies = append(policies, *policy)
+		}
+	}
+	return policies
+}
+
+// setMatcher replaces the matcher with the same name or adds it
+func (p *ResolvedPolicy) setMatcher(matcher ResolvedMatcher) {
+	for i := range p.Matchers {
+		if p.Matchers[i].Name == matcher.Name {
+			p.Matchers[i] = matcher
+			return
+		}
+	}
+	p.Matchers = append(p.Matchers, matcher)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// DefaultLogNodeLabel is the label Loki ruler alerts carry the node's hostname in
+const DefaultLogNodeLabel = "hostname"
+
+// LogAlerts describes the labels of alerts evaluated by the Loki ruler. They
+// reach the same Alertmanager as the Prometheus alerts, but are labeled after
+// the log streams they were computed from instead of the scrape targets
+type LogAlerts struct {
+	// NodeLabel is the label holding the node name, defaults to DefaultLogNodeLabel
+	NodeLabel string `json:"nodeLabel,omitempty"`
+	// Filenames restricts the silence to alerts about matching log files, a regex on the filename label
+	Filenames string `json:"filenames,omitempty"`
+	// Alertnames restricts the silence to matching alerts, a regex
+	Alertnames string `json:"alertnames,omitempty"`
+	// Ruler is the base URL of the Loki ruler used to verify that alert rules
+	// carry the labels above, optional
+	Ruler string `json:"ruler,omitempty"`
+	// Tenant is sent as X-Scope-OrgID to a multi-tenant Loki ruler
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Label returns the label holding the node name
+func (l *LogAlerts) Label() string {
+	if l.NodeLabel == "" {
+		return DefaultLogNodeLabel
+	}
+	return l.NodeLabel
+}
+
+// validate rejects invalid regexes and ruler URLs
+func (l *LogAlerts) validate() error {
+	for field, value := range map[string]string{"filenames": l.Filenames, "alertnames": l.Alertnames} {
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	if l.Ruler != "" {
+		if _, err := url.ParseRequestURI(l.Ruler); err != nil {
+			return fmt.Errorf("ruler: %w", err)
+		}
+	}
+	return nil
+}
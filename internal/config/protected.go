@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AlertNameLabel is the label holding the name of an alert
+const AlertNameLabel = "alertname"
+
+// Protected returns the first of the protected alerts a matcher on the
+// alertname label covers, empty if none. Regular expressions are anchored
+// like in Alertmanager, an invalid one covers nothing
+func (c *Config) Protected(name, value string, isRegex bool) string {
+	if name != AlertNameLabel {
+		return ""
+	}
+	var pattern *regexp.Regexp
+	if isRegex {
+		var err error
+		if pattern, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return ""
+		}
+	}
+	for _, alert := range c.ProtectedAlerts {
+		if (pattern == nil && value == alert) || (pattern != nil && pattern.MatchString(alert)) {
+			return alert
+		}
+	}
+	return ""
+}
+
+// validateProtected rejects policies whose alertname matchers cover a
+// protected alert. Templated values are checked when they're rendered
+func (c *Config) validateProtected(policies []Policy) error {
+	for _, policy := range policies {
+		for _, matcher := range policy.Matchers {
+			if strings.Contains(matcher.Value, "{{") {
+				continue
+			}
+			if alert := c.Protected(matcher.Name, matcher.Value, matcher.IsRegex); alert != "" {
+				return fmt.Errorf("policy %s: matcher %s covers the protected alert %s", policy.Name, matcher.Name, alert)
+			}
+		}
+	}
+	return nil
+}
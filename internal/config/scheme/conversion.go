@@ -0,0 +1,118 @@
+package scheme
+
+import (
+	"rollout-helper/internal/config"
+	v1 "rollout-helper/internal/config/scheme/v1"
+	"rollout-helper/internal/config/scheme/v1alpha1"
+)
+
+// convertV1Alpha1 upgrades a v1alpha1 file to v1, the hub every version is
+// converted to before it's converted to the internal configuration
+func convertV1Alpha1(in *v1alpha1.Config) *v1.Config {
+	out := &v1.Config{
+		APIVersion: APIVersion(v1.Version),
+		Kind:       Kind,
+	}
+	if in.Templates != nil {
+		out.BuiltinSilences = make(map[string]v1.SilenceOverride, len(in.Templates))
+		for name, override := range in.Templates {
+			out.BuiltinSilences[name] = v1.SilenceOverride{Duration: override.Duration}
+		}
+	}
+	out.Policies = convertV1Alpha1Policies(in.Policies)
+	if in.Pools != nil {
+		out.Pools = make(map[string]v1.PoolConfig, len(in.Pools))
+		for name, pool := range in.Pools {
+			out.Pools[name] = v1.PoolConfig{Policies: convertV1Alpha1Policies(pool.Policies)}
+		}
+	}
+	for _, taint := range in.RollingTaints {
+		out.RollingTaints = append(out.RollingTaints, v1.Taint{Key: taint.Key, Effect: taint.Effect})
+	}
+	if in.LogAlerts != nil {
+		out.LogAlerts = &v1.LogAlerts{
+			NodeLabel:  in.LogAlerts.NodeLabel,
+			Filenames:  in.LogAlerts.Filenames,
+			Alertnames: in.LogAlerts.Alertnames,
+			Ruler:      in.LogAlerts.Ruler,
+			Tenant:     in.LogAlerts.Tenant,
+		}
+	}
+	return out
+}
+
+func convertV1Alpha1Policies(in []v1alpha1.Policy) []v1.Policy {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1.Policy, 0, len(in))
+	for _, policy := range in {
+		converted := v1.Policy{
+			Name:     policy.Name,
+			Duration: policy.Duration,
+			Comment:  policy.Comment,
+			Disabled: policy.Disabled,
+		}
+		for _, matcher := range policy.Matchers {
+			converted.Matchers = append(converted.Matchers, v1.Matcher{Name: matcher.Name, Value: matcher.Value, IsRegex: matcher.IsRegex})
+		}
+		out = append(out, converted)
+	}
+	return out
+}
+
+// convertV1 converts a defaulted v1 file to the internal configuration
+func convertV1(in *v1.Config) *config.Config {
+	out := &config.Config{}
+	if in.BuiltinSilences != nil {
+		out.Templates = make(map[string]config.TemplateOverride, len(in.BuiltinSilences))
+		for name, override := range in.BuiltinSilences {
+			out.Templates[name] = config.TemplateOverride{Duration: override.Duration}
+		}
+	}
+	out.Policies = convertV1Policies(in.Policies)
+	if in.Pools != nil {
+		out.Pools = make(map[string]config.PoolConfig, len(in.Pools))
+		for name, pool := range in.Pools {
+			out.Pools[name] = config.PoolConfig{Policies: convertV1Policies(pool.Policies)}
+		}
+	}
+	for _, taint := range in.RollingTaints {
+		out.RollingTaints = append(out.RollingTaints, config.Taint{Key: taint.Key, Effect: taint.Effect})
+	}
+	if in.LogAlerts != nil {
+		out.LogAlerts = &config.LogAlerts{
+			NodeLabel:  in.LogAlerts.NodeLabel,
+			Filenames:  in.LogAlerts.Filenames,
+			Alertnames: in.LogAlerts.Alertnames,
+			Ruler:      in.LogAlerts.Ruler,
+			Tenant:     in.LogAlerts.Tenant,
+		}
+	}
+	out.ProtectedAlerts = in.ProtectedAlerts
+	for _, matcher := range in.ExtraMatchers {
+		out.ExtraMatchers = append(out.ExtraMatchers, config.StaticMatcher{Name: matcher.Name, Value: matcher.Value, IsRegex: matcher.IsRegex, IsEqual: matcher.IsEqual})
+	}
+	return out
+}
+
+func convertV1Policies(in []v1.Policy) []config.Policy {
+	if in == nil {
+		return nil
+	}
+	out := make([]config.Policy, 0, len(in))
+	for _, policy := range in {
+		converted := config.Policy{
+			Name:     policy.Name,
+			Duration: policy.Duration,
+			Comment:  policy.Comment,
+			Disabled: policy.Disabled,
+			Tenant:   policy.Tenant,
+		}
+		for _, matcher := range policy.Matchers {
+			converted.Matchers = append(converted.Matchers, config.Matcher{Name: matcher.Name, Value: matcher.Value, IsRegex: matcher.IsRegex})
+		}
+		out = append(out, converted)
+	}
+	return out
+}
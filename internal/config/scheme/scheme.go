@@ -0,0 +1,119 @@
+// Package scheme decodes the versioned configuration file into the internal
+// configuration. Every version is converted to v1 and defaulted, so the
+// internal types can change without breaking the files of existing clusters
+package scheme
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"rollout-helper/internal/config"
+	v1 "rollout-helper/internal/config/scheme/v1"
+	"rollout-helper/internal/config/scheme/v1alpha1"
+)
+
+const (
+	// Group is the API group of the configuration file
+	Group = "rollout-helper.snappcloud.io"
+	// Kind is the kind of the configuration file
+	Kind = "RolloutHelperConfig"
+)
+
+// LatestVersion is the version files are migrated to
+const LatestVersion = v1.Version
+
+// APIVersion returns the apiVersion of a version of the file
+func APIVersion(version string) string {
+	return Group + "/" + version
+}
+
+// typeMeta identifies the version of a file before it's decoded
+type typeMeta struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+}
+
+// Load reads, converts and validates the configuration file at path
+func Load(path string) (*config.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	versioned, version, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if version != LatestVersion {
+		klog.Warningf("Configuration file %s has version %s, upgrade it to %s with `rollout-helper config migrate --config %s`", path, version, LatestVersion, path)
+	}
+
+	v1.SetDefaults(versioned)
+	return config.Prepare(convertV1(versioned), data)
+}
+
+// Migrate converts a configuration file to the latest version. It returns
+// the version the file had, and the file unchanged if it's the latest.
+// Comments are lost and defaults aren't filled in
+func Migrate(data []byte) ([]byte, string, error) {
+	versioned, version, err := decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if version == LatestVersion {
+		return data, version, nil
+	}
+
+	migrated, err := yaml.Marshal(versioned)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	// Rejects files which convert but don't validate, before they're replaced
+	reloaded, _, err := decode(migrated)
+	if err != nil {
+		return nil, "", fmt.Errorf("migrated config doesn't decode: %w", err)
+	}
+	v1.SetDefaults(reloaded)
+	if _, err := config.Prepare(convertV1(reloaded), migrated); err != nil {
+		return nil, "", err
+	}
+	return migrated, version, nil
+}
+
+// decode parses a file of any version and converts it to v1, without defaults
+func decode(data []byte) (*v1.Config, string, error) {
+	var meta typeMeta
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil, "", fmt.Errorf("failed to parse config: %w", err)
+	}
+	if meta.Kind != "" && meta.Kind != Kind {
+		return nil, "", fmt.Errorf("unexpected kind %s, expected %s", meta.Kind, Kind)
+	}
+
+	switch meta.APIVersion {
+	case "", APIVersion(v1alpha1.Version):
+		// Files without an apiVersion predate the versioning
+		versioned := &v1alpha1.Config{}
+		if err := yaml.UnmarshalStrict(data, versioned); err != nil {
+			return nil, "", fmt.Errorf("failed to parse config: %w", err)
+		}
+		return convertV1Alpha1(versioned), v1alpha1.Version, nil
+	case APIVersion(v1.Version):
+		if meta.Kind == "" {
+			return nil, "", fmt.Errorf("kind is required, expected %s", Kind)
+		}
+		versioned := &v1.Config{}
+		if err := yaml.UnmarshalStrict(data, versioned); err != nil {
+			return nil, "", fmt.Errorf("failed to parse config: %w", err)
+		}
+		return versioned, v1.Version, nil
+	}
+
+	supported := []string{APIVersion(v1alpha1.Version), APIVersion(v1.Version)}
+	return nil, "", fmt.Errorf("unknown apiVersion %s, expected one of %s", meta.APIVersion, strings.Join(supported, ", "))
+}
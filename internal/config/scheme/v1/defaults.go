@@ -0,0 +1,11 @@
+package v1
+
+import "rollout-helper/internal/config"
+
+// SetDefaults fills in the fields left out of a decoded file. Files are
+// migrated without their defaults, so a later version may change them
+func SetDefaults(cfg *Config) {
+	if cfg.LogAlerts != nil && cfg.LogAlerts.NodeLabel == "" {
+		cfg.LogAlerts.NodeLabel = config.DefaultLogNodeLabel
+	}
+}
@@ -0,0 +1,68 @@
+// Package v1alpha1 holds the first version of the configuration file, which
+// files without an apiVersion are read as
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Version is the apiVersion of the types, without the group
+const Version = "v1alpha1"
+
+// Config is the v1alpha1 configuration file
+type Config struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	// Templates overrides settings of the built-in silence templates
+	Templates map[string]TemplateOverride `json:"templates,omitempty"`
+	// Policies are additional silences created for every rolling node
+	Policies []Policy `json:"policies,omitempty"`
+	// Pools overrides policies for the nodes of a MachineConfigPool
+	Pools map[string]PoolConfig `json:"pools,omitempty"`
+	// RollingTaints are the node taints indicating a rollout, in addition to the MCO state
+	RollingTaints []Taint `json:"rollingTaints,omitempty"`
+	// LogAlerts enables the silence of alerts evaluated by the Loki ruler
+	LogAlerts *LogAlerts `json:"logAlerts,omitempty"`
+}
+
+// TemplateOverride changes settings of a built-in silence template
+type TemplateOverride struct {
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// Policy describes one extra silence created while a node is rolling
+type Policy struct {
+	Name     string           `json:"name"`
+	Matchers []Matcher        `json:"matchers"`
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	Comment  string           `json:"comment,omitempty"`
+	Disabled bool             `json:"disabled,omitempty"`
+}
+
+// Matcher is a single silence matcher, its value a Go template
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex,omitempty"`
+}
+
+// PoolConfig overrides policies for the nodes of a MachineConfigPool
+type PoolConfig struct {
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+// Taint selects node taints by key and optionally effect
+type Taint struct {
+	Key    string             `json:"key"`
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+}
+
+// LogAlerts describes the labels of alerts evaluated by the Loki ruler
+type LogAlerts struct {
+	NodeLabel  string `json:"nodeLabel,omitempty"`
+	Filenames  string `json:"filenames,omitempty"`
+	Alertnames string `json:"alertnames,omitempty"`
+	Ruler      string `json:"ruler,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Taint selects node taints by key and optionally effect
+type Taint struct {
+	Key string `json:"key"`
+	// Effect restricts the match to taints with this effect, any effect matches if empty
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+}
+
+func (t Taint) String() string {
+	if t.Effect == "" {
+		return t.Key
+	}
+	return t.Key + ":" + string(t.Effect)
+}
+
+// Matches reports whether a node taint is selected
+func (t Taint) Matches(taint corev1.Taint) bool {
+	return taint.Key == t.Key && (t.Effect == "" || taint.Effect == t.Effect)
+}
+
+// ParseTaints parses a comma-separated list of taint keys, each optionally
+// followed by an effect, e.g. "wait-for-runc,example.com/maintenance:NoExecute"
+func ParseTaints(s string) ([]Taint, error) {
+	var taints []Taint
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, effect, _ := strings.Cut(item, ":")
+		taints = append(taints, Taint{Key: key, Effect: corev1.TaintEffect(effect)})
+	}
+	if err := validateTaints(taints); err != nil {
+		return nil, err
+	}
+	return taints, nil
+}
+
+// validateTaints rejects taints without key or with an unknown effect
+func validateTaints(taints []Taint) error {
+	for i, taint := range taints {
+		if taint.Key == "" {
+			return fmt.Errorf("taint #%d has no key", i)
+		}
+		switch taint.Effect {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("taint %s: unknown effect %s, expected one of %s, %s, %s", taint.Key, taint.Effect,
+				corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+		}
+	}
+	return nil
+}
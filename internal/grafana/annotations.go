@@ -0,0 +1,171 @@
+// Package grafana annotates Grafana dashboards with the rollouts of nodes, so
+// the metrics of a node can be read against when it was rolling
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// observationQueueSize bounds the state changes waiting to be annotated
+	observationQueueSize = 1000
+	// rolloutTag is set on every annotation of the helper
+	rolloutTag = "rollout"
+)
+
+type observation struct {
+	node    string
+	pool    string
+	rolling bool
+	time    time.Time
+}
+
+// Annotator creates a region annotation for every rollout of a node, from
+// when it started rolling until it finished. Annotations are tagged with
+// "rollout", "node:<node>" and "pool:<pool>" and are organization wide
+// unless a dashboard is set
+type Annotator struct {
+	url          string
+	token        string
+	dashboardUID string
+	tags         []string
+	httpClient   *http.Client
+	observations chan observation
+
+	// open maps rolling nodes to their annotation, only used by the run loop
+	open map[string]annotation
+}
+
+// annotation is the open annotation of a rolling node
+type annotation struct {
+	id    int64
+	start time.Time
+}
+
+// NewAnnotator creates an annotator for the Grafana at url, authenticated
+// with the token of a service account with the annotations:write permission
+func NewAnnotator(url, token string) *Annotator {
+	return &Annotator{
+		url:          strings.TrimSuffix(url, "/"),
+		token:        token,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		observations: make(chan observation, observationQueueSize),
+		open:         make(map[string]annotation),
+	}
+}
+
+// SetDashboard only shows the annotations on the dashboard with uid
+func (a *Annotator) SetDashboard(uid string) {
+	a.dashboardUID = uid
+}
+
+// SetTags adds tags to every annotation, e.g. the cluster name
+func (a *Annotator) SetTags(tags []string) {
+	a.tags = tags
+}
+
+// Observe records a node state change without blocking, it's a no-op on a nil annotator
+func (a *Annotator) Observe(node, pool string, rolling bool) {
+	if a == nil {
+		return
+	}
+
+	select {
+	case a.observations <- observation{node: node, pool: pool, rolling: rolling, time: time.Now()}:
+	default:
+		klog.Warningf("Grafana annotation queue is full, dropping state change of node %s", node)
+	}
+}
+
+// Start annotates state changes until ctx is cancelled
+func (a *Annotator) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case o := <-a.observations:
+				if err := a.handle(ctx, o); err != nil {
+					klog.Errorf("Failed to annotate the rollout of node %s in Grafana: %v", o.node, err)
+				}
+			}
+		}
+	}()
+}
+
+func (a *Annotator) handle(ctx context.Context, o observation) error {
+	if o.rolling {
+		if _, ok := a.open[o.node]; ok {
+			return nil
+		}
+		tags := append([]string{rolloutTag, "node:" + o.node}, a.tags...)
+		if o.pool != "" {
+			tags = append(tags, "pool:"+o.pool)
+		}
+		body := map[string]interface{}{
+			"time": o.time.UnixMilli(),
+			"tags": tags,
+			"text": fmt.Sprintf("Node %s rolling", o.node),
+		}
+		if a.dashboardUID != "" {
+			body["dashboardUID"] = a.dashboardUID
+		}
+		var created struct {
+			ID int64 `json:"id"`
+		}
+		if err := a.call(ctx, http.MethodPost, "/api/annotations", body, &created); err != nil {
+			return err
+		}
+		a.open[o.node] = annotation{id: created.ID, start: o.time}
+		return nil
+	}
+
+	open, ok := a.open[o.node]
+	if !ok {
+		// The rollout started before a restart, or its annotation failed
+		return nil
+	}
+	delete(a.open, o.node)
+	return a.call(ctx, http.MethodPatch, fmt.Sprintf("/api/annotations/%d", open.id), map[string]interface{}{
+		"timeEnd": o.time.UnixMilli(),
+		"text":    fmt.Sprintf("Node %s rolled for %s", o.node, o.time.Sub(open.start).Round(time.Second)),
+	}, nil)
+}
+
+// call sends body to the Grafana HTTP API and decodes the response into out unless it's nil
+func (a *Annotator) call(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.token)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package heartbeat proves that the helper is working, so a dead man's
+// switch notices when it isn't and rollouts would page
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/metrics"
+)
+
+// AlertName is the name of the heartbeat alert
+const AlertName = "RolloutHelperHeartbeat"
+
+// Heartbeat sets rollout_helper_heartbeat_timestamp_seconds every interval
+// while the helper is alive, and optionally posts an always firing alert to
+// Alertmanager. The alert ends after a few missed beats, so a dead man's
+// switch receiver notices once the helper crashed or got stuck
+type Heartbeat struct {
+	interval time.Duration
+	alive    func() bool
+	client   *alertmanager.Client
+	labels   models.LabelSet
+	// startsAt is when the current series of beats started, only used by beat
+	startsAt time.Time
+}
+
+// New creates a heartbeat beating every interval while alive returns true
+func New(interval time.Duration, alive func() bool) *Heartbeat {
+	return &Heartbeat{interval: interval, alive: alive}
+}
+
+// SetAlert posts the heartbeat alert with client, with labels in addition to
+// alertname and severity, e.g. the cluster for routing. It must be called before Start
+func (h *Heartbeat) SetAlert(client *alertmanager.Client, labels map[string]string) {
+	h.client = client
+	h.labels = models.LabelSet{"alertname": AlertName, "severity": "none"}
+	for name, value := range labels {
+		h.labels[name] = value
+	}
+}
+
+// Start beats every interval until ctx is cancelled
+func (h *Heartbeat) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.beat(ctx)
+			}
+		}
+	}()
+}
+
+func (h *Heartbeat) beat(ctx context.Context) {
+	now := time.Now()
+	if !h.alive() {
+		klog.Warning("Helper isn't working, skipping the heartbeat")
+		h.startsAt = time.Time{}
+		return
+	}
+	metrics.HeartbeatTimestamp.Set(float64(now.Unix()))
+	if h.client == nil {
+		return
+	}
+
+	if h.startsAt.IsZero() {
+		h.startsAt = now
+	}
+	alert := &models.PostableAlert{
+		Alert: models.Alert{Labels: h.labels},
+		Annotations: models.LabelSet{
+			"summary": "The rollout helper is working, its alerts are silenced during rollouts",
+		},
+		StartsAt: strfmt.DateTime(h.startsAt),
+		// Resolved after three missed beats
+		EndsAt: strfmt.DateTime(now.Add(3 * h.interval)),
+	}
+	if err := h.client.PostAlerts(ctx, models.PostableAlerts{alert}); err != nil && !errors.Is(err, alertmanager.ErrCircuitOpen) {
+		klog.Errorf("Failed to post the heartbeat alert: %v", err)
+	}
+}
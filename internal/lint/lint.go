@@ -0,0 +1,306 @@
+// Package lint checks silence policies for mistakes which are valid
+// configuration but silence more or less than intended, and suggests fixes
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/routing"
+)
+
+// Severity of a finding, errors fail the lint
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Names of the checks
+const (
+	CheckRegexInvalid   = "regex-invalid"
+	CheckRegexAnchors   = "regex-anchors"
+	CheckRegexUnquoted  = "regex-unquoted"
+	CheckRegexMissing   = "regex-missing"
+	CheckUnknownLabel   = "unknown-label"
+	CheckOverlap        = "overlap"
+	CheckClusterMatcher = "cluster-matcher"
+)
+
+// Finding is a mistake in a policy together with how to fix it
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Policy   string   `json:"policy"`
+	// Pool is the MachineConfigPool the policy is defined or resolved for, empty for the cluster layer
+	Pool       string `json:"pool,omitempty"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// Options selects the checks which need more than the configuration
+type Options struct {
+	// ClusterLabel is the label policies need a matcher on when several
+	// clusters share an Alertmanager, empty skips the check
+	ClusterLabel string
+	// Labels are the label names alerts may carry, e.g. from LoadRuleLabels,
+	// nil skips the unknown-label check
+	Labels map[string]bool
+}
+
+// HasErrors reports whether any finding is an error
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint checks the policies of the cluster and of every pool. Findings are
+// sorted by severity, policy and pool
+func Lint(cfg *config.Config, options Options) []Finding {
+	var findings []Finding
+	for _, layer := range layers(cfg) {
+		for _, policy := range layer.policies {
+			for _, matcher := range policy.Matchers {
+				for _, finding := range checkMatcher(matcher, options.Labels) {
+					finding.Policy, finding.Pool = policy.Name, layer.pool
+					findings = append(findings, finding)
+				}
+			}
+		}
+	}
+	findings = append(findings, checkOverlaps(cfg)...)
+	if options.ClusterLabel != "" {
+		findings = append(findings, checkClusterMatcher(cfg, options.ClusterLabel)...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity == SeverityError
+		}
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		return a.Pool < b.Pool
+	})
+	return findings
+}
+
+// layer are the policies of the cluster or of a pool as written in the configuration
+type layer struct {
+	pool     string
+	policies []config.Policy
+}
+
+func layers(cfg *config.Config) []layer {
+	layers := []layer{{policies: cfg.Policies}}
+	for _, pool := range pools(cfg) {
+		layers = append(layers, layer{pool: pool, policies: cfg.Pools[pool].Policies})
+	}
+	return layers
+}
+
+// pools returns the sorted names of the pools with overrides
+func pools(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Pools))
+	for pool := range cfg.Pools {
+		names = append(names, pool)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// templateAction matches the actions of a matcher value template
+var templateAction = regexp.MustCompile(`\{\{-?\s*(.*?)\s*-?\}\}`)
+
+// regexMeta matches values which look like a regex rather than a literal
+var regexMeta = regexp.MustCompile(`\.\*|\.\+|\||\[.*\]|\(.*\)`)
+
+// checkMatcher checks the value of a single matcher, and its name against
+// labels unless it's nil
+func checkMatcher(matcher config.Matcher, labels map[string]bool) []Finding {
+	var findings []Finding
+	actions := templateAction.FindAllStringSubmatch(matcher.Value, -1)
+
+	if matcher.IsRegex {
+		if len(actions) == 0 {
+			if _, err := regexp.Compile(matcher.Value); err != nil {
+				findings = append(findings, Finding{
+					Severity:   SeverityError,
+					Check:      CheckRegexInvalid,
+					Message:    fmt.Sprintf("matcher %s is not a valid regex: %v", matcher.Name, err),
+					Suggestion: "fix the regex, or set isRegex: false to match the value literally",
+				})
+			}
+		}
+		trimmed := strings.TrimSuffix(strings.TrimPrefix(matcher.Value, "^"), "$")
+		if trimmed != matcher.Value && !strings.HasSuffix(trimmed, `\`) {
+			findings = append(findings, Finding{
+				Severity:   SeverityWarning,
+				Check:      CheckRegexAnchors,
+				Message:    fmt.Sprintf("matcher %s has anchors, but Alertmanager anchors regex matchers already, it only matches whole values", matcher.Name),
+				Suggestion: fmt.Sprintf("use %q, with .* around it to match a part of the value", trimmed),
+			})
+		}
+		for _, action := range actions {
+			if isControl(action[1]) || strings.Contains(action[1], "regexQuote") {
+				continue
+			}
+			findings = append(findings, Finding{
+				Severity:   SeverityWarning,
+				Check:      CheckRegexUnquoted,
+				Message:    fmt.Sprintf("matcher %s renders %s into a regex unquoted, its dots match any character", matcher.Name, action[0]),
+				Suggestion: fmt.Sprintf("use {{ regexQuote %s }}", action[1]),
+			})
+		}
+	} else if len(actions) == 0 && regexMeta.MatchString(matcher.Value) {
+		findings = append(findings, Finding{
+			Severity:   SeverityWarning,
+			Check:      CheckRegexMissing,
+			Message:    fmt.Sprintf("matcher %s looks like a regex but matches %q literally", matcher.Name, matcher.Value),
+			Suggestion: "set isRegex: true",
+		})
+	}
+
+	if labels != nil && !labels[matcher.Name] {
+		suggestion := "remove the matcher, or pass the label with --extra-labels if it's added by relabeling or external labels"
+		if closest := closestLabel(matcher.Name, labels); closest != "" {
+			suggestion = fmt.Sprintf("did you mean %s?", closest)
+		}
+		findings = append(findings, Finding{
+			Severity:   SeverityError,
+			Check:      CheckUnknownLabel,
+			Message:    fmt.Sprintf("no alert rule has the label %s, the silences won't match any alert", matcher.Name),
+			Suggestion: suggestion,
+		})
+	}
+	return findings
+}
+
+// isControl reports whether a template action is control flow, e.g. range or end
+func isControl(action string) bool {
+	word, _, _ := strings.Cut(action, " ")
+	switch word {
+	case "if", "else", "end", "range", "with", "define", "block", "template", "break", "continue", "":
+		return true
+	}
+	return strings.HasPrefix(word, "/*")
+}
+
+// checkOverlaps finds effective policies whose silences are covered by
+// another policy, as every alert they match is matched by the other one
+func checkOverlaps(cfg *config.Config) []Finding {
+	var findings []Finding
+	seen := make(map[[2]string]bool)
+	for _, pool := range append([]string{""}, pools(cfg)...) {
+		policies := cfg.ResolvePolicies(pool, nil)
+		for i, broad := range policies {
+			for j, narrow := range policies {
+				if i == j || !covers(broad, narrow) {
+					continue
+				}
+				equal := covers(narrow, broad)
+				if equal && j < i {
+					// Duplicates are reported once
+					continue
+				}
+				// Pools inheriting both policies unchanged report them once
+				key := [2]string{broad.Name, narrow.Name}
+				if pool != "" && broad.Source == config.LayerCluster && narrow.Source == config.LayerCluster && seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				finding := Finding{
+					Severity:   SeverityWarning,
+					Check:      CheckOverlap,
+					Policy:     narrow.Name,
+					Pool:       pool,
+					Message:    fmt.Sprintf("every alert silenced by %s is silenced by %s already", narrow.Name, broad.Name),
+					Suggestion: fmt.Sprintf("remove %s, or add a matcher to %s to make it specific", narrow.Name, broad.Name),
+				}
+				if equal {
+					finding.Message = fmt.Sprintf("%s has the same matchers as %s", narrow.Name, broad.Name)
+					finding.Suggestion = fmt.Sprintf("remove %s, or merge the two policies", narrow.Name)
+				}
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// covers reports whether every matcher of broad is a matcher of narrow, so
+// the silences of broad match every alert the ones of narrow match
+func covers(broad, narrow config.ResolvedPolicy) bool {
+	for _, matcher := range broad.Matchers {
+		found := false
+		for _, other := range narrow.Matchers {
+			if matcher.Name == other.Name && matcher.Value == other.Value && matcher.IsRegex == other.IsRegex {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// checkClusterMatcher finds effective policies without a matcher on label,
+// whose silences would cover the alerts of every cluster sharing the Alertmanager
+func checkClusterMatcher(cfg *config.Config, label string) []Finding {
+	var findings []Finding
+	for _, missing := range routing.Check(cfg, routing.Keys{label: "--cluster-label"}) {
+		findings = append(findings, Finding{
+			Severity:   SeverityWarning,
+			Check:      CheckClusterMatcher,
+			Policy:     missing.Policy,
+			Pool:       missing.Pool,
+			Message:    fmt.Sprintf("no matcher on %s, the silences cover the alerts of every cluster sharing the Alertmanager", label),
+			Suggestion: fmt.Sprintf("add {name: %s, value: <cluster>}", label),
+		})
+	}
+	return findings
+}
+
+// closestLabel returns the label within an edit distance of 2 of name, empty if there's none
+func closestLabel(name string, labels map[string]bool) string {
+	closest, best := "", 3
+	for label := range labels {
+		if distance := editDistance(name, label); distance < best || distance == best && label < closest {
+			closest, best = label, distance
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,83 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ruleDump accepts the response of the Prometheus rules API, Prometheus
+// rule files and PrometheusRule objects
+type ruleDump struct {
+	Data struct {
+		Groups []ruleGroup `json:"groups"`
+	} `json:"data"`
+	Groups []ruleGroup `json:"groups"`
+	Spec   struct {
+		Groups []ruleGroup `json:"groups"`
+	} `json:"spec"`
+}
+
+type ruleGroup struct {
+	Rules []struct {
+		// Type, Name and Query are set by the rules API, Alert, Record and
+		// Expr in rule files
+		Type   string            `json:"type"`
+		Name   string            `json:"name"`
+		Record string            `json:"record"`
+		Query  string            `json:"query"`
+		Alert  string            `json:"alert"`
+		Expr   string            `json:"expr"`
+		Labels map[string]string `json:"labels"`
+		// Alerts are the active alerts of the rule in the rules API
+		Alerts []struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"alerts"`
+	} `json:"rules"`
+}
+
+// identifier matches the label names a query may carry through to its alerts
+var identifier = regexp.MustCompile(`[a-zA-Z_][a-zA-Z0-9_]*`)
+
+// LoadRuleLabels returns the label names the alerts of the rules dumped at
+// path may carry: their static labels, the labels of active alerts and every
+// name in their queries. Like the Loki rule check it's by name only, a query
+// mentioning a label may still aggregate it away
+func LoadRuleLabels(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	var dump ruleDump
+	if err := yaml.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	labels := map[string]bool{"alertname": true}
+	rules := 0
+	for _, group := range append(append(dump.Data.Groups, dump.Groups...), dump.Spec.Groups...) {
+		for _, rule := range group.Rules {
+			if rule.Type == "recording" || rule.Record != "" {
+				continue
+			}
+			rules++
+			for name := range rule.Labels {
+				labels[name] = true
+			}
+			for _, alert := range rule.Alerts {
+				for name := range alert.Labels {
+					labels[name] = true
+				}
+			}
+			for _, name := range identifier.FindAllString(rule.Query+" "+rule.Expr, -1) {
+				labels[name] = true
+			}
+		}
+	}
+	if rules == 0 {
+		return nil, fmt.Errorf("no alert rules found in %s", path)
+	}
+	return labels, nil
+}
@@ -0,0 +1,80 @@
+// Package logging configures the format of klog's output
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// FormatText is klog's default text format
+	FormatText = "text"
+	// FormatJSON writes one JSON object per line with the key/value pairs of
+	// structured log calls as fields
+	FormatJSON = "json"
+)
+
+// minLevel lets every message klog passes on through, klog already applied -v
+const minLevel = slog.Level(-128)
+
+// Setup switches klog to the given format, it must be called after the flags are parsed
+func Setup(format string) error {
+	switch format {
+	case FormatText:
+		return nil
+	case FormatJSON:
+		handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level:       minLevel,
+			ReplaceAttr: replaceAttr,
+		})
+		// Structured calls are passed to the logger with their key/value
+		// pairs, klog only keeps the severity of formatted ones in its header
+		logger := slog.New(handler)
+		klog.SetLoggerWithOptions(logr.FromSlogHandler(handler), klog.WriteKlogBuffer(func(data []byte) {
+			writeKlog(logger, data)
+		}))
+		return nil
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+}
+
+// severities maps the severity letter of klog headers to levels
+var severities = map[byte]slog.Level{
+	'I': slog.LevelInfo,
+	'W': slog.LevelWarn,
+	'E': slog.LevelError,
+	'F': slog.LevelError,
+}
+
+// writeKlog logs a formatted klog message, e.g.
+// "W1016 10:34:17.224940   29519 main.go:120] message", at its severity
+func writeKlog(logger *slog.Logger, data []byte) {
+	message := strings.TrimSuffix(string(data), "\n")
+	if message == "" {
+		return
+	}
+	level, ok := severities[message[0]]
+	header, text, found := strings.Cut(message, "] ")
+	if !ok || !found {
+		logger.Info(message)
+		return
+	}
+	fields := strings.Fields(header)
+	logger.Log(context.Background(), level, text, "caller", fields[len(fields)-1])
+}
+
+// replaceAttr writes durations the way they're written in text logs and
+// flags, e.g. 1h30m0s, instead of nanoseconds
+func replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindDuration {
+		attr.Value = slog.StringValue(attr.Value.Duration().String())
+	}
+	return attr
+}
@@ -0,0 +1,103 @@
+// Package loki verifies that the alert rules of a Loki ruler follow the
+// label conventions the log alert silences rely on
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"rollout-helper/internal/config"
+)
+
+// rulesPath is the Prometheus compatible rules API of the Loki ruler
+const rulesPath = "/prometheus/api/v1/rules"
+
+// rulesResponse is the subset of the rules API response which is checked
+type rulesResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Groups []struct {
+			Name  string `json:"name"`
+			Rules []Rule `json:"rules"`
+		} `json:"groups"`
+	} `json:"data"`
+}
+
+// Rule is an alerting or recording rule of the Loki ruler
+type Rule struct {
+	Type   string            `json:"type"`
+	Name   string            `json:"name"`
+	Query  string            `json:"query"`
+	Labels map[string]string `json:"labels"`
+}
+
+// CheckRules returns the alert rules whose alerts won't be silenced by the
+// log alert silences, because neither their labels nor their query carry the
+// node label, or the filename label if filenames are restricted. The check is
+// by name only, a query mentioning the label may still aggregate it away
+func CheckRules(ctx context.Context, logs *config.LogAlerts) ([]string, error) {
+	rules, err := fetchRules(ctx, logs)
+	if err != nil {
+		return nil, err
+	}
+
+	required := []string{logs.Label()}
+	if logs.Filenames != "" {
+		required = append(required, "filename")
+	}
+
+	var nonConforming []string
+	for _, rule := range rules {
+		if rule.Type != "alerting" {
+			continue
+		}
+		for _, label := range required {
+			if _, static := rule.Labels[label]; !static && !strings.Contains(rule.Query, label) {
+				nonConforming = append(nonConforming, fmt.Sprintf("%s (no %s label)", rule.Name, label))
+				break
+			}
+		}
+	}
+	return nonConforming, nil
+}
+
+// fetchRules lists the rules of all groups of the ruler
+func fetchRules(ctx context.Context, logs *config.LogAlerts) ([]Rule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(logs.Ruler, "/")+rulesPath+"?type=alert", nil)
+	if err != nil {
+		return nil, err
+	}
+	if logs.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", logs.Tenant)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach loki ruler: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var response rulesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode rules: %w", err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("loki ruler returned status %q", response.Status)
+	}
+
+	var rules []Rule
+	for _, group := range response.Data.Groups {
+		rules = append(rules, group.Rules...)
+	}
+	return rules, nil
+}
@@ -0,0 +1,190 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/policy"
+	"rollout-helper/internal/scope"
+)
+
+// resyncInterval is how often MaintenanceWindow objects are reconciled
+const resyncInterval = time.Minute
+
+// Target receives the nodes in an active maintenance window and reports
+// their silences
+type Target interface {
+	SetMaintenance(ctx context.Context, nodes map[string]alertmanager.Maintenance)
+	Silences() map[string][]alertmanager.TrackedSilence
+	LastErrors() map[string]alertmanager.NodeError
+}
+
+// Controller reconciles MaintenanceWindow objects into node silences
+type Controller struct {
+	client    dynamic.Interface
+	k8sClient kubernetes.Interface
+	target    Target
+	now       func() time.Time
+	// namespaces are the namespaces windows are listed in, all if empty
+	namespaces scope.Namespaces
+	// notInstalled is set while the CRD doesn't exist, to log it only once
+	notInstalled bool
+}
+
+// NewController creates a controller silencing the nodes of active MaintenanceWindows through target
+func NewController(client dynamic.Interface, k8sClient kubernetes.Interface, target Target) *Controller {
+	return &Controller{
+		client:    client,
+		k8sClient: k8sClient,
+		target:    target,
+		now:       time.Now,
+	}
+}
+
+// SetNamespaces restricts the namespaces windows are listed in, for
+// namespace-scoped permissions. It must be called before Start
+func (c *Controller) SetNamespaces(namespaces scope.Namespaces) {
+	c.namespaces = namespaces
+}
+
+// Start reconciles the windows now and then periodically
+func (c *Controller) Start(ctx context.Context) {
+	c.reconcile(ctx)
+
+	go func() {
+		ticker := time.NewTicker(resyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.reconcile(ctx)
+			}
+		}
+	}()
+}
+
+// reconcile hands the nodes of all active windows to the target and reports
+// their silences in the status of the windows. On errors listing the windows
+// or nodes the target isn't updated, so nodes aren't unsilenced because of an
+// API outage
+func (c *Controller) reconcile(ctx context.Context) {
+	list, err := c.namespaces.List(ctx, c.client.Resource(MaintenanceWindowResource), metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		if !c.notInstalled {
+			klog.Warningf("The MaintenanceWindow CRD is not installed, no maintenance windows are reconciled")
+			c.notInstalled = true
+		}
+		c.target.SetMaintenance(ctx, nil)
+		return
+	}
+	if err != nil {
+		klog.Errorf("Failed to list MaintenanceWindows: %v", err)
+		return
+	}
+	c.notInstalled = false
+
+	now := c.now()
+	nodes := make(map[string]alertmanager.Maintenance)
+	statuses := make([]MaintenanceWindowStatus, len(list.Items))
+	selected := make([][]string, len(list.Items))
+	for i := range list.Items {
+		item := &list.Items[i]
+		statuses[i].ObservedGeneration = item.GetGeneration()
+
+		window, err := fromUnstructured(item)
+		if err == nil {
+			err = validate(window)
+		}
+		if err != nil {
+			klog.Errorf("Ignoring MaintenanceWindow %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+			statuses[i].Phase, statuses[i].Error = PhaseInvalid, err.Error()
+			continue
+		}
+		switch {
+		case now.Before(window.Spec.StartTime.Time):
+			statuses[i].Phase = PhasePending
+			continue
+		case !now.Before(window.Spec.EndTime.Time):
+			statuses[i].Phase = PhaseEnded
+			continue
+		}
+		statuses[i].Phase = PhaseActive
+
+		nodeList, err := c.k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+			LabelSelector: metav1.FormatLabelSelector(&window.Spec.NodeSelector),
+		})
+		if err != nil {
+			klog.Errorf("Failed to list nodes of MaintenanceWindow %s/%s: %v", window.Namespace, window.Name, err)
+			return
+		}
+		for _, node := range nodeList.Items {
+			selected[i] = append(selected[i], node.Name)
+			// Overlapping windows silence the node until the last one ends
+			if existing, ok := nodes[node.Name]; ok && !window.Spec.EndTime.After(existing.Until) {
+				continue
+			}
+			nodes[node.Name] = alertmanager.Maintenance{
+				Window: window.Namespace + "/" + window.Name,
+				Reason: window.Spec.Reason,
+				Until:  window.Spec.EndTime.Time,
+			}
+		}
+	}
+
+	klog.V(2).Infof("Reconciled %d MaintenanceWindows, %d nodes are under maintenance", len(list.Items), len(nodes))
+	c.target.SetMaintenance(ctx, nodes)
+
+	silences := c.target.Silences()
+	failures := c.target.LastErrors()
+	for i := range list.Items {
+		sort.Strings(selected[i])
+		for _, name := range selected[i] {
+			node := policy.NodeStatus{Name: name, Silences: silences[name]}
+			if failure, ok := failures[name]; ok {
+				node.LastError = &failure
+			}
+			statuses[i].Nodes = append(statuses[i].Nodes, node)
+		}
+
+		if err := policy.UpdateStatus(ctx, c.client, MaintenanceWindowResource, &list.Items[i], &statuses[i]); err != nil {
+			klog.Errorf("Failed to report status of MaintenanceWindow %s/%s: %v", list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+		}
+	}
+}
+
+// validate rejects windows which would select no or all nodes or never be active
+func validate(window MaintenanceWindow) error {
+	selector, err := metav1.LabelSelectorAsSelector(&window.Spec.NodeSelector)
+	if err != nil {
+		return fmt.Errorf("invalid node selector: %w", err)
+	}
+	if selector.Empty() {
+		return fmt.Errorf("node selector is empty")
+	}
+	if !window.Spec.EndTime.After(window.Spec.StartTime.Time) {
+		return fmt.Errorf("end time must be after start time")
+	}
+	return nil
+}
+
+func fromUnstructured(item *unstructured.Unstructured) (MaintenanceWindow, error) {
+	var window MaintenanceWindow
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &window); err != nil {
+		return window, fmt.Errorf("failed to decode: %w", err)
+	}
+	return window, nil
+}
@@ -0,0 +1,55 @@
+package maintenance
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"rollout-helper/internal/policy"
+)
+
+// MaintenanceWindowResource is the namespaced MaintenanceWindow resource
+var MaintenanceWindowResource = schema.GroupVersionResource{
+	Group:    policy.Group,
+	Version:  policy.Version,
+	Resource: "maintenancewindows",
+}
+
+// MaintenanceWindow silences the selected nodes between its start and end time
+type MaintenanceWindow struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MaintenanceWindowSpec   `json:"spec"`
+	Status MaintenanceWindowStatus `json:"status,omitempty"`
+}
+
+// MaintenanceWindowSpec is the schedule of a MaintenanceWindow
+type MaintenanceWindowSpec struct {
+	// NodeSelector selects the nodes under maintenance, it must not be empty
+	NodeSelector metav1.LabelSelector `json:"nodeSelector"`
+	StartTime    metav1.Time          `json:"startTime"`
+	EndTime      metav1.Time          `json:"endTime"`
+	// Reason is shown in the events recorded on the nodes
+	Reason string `json:"reason,omitempty"`
+}
+
+// Phase is the progress of a MaintenanceWindow
+type Phase string
+
+const (
+	PhasePending Phase = "Pending"
+	PhaseActive  Phase = "Active"
+	PhaseEnded   Phase = "Ended"
+	// PhaseInvalid windows are ignored, see the status error
+	PhaseInvalid Phase = "Invalid"
+)
+
+// MaintenanceWindowStatus reports what the helper did for a MaintenanceWindow
+type MaintenanceWindowStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	Phase              Phase `json:"phase,omitempty"`
+	// Error explains why the window is ignored
+	Error string `json:"error,omitempty"`
+	// Nodes are the nodes selected by an active window
+	Nodes []policy.NodeStatus `json:"nodes,omitempty"`
+}
@@ -0,0 +1,426 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	"rollout-helper/internal/version"
+)
+
+const namespace = "rollout_helper"
+
+var (
+	// TrackedNodes is the number of nodes the helper currently tracks silences for
+	TrackedNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tracked_nodes",
+		Help:      "Number of nodes with tracked silences",
+	})
+
+	// TrackedSilences is the number of silence IDs the helper currently tracks
+	TrackedSilences = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tracked_silences",
+		Help:      "Number of silences tracked across all nodes, by kind",
+	}, []string{"kind"})
+
+	// ActiveSilenceInfo is 1 for every silence the helper manages
+	ActiveSilenceInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_silence_info",
+		Help:      "Silences managed by the helper, with the node, kind, ID and end as labels",
+	}, []string{"node", "kind", "silence_id", "ends_at"})
+
+	// ActiveSilenceExpiry is when each managed silence ends, for alerting on silences about to expire
+	ActiveSilenceExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_silence_expiry_timestamp_seconds",
+		Help:      "Unix time at which a silence managed by the helper ends",
+	}, []string{"node", "kind", "silence_id"})
+
+	// SilencesCreated counts the silences created by the helper
+	SilencesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "silences_created_total",
+		Help:      "Number of silences created, by kind",
+	}, []string{"kind"})
+
+	// SilencesReused counts the silences which already existed when they were to be created
+	SilencesReused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "silences_reused_total",
+		Help:      "Number of silences found by fingerprint instead of being created again, by kind",
+	}, []string{"kind"})
+
+	// MutationsHeld is 1 while an instance of another version manages the silences
+	MutationsHeld = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mutations_held",
+		Help:      "Whether silence mutations are held off while an instance of another version is running",
+	})
+
+	// SilenceStoreEvictions counts entries removed from the silence store without a node transition
+	SilenceStoreEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "silence_store_evictions_total",
+		Help:      "Number of nodes evicted from the silence store, by reason",
+	}, []string{"reason"})
+
+	// AlertmanagerEndpointActive is 1 for the endpoint requests are currently sent to
+	AlertmanagerEndpointActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_endpoint_active",
+		Help:      "Whether the Alertmanager endpoint is the one requests are sent to",
+	}, []string{"endpoint"})
+
+	// AlertmanagerEndpointUp is the last known health of each endpoint
+	AlertmanagerEndpointUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_endpoint_up",
+		Help:      "Whether the Alertmanager endpoint is considered healthy",
+	}, []string{"endpoint"})
+
+	// AlertmanagerFailovers counts switches between Alertmanager endpoints
+	AlertmanagerFailovers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_failovers_total",
+		Help:      "Number of times requests moved to another Alertmanager endpoint",
+	})
+
+	// AlertmanagerRequests counts attempts sent to Alertmanager by response status
+	AlertmanagerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_requests_total",
+		Help:      "Number of requests sent to Alertmanager, by method and status code",
+	}, []string{"method", "status"})
+
+	// AlertmanagerRetries counts repeated Alertmanager requests
+	AlertmanagerRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_retries_total",
+		Help:      "Number of retried Alertmanager requests, by method",
+	}, []string{"method"})
+
+	// AlertmanagerCircuitOpen is 1 while the circuit breaker holds back Alertmanager requests
+	AlertmanagerCircuitOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_circuit_open",
+		Help:      "Whether the circuit breaker is open or half-open and holds back Alertmanager requests",
+	})
+
+	// AlertmanagerCircuitOpens counts how often the circuit breaker opened
+	AlertmanagerCircuitOpens = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_circuit_opens_total",
+		Help:      "Number of times too many failed Alertmanager requests opened the circuit breaker",
+	})
+
+	// AlertmanagerRequestsRejected counts requests failed by the open circuit breaker without being sent
+	AlertmanagerRequestsRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_requests_rejected_total",
+		Help:      "Number of Alertmanager requests failed without being sent while the circuit breaker was open",
+	})
+
+	// SilenceOperationFailures counts silence operations which failed after all retries
+	SilenceOperationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "silence_operation_failures_total",
+		Help:      "Number of silence operations that failed after all retries, by operation",
+	}, []string{"operation"})
+
+	// AlertmanagerPartialFailures counts broadcast operations which failed on some endpoints only
+	AlertmanagerPartialFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_partial_failures_total",
+		Help:      "Number of broadcast silence operations that failed on some but not all Alertmanager endpoints, by operation",
+	}, []string{"operation"})
+
+	// PodSelectorValid is 1 if the selector of a silenced daemonset matches any pod
+	PodSelectorValid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pod_selector_valid",
+		Help:      "Whether the pod selector of a daemonset whose pods are silenced matches at least one pod",
+	}, []string{"namespace", "daemonset"})
+
+	// NamespaceAccessible is 0 for namespaces in which listing pods is forbidden
+	NamespaceAccessible = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "namespace_accessible",
+		Help:      "Whether pods of a namespace with silenced daemonsets can be listed",
+	}, []string{"namespace"})
+
+	// NotificationsSent counts notifications delivered to sinks
+	NotificationsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_sent_total",
+		Help:      "Number of notifications delivered to sinks, by sink and result",
+	}, []string{"sink", "result"})
+
+	// NotificationsDropped counts notifications which were never delivered
+	NotificationsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_dropped_total",
+		Help:      "Number of notifications dropped, by reason",
+	}, []string{"reason"})
+
+	// MetricPushes counts the pushes of the metrics to remote backends
+	MetricPushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "metric_pushes_total",
+		Help:      "Number of times the metrics were pushed to a remote backend, by backend and result",
+	}, []string{"backend", "result"})
+
+	// BuildInfo is 1 with the version of the running binary as labels
+	BuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information of the rollout helper",
+	}, []string{"version", "commit", "goversion"})
+
+	// ConfigHash identifies the loaded configuration file
+	ConfigHash = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_hash",
+		Help:      "Hash of the loaded configuration file, 0 without one",
+	})
+
+	// ReconcileActions counts the drift fixed by the reconciler
+	ReconcileActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_actions_total",
+		Help:      "Drift between rolling nodes and silences fixed by the reconciler, by action",
+	}, []string{"action"})
+
+	// NodesDeleted counts nodes deleted while rolling
+	NodesDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nodes_deleted_total",
+		Help:      "Number of nodes deleted while rolling, whose silences were deleted right away",
+	})
+
+	// AnnotationsRejected counts annotations ignored because their authorization failed
+	AnnotationsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "annotations_rejected_total",
+		Help:      "Number of times an annotation was ignored because it couldn't be authorized, by annotation",
+	}, []string{"annotation"})
+
+	// AlertmanagerThrottleSeconds sums how long requests waited for the request limits
+	AlertmanagerThrottleSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alertmanager_throttle_seconds_total",
+		Help:      "Total time Alertmanager requests waited for a free slot or the rate limit of their endpoint",
+	})
+
+	// PoolSilenceMembers tracks the nodes covered by the silence of each pool
+	PoolSilenceMembers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pool_silence_nodes",
+		Help:      "Number of rolling nodes covered by the shared node silence of a MachineConfigPool",
+	}, []string{"pool"})
+
+	// SilencesCollected counts the silences deleted by the garbage collection
+	SilencesCollected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "silences_collected_total",
+		Help:      "Helper-owned silences deleted by the garbage collection, by reason",
+	}, []string{"reason"})
+
+	// CriticalPodSilences counts the silences of critical pods moved off rolling nodes
+	CriticalPodSilences = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "critical_pod_silences_total",
+		Help:      "Number of silences created for critical pods on the nodes they were moved to from rolling nodes",
+	})
+
+	// EvictionSilences counts the silences of daemonset pods evicted from nodes which aren't rolling
+	EvictionSilences = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "eviction_silences_total",
+		Help:      "Number of silences created for daemonset pods evicted from nodes which aren't rolling, and their replacements",
+	})
+
+	// InhibitedNodes is the number of nodes whose NodeRolling alert is posted
+	InhibitedNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inhibited_nodes",
+		Help:      "Number of rolling nodes whose alerts are inhibited by a NodeRolling alert, in inhibition mode",
+	})
+
+	// HeartbeatTimestamp is when the helper last proved it's working
+	HeartbeatTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_timestamp_seconds",
+		Help:      "Unix time of the last heartbeat, sent while the nodes are polled and their changes handled",
+	})
+
+	// CatchUpSilences counts the catch-up silences of nodes whose rollout was detected late
+	CatchUpSilences = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "catch_up_silences_total",
+		Help:      "Number of catch-up silences created because alerts of a node fired before its rollout was detected",
+	})
+
+	// PolicyRoutingLabelMissing is 1 for each routing label a policy has no matcher on
+	PolicyRoutingLabelMissing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "policy_routing_label_missing",
+		Help:      "Routing labels of the Alertmanager configuration a silence policy has no matcher on, by policy, pool and label",
+	}, []string{"policy", "pool", "label"})
+
+	// PoolRolloutProgress is the fraction of updated machines of each MachineConfigPool
+	PoolRolloutProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pool_rollout_progress",
+		Help:      "Fraction of the machines of the MachineConfigPool which run its current config",
+	}, []string{"pool"})
+
+	// PoolMachines is the number of machines of each MachineConfigPool by state, as reported in its status
+	PoolMachines = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pool_machines",
+		Help:      "Machines of the MachineConfigPool as reported in its status, by state: total, updated, ready, unavailable or degraded",
+	}, []string{"pool", "state"})
+
+	// PoolNodesUpdating is the number of nodes of each pool the MCO or WMCO is updating
+	PoolNodesUpdating = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pool_nodes_updating",
+		Help:      "Nodes of the pool which are being updated according to their annotations",
+	}, []string{"pool"})
+
+	// NodeRolloutDuration is how long the rollouts of the nodes of each pool took
+	NodeRolloutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "node_rollout_duration_seconds",
+		Help:      "Time from a node starting to roll until it was done, by pool",
+		// 1 minute to a bit over 4 hours
+		Buckets: prometheus.ExponentialBuckets(60, 2, 9),
+	}, []string{"pool"})
+
+	// NodeRolloutStuck is 1 for nodes rolling longer than --stuck-rollout-threshold
+	NodeRolloutStuck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_rollout_stuck",
+		Help:      "1 for nodes which have been rolling longer than the stuck threshold",
+	}, []string{"node", "pool"})
+
+	// RolloutsEscalated counts rollouts whose silences were deleted after --max-rollout-duration
+	RolloutsEscalated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollouts_escalated_total",
+		Help:      "Rollouts whose silences were deleted because they took longer than the maximum rollout duration",
+	})
+
+	// PoolsPaused counts the updates of MachineConfigPools paused because of firing alerts
+	PoolsPaused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pools_paused_total",
+		Help:      "Updates of MachineConfigPools paused because alerts fired unsilenced, by pool",
+	}, []string{"pool"})
+
+	// RolloutVerifications counts the verifications of nodes which finished rolling
+	RolloutVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollout_verifications_total",
+		Help:      "Verifications of nodes which finished rolling, by result: passed or failed",
+	}, []string{"result"})
+
+	// RolloutVerificationFailures counts the checks failed verifications ended with
+	RolloutVerificationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollout_verification_failures_total",
+		Help:      "Checks which still failed when the verification of a node gave up, by check: ready, daemonset or scrape",
+	}, []string{"check"})
+
+	// UnsilenceTargetWaits counts the nodes which waited for their scrape targets before being unsilenced
+	UnsilenceTargetWaits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unsilence_target_waits_total",
+		Help:      "Nodes which finished rolling and waited for their scrape targets before their silences were deleted, by result: up or timeout",
+	}, []string{"result"})
+
+	// RolloutFlapsSuppressed counts nodes which looked done and then rolling again within the settle time
+	RolloutFlapsSuppressed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollout_flaps_suppressed_total",
+		Help:      "Number of times a node looked done and rolling again within the settle time",
+	})
+
+	// NodeDrainState is 1 for the current MCO drain state of each draining node
+	NodeDrainState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_drain_state",
+		Help:      "Current MCO drain state of nodes with a drain in progress",
+	}, []string{"node", "state"})
+
+	// NodeDrainDuration is how long a node has been in its current drain state
+	NodeDrainDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_drain_state_duration_seconds",
+		Help:      "Seconds since the node entered its current drain state",
+	}, []string{"node"})
+)
+
+// Registry holds all metrics exposed by the rollout helper
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		TrackedNodes,
+		TrackedSilences,
+		SilencesCreated,
+		SilencesReused,
+		MutationsHeld,
+		ActiveSilenceInfo,
+		ActiveSilenceExpiry,
+		SilenceStoreEvictions,
+		AlertmanagerEndpointActive,
+		AlertmanagerEndpointUp,
+		AlertmanagerFailovers,
+		AlertmanagerRequests,
+		AlertmanagerRetries,
+		AlertmanagerThrottleSeconds,
+		AlertmanagerCircuitOpen,
+		AlertmanagerCircuitOpens,
+		AlertmanagerRequestsRejected,
+		SilenceOperationFailures,
+		AlertmanagerPartialFailures,
+		PodSelectorValid,
+		NamespaceAccessible,
+		NotificationsSent,
+		NotificationsDropped,
+		MetricPushes,
+		BuildInfo,
+		ConfigHash,
+		NodeDrainState,
+		NodeDrainDuration,
+		RolloutFlapsSuppressed,
+		PoolRolloutProgress,
+		PoolMachines,
+		PoolNodesUpdating,
+		NodeRolloutDuration,
+		NodeRolloutStuck,
+		RolloutsEscalated,
+		PoolsPaused,
+		RolloutVerifications,
+		RolloutVerificationFailures,
+		UnsilenceTargetWaits,
+		ReconcileActions,
+		SilencesCollected,
+		NodesDeleted,
+		AnnotationsRejected,
+		PolicyRoutingLabelMissing,
+		CatchUpSilences,
+		CriticalPodSilences,
+		EvictionSilences,
+		PoolSilenceMembers,
+		InhibitedNodes,
+		HeartbeatTimestamp,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	BuildInfo.WithLabelValues(version.Version, version.Revision(), version.GoVersion).Set(1)
+}
@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"k8s.io/klog/v2"
+)
+
+// Pusher sends the metrics of the helper to a backend, for clusters whose
+// Prometheus can't scrape it
+type Pusher interface {
+	// Name identifies the backend in logs and metrics
+	Name() string
+	// Push sends the current values of the metrics
+	Push(ctx context.Context) error
+}
+
+// gatherer only gathers the metrics of the helper, the Go and process
+// metrics are left to the pull endpoint
+var gatherer = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+	families, err := Registry.Gather()
+	kept := families[:0]
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), namespace+"_") {
+			kept = append(kept, family)
+		}
+	}
+	return kept, err
+})
+
+// PushGateway pushes the metrics to a Prometheus Pushgateway, replacing the
+// metrics previously pushed for the job and instance
+type PushGateway struct {
+	pusher *push.Pusher
+}
+
+// NewPushGateway creates a pusher to the Pushgateway at url, grouped by
+// job and instance. Requests are authenticated with token unless it's empty
+func NewPushGateway(url, job, instance, token string) *PushGateway {
+	pusher := push.New(url, job).Gatherer(gatherer).Grouping("instance", instance)
+	if token != "" {
+		pusher = pusher.Client(&bearerClient{client: http.DefaultClient, token: token})
+	}
+	return &PushGateway{pusher: pusher}
+}
+
+func (p *PushGateway) Name() string {
+	return "pushgateway"
+}
+
+func (p *PushGateway) Push(ctx context.Context) error {
+	return p.pusher.PushContext(ctx)
+}
+
+// bearerClient adds a bearer token to the requests of the Pushgateway client
+type bearerClient struct {
+	client *http.Client
+	token  string
+}
+
+func (c *bearerClient) Do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return c.client.Do(req)
+}
+
+// RemoteWrite pushes the metrics with the Prometheus remote write protocol
+// 1.0, e.g. to Prometheus with --web.enable-remote-write-receiver, Thanos
+// Receive or Mimir. Every sample gets the job and instance labels
+type RemoteWrite struct {
+	url        string
+	token      string
+	labels     map[string]string
+	httpClient *http.Client
+}
+
+// NewRemoteWrite creates a pusher to the remote write endpoint at url.
+// Requests are authenticated with token unless it's empty
+func NewRemoteWrite(url, job, instance, token string) *RemoteWrite {
+	return &RemoteWrite{
+		url:        url,
+		token:      token,
+		labels:     map[string]string{"job": job, "instance": instance},
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (r *RemoteWrite) Name() string {
+	return "remote-write"
+}
+
+func (r *RemoteWrite) Push(ctx context.Context) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(families, r.labels, time.Now()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sample is a single series of a remote write request
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// encodeWriteRequest encodes the families as the protobuf WriteRequest of
+// remote write, with every sample at now. Histograms and summaries are
+// split into the series they're exposed as
+func encodeWriteRequest(families []*dto.MetricFamily, extra map[string]string, now time.Time) []byte {
+	var samples []sample
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string, len(metric.GetLabel())+len(extra)+2)
+			for key, value := range extra {
+				labels[key] = value
+			}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			add := func(suffix string, value float64, extraLabel ...string) {
+				series := make(map[string]string, len(labels)+2)
+				for key, value := range labels {
+					series[key] = value
+				}
+				if len(extraLabel) == 2 {
+					series[extraLabel[0]] = extraLabel[1]
+				}
+				series["__name__"] = name + suffix
+				samples = append(samples, sample{labels: series, value: value})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.GetBucket() {
+					add("_bucket", float64(bucket.GetCumulativeCount()), "le", formatFloat(bucket.GetUpperBound()))
+				}
+				add("_bucket", float64(histogram.GetSampleCount()), "le", "+Inf")
+				add("_sum", histogram.GetSampleSum())
+				add("_count", float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add("", quantile.GetValue(), "quantile", formatFloat(quantile.GetQuantile()))
+				}
+				add("_sum", summary.GetSampleSum())
+				add("_count", float64(summary.GetSampleCount()))
+			}
+		}
+	}
+
+	var request []byte
+	for _, s := range samples {
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, encodeTimeSeries(s, now.UnixMilli()))
+	}
+	return request
+}
+
+// encodeTimeSeries encodes a TimeSeries with a single sample, its labels
+// sorted by name as remote write requires
+func encodeTimeSeries(s sample, timestamp int64) []byte {
+	names := make([]string, 0, len(s.labels))
+	for name := range s.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var series []byte
+	for _, name := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, s.labels[name])
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, label)
+	}
+
+	var value []byte
+	value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+	value = protowire.AppendFixed64(value, math.Float64bits(s.value))
+	value = protowire.AppendTag(value, 2, protowire.VarintType)
+	value = protowire.AppendVarint(value, uint64(timestamp))
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	return protowire.AppendBytes(series, value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// StartPushing pushes the metrics to every pusher each interval until ctx
+// is cancelled, and once more when it is
+func StartPushing(ctx context.Context, interval time.Duration, pushers ...Pusher) {
+	pushAll := func(ctx context.Context) {
+		for _, pusher := range pushers {
+			if err := pusher.Push(ctx); err != nil {
+				MetricPushes.WithLabelValues(pusher.Name(), "error").Inc()
+				klog.Errorf("Failed to push metrics to %s: %v", pusher.Name(), err)
+				continue
+			}
+			MetricPushes.WithLabelValues(pusher.Name(), "success").Inc()
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Push the final values, e.g. the counters of a helper being replaced
+				finalCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				pushAll(finalCtx)
+				cancel()
+				return
+			case <-ticker.C:
+				pushAll(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeRequestDescriptor is the WriteRequest of prometheus/prompb remote.proto
+// and types.proto, with the fields a receiver of remote write 1.0 decodes
+func writeRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(".prometheus." + typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("prometheus/remote.proto"),
+		Package: proto.String("prometheus"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("WriteRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("timeseries", 1, message, repeated, "TimeSeries"),
+				},
+			},
+			{
+				Name: proto.String("TimeSeries"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("labels", 1, message, repeated, "Label"),
+					field("samples", 2, message, repeated, "Sample"),
+				},
+			},
+			{
+				Name: proto.String("Label"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+				},
+			},
+			{
+				Name: proto.String("Sample"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("value", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional, ""),
+					field("timestamp", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional, ""),
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("Invalid WriteRequest descriptor: %v", err)
+	}
+	return fd.Messages().ByName("WriteRequest")
+}
+
+// decodedSeries is a TimeSeries of a decoded WriteRequest
+type decodedSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes a WriteRequest by its descriptor, fields the
+// receiver doesn't know, e.g. with a wrong number or wire type, fail the test
+func decodeWriteRequest(t *testing.T, data []byte) []decodedSeries {
+	t.Helper()
+	request := dynamicpb.NewMessage(writeRequestDescriptor(t))
+	if err := proto.Unmarshal(data, request); err != nil {
+		t.Fatalf("Failed to decode the WriteRequest: %v", err)
+	}
+
+	var unknown func(m protoreflect.Message)
+	unknown = func(m protoreflect.Message) {
+		if len(m.GetUnknown()) > 0 {
+			t.Fatalf("%s has unknown fields: %x", m.Descriptor().Name(), m.GetUnknown())
+		}
+		m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			if fd.Kind() == protoreflect.MessageKind && fd.IsList() {
+				for i := 0; i < v.List().Len(); i++ {
+					unknown(v.List().Get(i).Message())
+				}
+			}
+			return true
+		})
+	}
+	unknown(request)
+
+	fields := request.Descriptor().Fields()
+	timeseries := request.Get(fields.ByName("timeseries")).List()
+	decoded := make([]decodedSeries, 0, timeseries.Len())
+	for i := 0; i < timeseries.Len(); i++ {
+		ts := timeseries.Get(i).Message()
+		tsFields := ts.Descriptor().Fields()
+
+		series := decodedSeries{labels: make(map[string]string)}
+		labels := ts.Get(tsFields.ByName("labels")).List()
+		var names []string
+		for j := 0; j < labels.Len(); j++ {
+			label := labels.Get(j).Message()
+			labelFields := label.Descriptor().Fields()
+			name := label.Get(labelFields.ByName("name")).String()
+			names = append(names, name)
+			series.labels[name] = label.Get(labelFields.ByName("value")).String()
+		}
+		if !sort.StringsAreSorted(names) {
+			t.Errorf("Labels of series %v aren't sorted by name", names)
+		}
+
+		samples := ts.Get(tsFields.ByName("samples")).List()
+		if samples.Len() != 1 {
+			t.Fatalf("Expected one sample in series %v, got %d", series.labels, samples.Len())
+		}
+		sample := samples.Get(0).Message()
+		sampleFields := sample.Descriptor().Fields()
+		series.value = sample.Get(sampleFields.ByName("value")).Float()
+		series.timestamp = sample.Get(sampleFields.ByName("timestamp")).Int()
+		decoded = append(decoded, series)
+	}
+	return decoded
+}
+
+// seriesKey identifies a series by its name and le or quantile label
+func seriesKey(labels map[string]string) string {
+	key := labels["__name__"]
+	if le, ok := labels["le"]; ok {
+		key += "{le=" + le + "}"
+	}
+	if quantile, ok := labels["quantile"]; ok {
+		key += "{quantile=" + quantile + "}"
+	}
+	return key
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_silences_total", Help: "Test counter"}, []string{"node"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_rolling_nodes", Help: "Test gauge"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds", Help: "Test histogram", Buckets: []float64{0.5, 1}})
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "test_latency_seconds", Help: "Test summary", Objectives: map[float64]float64{0.5: 0.05}})
+	registry.MustRegister(counter, gauge, histogram, summary)
+
+	counter.WithLabelValues("worker-0").Add(3)
+	gauge.Set(-2.5)
+	for _, value := range []float64{0.25, 0.75, 2} {
+		histogram.Observe(value)
+	}
+	summary.Observe(4)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	now := time.UnixMilli(1700000000123)
+	decoded := decodeWriteRequest(t, encodeWriteRequest(families, map[string]string{"job": "rollout-helper", "instance": "pod-0"}, now))
+
+	got := make(map[string]decodedSeries, len(decoded))
+	for _, series := range decoded {
+		if series.timestamp != now.UnixMilli() {
+			t.Errorf("Expected timestamp %d for %v, got %d", now.UnixMilli(), series.labels, series.timestamp)
+		}
+		if series.labels["job"] != "rollout-helper" || series.labels["instance"] != "pod-0" {
+			t.Errorf("Expected the job and instance labels on %v", series.labels)
+		}
+		got[seriesKey(series.labels)] = series
+	}
+
+	want := map[string]float64{
+		"test_silences_total":                   3,
+		"test_rolling_nodes":                    -2.5,
+		"test_duration_seconds_bucket{le=0.5}":  1,
+		"test_duration_seconds_bucket{le=1}":    2,
+		"test_duration_seconds_bucket{le=+Inf}": 3,
+		"test_duration_seconds_sum":             3,
+		"test_duration_seconds_count":           3,
+		"test_latency_seconds{quantile=0.5}":    4,
+		"test_latency_seconds_sum":              4,
+		"test_latency_seconds_count":            1,
+	}
+	if len(got) != len(want) {
+		keys := make([]string, 0, len(got))
+		for key := range got {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		t.Fatalf("Expected %d series, got %d: %s", len(want), len(got), strings.Join(keys, ", "))
+	}
+	for key, value := range want {
+		series, ok := got[key]
+		if !ok {
+			t.Errorf("Series %s is missing", key)
+			continue
+		}
+		if series.value != value {
+			t.Errorf("Expected %s to be %g, got %g", key, value, series.value)
+		}
+	}
+	if labels := got["test_silences_total"].labels; labels["node"] != "worker-0" {
+		t.Errorf("Expected the node label on the counter, got %v", labels)
+	}
+}
+
+func TestEncodeWriteRequestSpecialValues(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_value", Help: "Test gauge"}, []string{"case"})
+	registry.MustRegister(gauge)
+	gauge.WithLabelValues("inf").Set(math.Inf(1))
+	gauge.WithLabelValues("nan").Set(math.NaN())
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	for _, series := range decodeWriteRequest(t, encodeWriteRequest(families, nil, time.Now())) {
+		switch series.labels["case"] {
+		case "inf":
+			if !math.IsInf(series.value, 1) {
+				t.Errorf("Expected +Inf, got %g", series.value)
+			}
+		case "nan":
+			if !math.IsNaN(series.value) {
+				t.Errorf("Expected NaN, got %g", series.value)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/scope"
+)
+
+const (
+	// maxNodeEvents is how many events are attached per node
+	maxNodeEvents = 3
+	// nodeEventsMaxAge is how old attached events may be
+	nodeEventsMaxAge = time.Hour
+)
+
+// EventSource returns the most relevant recent events of a node, formatted for responders
+type EventSource func(ctx context.Context, node string) []string
+
+// KubernetesEvents returns the recent events recorded on a node, e.g. drain
+// failures, eviction errors and reboot reasons, listed in the node events
+// namespace of namespaces. Warnings come first, then the most recent events
+func KubernetesEvents(client kubernetes.Interface, namespaces scope.Namespaces) EventSource {
+	return func(ctx context.Context, node string) []string {
+		list, err := client.CoreV1().Events(namespaces.NodeEventsNamespace()).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.Set{
+				"involvedObject.kind": "Node",
+				"involvedObject.name": node,
+			}.String(),
+		})
+		if err != nil {
+			klog.Warningf("Failed to list events of node %s: %v", node, err)
+			return nil
+		}
+
+		now := time.Now()
+		var events []corev1.Event
+		for _, event := range list.Items {
+			if now.Sub(eventTime(event)) <= nodeEventsMaxAge {
+				events = append(events, event)
+			}
+		}
+		sort.Slice(events, func(i, j int) bool {
+			iWarning, jWarning := events[i].Type == corev1.EventTypeWarning, events[j].Type == corev1.EventTypeWarning
+			if iWarning != jWarning {
+				return iWarning
+			}
+			return eventTime(events[i]).After(eventTime(events[j]))
+		})
+		if len(events) > maxNodeEvents {
+			events = events[:maxNodeEvents]
+		}
+
+		lines := make([]string, 0, len(events))
+		for _, event := range events {
+			line := fmt.Sprintf("%s %s: %s (%s ago)", event.Type, event.Reason, event.Message, now.Sub(eventTime(event)).Round(time.Second))
+			if event.Count > 1 {
+				line = fmt.Sprintf("%s %s: %s (x%d, last %s ago)", event.Type, event.Reason, event.Message, event.Count, now.Sub(eventTime(event)).Round(time.Second))
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+}
+
+// eventTime returns when an event was last seen, for both the core and events.k8s.io APIs
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case event.Series != nil:
+		return event.Series.LastObservedTime.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// lifecycleSinkName identifies the lifecycle webhook in metrics
+const lifecycleSinkName = "lifecycle-webhook"
+
+// Reasons of the silence lifecycle events, the same as the reasons of the
+// events recorded on nodes
+const (
+	ReasonSilenceCreated  = "SilenceCreated"
+	ReasonSilenceExtended = "SilenceExtended"
+	ReasonSilenceDeleted  = "SilenceDeleted"
+	ReasonSilenceFailed   = "SilenceFailed"
+)
+
+// DefaultLifecycleReasons are the events posted unless SetReasons is called,
+// extensions are left out as every renewal would post one
+var DefaultLifecycleReasons = []string{ReasonSilenceCreated, ReasonSilenceDeleted, ReasonSilenceFailed}
+
+// LifecycleEvent is a change of the silences of a node
+type LifecycleEvent struct {
+	Reason  string    `json:"reason"`
+	Node    string    `json:"node"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// LifecycleWebhook posts every silence lifecycle event to a URL on its own,
+// unlike the Pipeline which digests rollouts for humans. The body is the
+// event as JSON or rendered by a template, e.g. into the payload of a
+// chatops bot
+type LifecycleWebhook struct {
+	url        string
+	httpClient *http.Client
+	body       *template.Template
+	headers    http.Header
+	reasons    map[string]bool
+	events     chan LifecycleEvent
+}
+
+// NewLifecycleWebhook creates a webhook posting to url
+func NewLifecycleWebhook(url string) *LifecycleWebhook {
+	w := &LifecycleWebhook{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		headers:    http.Header{"Content-Type": []string{"application/json"}},
+		events:     make(chan LifecycleEvent, eventQueueSize),
+	}
+	w.SetReasons(DefaultLifecycleReasons)
+	return w
+}
+
+// SetTemplate renders the body with the Go template text instead of posting
+// the event as JSON. The template gets the LifecycleEvent, and a json
+// function quoting a value for JSON bodies
+func (w *LifecycleWebhook) SetTemplate(text string) error {
+	tmpl, err := template.New("body").Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid lifecycle webhook template: %w", err)
+	}
+	w.body = tmpl
+	return nil
+}
+
+// SetHeaders adds headers given as "Name: value" to every request, values
+// are expanded from the environment, e.g. "Authorization: Bearer $TOKEN"
+func (w *LifecycleWebhook) SetHeaders(headers []string) error {
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid header %q, expected Name: value", header)
+		}
+		w.headers.Set(strings.TrimSpace(name), os.ExpandEnv(strings.TrimSpace(value)))
+	}
+	return nil
+}
+
+// SetReasons selects the events which are posted
+func (w *LifecycleWebhook) SetReasons(reasons []string) {
+	w.reasons = make(map[string]bool, len(reasons))
+	for _, reason := range reasons {
+		w.reasons[reason] = true
+	}
+}
+
+// Fire queues an event without blocking, it's a no-op on a nil webhook
+func (w *LifecycleWebhook) Fire(event LifecycleEvent) {
+	if w == nil || !w.reasons[event.Reason] {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case w.events <- event:
+	default:
+		metrics.NotificationsDropped.WithLabelValues("queue_full").Inc()
+		klog.Warningf("Lifecycle webhook queue is full, dropping %s event of node %s", event.Reason, event.Node)
+	}
+}
+
+// Start posts the queued events in order until ctx is cancelled
+func (w *LifecycleWebhook) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-w.events:
+				if err := w.post(ctx, event); err != nil {
+					metrics.NotificationsSent.WithLabelValues(lifecycleSinkName, "error").Inc()
+					klog.Errorf("Failed to post %s event of node %s to the lifecycle webhook: %v", event.Reason, event.Node, err)
+					continue
+				}
+				metrics.NotificationsSent.WithLabelValues(lifecycleSinkName, "success").Inc()
+			}
+		}
+	}()
+}
+
+func (w *LifecycleWebhook) post(ctx context.Context, event LifecycleEvent) error {
+	var body bytes.Buffer
+	if w.body != nil {
+		if err := w.body.Execute(&body, event); err != nil {
+			return fmt.Errorf("failed to render template: %w", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(event); err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
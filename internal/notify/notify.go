@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// Priority decides which queued messages are delivered first when a sink is rate limited
+type Priority int
+
+const (
+	// PriorityLow is used for updates of messages which were already delivered
+	PriorityLow Priority = iota
+	// PriorityNormal is used for new rollout digests
+	PriorityNormal
+	// PriorityHigh is used for failures on-call needs to know about
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// Kind is the type of an event
+type Kind string
+
+const (
+	KindRolloutStarted  Kind = "RolloutStarted"
+	KindRolloutFinished Kind = "RolloutFinished"
+	KindSilenceFailed   Kind = "SilenceFailed"
+	// KindRolloutStuck is raised by the pipeline for nodes rolling for too long
+	KindRolloutStuck Kind = "RolloutStuck"
+	// KindAlertmanagerUnavailable and KindAlertmanagerRecovered aren't about a
+	// node but the circuit breaker of Alertmanager requests
+	KindAlertmanagerUnavailable Kind = "AlertmanagerUnavailable"
+	KindAlertmanagerRecovered   Kind = "AlertmanagerRecovered"
+)
+
+// Event is something that happened to a node
+type Event struct {
+	Kind Kind
+	Node string
+	// Pool is the MachineConfigPool of the node, rollout events are digested per pool
+	Pool    string
+	Message string
+	Time    time.Time
+	// OSImage and KubeletVersion are the versions the node reported, rollout
+	// digests summarize how they changed
+	OSImage        string
+	KubeletVersion string
+}
+
+// Message is what is delivered to sinks
+type Message struct {
+	// Key identifies the message, messages with the same key replace each
+	// other while queued and update each other once delivered
+	Key      string
+	Title    string
+	Text     string
+	Priority Priority
+	// Final marks the last version of a message, no further updates follow
+	Final bool
+	// Events are recent events of the nodes the message is about
+	Events []string
+	// Silences link the silences of the rolling nodes the message is about
+	Silences []Link
+}
+
+// Link is a named URL
+type Link struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// Sink delivers messages, e.g. to a chat or a webhook
+type Sink interface {
+	// Name identifies the sink in logs and metrics
+	Name() string
+	// Send delivers a new message and returns a reference used to update it
+	Send(ctx context.Context, message Message) (string, error)
+	// Update replaces a delivered message, e.g. by editing it or replying in its thread
+	Update(ctx context.Context, ref string, message Message) error
+}
+
+// SilenceSource returns links to the silences of a node
+type SilenceSource func(node string) []Link
+
+// ProgressSource returns how many nodes of a pool are updated, out of its total
+type ProgressSource func(pool string) (updated, total int64, ok bool)
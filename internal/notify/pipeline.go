@@ -0,0 +1,522 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+const (
+	// eventQueueSize bounds the events waiting to be processed
+	eventQueueSize = 1000
+	// dedupWindow is how long identical high priority events are suppressed
+	dedupWindow = 10 * time.Minute
+	// maxListedNodes caps the node names listed per section of a digest
+	maxListedNodes = 20
+	// maxEventNodes caps the rolling nodes whose events are attached to a digest
+	maxEventNodes = 5
+)
+
+// Pipeline turns node events into messages. Rollout events are digested into
+// one message per pool which is updated as nodes progress, other events are
+// deduplicated and sent on their own. Every sink is rate limited separately
+type Pipeline struct {
+	digestWindow time.Duration
+	events       chan Event
+	sinks        []*sinkQueue
+	nodeEvents   EventSource
+	silences     SilenceSource
+	poolProgress ProgressSource
+	stuckAfter   time.Duration
+
+	// Only used by the run loop
+	digests map[string]*digest
+	recent  map[string]time.Time
+}
+
+// NewPipeline creates a pipeline flushing digests every digestWindow
+func NewPipeline(digestWindow time.Duration) *Pipeline {
+	return &Pipeline{
+		digestWindow: digestWindow,
+		events:       make(chan Event, eventQueueSize),
+		digests:      make(map[string]*digest),
+		recent:       make(map[string]time.Time),
+	}
+}
+
+// AddSink delivers messages to sink, at most perMinute messages per minute
+func (p *Pipeline) AddSink(sink Sink, perMinute int) {
+	p.sinks = append(p.sinks, newSinkQueue(sink, perMinute))
+}
+
+// SetEventSource attaches the recent events of rolling nodes to rollout notifications
+func (p *Pipeline) SetEventSource(source EventSource) {
+	p.nodeEvents = source
+}
+
+// SetSilenceSource links the silences of the rolling nodes in rollout notifications
+func (p *Pipeline) SetSilenceSource(source SilenceSource) {
+	p.silences = source
+}
+
+// SetProgressSource adds the progress of the whole pool to rollout notifications
+func (p *Pipeline) SetProgressSource(source ProgressSource) {
+	p.poolProgress = source
+}
+
+// SetStuckAfter notifies about nodes rolling for longer than d, zero disables it
+func (p *Pipeline) SetStuckAfter(d time.Duration) {
+	p.stuckAfter = d
+}
+
+// Notify queues an event without blocking, it's a no-op on a nil pipeline
+func (p *Pipeline) Notify(event Event) {
+	if p == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case p.events <- event:
+	default:
+		metrics.NotificationsDropped.WithLabelValues("queue_full").Inc()
+		klog.Warningf("Notification queue is full, dropping %s event of node %s", event.Kind, event.Node)
+	}
+}
+
+// Start processes events and delivers messages until ctx is cancelled
+func (p *Pipeline) Start(ctx context.Context) {
+	for _, sink := range p.sinks {
+		go sink.run(ctx)
+	}
+	go p.run(ctx)
+}
+
+func (p *Pipeline) run(ctx context.Context) {
+	ticker := time.NewTicker(p.digestWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-p.events:
+			p.handle(event)
+		case <-ticker.C:
+			p.flush(ctx)
+		}
+	}
+}
+
+func (p *Pipeline) handle(event Event) {
+	switch event.Kind {
+	case KindRolloutStarted, KindRolloutFinished:
+		pool := event.Pool
+		if pool == "" {
+			pool = "unknown"
+		}
+		d, ok := p.digests[pool]
+		if !ok {
+			d = newDigest(pool, event.Time)
+			p.digests[pool] = d
+		}
+		d.add(event)
+	default:
+		key := string(event.Kind) + "/" + event.Node
+		if last, ok := p.recent[key]; ok && event.Time.Sub(last) < dedupWindow {
+			metrics.NotificationsDropped.WithLabelValues("duplicate").Inc()
+			return
+		}
+		p.recent[key] = event.Time
+		title := fmt.Sprintf("%s on node %s", event.Kind, event.Node)
+		if event.Node == "" {
+			title = string(event.Kind)
+		}
+		p.enqueue(Message{
+			Key:      fmt.Sprintf("%s/%d", key, event.Time.UnixNano()),
+			Title:    title,
+			Text:     event.Message,
+			Priority: PriorityHigh,
+			Final:    true,
+		})
+	}
+}
+
+// flush delivers the digests which changed since the last flush and
+// notifies about nodes which got stuck
+func (p *Pipeline) flush(ctx context.Context) {
+	now := time.Now()
+	for pool, d := range p.digests {
+		if d.dirty {
+			message := d.message(p.progressOf(d.pool))
+			if !d.sent {
+				// Events are attached when the rollout starts, updates only track progress
+				message.Events = p.eventsOf(ctx, d.rollingNodes())
+			}
+			message.Silences = p.silencesOf(d.rollingNodes())
+			p.enqueue(message)
+			d.dirty, d.sent = false, true
+		}
+		for node, since := range d.rolling {
+			if p.stuckAfter > 0 && now.Sub(since) >= p.stuckAfter && !d.stuck[node] {
+				d.stuck[node] = true
+				p.enqueue(Message{
+					Key:      fmt.Sprintf("%s/%s/%d", KindRolloutStuck, node, since.UnixNano()),
+					Title:    fmt.Sprintf("Rollout of node %s in pool %s is stuck", node, d.pool),
+					Text:     fmt.Sprintf("Rolling since %s (%s)", since.Format(time.RFC3339), now.Sub(since).Round(time.Minute)),
+					Priority: PriorityHigh,
+					Final:    true,
+					Events:   p.eventsOf(ctx, []string{node}),
+				})
+			}
+		}
+		if d.done() {
+			delete(p.digests, pool)
+		}
+	}
+	for key, last := range p.recent {
+		if now.Sub(last) >= dedupWindow {
+			delete(p.recent, key)
+		}
+	}
+}
+
+// eventsOf returns the recent events of the first nodes, prefixed with the node name
+func (p *Pipeline) eventsOf(ctx context.Context, nodes []string) []string {
+	if p.nodeEvents == nil {
+		return nil
+	}
+	if len(nodes) > maxEventNodes {
+		nodes = nodes[:maxEventNodes]
+	}
+
+	var events []string
+	for _, node := range nodes {
+		for _, event := range p.nodeEvents(ctx, node) {
+			events = append(events, node+": "+event)
+		}
+	}
+	return events
+}
+
+// silencesOf returns the links to the silences of the first nodes, prefixed
+// with the node name
+func (p *Pipeline) silencesOf(nodes []string) []Link {
+	if p.silences == nil {
+		return nil
+	}
+	if len(nodes) > maxListedNodes {
+		nodes = nodes[:maxListedNodes]
+	}
+
+	var links []Link
+	for _, node := range nodes {
+		for _, link := range p.silences(node) {
+			links = append(links, Link{Text: node + ": " + link.Text, URL: link.URL})
+		}
+	}
+	return links
+}
+
+// progressOf describes the progress of a pool, e.g. "node 7 of 42 in pool
+// worker", empty if unknown
+func (p *Pipeline) progressOf(pool string) string {
+	if p.poolProgress == nil {
+		return ""
+	}
+	updated, total, ok := p.poolProgress(pool)
+	if !ok || total == 0 {
+		return ""
+	}
+	if updated >= total {
+		return fmt.Sprintf("all %d nodes in pool %s updated", total, pool)
+	}
+	// The node being updated is the one after the updated ones
+	return fmt.Sprintf("node %d of %d in pool %s", updated+1, total, pool)
+}
+
+func (p *Pipeline) enqueue(message Message) {
+	for _, sink := range p.sinks {
+		sink.enqueue(message)
+	}
+}
+
+// digest summarizes the rollout of one pool
+type digest struct {
+	pool    string
+	started time.Time
+	// rolling maps the rolling nodes to when they started
+	rolling map[string]time.Time
+	// finished maps the finished nodes to how long they rolled, zero if unknown
+	finished map[string]time.Duration
+	// stuck holds the rolling nodes which were reported as stuck
+	stuck map[string]bool
+	// before and after are the versions of the nodes when they started and finished
+	before map[string]nodeVersions
+	after  map[string]nodeVersions
+	dirty  bool
+	sent   bool
+}
+
+type nodeVersions struct {
+	osImage string
+	kubelet string
+}
+
+func newDigest(pool string, started time.Time) *digest {
+	return &digest{
+		pool:     pool,
+		started:  started,
+		rolling:  make(map[string]time.Time),
+		finished: make(map[string]time.Duration),
+		stuck:    make(map[string]bool),
+		before:   make(map[string]nodeVersions),
+		after:    make(map[string]nodeVersions),
+	}
+}
+
+func (d *digest) add(event Event) {
+	versions := nodeVersions{osImage: event.OSImage, kubelet: event.KubeletVersion}
+	if event.Kind == KindRolloutStarted {
+		d.rolling[event.Node] = event.Time
+		delete(d.finished, event.Node)
+		d.before[event.Node] = versions
+		delete(d.after, event.Node)
+	} else {
+		var took time.Duration
+		if started, ok := d.rolling[event.Node]; ok {
+			took = event.Time.Sub(started)
+		}
+		delete(d.rolling, event.Node)
+		d.finished[event.Node] = took
+		d.after[event.Node] = versions
+	}
+	delete(d.stuck, event.Node)
+	d.dirty = true
+}
+
+// rollingNodes returns the names of the rolling nodes, sorted
+func (d *digest) rollingNodes() []string {
+	names := make([]string, 0, len(d.rolling))
+	for name := range d.rolling {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// done reports whether every node of the digest finished and the final version was queued
+func (d *digest) done() bool {
+	return len(d.rolling) == 0 && !d.dirty
+}
+
+// message summarizes the digest, progress describes the progress of the whole pool if known
+func (d *digest) message(progress string) Message {
+	total := len(d.rolling) + len(d.finished)
+	title := fmt.Sprintf("Rollout of pool %s: %d/%d nodes done", d.pool, len(d.finished), total)
+	if len(d.rolling) == 0 {
+		title = fmt.Sprintf("Rollout of pool %s finished: %d nodes", d.pool, total)
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Started %s\n", d.started.Format(time.RFC3339))
+	if progress != "" {
+		fmt.Fprintf(&text, "Progress: %s\n", progress)
+	}
+	if len(d.rolling) > 0 {
+		fmt.Fprintf(&text, "Rolling: %s\n", listNames(d.rollingNodes()))
+	}
+	if len(d.finished) > 0 {
+		fmt.Fprintf(&text, "Done: %s\n", listNames(d.finishedNodes()))
+	}
+	for _, line := range d.versionChanges("Image", func(v nodeVersions) string { return v.osImage }) {
+		fmt.Fprintf(&text, "%s\n", line)
+	}
+	for _, line := range d.versionChanges("Kubelet", func(v nodeVersions) string { return v.kubelet }) {
+		fmt.Fprintf(&text, "%s\n", line)
+	}
+
+	priority := PriorityNormal
+	if d.sent {
+		priority = PriorityLow
+	}
+	return Message{
+		Key:      fmt.Sprintf("pool/%s/%d", d.pool, d.started.UnixNano()),
+		Title:    title,
+		Text:     strings.TrimSuffix(text.String(), "\n"),
+		Priority: priority,
+		Final:    len(d.rolling) == 0,
+	}
+}
+
+// versionChanges summarizes how a version of the finished nodes changed,
+// e.g. "Image: RHCOS 414.92.1 -> RHCOS 414.92.2 (3 nodes)", counting the
+// nodes of each change
+func (d *digest) versionChanges(label string, version func(nodeVersions) string) []string {
+	counts := make(map[string]int)
+	for node := range d.finished {
+		after := version(d.after[node])
+		if after == "" {
+			continue
+		}
+		before, ok := d.before[node]
+		switch {
+		case !ok || version(before) == "":
+			counts[fmt.Sprintf("%s: unknown -> %s", label, after)]++
+		case version(before) == after:
+			counts[fmt.Sprintf("%s unchanged: %s", label, after)]++
+		default:
+			counts[fmt.Sprintf("%s: %s -> %s", label, version(before), after)]++
+		}
+	}
+
+	lines := make([]string, 0, len(counts))
+	for change, count := range counts {
+		if count == 1 {
+			lines = append(lines, change+" (1 node)")
+		} else {
+			lines = append(lines, fmt.Sprintf("%s (%d nodes)", change, count))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// finishedNodes returns the names of the finished nodes with how long they
+// rolled, e.g. "worker-1 (12m0s)", sorted
+func (d *digest) finishedNodes() []string {
+	names := make([]string, 0, len(d.finished))
+	for name := range d.finished {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if took := d.finished[name]; took > 0 {
+			names[i] = fmt.Sprintf("%s (%s)", name, took.Round(time.Minute))
+		}
+	}
+	return names
+}
+
+// listNames joins sorted node names, capped at maxListedNodes
+func listNames(names []string) string {
+	if len(names) > maxListedNodes {
+		return fmt.Sprintf("%s (+%d more)", strings.Join(names[:maxListedNodes], ", "), len(names)-maxListedNodes)
+	}
+	return strings.Join(names, ", ")
+}
+
+// sinkQueue holds the messages waiting for a rate limited sink. A queued
+// message is replaced by newer versions with the same key
+type sinkQueue struct {
+	sink    Sink
+	limiter *rate.Limiter
+	wake    chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]Message
+	order   []string
+	// refs maps keys of delivered messages to the sink's reference for updates
+	refs map[string]string
+}
+
+func newSinkQueue(sink Sink, perMinute int) *sinkQueue {
+	return &sinkQueue{
+		sink:    sink,
+		limiter: rate.NewLimiter(rate.Limit(float64(perMinute)/60), perMinute),
+		wake:    make(chan struct{}, 1),
+		pending: make(map[string]Message),
+		refs:    make(map[string]string),
+	}
+}
+
+func (q *sinkQueue) enqueue(message Message) {
+	q.mu.Lock()
+	if _, queued := q.pending[message.Key]; queued {
+		metrics.NotificationsDropped.WithLabelValues("superseded").Inc()
+	} else {
+		q.order = append(q.order, message.Key)
+	}
+	q.pending[message.Key] = message
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes the oldest queued message of the highest priority
+func (q *sinkQueue) next() (Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	best := -1
+	for i, key := range q.order {
+		if best < 0 || q.pending[key].Priority > q.pending[q.order[best]].Priority {
+			best = i
+		}
+	}
+	if best < 0 {
+		return Message{}, false
+	}
+
+	key := q.order[best]
+	message := q.pending[key]
+	delete(q.pending, key)
+	q.order = append(q.order[:best], q.order[best+1:]...)
+	return message, true
+}
+
+func (q *sinkQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+
+		for {
+			message, ok := q.next()
+			if !ok {
+				break
+			}
+			if err := q.limiter.Wait(ctx); err != nil {
+				return
+			}
+			q.deliver(ctx, message)
+		}
+	}
+}
+
+func (q *sinkQueue) deliver(ctx context.Context, message Message) {
+	ref, delivered := q.refs[message.Key]
+	var err error
+	if delivered {
+		err = q.sink.Update(ctx, ref, message)
+	} else {
+		ref, err = q.sink.Send(ctx, message)
+	}
+	if err != nil {
+		metrics.NotificationsSent.WithLabelValues(q.sink.Name(), "error").Inc()
+		klog.Errorf("Failed to deliver notification %q to %s: %v", message.Title, q.sink.Name(), err)
+		return
+	}
+	metrics.NotificationsSent.WithLabelValues(q.sink.Name(), "success").Inc()
+
+	if message.Final {
+		delete(q.refs, message.Key)
+	} else {
+		q.refs[message.Key] = ref
+	}
+}
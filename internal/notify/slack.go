@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// slackAPIURL is the base URL of the Slack Web API
+const slackAPIURL = "https://slack.com/api"
+
+// SlackSink posts messages to a Slack channel with a bot token. Updates edit
+// the posted message, so a rollout stays a single message in the channel
+type SlackSink struct {
+	token      string
+	channel    string
+	httpClient *http.Client
+}
+
+// slackMessage is the body of chat.postMessage and chat.update
+type slackMessage struct {
+	Channel string `json:"channel"`
+	TS      string `json:"ts,omitempty"`
+	Text    string `json:"text"`
+	// UnfurlLinks is disabled, the links to silences would fill the channel
+	UnfurlLinks bool `json:"unfurl_links"`
+}
+
+// slackResponse is the common part of Web API responses
+type slackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	TS      string `json:"ts,omitempty"`
+}
+
+// NewSlackSink creates a sink posting to channel, a channel name or ID the
+// bot was invited to
+func NewSlackSink(token, channel string) *SlackSink {
+	return &SlackSink{
+		token:      token,
+		channel:    channel,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *SlackSink) Name() string {
+	return "slack"
+}
+
+// Send posts the message and returns the channel ID and timestamp of the post
+func (s *SlackSink) Send(ctx context.Context, message Message) (string, error) {
+	resp, err := s.call(ctx, "chat.postMessage", slackMessage{Channel: s.channel, Text: slackText(message)})
+	if err != nil {
+		return "", err
+	}
+	return resp.Channel + "/" + resp.TS, nil
+}
+
+// Update edits the post referenced by ref
+func (s *SlackSink) Update(ctx context.Context, ref string, message Message) error {
+	channel, ts, ok := strings.Cut(ref, "/")
+	if !ok {
+		return fmt.Errorf("invalid Slack message reference %q", ref)
+	}
+	_, err := s.call(ctx, "chat.update", slackMessage{Channel: channel, TS: ts, Text: slackText(message)})
+	return err
+}
+
+// call invokes a Web API method, which reports failures in the body
+func (s *SlackSink) call(ctx context.Context, method string, message slackMessage) (*slackResponse, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", slackAPIURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	var response slackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !response.OK {
+		return nil, fmt.Errorf("%s failed: %s", method, response.Error)
+	}
+	return &response, nil
+}
+
+// slackText formats a message as Slack mrkdwn
+func slackText(message Message) string {
+	var text strings.Builder
+	if message.Priority == PriorityHigh {
+		text.WriteString(":rotating_light: ")
+	}
+	fmt.Fprintf(&text, "*%s*\n%s", slackEscape(message.Title), slackEscape(message.Text))
+	if len(message.Silences) > 0 {
+		links := make([]string, 0, len(message.Silences))
+		for _, link := range message.Silences {
+			links = append(links, fmt.Sprintf("<%s|%s>", link.URL, slackEscape(link.Text)))
+		}
+		fmt.Fprintf(&text, "\nSilences: %s", strings.Join(links, ", "))
+	}
+	for _, event := range message.Events {
+		fmt.Fprintf(&text, "\n> %s", slackEscape(event))
+	}
+	return text.String()
+}
+
+// slackEscape escapes the characters Slack treats as control sequences
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSink posts messages as JSON to a URL. Updates are posted again with
+// the same key and update set, receivers replace the message with that key
+type WebhookSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+// webhookPayload is the body posted to the webhook
+type webhookPayload struct {
+	Key      string   `json:"key"`
+	Title    string   `json:"title"`
+	Text     string   `json:"text"`
+	Priority string   `json:"priority"`
+	Update   bool     `json:"update"`
+	Final    bool     `json:"final"`
+	Events   []string `json:"events,omitempty"`
+	Silences []Link   `json:"silences,omitempty"`
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Send(ctx context.Context, message Message) (string, error) {
+	return message.Key, s.post(ctx, message, false)
+}
+
+func (s *WebhookSink) Update(ctx context.Context, _ string, message Message) error {
+	return s.post(ctx, message, true)
+}
+
+func (s *WebhookSink) post(ctx context.Context, message Message, update bool) error {
+	body, err := json.Marshal(webhookPayload{
+		Key:      message.Key,
+		Title:    message.Title,
+		Text:     message.Text,
+		Priority: message.Priority.String(),
+		Update:   update,
+		Final:    message.Final,
+		Events:   message.Events,
+		Silences: message.Silences,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/config"
+)
+
+// resyncInterval is how often RolloutSilencePolicy objects are reconciled
+const resyncInterval = time.Minute
+
+// Target receives the reconciled policies and pod targets, and the objects
+// declaring the policies to record events about their silences on. It
+// reports the silences of the policies
+type Target interface {
+	SetDeclared(policies []config.Policy, targets []alertmanager.PodTarget, owners map[string]*corev1.ObjectReference)
+	Silences() map[string][]alertmanager.TrackedSilence
+	LastErrors() map[string]alertmanager.NodeError
+}
+
+// Controller reconciles RolloutSilencePolicy objects into the silence manager
+type Controller struct {
+	client    dynamic.Interface
+	k8sClient kubernetes.Interface
+	target    Target
+	// notInstalled is set while the CRD doesn't exist, to log it only once
+	notInstalled bool
+}
+
+// NewController creates a controller reconciling RolloutSilencePolicy objects into target
+func NewController(client dynamic.Interface, k8sClient kubernetes.Interface, target Target) *Controller {
+	return &Controller{
+		client:    client,
+		k8sClient: k8sClient,
+		target:    target,
+	}
+}
+
+// Start reconciles the policies now and then periodically
+func (c *Controller) Start(ctx context.Context) {
+	c.reconcile(ctx)
+
+	go func() {
+		ticker := time.NewTicker(resyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.reconcile(ctx)
+			}
+		}
+	}()
+}
+
+// reconcile lists all RolloutSilencePolicy objects, hands their valid
+// policies and daemonsets to the target and reports problems and the
+// silences of their policies in their status. On errors listing the objects
+// the previously reconciled state is kept
+func (c *Controller) reconcile(ctx context.Context) {
+	list, err := c.client.Resource(RolloutSilencePolicyResource).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		if !c.notInstalled {
+			klog.Warningf("The RolloutSilencePolicy CRD is not installed, no policies are declared")
+			c.notInstalled = true
+		}
+		c.target.SetDeclared(nil, nil, nil)
+		return
+	}
+	if err != nil {
+		klog.Errorf("Failed to list RolloutSilencePolicies: %v", err)
+		return
+	}
+	c.notInstalled = false
+
+	objects, errors := decode(list.Items)
+	for name, err := range errors {
+		klog.Errorf("Ignoring RolloutSilencePolicy %s: %s", name, err[0])
+	}
+	policies, invalid := Policies(objects)
+	var targets []alertmanager.PodTarget
+	owners := make(map[string]*corev1.ObjectReference)
+	for _, object := range objects {
+		if err, ok := invalid[object.Name]; ok {
+			klog.Errorf("Ignoring RolloutSilencePolicy %s: %v", object.Name, err)
+			errors[object.Name] = append(errors[object.Name], err.Error())
+			continue
+		}
+		for _, policy := range object.Spec.Policies {
+			owners[policy.Name] = objectRef(object)
+		}
+
+		for _, ds := range object.Spec.DaemonSets {
+			target, err := c.podTarget(ctx, ds)
+			if err != nil {
+				klog.Errorf("Ignoring daemonset %s/%s of RolloutSilencePolicy %s: %v", ds.Namespace, ds.Name, object.Name, err)
+				errors[object.Name] = append(errors[object.Name], fmt.Sprintf("daemonset %s/%s: %v", ds.Namespace, ds.Name, err))
+				continue
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	klog.V(2).Infof("Reconciled %d RolloutSilencePolicies: %d policies, %d daemonsets", len(objects), len(policies), len(targets))
+	c.target.SetDeclared(policies, targets, owners)
+
+	silences := c.target.Silences()
+	failures := c.target.LastErrors()
+	for i := range list.Items {
+		item := &list.Items[i]
+		status := RolloutSilencePolicyStatus{
+			ObservedGeneration: item.GetGeneration(),
+			Errors:             errors[item.GetName()],
+			Nodes:              nodeStatuses(item.GetName(), owners, silences, failures),
+		}
+		if err := UpdateStatus(ctx, c.client, RolloutSilencePolicyResource, item, &status); err != nil {
+			klog.Errorf("Failed to report status of RolloutSilencePolicy %s: %v", item.GetName(), err)
+		}
+	}
+}
+
+// nodeStatuses returns the nodes with silences of the policies the object
+// declares, sorted by name
+func nodeStatuses(object string, owners map[string]*corev1.ObjectReference, silences map[string][]alertmanager.TrackedSilence, failures map[string]alertmanager.NodeError) []NodeStatus {
+	var nodes []NodeStatus
+	for name, tracked := range silences {
+		node := NodeStatus{Name: name}
+		for _, silence := range tracked {
+			if owner, ok := owners[silence.Policy]; ok && owner.Name == object {
+				node.Silences = append(node.Silences, silence)
+			}
+		}
+		if len(node.Silences) == 0 {
+			continue
+		}
+		if failure, ok := failures[name]; ok {
+			node.LastError = &failure
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+// objectRef references an object for events
+func objectRef(object RolloutSilencePolicy) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: Group + "/" + Version,
+		Kind:       "RolloutSilencePolicy",
+		Name:       object.Name,
+		UID:        object.UID,
+	}
+}
+
+// Policies returns the policies of all valid objects and the errors of the
+// invalid ones by object name. Policy names must be unique across objects so
+// pools and nodes can override them by name
+func Policies(objects []RolloutSilencePolicy) ([]config.Policy, map[string]error) {
+	var policies []config.Policy
+	invalid := make(map[string]error)
+	owners := make(map[string]string)
+	for _, object := range objects {
+		if err := validate(object, owners); err != nil {
+			invalid[object.Name] = err
+			continue
+		}
+		for _, policy := range object.Spec.Policies {
+			owners[policy.Name] = object.Name
+		}
+		policies = append(policies, object.Spec.Policies...)
+	}
+	return policies, invalid
+}
+
+// validate compiles the policies of an object, owners maps the names of the
+// policies seen so far to their object
+func validate(object RolloutSilencePolicy, owners map[string]string) error {
+	if err := config.CompilePolicies(object.Spec.Policies); err != nil {
+		return err
+	}
+	for _, policy := range object.Spec.Policies {
+		if owner, ok := owners[policy.Name]; ok {
+			return fmt.Errorf("policy %s is already declared by %s", policy.Name, owner)
+		}
+	}
+	return nil
+}
+
+// podTarget resolves the pod selector of a declared daemonset
+func (c *Controller) podTarget(ctx context.Context, ds DaemonSetTarget) (alertmanager.PodTarget, error) {
+	target := alertmanager.PodTarget{Namespace: ds.Namespace, DaemonSet: ds.Name, Selector: ds.Selector}
+	if ds.Namespace == "" || ds.Name == "" {
+		return target, fmt.Errorf("namespace and name are required")
+	}
+
+	if ds.Selector != "" {
+		if _, err := labels.Parse(ds.Selector); err != nil {
+			return target, fmt.Errorf("invalid selector: %w", err)
+		}
+		return target, nil
+	}
+
+	daemonSet, err := c.k8sClient.AppsV1().DaemonSets(ds.Namespace).Get(ctx, ds.Name, metav1.GetOptions{})
+	if err != nil {
+		return target, fmt.Errorf("failed to get daemonset: %w", err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(daemonSet.Spec.Selector)
+	if err != nil || selector.Empty() {
+		return target, fmt.Errorf("invalid selector: %v", err)
+	}
+	target.Selector = selector.String()
+	return target, nil
+}
+
+// List returns all RolloutSilencePolicy objects sorted by name
+func List(ctx context.Context, client dynamic.Interface) ([]RolloutSilencePolicy, error) {
+	list, err := client.Resource(RolloutSilencePolicyResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	objects, errors := decode(list.Items)
+	for name, err := range errors {
+		klog.Errorf("Ignoring RolloutSilencePolicy %s: %s", name, err[0])
+	}
+	return objects, nil
+}
+
+// decode returns the objects sorted by name, and the errors of the objects
+// which couldn't be decoded by name
+func decode(items []unstructured.Unstructured) ([]RolloutSilencePolicy, map[string][]string) {
+	objects := make([]RolloutSilencePolicy, 0, len(items))
+	errors := make(map[string][]string)
+	for i := range items {
+		object, err := fromUnstructured(&items[i])
+		if err != nil {
+			errors[items[i].GetName()] = []string{err.Error()}
+			continue
+		}
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, errors
+}
+
+// fromUnstructured decodes an object through JSON, the unstructured converter
+// can't handle the unexported fields of config.Matcher
+func fromUnstructured(item *unstructured.Unstructured) (RolloutSilencePolicy, error) {
+	var object RolloutSilencePolicy
+	data, err := item.MarshalJSON()
+	if err != nil {
+		return object, fmt.Errorf("failed to encode: %w", err)
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return object, fmt.Errorf("failed to decode: %w", err)
+	}
+	return object, nil
+}
@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"rollout-helper/internal/alertmanager"
+)
+
+// NodeStatus is the silencing of a node reported in the status of a custom resource
+type NodeStatus struct {
+	Name      string                        `json:"name"`
+	Silences  []alertmanager.TrackedSilence `json:"silences,omitempty"`
+	LastError *alertmanager.NodeError       `json:"lastError,omitempty"`
+}
+
+// UpdateStatus writes status, a pointer to the status struct, to the status
+// subresource of item unless it is unchanged
+func UpdateStatus(ctx context.Context, client dynamic.Interface, resource schema.GroupVersionResource, item *unstructured.Unstructured, status interface{}) error {
+	value, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return fmt.Errorf("failed to encode status: %w", err)
+	}
+	if equality.Semantic.DeepEqual(item.Object["status"], value) {
+		return nil
+	}
+
+	updated := item.DeepCopy()
+	updated.Object["status"] = value
+	_, err = client.Resource(resource).Namespace(item.GetNamespace()).UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
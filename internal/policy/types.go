@@ -0,0 +1,56 @@
+package policy
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"rollout-helper/internal/config"
+)
+
+// Group and version of the rollout helper's custom resources
+const (
+	Group   = "rollout-helper.snappcloud.io"
+	Version = "v1alpha1"
+)
+
+// RolloutSilencePolicyResource is the cluster-scoped RolloutSilencePolicy resource
+var RolloutSilencePolicyResource = schema.GroupVersionResource{
+	Group:    Group,
+	Version:  Version,
+	Resource: "rolloutsilencepolicies",
+}
+
+// RolloutSilencePolicy declares the alerts and daemonsets silenced while nodes are rolling
+type RolloutSilencePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RolloutSilencePolicySpec   `json:"spec"`
+	Status RolloutSilencePolicyStatus `json:"status,omitempty"`
+}
+
+// RolloutSilencePolicySpec is the desired silencing of a RolloutSilencePolicy
+type RolloutSilencePolicySpec struct {
+	// Policies are merged into the cluster-wide policies of the configuration
+	// file and may be overridden per pool and node like those
+	Policies []config.Policy `json:"policies,omitempty"`
+	// DaemonSets whose pods on a rolling node are silenced
+	DaemonSets []DaemonSetTarget `json:"daemonSets,omitempty"`
+}
+
+// RolloutSilencePolicyStatus reports whether the helper applied a RolloutSilencePolicy
+type RolloutSilencePolicyStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Errors explain why the object or some of its daemonsets are ignored
+	Errors []string `json:"errors,omitempty"`
+	// Nodes are the nodes with silences of the object's policies
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+}
+
+// DaemonSetTarget names a DaemonSet whose pods are silenced
+type DaemonSetTarget struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Selector of the DaemonSet's pods, taken from the DaemonSet if empty
+	Selector string `json:"selector,omitempty"`
+}
@@ -0,0 +1,126 @@
+// Package prometheus runs instant queries against Prometheus or the Thanos
+// querier, e.g. to check the scrape targets of a node are up again
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// serviceAccountTokenFile authenticates the queries without a token
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// serviceCAFile is the CA of OpenShift service certificates, e.g. of the thanos-querier
+	serviceCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+)
+
+// Sample is an element of the instant vector a query returned
+type Sample struct {
+	Metric map[string]string
+	Value  float64
+}
+
+// Client queries the Prometheus HTTP API
+type Client struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the Prometheus at rawURL. Queries are
+// authenticated with token, or the service account token if it's empty, and
+// Prometheus is trusted with the system roots and the OpenShift service CA
+// if it's mounted
+func NewClient(rawURL, token string) (*Client, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus URL: %w", err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if ca, err := os.ReadFile(serviceCAFile); err == nil {
+		roots.AppendCertsFromPEM(ca)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+
+	return &Client{
+		url:   strings.TrimSuffix(rawURL, "/"),
+		token: token,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: transport,
+		},
+	}, nil
+}
+
+// queryResponse is the part of an instant query response the client reads
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			// Value is the timestamp and the value as a string
+			Value [2]interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// Query runs an instant query which has to return a vector
+func (c *Client) Query(ctx context.Context, query string) ([]Sample, error) {
+	endpoint := c.url + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	token := c.token
+	if token == "" {
+		if data, err := os.ReadFile(serviceAccountTokenFile); err == nil {
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("unexpected response with status %d: %w", resp.StatusCode, err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("query failed with status %d: %s", resp.StatusCode, response.Error)
+	}
+	if response.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("expected a vector, got a %s", response.Data.ResultType)
+	}
+
+	samples := make([]Sample, 0, len(response.Data.Result))
+	for _, result := range response.Data.Result {
+		raw, _ := result.Value[1].(string)
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample value %q: %w", raw, err)
+		}
+		samples = append(samples, Sample{Metric: result.Metric, Value: value})
+	}
+	return samples, nil
+}
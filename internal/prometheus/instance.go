@@ -0,0 +1,27 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// InstancePattern matches the instance label of targets on the node, which
+// is the node name or one of its InternalIPs, optionally followed by a port
+func InstancePattern(node *corev1.Node) string {
+	hosts := []string{regexp.QuoteMeta(node.Name)}
+	for _, address := range node.Status.Addresses {
+		if address.Type != corev1.NodeInternalIP {
+			continue
+		}
+		host := regexp.QuoteMeta(address.Address)
+		if strings.Contains(address.Address, ":") {
+			// IPv6 instances are bracketed, e.g. [fd00::1]:9100
+			host = `\[` + host + `\]`
+		}
+		hosts = append(hosts, host)
+	}
+	return fmt.Sprintf("(%s)(:[0-9]+)?", strings.Join(hosts, "|"))
+}
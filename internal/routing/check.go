@@ -0,0 +1,137 @@
+package routing
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/scope"
+)
+
+// checkInterval is how often the routing labels are discovered and the policies checked
+const checkInterval = 10 * time.Minute
+
+// Finding is a policy whose silences aren't scoped by a routing label
+type Finding struct {
+	Policy string
+	// Pool is the MachineConfigPool the policy was resolved for, empty for the cluster layer
+	Pool  string
+	Label string
+	// Source is where a route matching on the label was found
+	Source string
+}
+
+// Check returns the routing labels the effective policies of the cluster
+// and of every pool have no matcher on
+func Check(cfg *config.Config, keys Keys) []Finding {
+	pools := []string{""}
+	for pool := range cfg.Pools {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+
+	var findings []Finding
+	seen := make(map[Finding]bool)
+	for _, pool := range pools {
+		for _, policy := range cfg.ResolvePolicies(pool, nil) {
+			matched := make(map[string]bool, len(policy.Matchers))
+			for _, matcher := range policy.Matchers {
+				matched[matcher.Name] = true
+			}
+			for _, label := range keys.Names() {
+				if matched[label] {
+					continue
+				}
+				// Pools inheriting a cluster policy unchanged report it once
+				finding := Finding{Policy: policy.Name, Pool: pool, Label: label, Source: keys[label]}
+				if pool != "" && policy.Source == config.LayerCluster && seen[Finding{Policy: policy.Name, Label: label, Source: keys[label]}] {
+					continue
+				}
+				seen[finding] = true
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// Checker periodically discovers the routing labels and warns about policies
+// which aren't scoped by them
+type Checker struct {
+	client        kubernetes.Interface
+	dynamicClient dynamic.Interface
+	secret        string
+	namespaces    scope.Namespaces
+	config        func() *config.Config
+	// warned are the findings which were logged already, only used by check
+	warned map[Finding]bool
+}
+
+// NewChecker checks the policies returned by cfg against the routes of the
+// AlertmanagerConfig objects and of the configuration in secret, if set
+func NewChecker(client kubernetes.Interface, dynamicClient dynamic.Interface, secret string, cfg func() *config.Config) *Checker {
+	return &Checker{
+		client:        client,
+		dynamicClient: dynamicClient,
+		secret:        secret,
+		config:        cfg,
+		warned:        make(map[Finding]bool),
+	}
+}
+
+// SetNamespaces restricts the namespaces AlertmanagerConfigs are listed in,
+// for namespace-scoped permissions. It must be called before Start
+func (c *Checker) SetNamespaces(namespaces scope.Namespaces) {
+	c.namespaces = namespaces
+}
+
+// Start checks the policies now and then periodically until ctx is cancelled
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		c.check(ctx)
+
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.check(ctx)
+			}
+		}
+	}()
+}
+
+func (c *Checker) check(ctx context.Context) {
+	keys, err := Discover(ctx, c.client, c.dynamicClient, c.namespaces, c.secret)
+	if err != nil {
+		// Keep the last findings, the routes rarely change
+		klog.Errorf("Failed to discover the routing labels: %v", err)
+		return
+	}
+	klog.V(2).Infof("Alerts are routed by the labels %v", keys.Names())
+
+	findings := Check(c.config(), keys)
+	current := make(map[Finding]bool, len(findings))
+	metrics.PolicyRoutingLabelMissing.Reset()
+	for _, finding := range findings {
+		current[finding] = true
+		metrics.PolicyRoutingLabelMissing.WithLabelValues(finding.Policy, finding.Pool, finding.Label).Set(1)
+		if c.warned[finding] {
+			continue
+		}
+		pool := ""
+		if finding.Pool != "" {
+			pool = " of pool " + finding.Pool
+		}
+		klog.Warningf("Policy %s%s has no matcher on %s, which %s routes by: its silences cover the alerts of every %s", finding.Policy, pool, finding.Label, finding.Source, finding.Label)
+	}
+	c.warned = current
+}
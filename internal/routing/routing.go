@@ -0,0 +1,158 @@
+// Package routing learns which labels drive the routing of alerts from the
+// Alertmanager configuration and warns about silence policies which don't
+// scope their silences by them, e.g. a policy without a team matcher silences
+// the alerts of every team's route
+package routing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	"rollout-helper/internal/scope"
+)
+
+// AlertmanagerConfigResource are the AlertmanagerConfig objects of the Prometheus Operator
+var AlertmanagerConfigResource = schema.GroupVersionResource{
+	Group:    "monitoring.coreos.com",
+	Version:  "v1alpha1",
+	Resource: "alertmanagerconfigs",
+}
+
+// ConfigSecretKey is the key of the Alertmanager configuration in its Secret
+const ConfigSecretKey = "alertmanager.yaml"
+
+// ignoredLabels select alerts rather than the route of their owners, silences
+// are scoped by them on purpose or not at all
+var ignoredLabels = map[string]bool{
+	"alertname": true,
+	"severity":  true,
+}
+
+// Keys maps the labels routes match on to where the first route matching on
+// them was found
+type Keys map[string]string
+
+// Names returns the sorted label names
+func (k Keys) Names() []string {
+	names := make([]string, 0, len(k))
+	for name := range k {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (k Keys) add(name, source string) {
+	if ignoredLabels[name] {
+		return
+	}
+	if _, ok := k[name]; !ok {
+		k[name] = source
+	}
+}
+
+// Discover returns the labels the routes of the AlertmanagerConfig objects in
+// namespaces and of the Alertmanager configuration in secret ("namespace/name",
+// empty to skip it) match on. AlertmanagerConfigs which aren't installed are
+// skipped
+func Discover(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, namespaces scope.Namespaces, secret string) (Keys, error) {
+	keys := make(Keys)
+
+	list, err := namespaces.List(ctx, dynamicClient.Resource(AlertmanagerConfigResource), metav1.ListOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list AlertmanagerConfigs: %w", err)
+	}
+	if err == nil {
+		for _, item := range list.Items {
+			source := fmt.Sprintf("AlertmanagerConfig %s/%s", item.GetNamespace(), item.GetName())
+			// The operator scopes the routes of every AlertmanagerConfig to its namespace
+			keys.add("namespace", source)
+			if route, found, _ := unstructured.NestedMap(item.Object, "spec", "route"); found {
+				walkObjectRoute(route, keys, source)
+			}
+		}
+	}
+
+	if secret != "" {
+		namespace, name, ok := strings.Cut(secret, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid Alertmanager config secret %q, expected namespace/name", secret)
+		}
+		object, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Alertmanager config secret: %w", err)
+		}
+		var cfg struct {
+			Route *configRoute `json:"route"`
+		}
+		if err := yaml.Unmarshal(object.Data[ConfigSecretKey], &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s of secret %s: %w", ConfigSecretKey, secret, err)
+		}
+		if cfg.Route != nil {
+			if err := cfg.Route.walk(keys, "Secret "+secret); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return keys, nil
+}
+
+// walkObjectRoute collects the matchers of an AlertmanagerConfig route and its children
+func walkObjectRoute(route map[string]interface{}, keys Keys, source string) {
+	matchers, _ := route["matchers"].([]interface{})
+	for _, matcher := range matchers {
+		if matcher, ok := matcher.(map[string]interface{}); ok {
+			if name, ok := matcher["name"].(string); ok {
+				keys.add(name, source)
+			}
+		}
+	}
+	children, _ := route["routes"].([]interface{})
+	for _, child := range children {
+		if child, ok := child.(map[string]interface{}); ok {
+			walkObjectRoute(child, keys, source)
+		}
+	}
+}
+
+// configRoute is a route of the Alertmanager configuration file
+type configRoute struct {
+	Match    map[string]string `json:"match,omitempty"`
+	MatchRE  map[string]string `json:"match_re,omitempty"`
+	Matchers []string          `json:"matchers,omitempty"`
+	Routes   []configRoute     `json:"routes,omitempty"`
+}
+
+// walk collects the matchers of the route and its children
+func (r *configRoute) walk(keys Keys, source string) error {
+	for name := range r.Match {
+		keys.add(name, source)
+	}
+	for name := range r.MatchRE {
+		keys.add(name, source)
+	}
+	for _, text := range r.Matchers {
+		matcher, err := labels.ParseMatcher(text)
+		if err != nil {
+			return fmt.Errorf("invalid matcher %q in %s: %w", text, source, err)
+		}
+		keys.add(matcher.Name, source)
+	}
+	for i := range r.Routes {
+		if err := r.Routes[i].walk(keys, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package scope restricts the namespaced objects the helper lists to a set of
+// namespaces, for deployments granted namespace-scoped permissions only
+// instead of listing pods and daemonsets cluster-wide
+package scope
+
+import (
+	"context"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Namespaces are the namespaces objects are listed in, all of them if empty
+type Namespaces []string
+
+// Parse returns the namespaces of a comma-separated list
+func Parse(value string) Namespaces {
+	var namespaces Namespaces
+	for _, namespace := range strings.Split(value, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// All reports whether objects are listed cluster-wide
+func (n Namespaces) All() bool {
+	return len(n) == 0
+}
+
+// Contains reports whether objects of the namespace may be listed
+func (n Namespaces) Contains(namespace string) bool {
+	if n.All() {
+		return true
+	}
+	for _, allowed := range n {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// ListPods lists pods in all namespaces with one request, or in each of the
+// namespaces
+func (n Namespaces) ListPods(ctx context.Context, client kubernetes.Interface, options metav1.ListOptions) (*corev1.PodList, error) {
+	if n.All() {
+		return client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, options)
+	}
+	list := &corev1.PodList{}
+	for _, namespace := range n {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, pods.Items...)
+	}
+	return list, nil
+}
+
+// ListDaemonSets lists daemonsets in all namespaces with one request, or in
+// each of the namespaces
+func (n Namespaces) ListDaemonSets(ctx context.Context, client kubernetes.Interface, options metav1.ListOptions) (*appsv1.DaemonSetList, error) {
+	if n.All() {
+		return client.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, options)
+	}
+	list := &appsv1.DaemonSetList{}
+	for _, namespace := range n {
+		daemonSets, err := client.AppsV1().DaemonSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, daemonSets.Items...)
+	}
+	return list, nil
+}
+
+// List lists namespaced custom objects in all namespaces with one request, or
+// in each of the namespaces
+func (n Namespaces) List(ctx context.Context, resource dynamic.NamespaceableResourceInterface, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	if n.All() {
+		return resource.Namespace(metav1.NamespaceAll).List(ctx, options)
+	}
+	list := &unstructured.UnstructuredList{}
+	for _, namespace := range n {
+		objects, err := resource.Namespace(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, objects.Items...)
+	}
+	return list, nil
+}
+
+// NodeEventsNamespace returns the namespace the events of nodes are listed
+// in. Kubernetes records them in the default namespace, a cluster-wide list
+// also finds the ones recorded elsewhere
+func (n Namespaces) NodeEventsNamespace() string {
+	if n.All() {
+		return metav1.NamespaceAll
+	}
+	return metav1.NamespaceDefault
+}
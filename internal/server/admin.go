@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"rollout-helper/internal/alertmanager"
+)
+
+// Admin runs the manual operations of the admin API
+type Admin interface {
+	Silences() map[string][]alertmanager.TrackedSilence
+	SilenceManually(ctx context.Context, nodeName string, duration time.Duration) ([]alertmanager.TrackedSilence, bool, error)
+	UnsilenceManually(ctx context.Context, nodeName string) (bool, error)
+	Reconcile(ctx context.Context) error
+	Circuit() alertmanager.CircuitStatus
+}
+
+// SilencesResponse lists the silences tracked per node
+type SilencesResponse struct {
+	Nodes map[string][]alertmanager.TrackedSilence `json:"nodes"`
+	// Alertmanager is the state of the circuit breaker of Alertmanager requests
+	Alertmanager alertmanager.CircuitStatus `json:"alertmanager"`
+}
+
+// SilenceResponse is returned when a node was silenced manually
+type SilenceResponse struct {
+	Node     string                        `json:"node"`
+	Silences []alertmanager.TrackedSilence `json:"silences"`
+	// Complete is false if some of the silences couldn't be created
+	Complete bool `json:"complete"`
+}
+
+// HandleAdmin serves the admin API for incident response, every request has
+// to be admitted by authorizer:
+//
+//	GET /api/v1/silences                   lists the silences tracked per node
+//	POST /api/v1/silences/reconcile        reconciles the silences right away
+//	POST /api/v1/nodes/<node>/silence      silences a node, for ?duration=2h if given
+//	DELETE /api/v1/nodes/<node>/silence    removes the silences of a node which isn't rolling
+func (s *Server) HandleAdmin(admin Admin, authorizer *Authorizer) {
+	s.Handle("/api/v1/silences", authorizer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, SilencesResponse{Nodes: admin.Silences(), Alertmanager: admin.Circuit()})
+	})))
+
+	s.Handle("/api/v1/silences/reconcile", authorizer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := admin.Reconcile(r.Context()); err != nil {
+			adminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	s.handleNodeAction("silence", func(w http.ResponseWriter, r *http.Request, nodeName string) {
+		if !authorizer.admit(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var duration time.Duration
+			if value := r.URL.Query().Get("duration"); value != "" {
+				var err error
+				if duration, err = time.ParseDuration(value); err != nil || duration <= 0 {
+					http.Error(w, "duration must be a positive duration like 2h", http.StatusBadRequest)
+					return
+				}
+			}
+			silences, complete, err := admin.SilenceManually(r.Context(), nodeName, duration)
+			if err != nil {
+				adminError(w, err)
+				return
+			}
+			writeJSON(w, SilenceResponse{Node: nodeName, Silences: silences, Complete: complete})
+		case http.MethodDelete:
+			found, err := admin.UnsilenceManually(r.Context(), nodeName)
+			if err != nil {
+				adminError(w, err)
+				return
+			}
+			if !found {
+				http.Error(w, "node has no silences", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// adminError responds with the status of an error of a manual operation
+func adminError(w http.ResponseWriter, err error) {
+	switch {
+	case apierrors.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, alertmanager.ErrRejected):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, alertmanager.ErrCircuitOpen):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		// Everything else failed talking to Alertmanager
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
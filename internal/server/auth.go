@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// authzPathPrefix is prepended to the paths of admin requests in access
+// reviews, so they can't be mistaken for paths of the API server
+const authzPathPrefix = "/rollout-helper"
+
+// Authorizer admits requests to the admin API by the bearer token of the
+// caller, e.g. from `oc whoami -t`. The token is authenticated with a
+// TokenReview and the request is authorized with a SubjectAccessReview of its
+// path and verb, so access is granted by RBAC rules on nonResourceURLs
+type Authorizer struct {
+	client kubernetes.Interface
+}
+
+func NewAuthorizer(client kubernetes.Interface) *Authorizer {
+	return &Authorizer{client: client}
+}
+
+// Wrap rejects requests to next which aren't authorized
+func (a *Authorizer) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.admit(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// admit reports whether the request is authorized, and responds with the
+// reason if it isn't
+func (a *Authorizer) admit(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return false
+	}
+	user, err := a.authenticate(r.Context(), token)
+	if err != nil {
+		klog.V(2).Infof("Rejected admin request to %s: %v", r.URL.Path, err)
+		http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+		return false
+	}
+	if err := a.authorize(r.Context(), user, r); err != nil {
+		klog.InfoS("Denied admin request", "user", user.Username, "method", r.Method, "path", r.URL.Path, "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	klog.InfoS("Admin request", "user", user.Username, "method", r.Method, "path", r.URL.Path)
+	return true
+}
+
+// authenticate returns the user a token belongs to
+func (a *Authorizer) authenticate(ctx context.Context, token string) (authenticationv1.UserInfo, error) {
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token review failed: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token isn't authenticated: %s", review.Status.Error)
+	}
+	return review.Status.User, nil
+}
+
+// authorize checks whether user may send the request
+func (a *Authorizer) authorize(ctx context.Context, user authenticationv1.UserInfo, r *http.Request) error {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, values := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(values)
+	}
+	review, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: authzPathPrefix + r.URL.Path,
+				Verb: requestVerb(r.Method),
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("access review failed: %w", err)
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("%s isn't allowed to %s %s", user.Username, requestVerb(r.Method), authzPathPrefix+r.URL.Path)
+	}
+	return nil
+}
+
+// requestVerb returns the RBAC verb of an HTTP method, like the API server does
+func requestVerb(method string) string {
+	switch method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	default:
+		return strings.ToLower(method)
+	}
+}
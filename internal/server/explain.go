@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"rollout-helper/internal/alertmanager"
+)
+
+// Explainer looks up the silences covering an alert
+type Explainer interface {
+	Explain(ctx context.Context, labels map[string]string) ([]alertmanager.CoveringSilence, error)
+}
+
+// ExplainResponse is the body of the explain API
+type ExplainResponse struct {
+	Labels   map[string]string              `json:"labels"`
+	Silences []alertmanager.CoveringSilence `json:"silences"`
+}
+
+// HandleExplain serves /api/v1/explain?alertname=<alert>&node=<node>, which
+// returns the helper's silences covering the alert. Other query parameters
+// are matched as further labels of the alert, e.g. namespace or instance
+func (s *Server) HandleExplain(explainer Explainer) {
+	s.Handle("/api/v1/explain", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		labels := make(map[string]string)
+		for name, values := range r.URL.Query() {
+			labels[name] = values[0]
+		}
+		if labels["alertname"] == "" {
+			http.Error(w, "missing alert name in ?alertname=", http.StatusBadRequest)
+			return
+		}
+
+		silences, err := explainer.Explain(r.Context(), labels)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, ExplainResponse{Labels: labels, Silences: silences})
+	}))
+}
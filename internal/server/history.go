@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/slo"
+)
+
+// HistoryResponse lists the rollout windows of nodes and pools, and the
+// silence actions taken for nodes
+type HistoryResponse struct {
+	Windows  []slo.Window  `json:"windows"`
+	Silences []audit.Entry `json:"silences"`
+}
+
+// HandleHistory serves GET /api/v1/history, which returns the recent and
+// ongoing rollout windows of nodes and pools and the recent silence actions,
+// to callers admitted by authorizer. Either source may be nil
+func (s *Server) HandleHistory(windows func() []slo.Window, silences func() []audit.Entry, authorizer *Authorizer) {
+	s.Handle("/api/v1/history", authorizer.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		response := HistoryResponse{Windows: []slo.Window{}, Silences: []audit.Entry{}}
+		if windows != nil {
+			response.Windows = append(response.Windows, windows()...)
+		}
+		if silences != nil {
+			response.Silences = append(response.Silences, silences()...)
+		}
+		writeJSON(w, response)
+	})))
+}
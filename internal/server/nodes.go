@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"rollout-helper/internal/alertmanager"
+)
+
+// Overrides changes how the silences of single nodes are managed
+type Overrides interface {
+	ForceUnsilence(ctx context.Context, nodeName string, duration time.Duration) (time.Time, error)
+	CancelForceUnsilence(ctx context.Context, nodeName string) (bool, error)
+}
+
+// ForceUnsilenceResponse is returned when a node was force-unsilenced
+type ForceUnsilenceResponse struct {
+	Node            string    `json:"node"`
+	UnsilencedUntil time.Time `json:"unsilencedUntil"`
+}
+
+const nodesPath = "/api/v1/nodes/"
+
+// nodeHandler serves an action on a single node
+type nodeHandler func(w http.ResponseWriter, r *http.Request, nodeName string)
+
+// handleNodeAction serves /api/v1/nodes/<node>/<action> with handler, the
+// path is registered once and dispatched by action
+func (s *Server) handleNodeAction(action string, handler nodeHandler) {
+	if s.nodeActions == nil {
+		s.nodeActions = make(map[string]nodeHandler)
+		s.Handle(nodesPath, http.HandlerFunc(s.serveNode))
+	}
+	s.nodeActions[action] = handler
+}
+
+func (s *Server) serveNode(w http.ResponseWriter, r *http.Request) {
+	nodeName, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, nodesPath), "/")
+	handler, found := s.nodeActions[action]
+	if !ok || nodeName == "" || !found {
+		http.NotFound(w, r)
+		return
+	}
+	handler(w, r, nodeName)
+}
+
+// HandleOverrides serves node overrides on /api/v1/nodes/<node>/force-unsilence,
+// every request has to be admitted by authorizer. POST with ?for=<duration>
+// removes the node's silences for that long, DELETE ends the override early
+func (s *Server) HandleOverrides(overrides Overrides, authorizer *Authorizer) {
+	s.handleNodeAction("force-unsilence", func(w http.ResponseWriter, r *http.Request, nodeName string) {
+		if !authorizer.admit(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			duration, err := time.ParseDuration(r.URL.Query().Get("for"))
+			if err != nil {
+				http.Error(w, "invalid or missing duration in ?for=", http.StatusBadRequest)
+				return
+			}
+			until, err := overrides.ForceUnsilence(r.Context(), nodeName, duration)
+			if apierrors.IsNotFound(err) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, alertmanager.ErrRejected) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, ForceUnsilenceResponse{Node: nodeName, UnsilencedUntil: until})
+		case http.MethodDelete:
+			found, err := overrides.CancelForceUnsilence(r.Context(), nodeName)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "node is not force-unsilenced", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
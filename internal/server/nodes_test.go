@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeOverrides force-unsilences the nodes it knows
+type fakeOverrides struct {
+	nodes      map[string]bool
+	unsilenced []string
+	cancelled  []string
+}
+
+func (o *fakeOverrides) ForceUnsilence(ctx context.Context, nodeName string, duration time.Duration) (time.Time, error) {
+	if !o.nodes[nodeName] {
+		return time.Time{}, apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, nodeName)
+	}
+	o.unsilenced = append(o.unsilenced, nodeName)
+	return time.Now().Add(duration), nil
+}
+
+func (o *fakeOverrides) CancelForceUnsilence(ctx context.Context, nodeName string) (bool, error) {
+	o.cancelled = append(o.cancelled, nodeName)
+	return true, nil
+}
+
+// newTestAuthorizer authenticates the tokens "admin" and "viewer", only the
+// admin is allowed to send requests
+func newTestAuthorizer() *Authorizer {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		token := review.Spec.Token
+		review.Status = authenticationv1.TokenReviewStatus{
+			Authenticated: token == "admin" || token == "viewer",
+			User:          authenticationv1.UserInfo{Username: token},
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "admin"
+		return true, review, nil
+	})
+	return NewAuthorizer(client)
+}
+
+func TestForceUnsilenceAuthorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		node       string
+		token      string
+		wantStatus int
+		unsilenced bool
+	}{
+		{name: "no token", method: http.MethodPost, node: "worker-1", wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodPost, node: "worker-1", token: "nobody", wantStatus: http.StatusUnauthorized},
+		{name: "denied", method: http.MethodPost, node: "worker-1", token: "viewer", wantStatus: http.StatusForbidden},
+		{name: "cancel denied", method: http.MethodDelete, node: "worker-1", token: "viewer", wantStatus: http.StatusForbidden},
+		{name: "allowed", method: http.MethodPost, node: "worker-1", token: "admin", wantStatus: http.StatusOK, unsilenced: true},
+		{name: "unknown node", method: http.MethodPost, node: "worker-9", token: "admin", wantStatus: http.StatusNotFound},
+		{name: "cancel allowed", method: http.MethodDelete, node: "worker-1", token: "admin", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides := &fakeOverrides{nodes: map[string]bool{"worker-1": true}}
+			s := New(":0")
+			s.HandleOverrides(overrides, newTestAuthorizer())
+
+			req := httptest.NewRequest(tt.method, "/api/v1/nodes/"+tt.node+"/force-unsilence?for=30m", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if unsilenced := len(overrides.unsilenced) > 0; unsilenced != tt.unsilenced {
+				t.Errorf("Expected the node to be force-unsilenced: %t, got %v", tt.unsilenced, overrides.unsilenced)
+			}
+			if tt.wantStatus == http.StatusForbidden || tt.wantStatus == http.StatusUnauthorized {
+				if len(overrides.cancelled) > 0 {
+					t.Errorf("Expected no override to be cancelled, got %v", overrides.cancelled)
+				}
+			}
+		})
+	}
+}
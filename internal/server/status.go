@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/watcher"
+)
+
+// StatusSource provides the data served by the status API
+type StatusSource struct {
+	// Nodes returns the nodes which are rolling or draining
+	Nodes func() []watcher.NodeStatus
+	// Silences returns the silences tracked per node, nil without Alertmanager
+	Silences func() map[string][]alertmanager.TrackedSilence
+	// InaccessibleNamespaces returns the namespaces whose pods can't be listed, nil without Alertmanager
+	InaccessibleNamespaces func() []alertmanager.NamespaceAccess
+	// ForceUnsilenced returns the force-unsilenced nodes and until when, nil without Alertmanager
+	ForceUnsilenced func() map[string]time.Time
+	// Escalated returns the rolling nodes whose silences were deleted after the
+	// maximum rollout duration and when, nil without Alertmanager
+	Escalated func() map[string]time.Time
+	// Verifying returns the nodes which finished rolling and are verified
+	// before their silences are deleted and since when, nil without verification
+	Verifying func() map[string]time.Time
+	// Maintenance returns the nodes in an active maintenance window, nil without Alertmanager
+	Maintenance func() map[string]alertmanager.Maintenance
+	// Circuit returns the state of the circuit breaker of Alertmanager requests, nil without Alertmanager
+	Circuit func() alertmanager.CircuitStatus
+}
+
+// NodeStatus is a node as reported by the status API
+type NodeStatus struct {
+	watcher.NodeStatus
+	Silences        []alertmanager.TrackedSilence `json:"silences,omitempty"`
+	UnsilencedUntil *time.Time                    `json:"unsilencedUntil,omitempty"`
+	EscalatedAt     *time.Time                    `json:"escalatedAt,omitempty"`
+	VerifyingSince  *time.Time                    `json:"verifyingSince,omitempty"`
+	Maintenance     *alertmanager.Maintenance     `json:"maintenance,omitempty"`
+}
+
+// Status is the body of the status API
+type Status struct {
+	Nodes                  []NodeStatus                   `json:"nodes"`
+	InaccessibleNamespaces []alertmanager.NamespaceAccess `json:"inaccessibleNamespaces,omitempty"`
+	// Alertmanager is degraded while the circuit breaker isn't closed
+	Alertmanager *alertmanager.CircuitStatus `json:"alertmanager,omitempty"`
+}
+
+// HandleStatus serves the state of rolling nodes on /api/v1/status
+func (s *Server) HandleStatus(source StatusSource) {
+	s.Handle("/api/v1/status", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, source.status())
+	}))
+}
+
+func (s StatusSource) status() Status {
+	nodes := make(map[string]*NodeStatus)
+	for _, node := range s.Nodes() {
+		nodes[node.Name] = &NodeStatus{NodeStatus: node}
+	}
+	// Nodes may be known to the silence manager only, e.g. after a restart
+	get := func(name string) *NodeStatus {
+		node, ok := nodes[name]
+		if !ok {
+			node = &NodeStatus{NodeStatus: watcher.NodeStatus{Name: name}}
+			nodes[name] = node
+		}
+		return node
+	}
+
+	if s.Silences != nil {
+		for name, silences := range s.Silences() {
+			get(name).Silences = silences
+		}
+	}
+	if s.ForceUnsilenced != nil {
+		for name, until := range s.ForceUnsilenced() {
+			until := until
+			get(name).UnsilencedUntil = &until
+		}
+	}
+	if s.Escalated != nil {
+		for name, at := range s.Escalated() {
+			at := at
+			get(name).EscalatedAt = &at
+		}
+	}
+	if s.Verifying != nil {
+		for name, since := range s.Verifying() {
+			since := since
+			get(name).VerifyingSince = &since
+		}
+	}
+
+	if s.Maintenance != nil {
+		for name, window := range s.Maintenance() {
+			window := window
+			get(name).Maintenance = &window
+		}
+	}
+
+	status := Status{Nodes: make([]NodeStatus, 0, len(nodes))}
+	for _, node := range nodes {
+		status.Nodes = append(status.Nodes, *node)
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool { return status.Nodes[i].Name < status.Nodes[j].Name })
+
+	if s.InaccessibleNamespaces != nil {
+		status.InaccessibleNamespaces = s.InaccessibleNamespaces()
+	}
+	if s.Circuit != nil {
+		circuit := s.Circuit()
+		status.Alertmanager = &circuit
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
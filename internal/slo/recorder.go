@@ -0,0 +1,242 @@
+// Package slo records the windows in which nodes and pools were rolling, for
+// SLO tooling which excludes planned rollouts from error budget burn
+package slo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ScopeNode windows cover the rollout of a single node
+	ScopeNode = "node"
+	// ScopePool windows cover the time any node of a pool was rolling
+	ScopePool = "pool"
+
+	// observationQueueSize bounds the observations waiting to be processed
+	observationQueueSize = 1000
+	// publishInterval is how often changed windows are published
+	publishInterval = 30 * time.Second
+)
+
+// Window is a period in which a node or pool was rolling
+type Window struct {
+	Scope string `json:"scope"`
+	Name  string `json:"name"`
+	// Pool is the pool of a node window
+	Pool  string    `json:"pool,omitempty"`
+	Start time.Time `json:"start"`
+	// End is unset while the window is open
+	End *time.Time `json:"end,omitempty"`
+	// Before and After are the versions of a node when its rollout started
+	// and ended, After is unset while it's rolling or if it was deleted
+	Before *Versions `json:"before,omitempty"`
+	After  *Versions `json:"after,omitempty"`
+}
+
+// Versions are the versions a node reports in its status
+type Versions struct {
+	OSImage        string `json:"osImage,omitempty"`
+	KubeletVersion string `json:"kubeletVersion,omitempty"`
+}
+
+// versionsOf returns v, or nil if the node reported no versions
+func versionsOf(v Versions) *Versions {
+	if v == (Versions{}) {
+		return nil
+	}
+	return &v
+}
+
+// Sink publishes the recorded windows, e.g. to a ConfigMap or an endpoint
+type Sink interface {
+	// Name identifies the sink in logs
+	Name() string
+	// Publish replaces the windows previously published
+	Publish(ctx context.Context, windows []Window) error
+}
+
+// Loader is implemented by sinks which can return what they published
+// before a restart
+type Loader interface {
+	Load(ctx context.Context) ([]Window, error)
+}
+
+type observation struct {
+	node     string
+	pool     string
+	rolling  bool
+	versions Versions
+	time     time.Time
+}
+
+// Recorder turns node state changes into windows and publishes them. Closed
+// windows are kept for the retention period
+type Recorder struct {
+	retention    time.Duration
+	observations chan observation
+	sinks        []Sink
+
+	// Only used by the run loop
+	open   map[string]*Window
+	pools  map[string]*Window
+	closed []Window
+	dirty  bool
+}
+
+// NewRecorder creates a recorder keeping closed windows for retention
+func NewRecorder(retention time.Duration) *Recorder {
+	return &Recorder{
+		retention:    retention,
+		observations: make(chan observation, observationQueueSize),
+		open:         make(map[string]*Window),
+		pools:        make(map[string]*Window),
+	}
+}
+
+// AddSink publishes the windows to sink
+func (r *Recorder) AddSink(sink Sink) {
+	r.sinks = append(r.sinks, sink)
+}
+
+// Observe records a node state change and the versions the node reported
+// without blocking, it's a no-op on a nil recorder
+func (r *Recorder) Observe(node, pool string, rolling bool, versions Versions) {
+	if r == nil {
+		return
+	}
+
+	select {
+	case r.observations <- observation{node: node, pool: pool, rolling: rolling, versions: versions, time: time.Now()}:
+	default:
+		klog.Warningf("SLO window queue is full, dropping state change of node %s", node)
+	}
+}
+
+// Start loads the windows published before a restart and records state
+// changes until ctx is cancelled
+func (r *Recorder) Start(ctx context.Context) {
+	r.load(ctx)
+	go r.run(ctx)
+}
+
+// load restores the closed windows from the first sink which can load them.
+// Windows which were open are closed, the nodes still rolling open new ones
+func (r *Recorder) load(ctx context.Context) {
+	for _, sink := range r.sinks {
+		loader, ok := sink.(Loader)
+		if !ok {
+			continue
+		}
+		windows, err := loader.Load(ctx)
+		if err != nil {
+			klog.Warningf("Failed to load SLO windows from %s: %v", sink.Name(), err)
+			return
+		}
+		now := time.Now()
+		for _, window := range windows {
+			if window.End == nil {
+				window.End = &now
+			}
+			r.closed = append(r.closed, window)
+		}
+		r.dirty = len(windows) > 0
+		return
+	}
+}
+
+func (r *Recorder) run(ctx context.Context) {
+	ticker := time.NewTicker(publishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case o := <-r.observations:
+			r.handle(o)
+		case <-ticker.C:
+			r.publish(ctx)
+		}
+	}
+}
+
+func (r *Recorder) handle(o observation) {
+	if o.rolling {
+		if _, ok := r.open[o.node]; ok {
+			return
+		}
+		r.open[o.node] = &Window{Scope: ScopeNode, Name: o.node, Pool: o.pool, Start: o.time, Before: versionsOf(o.versions)}
+		if o.pool != "" && r.pools[o.pool] == nil {
+			r.pools[o.pool] = &Window{Scope: ScopePool, Name: o.pool, Start: o.time}
+		}
+		r.dirty = true
+		return
+	}
+
+	window, ok := r.open[o.node]
+	if !ok {
+		return
+	}
+	delete(r.open, o.node)
+	window.After = versionsOf(o.versions)
+	r.close(window, o.time)
+
+	// The pool window ends with the last rolling node of the pool
+	for _, other := range r.open {
+		if other.Pool == window.Pool {
+			return
+		}
+	}
+	if pool, ok := r.pools[window.Pool]; ok {
+		delete(r.pools, window.Pool)
+		r.close(pool, o.time)
+	}
+}
+
+func (r *Recorder) close(window *Window, end time.Time) {
+	window.End = &end
+	r.closed = append(r.closed, *window)
+	r.dirty = true
+}
+
+// publish sends all windows to the sinks if they changed, dropping closed
+// windows older than the retention period
+func (r *Recorder) publish(ctx context.Context) {
+	cutoff := time.Now().Add(-r.retention)
+	kept := r.closed[:0]
+	for _, window := range r.closed {
+		if window.End.After(cutoff) {
+			kept = append(kept, window)
+		} else {
+			r.dirty = true
+		}
+	}
+	r.closed = kept
+
+	if !r.dirty {
+		return
+	}
+
+	windows := append([]Window(nil), r.closed...)
+	for _, window := range r.pools {
+		windows = append(windows, *window)
+	}
+	for _, window := range r.open {
+		windows = append(windows, *window)
+	}
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+
+	published := true
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, windows); err != nil {
+			klog.Errorf("Failed to publish SLO windows to %s: %v", sink.Name(), err)
+			published = false
+		}
+	}
+	// Retry failed sinks on the next tick
+	r.dirty = !published
+}
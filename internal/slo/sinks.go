@@ -0,0 +1,164 @@
+package slo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// ConfigMapKey holds the windows in the ConfigMap as a JSON list
+const ConfigMapKey = "windows.json"
+
+// ConfigMapSink keeps the windows in a ConfigMap
+type ConfigMapSink struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func NewConfigMapSink(client kubernetes.Interface, namespace, name string) *ConfigMapSink {
+	return &ConfigMapSink{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (s *ConfigMapSink) Name() string {
+	return "configmap " + s.namespace + "/" + s.name
+}
+
+func (s *ConfigMapSink) Load(ctx context.Context) ([]Window, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configmap %s/%s: %w", s.namespace, s.name, err)
+	}
+
+	raw, ok := cm.Data[ConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+	var windows []Window
+	if err := json.Unmarshal([]byte(raw), &windows); err != nil {
+		return nil, fmt.Errorf("invalid windows in configmap %s/%s: %w", s.namespace, s.name, err)
+	}
+	return windows, nil
+}
+
+func (s *ConfigMapSink) Publish(ctx context.Context, windows []Window) error {
+	raw, err := json.Marshal(windows)
+	if err != nil {
+		return fmt.Errorf("failed to marshal windows: %w", err)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+				},
+				Data: map[string]string{ConfigMapKey: string(raw)},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[ConfigMapKey] = string(raw)
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// WebhookSink posts all windows as JSON to a URL whenever they change
+type WebhookSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+// webhookPayload is the body posted to the webhook
+type webhookPayload struct {
+	Windows []Window `json:"windows"`
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, windows []Window) error {
+	body, err := json.Marshal(webhookPayload{Windows: windows})
+	if err != nil {
+		return fmt.Errorf("failed to marshal windows: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MemorySink keeps the last published windows for the history API
+type MemorySink struct {
+	mu      sync.Mutex
+	windows []Window
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Name() string {
+	return "memory"
+}
+
+func (s *MemorySink) Publish(ctx context.Context, windows []Window) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windows = windows
+	return nil
+}
+
+// Windows returns the windows published last, sorted by their start
+func (s *MemorySink) Windows() []Window {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Window(nil), s.windows...)
+}
@@ -0,0 +1,159 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Silences maps node names to the IDs of the silences created for them
+type Silences map[string][]string
+
+// Store persists the silences managed by the rollout helper across restarts
+type Store interface {
+	// Load returns the persisted silences, found is false if nothing was persisted yet
+	Load(ctx context.Context) (silences Silences, found bool, err error)
+	// Save replaces the persisted silences
+	Save(ctx context.Context, silences Silences) error
+}
+
+// ConfigMapStore keeps the silences in a ConfigMap, one key per node
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func NewConfigMapStore(client kubernetes.Interface, namespace, name string) *ConfigMapStore {
+	return &ConfigMapStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (s *ConfigMapStore) Load(ctx context.Context) (Silences, bool, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return Silences{}, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get configmap %s/%s: %w", s.namespace, s.name, err)
+	}
+
+	silences := make(Silences, len(cm.Data))
+	for node, raw := range cm.Data {
+		var ids []string
+		if err := json.Unmarshal([]byte(raw), &ids); err != nil {
+			return nil, false, fmt.Errorf("invalid state for node %s: %w", node, err)
+		}
+		silences[node] = ids
+	}
+	return silences, true, nil
+}
+
+func (s *ConfigMapStore) Save(ctx context.Context, silences Silences) error {
+	data := make(map[string]string, len(silences))
+	for node, ids := range silences {
+		raw, err := json.Marshal(ids)
+		if err != nil {
+			return fmt.Errorf("failed to marshal state for node %s: %w", node, err)
+		}
+		data[node] = string(raw)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+				},
+				Data: data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		cm.Data = data
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// loadAnnotation decodes the JSON in the annotation key of the ConfigMap into
+// v, which is left as is if the ConfigMap or annotation doesn't exist
+func (s *ConfigMapStore) loadAnnotation(ctx context.Context, key string, v interface{}) error {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s/%s: %w", s.namespace, s.name, err)
+	}
+
+	if raw, ok := cm.Annotations[key]; ok {
+		if err := json.Unmarshal([]byte(raw), v); err != nil {
+			return fmt.Errorf("invalid %s annotation in configmap %s/%s: %w", key, s.namespace, s.name, err)
+		}
+	}
+	return nil
+}
+
+// saveAnnotation records v as JSON in the annotation key of the ConfigMap,
+// creating it if needed
+func (s *ConfigMapStore) saveAnnotation(ctx context.Context, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s annotation: %w", key, err)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        s.name,
+					Namespace:   s.namespace,
+					Annotations: map[string]string{key: string(raw)},
+				},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Annotations == nil {
+			cm.Annotations = make(map[string]string)
+		}
+		cm.Annotations[key] = string(raw)
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// CurrentNamespace returns the namespace the helper runs in, falling back to
+// "default" when running outside of a cluster
+func CurrentNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return "default"
+}
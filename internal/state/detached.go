@@ -0,0 +1,47 @@
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// DetachedAnnotation keeps the detached silences on the state ConfigMap
+const DetachedAnnotation = "rollout-helper.snappcloud.io/detached"
+
+// DetachedSilence is a silence which isn't tracked with the silences of its
+// node and may outlive its rollout, e.g. of a pod moved off the node
+type DetachedSilence struct {
+	ID   string `json:"id"`
+	Node string `json:"node"`
+	// Reason tells what the silence is for, e.g. relocation
+	Reason string `json:"reason"`
+	// Target is what the silence covers on the node, e.g. the namespace and
+	// name of the daemonset of evicted pods
+	Target string    `json:"target,omitempty"`
+	EndsAt time.Time `json:"endsAt"`
+}
+
+// DetachedStore persists the detached silences across restarts, so they
+// aren't taken for orphans
+type DetachedStore interface {
+	// LoadDetached returns the persisted detached silences
+	LoadDetached(ctx context.Context) ([]DetachedSilence, error)
+	// SaveDetached replaces the persisted detached silences
+	SaveDetached(ctx context.Context, silences []DetachedSilence) error
+}
+
+// LoadDetached returns the detached silences recorded on the ConfigMap, none
+// if it doesn't exist yet
+func (s *ConfigMapStore) LoadDetached(ctx context.Context) ([]DetachedSilence, error) {
+	var silences []DetachedSilence
+	if err := s.loadAnnotation(ctx, DetachedAnnotation, &silences); err != nil {
+		return nil, err
+	}
+	return silences, nil
+}
+
+// SaveDetached records the detached silences on the ConfigMap, creating it
+// if needed
+func (s *ConfigMapStore) SaveDetached(ctx context.Context, silences []DetachedSilence) error {
+	return s.saveAnnotation(ctx, DetachedAnnotation, silences)
+}
@@ -0,0 +1,97 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// InstancesAnnotation lists the helper instances sharing the state ConfigMap
+const InstancesAnnotation = "rollout-helper.snappcloud.io/instances"
+
+// Instance is a running rollout helper sharing the state store
+type Instance struct {
+	ID        string    `json:"id"`
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"startedAt"`
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// Registry records the helper instances sharing a state store
+type Registry interface {
+	// Heartbeat records self, forgets instances which didn't heartbeat within
+	// staleAfter and returns the other live instances
+	Heartbeat(ctx context.Context, self Instance, staleAfter time.Duration) ([]Instance, error)
+	// Deregister removes an instance which is shutting down
+	Deregister(ctx context.Context, id string) error
+}
+
+// Heartbeat records the instance on the ConfigMap. Nothing is recorded until
+// the ConfigMap was created by the first Save, a missing ConfigMap means no
+// other instance persisted anything yet
+func (s *ConfigMapStore) Heartbeat(ctx context.Context, self Instance, staleAfter time.Duration) ([]Instance, error) {
+	var peers []Instance
+	err := s.updateInstances(ctx, func(instances map[string]Instance) {
+		self.Heartbeat = time.Now()
+		instances[self.ID] = self
+
+		peers = nil
+		for id, instance := range instances {
+			if time.Since(instance.Heartbeat) > staleAfter {
+				delete(instances, id)
+				continue
+			}
+			if id != self.ID {
+				peers = append(peers, instance)
+			}
+		}
+	})
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers, err
+}
+
+// Deregister removes the instance from the ConfigMap
+func (s *ConfigMapStore) Deregister(ctx context.Context, id string) error {
+	return s.updateInstances(ctx, func(instances map[string]Instance) {
+		delete(instances, id)
+	})
+}
+
+// updateInstances applies update to the instances recorded on the ConfigMap
+func (s *ConfigMapStore) updateInstances(ctx context.Context, update func(map[string]Instance)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get configmap %s/%s: %w", s.namespace, s.name, err)
+		}
+
+		instances := make(map[string]Instance)
+		if raw, ok := cm.Annotations[InstancesAnnotation]; ok {
+			if err := json.Unmarshal([]byte(raw), &instances); err != nil {
+				// Start over, every live instance records itself again on its next heartbeat
+				instances = make(map[string]Instance)
+			}
+		}
+		update(instances)
+
+		raw, err := json.Marshal(instances)
+		if err != nil {
+			return fmt.Errorf("failed to marshal instances: %w", err)
+		}
+		if cm.Annotations == nil {
+			cm.Annotations = make(map[string]string)
+		}
+		cm.Annotations[InstancesAnnotation] = string(raw)
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
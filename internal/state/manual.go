@@ -0,0 +1,33 @@
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// ManualAnnotation keeps when the manual silences of nodes end on the state ConfigMap
+const ManualAnnotation = "rollout-helper.snappcloud.io/manual"
+
+// ManualStore persists when the silences of nodes silenced manually for a
+// duration end, they're deleted then instead of being extended
+type ManualStore interface {
+	// LoadManual returns the persisted ends by node
+	LoadManual(ctx context.Context) (map[string]time.Time, error)
+	// SaveManual replaces the persisted ends
+	SaveManual(ctx context.Context, manual map[string]time.Time) error
+}
+
+// LoadManual returns the ends recorded on the ConfigMap, none if it doesn't
+// exist yet
+func (s *ConfigMapStore) LoadManual(ctx context.Context) (map[string]time.Time, error) {
+	manual := make(map[string]time.Time)
+	if err := s.loadAnnotation(ctx, ManualAnnotation, &manual); err != nil {
+		return nil, err
+	}
+	return manual, nil
+}
+
+// SaveManual records the ends on the ConfigMap, creating it if needed
+func (s *ConfigMapStore) SaveManual(ctx context.Context, manual map[string]time.Time) error {
+	return s.saveAnnotation(ctx, ManualAnnotation, manual)
+}
@@ -0,0 +1,107 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// RollbackScriptKey holds the rollback script in the rollback ConfigMap
+const RollbackScriptKey = "rollback.sh"
+
+// RollbackWriter keeps the script which expires every silence of the helper,
+// for manual cleanup if the helper can't do it anymore
+type RollbackWriter interface {
+	// Name identifies the writer in logs
+	Name() string
+	// Write replaces the script
+	Write(ctx context.Context, script []byte) error
+}
+
+// RollbackFile writes the script to a file, e.g. on an emptyDir volume
+type RollbackFile struct {
+	path string
+}
+
+func NewRollbackFile(path string) *RollbackFile {
+	return &RollbackFile{path: path}
+}
+
+func (f *RollbackFile) Name() string {
+	return "file " + f.path
+}
+
+func (f *RollbackFile) Write(_ context.Context, script []byte) error {
+	// Replaced atomically so a crash never leaves a truncated script behind
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", f.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(script); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", f.path, err)
+	}
+	if err := tmp.Chmod(0o755); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", f.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.path, err)
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// RollbackConfigMap writes the script to the RollbackScriptKey of a ConfigMap,
+// which outlives the pod
+type RollbackConfigMap struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func NewRollbackConfigMap(client kubernetes.Interface, namespace, name string) *RollbackConfigMap {
+	return &RollbackConfigMap{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (c *RollbackConfigMap) Name() string {
+	return "configmap " + c.namespace + "/" + c.name
+}
+
+func (c *RollbackConfigMap) Write(ctx context.Context, script []byte) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := c.client.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = c.client.CoreV1().ConfigMaps(c.namespace).Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      c.name,
+					Namespace: c.namespace,
+				},
+				Data: map[string]string{RollbackScriptKey: string(script)},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[RollbackScriptKey] = string(script)
+		_, err = c.client.CoreV1().ConfigMaps(c.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,48 @@
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// RolloutsAnnotation keeps the rollouts of the rolling nodes on the state ConfigMap
+const RolloutsAnnotation = "rollout-helper.snappcloud.io/rollouts"
+
+// Rollout is the rollout of a rolling node, or of a node which finished
+// rolling and keeps its silences until it's verified
+type Rollout struct {
+	// StartedAt is zero once the node finished rolling
+	StartedAt time.Time `json:"startedAt"`
+	// EscalatedAt is when the rollout exceeded the maximum rollout duration
+	EscalatedAt *time.Time `json:"escalatedAt,omitempty"`
+	// VerifyingSince is when the verification of the finished node started
+	VerifyingSince *time.Time `json:"verifyingSince,omitempty"`
+	// TargetsSince is since when the finished node waits for its scrape targets
+	TargetsSince *time.Time `json:"targetsSince,omitempty"`
+}
+
+// RolloutStore persists the rollouts of the rolling nodes across restarts,
+// their silences are deleted once a rollout is escalated so they can't be
+// timed from those. Finished nodes being verified would otherwise lose their
+// silences to the garbage collection
+type RolloutStore interface {
+	// LoadRollouts returns the persisted rollouts by node
+	LoadRollouts(ctx context.Context) (map[string]Rollout, error)
+	// SaveRollouts replaces the persisted rollouts
+	SaveRollouts(ctx context.Context, rollouts map[string]Rollout) error
+}
+
+// LoadRollouts returns the rollouts recorded on the ConfigMap, none if it
+// doesn't exist yet
+func (s *ConfigMapStore) LoadRollouts(ctx context.Context) (map[string]Rollout, error) {
+	rollouts := make(map[string]Rollout)
+	if err := s.loadAnnotation(ctx, RolloutsAnnotation, &rollouts); err != nil {
+		return nil, err
+	}
+	return rollouts, nil
+}
+
+// SaveRollouts records the rollouts on the ConfigMap, creating it if needed
+func (s *ConfigMapStore) SaveRollouts(ctx context.Context, rollouts map[string]Rollout) error {
+	return s.saveAnnotation(ctx, RolloutsAnnotation, rollouts)
+}
@@ -0,0 +1,67 @@
+// Package tracing traces the silence pipeline with OpenTelemetry, from the
+// watcher noticing a node state change to the Alertmanager requests
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"rollout-helper/internal/version"
+)
+
+// serviceName identifies the helper in traces
+const serviceName = "rollout-helper"
+
+// Tracer returns the tracer of the helper. Its spans are dropped unless Setup
+// configured an exporter
+func Tracer() trace.Tracer {
+	return otel.Tracer(serviceName)
+}
+
+// Setup exports spans to the OTLP/HTTP collector at endpoint, e.g.
+// http://otel-collector:4318. The returned function flushes the spans which
+// weren't exported yet
+func Setup(endpoint string, sampleRatio float64) (func(context.Context) error, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q, expected http(s)://host:port", endpoint)
+	}
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio %v isn't between 0 and 1", sampleRatio)
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(parsed.JoinPath("v1", "traces").String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version.Version),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// End ends a span, recording err if it's not nil. It's meant to be deferred
+// with a pointer to the named error result
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
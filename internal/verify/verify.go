@@ -0,0 +1,218 @@
+// Package verify checks that a node which finished rolling is healthy again
+// before its silences are deleted: it's Ready, the pods of critical
+// DaemonSets run on it and Prometheus scrapes its kubelet
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/prometheus"
+)
+
+// Checks reported in failures
+const (
+	CheckReady     = "ready"
+	CheckDaemonSet = "daemonset"
+	CheckScrape    = "scrape"
+)
+
+// DefaultDaemonSets are the DaemonSets whose pods have to run on a node
+// after its rollout
+var DefaultDaemonSets = []string{
+	"openshift-machine-config-operator/machine-config-daemon",
+	"openshift-dns/node-resolver",
+	"openshift-monitoring/node-exporter",
+}
+
+// DefaultScrapeJobs are the jobs whose targets on a node have to be up after its rollout
+var DefaultScrapeJobs = []string{"kubelet", "kubernetes-cadvisor"}
+
+// Failure is a check a node didn't pass
+type Failure struct {
+	Check  string
+	Reason string
+}
+
+func (f Failure) String() string {
+	return f.Check + ": " + f.Reason
+}
+
+// Options select what is verified
+type Options struct {
+	// DaemonSets are the namespace/name of the DaemonSets whose pods have to
+	// be running and ready on the node. DaemonSets which don't exist or whose
+	// nodeSelector doesn't select the node are skipped
+	DaemonSets []string
+	// Prometheus is queried for the scrape targets of ScrapeJobs on the
+	// node, e.g. the thanos-querier. nil skips the scrape check
+	Prometheus *prometheus.Client
+	// ScrapeJobs are the jobs which need at least one target on the node,
+	// all of them up
+	ScrapeJobs []string
+}
+
+// Validate checks the DaemonSets are namespace/name
+func (o Options) Validate() error {
+	for _, daemonSet := range o.DaemonSets {
+		if _, _, ok := splitName(daemonSet); !ok {
+			return fmt.Errorf("invalid DaemonSet %q, expected namespace/name", daemonSet)
+		}
+	}
+	if o.Prometheus != nil && len(o.ScrapeJobs) == 0 {
+		return errors.New("at least one scrape job is required with a Prometheus URL")
+	}
+	return nil
+}
+
+// Verifier runs the checks of Options against a node
+type Verifier struct {
+	client  kubernetes.Interface
+	options Options
+}
+
+// NewVerifier creates a verifier
+func NewVerifier(client kubernetes.Interface, options Options) *Verifier {
+	return &Verifier{client: client, options: options}
+}
+
+// Verify runs all checks against a node and returns the failed ones, none if
+// it's healthy. A node which can't be read fails the ready check only
+func (v *Verifier) Verify(ctx context.Context, nodeName string) []Failure {
+	node, err := v.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return []Failure{{Check: CheckReady, Reason: fmt.Sprintf("failed to get node: %v", err)}}
+	}
+
+	var failures []Failure
+	if !nodeReady(node) {
+		failures = append(failures, Failure{Check: CheckReady, Reason: "node isn't Ready"})
+	}
+	for _, daemonSet := range v.options.DaemonSets {
+		if reason := v.checkDaemonSet(ctx, node, daemonSet); reason != "" {
+			failures = append(failures, Failure{Check: CheckDaemonSet, Reason: reason})
+		}
+	}
+	if v.options.Prometheus != nil {
+		for _, job := range v.options.ScrapeJobs {
+			if reason := v.checkScrape(ctx, node, job); reason != "" {
+				failures = append(failures, Failure{Check: CheckScrape, Reason: reason})
+			}
+		}
+	}
+	return failures
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// checkDaemonSet returns why the pod of a DaemonSet on the node isn't running
+// and ready, empty if it is
+func (v *Verifier) checkDaemonSet(ctx context.Context, node *corev1.Node, daemonSet string) string {
+	namespace, name, _ := splitName(daemonSet)
+	ds, err := v.client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.V(2).Infof("DaemonSet %s doesn't exist, not verifying its pod on node %s", daemonSet, node.Name)
+		return ""
+	}
+	if err != nil {
+		return fmt.Sprintf("failed to get DaemonSet %s: %v", daemonSet, err)
+	}
+	if !selectsNode(ds, node) {
+		return ""
+	}
+
+	pods, err := v.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{FieldSelector: "spec.nodeName=" + node.Name})
+	if err != nil {
+		return fmt.Sprintf("failed to list the pods of DaemonSet %s: %v", daemonSet, err)
+	}
+	for _, pod := range pods.Items {
+		if !ownedBy(&pod, ds) {
+			continue
+		}
+		if pod.Status.Phase != corev1.PodRunning {
+			return fmt.Sprintf("pod %s/%s of DaemonSet %s is %s", namespace, pod.Name, daemonSet, pod.Status.Phase)
+		}
+		if !podReady(&pod) {
+			return fmt.Sprintf("pod %s/%s of DaemonSet %s isn't ready", namespace, pod.Name, daemonSet)
+		}
+		return ""
+	}
+	return fmt.Sprintf("no pod of DaemonSet %s runs on the node", daemonSet)
+}
+
+// selectsNode reports whether the nodeSelector of a DaemonSet selects the
+// node, affinities and tolerations aren't considered
+func selectsNode(ds *appsv1.DaemonSet, node *corev1.Node) bool {
+	selector := ds.Spec.Template.Spec.NodeSelector
+	if len(selector) == 0 {
+		return true
+	}
+	return labels.SelectorFromSet(selector).Matches(labels.Set(node.Labels))
+}
+
+func ownedBy(pod *corev1.Pod, ds *appsv1.DaemonSet) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" && owner.UID == ds.UID {
+			return true
+		}
+	}
+	return false
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// checkScrape returns why the targets of a job on the node aren't up, empty
+// if they all are. Targets are matched by their instance label, which is
+// the node name or one of its InternalIPs
+func (v *Verifier) checkScrape(ctx context.Context, node *corev1.Node, job string) string {
+	query := fmt.Sprintf(`up{job=%q,instance=~%q}`, job, prometheus.InstancePattern(node))
+	samples, err := v.options.Prometheus.Query(ctx, query)
+	if err != nil {
+		return fmt.Sprintf("failed to query the %s targets: %v", job, err)
+	}
+	if len(samples) == 0 {
+		return fmt.Sprintf("no %s target of the node is scraped", job)
+	}
+	var down []string
+	for _, sample := range samples {
+		if sample.Value != 1 {
+			down = append(down, sample.Metric["instance"])
+		}
+	}
+	if len(down) > 0 {
+		return fmt.Sprintf("%s targets are down: %s", job, strings.Join(down, ", "))
+	}
+	return ""
+}
+
+func splitName(namespacedName string) (string, string, bool) {
+	namespace, name, ok := strings.Cut(namespacedName, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+	return namespace, name, true
+}
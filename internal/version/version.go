@@ -0,0 +1,32 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with
+// -ldflags "-X rollout-helper/internal/version.Version=... -X rollout-helper/internal/version.Commit=..."
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// GoVersion is the Go version the binary was built with
+var GoVersion = runtime.Version()
+
+// Revision returns the commit the binary was built from, falling back to the
+// VCS information embedded by the Go toolchain
+func Revision() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
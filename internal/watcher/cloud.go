@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/cloud"
+)
+
+// cloudMaintenanceDuration is how long a maintenance without an announced end
+// is assumed to take
+const cloudMaintenanceDuration = 2 * time.Hour
+
+// SetCloudMaintenanceLead considers nodes rolling d before the planned host
+// maintenance published by the cloud agent starts, zero disables it. It must
+// be called before Start
+func (w *Watcher) SetCloudMaintenanceLead(d time.Duration) {
+	w.cloudMaintenanceLead = d
+}
+
+// cloudMaintenance reports whether the node's host is within the lead time or
+// the window of a planned maintenance
+func (w *Watcher) cloudMaintenance(node *corev1.Node, now time.Time) bool {
+	if w.cloudMaintenanceLead <= 0 {
+		return false
+	}
+	value, ok := node.Annotations[cloud.MaintenanceAnnotation]
+	if !ok {
+		return false
+	}
+	start, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.Warningf("Ignoring invalid %s annotation of node %s: %v", cloud.MaintenanceAnnotation, node.Name, err)
+		return false
+	}
+	if !w.authorized(node, cloud.MaintenanceAnnotation) {
+		return false
+	}
+	end := start.Add(cloudMaintenanceDuration)
+	if value, ok := node.Annotations[cloud.MaintenanceEndAnnotation]; ok && w.authorized(node, cloud.MaintenanceEndAnnotation) {
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil && parsed.After(start) {
+			end = parsed
+		}
+	}
+	return !now.Before(start.Add(-w.cloudMaintenanceLead)) && now.Before(end)
+}
@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/scope"
+)
+
+const (
+	// AutoscalerTaint is added by the cluster autoscaler to nodes it scales down
+	AutoscalerTaint = "ToBeDeletedByClusterAutoscaler"
+	// drainEventsMaxAge is how recent node events have to be to indicate a drain
+	drainEventsMaxAge = 10 * time.Minute
+)
+
+// drainEventReasons are the reasons of node events recorded by drain
+// controllers, the cluster autoscaler and the MCO drain controller
+var drainEventReasons = map[string]bool{
+	"ScaleDown": true,
+	"Drain":     true,
+}
+
+// SetDetectDrains considers cordoned nodes rolling once pods are evicted from
+// them, for drains which don't go through the MCO, e.g. cluster autoscaler
+// scale-downs or manual drains. It must be called before Start
+func (w *Watcher) SetDetectDrains(enabled bool) {
+	w.detectDrains = enabled
+}
+
+// SetNamespaces restricts the pods and events listed to detect drains, for
+// namespace-scoped permissions. It must be called before Start
+func (w *Watcher) SetNamespaces(namespaces scope.Namespaces) {
+	w.namespaces = namespaces
+}
+
+// drainDetected reports whether a cordoned node is being drained. A node stays
+// drained until it's uncordoned, the signals are usually gone once the
+// evictions completed
+func (w *Watcher) drainDetected(ctx context.Context, node *corev1.Node) bool {
+	if !node.Spec.Unschedulable {
+		delete(w.drained, node.Name)
+		return false
+	}
+	if w.drained[node.Name] {
+		return true
+	}
+
+	reason := w.drainSignal(ctx, node)
+	if reason == "" {
+		return false
+	}
+	klog.Infof("Detected drain of cordoned node %s: %s", node.Name, reason)
+	w.drained[node.Name] = true
+	return true
+}
+
+// drainSignal returns why a cordoned node is considered drained, or "" if it isn't
+func (w *Watcher) drainSignal(ctx context.Context, node *corev1.Node) string {
+	if nodeDrainState(node) != DrainNone {
+		return "drain requested by the MCO"
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == AutoscalerTaint {
+			return "scaled down by the cluster autoscaler"
+		}
+	}
+
+	// Pods evicted through the eviction API get the DisruptionTarget condition
+	pods, err := w.namespaces.ListPods(ctx, w.client, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		klog.Errorf("Failed to list pods of cordoned node %s: %v", node.Name, err)
+	} else {
+		for _, pod := range pods.Items {
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == corev1.DisruptionTarget && condition.Status == corev1.ConditionTrue {
+					return "pod " + pod.Namespace + "/" + pod.Name + " is evicted"
+				}
+			}
+		}
+	}
+
+	events, err := w.client.CoreV1().Events(w.namespaces.NodeEventsNamespace()).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Node",
+			"involvedObject.name": node.Name,
+		}.String(),
+	})
+	if err != nil {
+		klog.Errorf("Failed to list events of cordoned node %s: %v", node.Name, err)
+		return ""
+	}
+	for _, event := range events.Items {
+		last := event.LastTimestamp.Time
+		if last.IsZero() {
+			last = event.EventTime.Time
+		}
+		if drainEventReasons[event.Reason] && w.clock.Since(last) <= drainEventsMaxAge {
+			return event.Reason + " event: " + event.Message
+		}
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// forgetDeleted drops the state of nodes which no longer exist. Nodes which
+// were rolling are reported with Deleted set, e.g. when their machine was
+// replaced mid-rollout, so their silences don't linger until they expire.
+// Only used by reconcileOnce
+func (w *Watcher) forgetDeleted(ctx context.Context, existing map[string]bool, polled time.Time) {
+	w.previousStates.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		if existing[name] {
+			return true
+		}
+		w.previousStates.Delete(name)
+		if wasRolling, _ := value.(bool); wasRolling {
+			klog.Infof("Node %s was deleted while rolling", name)
+			deleted := NodeState{Name: name, Deleted: true}
+			traceState(ctx, &deleted, polled)
+			w.stateCh <- deleted
+		}
+		return true
+	})
+
+	w.statuses.retain(existing)
+	for name := range w.drained {
+		if !existing[name] {
+			delete(w.drained, name)
+		}
+	}
+	for name := range w.settleSince {
+		if !existing[name] {
+			delete(w.settleSince, name)
+		}
+	}
+	for name := range w.rollingSince {
+		if !existing[name] {
+			delete(w.rollingSince, name)
+		}
+	}
+	for name := range w.upcoming {
+		if !existing[name] {
+			delete(w.upcoming, name)
+		}
+	}
+}
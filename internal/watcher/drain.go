@@ -0,0 +1,145 @@
+package watcher
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+const (
+	// DesiredDrainAnnotation is set by the MCO to request a drain or uncordon of the node
+	DesiredDrainAnnotation = "machineconfiguration.openshift.io/desiredDrain"
+	// LastAppliedDrainAnnotation is set by the MCO once the requested drain or uncordon completed
+	LastAppliedDrainAnnotation = "machineconfiguration.openshift.io/lastAppliedDrain"
+)
+
+// DrainState is the progress of a node drain requested by the MCO, or of a
+// drain detected on a cordoned node
+type DrainState string
+
+const (
+	// DrainNone means no drain is requested or the node was uncordoned
+	DrainNone DrainState = ""
+	// DrainRequested means a drain is requested but the node isn't cordoned yet
+	DrainRequested DrainState = "DrainRequested"
+	// Draining means the node is cordoned and its pods are being evicted
+	Draining DrainState = "Draining"
+	// Drained means the requested drain completed
+	Drained DrainState = "Drained"
+)
+
+var drainStates = []DrainState{DrainRequested, Draining, Drained}
+
+// nodeDrainState derives the drain progress from the MCO drain annotations
+func nodeDrainState(node *corev1.Node) DrainState {
+	desired := node.Annotations[DesiredDrainAnnotation]
+	if !strings.HasPrefix(desired, "drain-") {
+		return DrainNone
+	}
+	if node.Annotations[LastAppliedDrainAnnotation] == desired {
+		return Drained
+	}
+	if node.Spec.Unschedulable {
+		return Draining
+	}
+	return DrainRequested
+}
+
+// NodeStatus is the last observed state of a node which is rolling or draining
+type NodeStatus struct {
+	Name      string     `json:"name"`
+	IsRolling bool       `json:"rolling"`
+	Drain     DrainState `json:"drain,omitempty"`
+	// DrainSince is when the current drain state was first observed
+	DrainSince *time.Time `json:"drainSince,omitempty"`
+}
+
+// statusTracker keeps the status of nodes which are rolling or draining
+type statusTracker struct {
+	mu       sync.Mutex
+	statuses map[string]*NodeStatus
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{statuses: make(map[string]*NodeStatus)}
+}
+
+// update records the observed state of a node
+func (t *statusTracker) update(name string, isRolling bool, drain DrainState, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, ok := t.statuses[name]
+	if !isRolling && drain == DrainNone {
+		if ok {
+			delete(t.statuses, name)
+			deleteDrainMetrics(name)
+		}
+		return
+	}
+	if !ok {
+		status = &NodeStatus{Name: name}
+		t.statuses[name] = status
+	}
+
+	status.IsRolling = isRolling
+	if status.Drain != drain {
+		klog.Infof("Node %s drain state changed: %q -> %q", name, status.Drain, drain)
+		status.Drain = drain
+		status.DrainSince = nil
+		if drain != DrainNone {
+			since := now
+			status.DrainSince = &since
+		}
+	}
+
+	for _, state := range drainStates {
+		value := 0.0
+		if state == drain {
+			value = 1
+		}
+		metrics.NodeDrainState.WithLabelValues(name, string(state)).Set(value)
+	}
+	if status.DrainSince != nil {
+		metrics.NodeDrainDuration.WithLabelValues(name).Set(now.Sub(*status.DrainSince).Seconds())
+	} else {
+		metrics.NodeDrainDuration.DeleteLabelValues(name)
+	}
+}
+
+// retain forgets nodes which no longer exist
+func (t *statusTracker) retain(existing map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name := range t.statuses {
+		if !existing[name] {
+			delete(t.statuses, name)
+			deleteDrainMetrics(name)
+		}
+	}
+}
+
+// snapshot returns a copy of all tracked statuses
+func (t *statusTracker) snapshot() []NodeStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]NodeStatus, 0, len(t.statuses))
+	for _, status := range t.statuses {
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+func deleteDrainMetrics(name string) {
+	for _, state := range drainStates {
+		metrics.NodeDrainState.DeleteLabelValues(name, string(state))
+	}
+	metrics.NodeDrainDuration.DeleteLabelValues(name)
+}
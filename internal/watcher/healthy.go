@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"rollout-helper/internal/config"
+)
+
+// Settled returns why a node may still be rolling, or "" if it's done: no
+// rollout is announced by the MCO, the WMCO, a rolling taint or kured, it's
+// schedulable and has been Ready for at least minReady. It only looks at the
+// node, unlike the watcher which also follows drains, machines and pools
+func Settled(node *corev1.Node, rollingTaints []config.Taint, kuredAnnotation string, minReady time.Duration, now time.Time) string {
+	if state, ok := node.Annotations[MachineConfigStateAnnotation]; ok && state != MachineConfigStateDone {
+		return fmt.Sprintf("machine config state is %s", state)
+	}
+	if configPending(node) {
+		return "machine config update pending"
+	}
+	if IsWindows(node) && (windowsUpdating(node) || windowsRebooting(node)) {
+		return "WMCO upgrade in progress"
+	}
+	if hasRollingTaint(node.Spec.Taints, rollingTaints) {
+		return "rolling taint"
+	}
+	if _, ok := node.Annotations[kuredAnnotation]; ok && kuredAnnotation != "" {
+		return "kured reboot in progress"
+	}
+	if node.Spec.Unschedulable {
+		return "cordoned"
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != corev1.NodeReady {
+			continue
+		}
+		if condition.Status != corev1.ConditionTrue {
+			return "not ready"
+		}
+		if since := now.Sub(condition.LastTransitionTime.Time); since < minReady {
+			return fmt.Sprintf("ready for %s only", since.Round(time.Second))
+		}
+		return ""
+	}
+	return "not ready"
+}
@@ -0,0 +1,38 @@
+package watcher
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/authz"
+)
+
+// IgnoreAnnotation opts a node out of silencing when set to "true", e.g. for
+// a node under investigation whose alerts are wanted during its reboots
+const IgnoreAnnotation = "rollout-helper.snappcloud.io/ignore"
+
+// SetAuthorizer only honors the ignore and cloud maintenance annotations of
+// nodes accepted by authorizer, all are honored if it's nil. It must be
+// called before Start
+func (w *Watcher) SetAuthorizer(authorizer authz.Authorizer) {
+	w.authorizer = authorizer
+}
+
+// ignored reports whether the node opted out of silencing
+func (w *Watcher) ignored(node *corev1.Node) bool {
+	if node.Annotations[IgnoreAnnotation] != "true" {
+		return false
+	}
+	return w.authorized(node, IgnoreAnnotation)
+}
+
+// authorized reports whether the annotation key of the node may be honored,
+// rejections are logged
+func (w *Watcher) authorized(node *corev1.Node, key string) bool {
+	object := authz.Object{Kind: "Node", Name: node.Name}
+	if err := authz.Check(w.authorizer, object, node.Annotations, key); err != nil {
+		klog.Warningf("Ignoring annotation of node %s: %v", node.Name, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package watcher
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultKuredAnnotation is set by kured on a node while it drains and reboots it
+const DefaultKuredAnnotation = "weave.works/kured-reboot-in-progress"
+
+// SetKuredAnnotation replaces the annotation kured sets during reboots, empty
+// disables kured detection. It must be called before Start
+func (w *Watcher) SetKuredAnnotation(key string) {
+	w.kuredAnnotation = key
+}
+
+// kuredRebooting reports whether kured is rebooting the node. kured sets the
+// annotation before draining and removes it once the node is back
+func (w *Watcher) kuredRebooting(node *corev1.Node) bool {
+	if w.kuredAnnotation == "" {
+		return false
+	}
+	_, ok := node.Annotations[w.kuredAnnotation]
+	return ok
+}
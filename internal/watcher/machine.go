@@ -0,0 +1,74 @@
+package watcher
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+// MachineResource is the resource of the OpenShift Machine API's Machines
+var MachineResource = schema.GroupVersionResource{
+	Group:    "machine.openshift.io",
+	Version:  "v1beta1",
+	Resource: "machines",
+}
+
+// MachineNamespace is the namespace the Machine API keeps the Machines in
+const MachineNamespace = "openshift-machine-api"
+
+// SetMachinePhases considers the node of a Machine rolling while the Machine
+// is in one of phases, e.g. Deleting while it's replaced. Empty phases
+// disable it. It must be called before Start
+func (w *Watcher) SetMachinePhases(client dynamic.Interface, phases []string) {
+	w.machineClient = client
+	w.machinePhases = make(map[string]bool, len(phases))
+	for _, phase := range phases {
+		if phase = strings.TrimSpace(phase); phase != "" {
+			w.machinePhases[phase] = true
+		}
+	}
+}
+
+// machineNodes returns the nodes whose Machine is in one of the rolling
+// phases, mapped to the phase. Only used by reconcileOnce
+func (w *Watcher) machineNodes(ctx context.Context) map[string]string {
+	if w.machineClient == nil || len(w.machinePhases) == 0 {
+		return nil
+	}
+	list, err := w.machineClient.Resource(MachineResource).Namespace(MachineNamespace).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.Info("Machines aren't available, not watching machine phases")
+		w.machineClient = nil
+		return nil
+	}
+	if err != nil {
+		// The node states alone still apply
+		klog.Errorf("Failed to list machines: %v", err)
+		return nil
+	}
+
+	nodes := make(map[string]string)
+	for _, item := range list.Items {
+		phase, _, _ := unstructured.NestedString(item.Object, "status", "phase")
+		// Deleting machines aren't always reported in the phase yet
+		if item.GetDeletionTimestamp() != nil {
+			phase = "Deleting"
+		}
+		if !w.machinePhases[phase] {
+			continue
+		}
+		// Machines which are still provisioning may not have a node yet
+		node, _, _ := unstructured.NestedString(item.Object, "status", "nodeRef", "name")
+		if node == "" {
+			continue
+		}
+		nodes[node] = phase
+	}
+	return nodes
+}
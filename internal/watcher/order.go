@@ -0,0 +1,157 @@
+package watcher
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ZoneLabel is the topology label the MCO orders the nodes of a pool by
+const ZoneLabel = "topology.kubernetes.io/zone"
+
+// poolRollout tracks the update of a pool to a rendered config
+type poolRollout struct {
+	target string
+	// updating maps the nodes being updated to when they were first seen updating
+	updating map[string]time.Time
+	// durations are how long the nodes which reached target were updating
+	durations []time.Duration
+}
+
+// SetPreSilenceWindow considers the nodes the MCO updates next rolling once
+// the update of the current ones is expected to end within d, zero disables
+// it. It must be called before Start
+func (w *Watcher) SetPreSilenceWindow(d time.Duration) {
+	w.preSilenceWindow = d
+}
+
+// upcomingNodes returns the nodes of rolling pools the MCO is expected to
+// pick within the pre-silence window, only used by reconcileOnce
+func (w *Watcher) upcomingNodes(nodes []corev1.Node, now time.Time) map[string]bool {
+	pools := make(map[string][]*corev1.Node)
+	for i := range nodes {
+		node := &nodes[i]
+		if IsWindows(node) {
+			continue
+		}
+		if pool := NodePool(node); pool != "" {
+			pools[pool] = append(pools[pool], node)
+		}
+	}
+
+	upcoming := make(map[string]bool)
+	for pool, members := range pools {
+		rollout := w.trackRollout(pool, members, now)
+		if rollout == nil {
+			continue
+		}
+
+		queue := pendingNodes(members, rollout.target)
+		if len(queue) == 0 || !rollout.endingWithin(w.preSilenceWindow, now) {
+			continue
+		}
+		// The MCO picks as many nodes as it's updating now, bounded by maxUnavailable
+		batch := len(rollout.updating)
+		if batch > len(queue) {
+			batch = len(queue)
+		}
+		for _, node := range queue[:batch] {
+			if !w.upcoming[node.Name] {
+				klog.Infof("Node %s is expected to be updated next in pool %s, pre-silencing", node.Name, pool)
+			}
+			upcoming[node.Name] = true
+		}
+	}
+	for name := range w.rollouts {
+		if _, ok := pools[name]; !ok {
+			delete(w.rollouts, name)
+		}
+	}
+	w.upcoming = upcoming
+	return upcoming
+}
+
+// trackRollout updates the rollout of a pool from its nodes, it returns nil
+// if no node of the pool is being updated
+func (w *Watcher) trackRollout(pool string, members []*corev1.Node, now time.Time) *poolRollout {
+	target := ""
+	for _, node := range members {
+		if configPending(node) {
+			target = node.Annotations[DesiredConfigAnnotation]
+			break
+		}
+	}
+	if target == "" {
+		delete(w.rollouts, pool)
+		return nil
+	}
+
+	rollout, ok := w.rollouts[pool]
+	if !ok || rollout.target != target {
+		rollout = &poolRollout{target: target, updating: make(map[string]time.Time)}
+		w.rollouts[pool] = rollout
+	}
+
+	updating := make(map[string]bool)
+	for _, node := range members {
+		if node.Annotations[DesiredConfigAnnotation] == target && configPending(node) {
+			updating[node.Name] = true
+			if _, ok := rollout.updating[node.Name]; !ok {
+				rollout.updating[node.Name] = now
+			}
+		}
+	}
+	for name, since := range rollout.updating {
+		if !updating[name] {
+			delete(rollout.updating, name)
+			rollout.durations = append(rollout.durations, now.Sub(since))
+		}
+	}
+	return rollout
+}
+
+// endingWithin reports whether the update of the oldest updating node is
+// expected to end within d, estimated from the nodes which finished. Before
+// any node finished the end is unknown and no node is expected next
+func (r *poolRollout) endingWithin(d time.Duration, now time.Time) bool {
+	if len(r.durations) == 0 {
+		return false
+	}
+	var total time.Duration
+	for _, duration := range r.durations {
+		total += duration
+	}
+	average := total / time.Duration(len(r.durations))
+
+	var oldest time.Time
+	for _, since := range r.updating {
+		if oldest.IsZero() || since.Before(oldest) {
+			oldest = since
+		}
+	}
+	return oldest.Add(average).Sub(now) <= d
+}
+
+// pendingNodes returns the nodes which still need to be updated to target in
+// the order the MCO picks them: by zone, then oldest first
+func pendingNodes(members []*corev1.Node, target string) []*corev1.Node {
+	var pending []*corev1.Node
+	for _, node := range members {
+		if node.Annotations[CurrentConfigAnnotation] != target && node.Annotations[DesiredConfigAnnotation] != target {
+			pending = append(pending, node)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		a, b := pending[i], pending[j]
+		if a.Labels[ZoneLabel] != b.Labels[ZoneLabel] {
+			return a.Labels[ZoneLabel] < b.Labels[ZoneLabel]
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+	return pending
+}
@@ -0,0 +1,39 @@
+package watcher
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// CurrentConfigAnnotation holds the name of the rendered MachineConfig the node runs
+	CurrentConfigAnnotation = "machineconfiguration.openshift.io/currentConfig"
+	// DesiredConfigAnnotation holds the name of the rendered MachineConfig the MCO wants the node to run
+	DesiredConfigAnnotation = "machineconfiguration.openshift.io/desiredConfig"
+)
+
+// configPending reports whether the MCO picked the node for an update which
+// didn't start yet. The desired config is set before the MCD drains the node
+// and moves the state to Working
+func configPending(node *corev1.Node) bool {
+	desired := node.Annotations[DesiredConfigAnnotation]
+	return desired != "" && desired != node.Annotations[CurrentConfigAnnotation]
+}
+
+// NodePool returns the MachineConfigPool of a node, derived from its rendered
+// config name "rendered-<pool>-<hash>", WindowsPool for Windows nodes, or ""
+// if it can't be determined
+func NodePool(node *corev1.Node) string {
+	if IsWindows(node) {
+		return WindowsPool
+	}
+	rendered := strings.TrimPrefix(node.Annotations[CurrentConfigAnnotation], "rendered-")
+	if rendered == node.Annotations[CurrentConfigAnnotation] {
+		return ""
+	}
+	if i := strings.LastIndex(rendered, "-"); i > 0 {
+		return rendered[:i]
+	}
+	return ""
+}
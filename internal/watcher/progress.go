@@ -0,0 +1,127 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// poolMachineCounts maps the states of the pool_machines metric to the
+// counts of the MachineConfigPool status
+var poolMachineCounts = map[string]string{
+	"total":       "machineCount",
+	"updated":     "updatedMachineCount",
+	"ready":       "readyMachineCount",
+	"unavailable": "unavailableMachineCount",
+	"degraded":    "degradedMachineCount",
+}
+
+// MachineConfigPoolResource is the resource of the MCO's MachineConfigPools
+var MachineConfigPoolResource = schema.GroupVersionResource{
+	Group:    "machineconfiguration.openshift.io",
+	Version:  "v1",
+	Resource: "machineconfigpools",
+}
+
+// PoolProgress is the update progress of a MachineConfigPool as reported in its status
+type PoolProgress struct {
+	Pool    string `json:"pool"`
+	Updated int64  `json:"updated"`
+	Total   int64  `json:"total"`
+}
+
+// ProgressTracker polls the status of the MachineConfigPools
+type ProgressTracker struct {
+	client   dynamic.Interface
+	interval time.Duration
+
+	mu    sync.Mutex
+	pools map[string]PoolProgress
+}
+
+func NewProgressTracker(client dynamic.Interface, interval time.Duration) *ProgressTracker {
+	return &ProgressTracker{
+		client:   client,
+		interval: interval,
+		pools:    make(map[string]PoolProgress),
+	}
+}
+
+func (t *ProgressTracker) Start(ctx context.Context) {
+	go t.run(ctx)
+}
+
+// Progress returns the last observed progress of a pool
+func (t *ProgressTracker) Progress(pool string) (PoolProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	progress, ok := t.pools[pool]
+	return progress, ok
+}
+
+func (t *ProgressTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if !t.poll(ctx) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll updates the progress of all pools, it returns false if the cluster has no MachineConfigPools
+func (t *ProgressTracker) poll(ctx context.Context) bool {
+	list, err := t.client.Resource(MachineConfigPoolResource).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.Info("MachineConfigPools aren't available, not tracking pool progress")
+		return false
+	}
+	if err != nil {
+		klog.Errorf("Failed to list MachineConfigPools: %v", err)
+		return true
+	}
+
+	pools := make(map[string]PoolProgress, len(list.Items))
+	for _, item := range list.Items {
+		total, _, _ := unstructured.NestedInt64(item.Object, "status", "machineCount")
+		updated, _, _ := unstructured.NestedInt64(item.Object, "status", "updatedMachineCount")
+		pools[item.GetName()] = PoolProgress{Pool: item.GetName(), Updated: updated, Total: total}
+
+		ratio := 1.0
+		if total > 0 {
+			ratio = float64(updated) / float64(total)
+		}
+		metrics.PoolRolloutProgress.WithLabelValues(item.GetName()).Set(ratio)
+		for state, field := range poolMachineCounts {
+			count, _, _ := unstructured.NestedInt64(item.Object, "status", field)
+			metrics.PoolMachines.WithLabelValues(item.GetName(), state).Set(float64(count))
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name := range t.pools {
+		if _, ok := pools[name]; !ok {
+			metrics.PoolRolloutProgress.DeleteLabelValues(name)
+			metrics.PoolMachines.DeletePartialMatch(prometheus.Labels{"pool": name})
+		}
+	}
+	t.pools = pools
+	return true
+}
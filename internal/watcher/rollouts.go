@@ -0,0 +1,49 @@
+package watcher
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"rollout-helper/internal/metrics"
+)
+
+// nodeUpdating reports whether the MCO, or the WMCO for Windows nodes, is
+// updating the node according to its annotations
+func nodeUpdating(node *corev1.Node) bool {
+	if IsWindows(node) {
+		return windowsUpdating(node)
+	}
+	return node.Annotations[MachineConfigStateAnnotation] == MachineConfigStateWorking
+}
+
+// observeRollout records when a node started rolling, and the duration of
+// its rollout once it's done. Only used by reconcileOnce
+func (w *Watcher) observeRollout(name, pool string, isRolling bool, now time.Time) {
+	if isRolling {
+		w.rollingSince[name] = now
+		return
+	}
+	// Rollouts in progress when the helper started have no known start
+	since, ok := w.rollingSince[name]
+	if !ok {
+		return
+	}
+	delete(w.rollingSince, name)
+	metrics.NodeRolloutDuration.WithLabelValues(pool).Observe(now.Sub(since).Seconds())
+}
+
+// setUpdatingNodes exports the number of updating nodes of every pool with
+// nodes, and drops the pools which have none anymore. Only used by reconcileOnce
+func (w *Watcher) setUpdatingNodes(updating map[string]int) {
+	for pool := range w.updatingPools {
+		if _, ok := updating[pool]; !ok {
+			metrics.PoolNodesUpdating.DeleteLabelValues(pool)
+			delete(w.updatingPools, pool)
+		}
+	}
+	for pool, count := range updating {
+		metrics.PoolNodesUpdating.WithLabelValues(pool).Set(float64(count))
+		w.updatingPools[pool] = true
+	}
+}
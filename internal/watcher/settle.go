@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"rollout-helper/internal/metrics"
+)
+
+// DefaultSettleTime is how long a node has to look done before it's reported done
+const DefaultSettleTime = time.Minute
+
+// SetSettleTime replaces how long a rolling node has to look done before it's
+// reported done, zero reports it right away. It must be called before Start
+func (w *Watcher) SetSettleTime(d time.Duration) {
+	w.settleTime = d
+}
+
+// settling reports whether a rolling node which looks done is still reported
+// as rolling. The taint and the MCO state don't change at the same time, a
+// node which briefly looks done between the two must not end its rollout and
+// start another one. Only used by reconcileOnce
+func (w *Watcher) settling(name string, isRolling bool, now time.Time) bool {
+	since, ok := w.settleSince[name]
+	if isRolling {
+		if ok {
+			delete(w.settleSince, name)
+			metrics.RolloutFlapsSuppressed.Inc()
+			klog.Infof("Node %s is rolling again after looking done for %s", name, now.Sub(since).Round(time.Second))
+		}
+		return false
+	}
+
+	prevState, _ := w.previousStates.Load(name)
+	if wasRolling, _ := prevState.(bool); !wasRolling || w.settleTime <= 0 {
+		return false
+	}
+	if !ok {
+		w.settleSince[name] = now
+		return true
+	}
+	if now.Sub(since) < w.settleTime {
+		return true
+	}
+	delete(w.settleSince, name)
+	return false
+}
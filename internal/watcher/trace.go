@@ -0,0 +1,27 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"rollout-helper/internal/tracing"
+)
+
+// traceState starts the trace of a state change at polled, the start of the
+// poll which observed it, and stores its span context in the state so the
+// handling of the state continues the trace. Only used by reconcileOnce
+func traceState(ctx context.Context, state *NodeState, polled time.Time) {
+	_, span := tracing.Tracer().Start(ctx, "Watcher.NodeStateChanged",
+		trace.WithTimestamp(polled),
+		trace.WithAttributes(
+			attribute.String("node", state.Name),
+			attribute.Bool("rolling", state.IsRolling),
+			attribute.Bool("deleted", state.Deleted),
+			attribute.String("pool", state.Pool),
+		))
+	state.SpanContext = span.SpanContext()
+	span.End()
+}
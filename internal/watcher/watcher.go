@@ -3,12 +3,20 @@ package watcher
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/scope"
 )
 
 const (
@@ -20,87 +28,307 @@ const (
 	MachineConfigStateDone = "Done"
 )
 
+// DefaultRollingTaints are the taints marking a node as rolling unless configured otherwise
+var DefaultRollingTaints = []config.Taint{{Key: "wait-for-runc"}}
+
 type NodeState struct {
 	Name      string
 	IsRolling bool
+	// Updating is set while the MCO applies a new config to the node, or the WMCO upgrades a Windows node
+	Updating bool
+	// Windows is set for Windows nodes managed by the WMCO
+	Windows bool
+	Drain   DrainState
+	// Pool is the MachineConfigPool of the node, empty if unknown
+	Pool string
+	// Deleted is set for nodes which were deleted while rolling, IsRolling is false
+	Deleted bool
+	// MachinePhase is the phase of the node's Machine if it's one of the rolling phases
+	MachinePhase string
+	// OSImage and KubeletVersion are reported by the node when the change was detected
+	OSImage        string
+	KubeletVersion string
+	// SpanContext is the span of the detected change, the parent of the spans handling it
+	SpanContext trace.SpanContext
 }
 
 type Watcher struct {
-	client  kubernetes.Interface
+	client   kubernetes.Interface
+	interval time.Duration
+	// clock is the time source of the polls, settling and drain durations
+	clock   clock.WithTicker
 	stateCh chan NodeState
 	// Track previous states to detect changes
 	previousStates sync.Map
+	statuses       *statusTracker
+	rollingTaints  []config.Taint
+	// kuredAnnotation marks nodes rebooted by kured, empty if disabled
+	kuredAnnotation string
+	// preRolling treats nodes with a pending config as rolling
+	preRolling bool
+	// detectDrains treats cordoned nodes with evictions as rolling
+	detectDrains bool
+	// namespaces are the namespaces pods and events are listed in, all if empty
+	namespaces scope.Namespaces
+	// nodeSelector is the label selector of the watched nodes, all if empty
+	nodeSelector string
+	// drained are the cordoned nodes a drain was detected on, only used by reconcileOnce
+	drained map[string]bool
+	// preSilenceWindow is the lead time of silences before the MCO picks a node, zero if disabled
+	preSilenceWindow time.Duration
+	// rollouts and upcoming track the updates of pools, only used by reconcileOnce
+	rollouts map[string]*poolRollout
+	upcoming map[string]bool
+	// settleTime is how long a rolling node has to look done, settleSince
+	// when it first did, only used by reconcileOnce
+	settleTime  time.Duration
+	settleSince map[string]time.Time
+	// rollingSince maps the rolling nodes to when they started rolling,
+	// updatingPools are the pools with exported updating nodes, only used by
+	// reconcileOnce
+	rollingSince  map[string]time.Time
+	updatingPools map[string]bool
+	// cloudMaintenanceLead is how long before a planned host maintenance a node is rolling, zero if disabled
+	cloudMaintenanceLead time.Duration
+	// authorizer decides whether the annotations of nodes changing what is
+	// silenced are honored, all are if nil
+	authorizer authz.Authorizer
+	// machineClient lists the Machines, nil if machine phases aren't watched
+	machineClient dynamic.Interface
+	// machinePhases are the Machine phases their node is rolling in
+	machinePhases map[string]bool
+	// lastPoll is when the nodes were last polled and their changes handed
+	// over, in Unix nanoseconds
+	lastPoll atomic.Int64
+	// pollHandler is called with the rolling nodes after every poll, nil if unset
+	pollHandler func(ctx context.Context, rolling map[string]bool)
 }
 
-func NewWatcher(client kubernetes.Interface) *Watcher {
+func NewWatcher(client kubernetes.Interface, interval time.Duration) *Watcher {
 	return &Watcher{
-		client:  client,
-		stateCh: make(chan NodeState, 10),
+		client:   client,
+		interval: interval,
+		clock:    clock.RealClock{},
+		stateCh:  make(chan NodeState, 10),
+		statuses: newStatusTracker(),
+		// Copied so SetRollingTaints never aliases the package default
+		rollingTaints:   append([]config.Taint(nil), DefaultRollingTaints...),
+		kuredAnnotation: DefaultKuredAnnotation,
+		drained:         make(map[string]bool),
+		rollouts:        make(map[string]*poolRollout),
+		settleTime:      DefaultSettleTime,
+		settleSince:     make(map[string]time.Time),
+		rollingSince:    make(map[string]time.Time),
+		updatingPools:   make(map[string]bool),
 	}
 }
 
+// SetPreRolling considers nodes rolling as soon as the MCO sets a new desired
+// config, before the drain starts. It must be called before Start
+func (w *Watcher) SetPreRolling(enabled bool) {
+	w.preRolling = enabled
+}
+
+// SetRollingTaints replaces the taints marking a node as rolling, it must be called before Start
+func (w *Watcher) SetRollingTaints(taints []config.Taint) {
+	w.rollingTaints = taints
+}
+
+// SetNodeSelector only watches the nodes matching the label selector. Nodes
+// which stop matching while rolling are reported like deleted nodes. It must
+// be called before Start
+func (w *Watcher) SetNodeSelector(selector string) {
+	w.nodeSelector = selector
+}
+
+// SetClock replaces the time source of the watcher, e.g. with a fake clock
+// to step through settling deterministically. It must be called before Start
+func (w *Watcher) SetClock(c clock.WithTicker) {
+	w.clock = c
+}
+
+// SetPollHandler calls handler with the nodes reported as rolling after every
+// successful poll, once their changes are queued. It's called by the polling
+// goroutine and must be called before Start
+func (w *Watcher) SetPollHandler(handler func(ctx context.Context, rolling map[string]bool)) {
+	w.pollHandler = handler
+}
+
 func (w *Watcher) Start(ctx context.Context) {
 	go w.watchNodes(ctx)
 }
 
+// StateChannel returns the node state changes, it's closed once ctx of Start
+// is cancelled and the changes of the last poll were queued
 func (w *Watcher) StateChannel() <-chan NodeState {
 	return w.stateCh
 }
 
+// LastPoll returns when the nodes were last polled successfully and their
+// changes were queued on the state channel, zero before the first poll. It
+// falls behind while nobody reads the channel
+func (w *Watcher) LastPoll() time.Time {
+	if nanos := w.lastPoll.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+// Statuses returns the last observed status of nodes which are rolling or draining
+func (w *Watcher) Statuses() []NodeStatus {
+	return w.statuses.snapshot()
+}
+
 func (w *Watcher) watchNodes(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := w.clock.NewTicker(w.interval)
 	defer ticker.Stop()
+	// Only the polls of watchNodes send, readers drain the channel until it's closed
+	defer close(w.stateCh)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			nodes, err := w.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-			if err != nil {
+		case <-ticker.C():
+			if err := w.reconcileOnce(ctx); err != nil {
 				klog.Errorf("Failed to list nodes: %v", err)
-				continue
 			}
+		}
+	}
+}
+
+// Poll polls the nodes once like a tick of a started watcher, e.g. to step a
+// watcher which isn't started through its polls with a fake clock. The
+// changes are queued on the state channel, so it blocks while it's full
+func (w *Watcher) Poll(ctx context.Context) error {
+	return w.reconcileOnce(ctx)
+}
+
+// reconcileOnce polls the nodes once and queues their changes on the state
+// channel, blocking while it's full. It returns the error of listing the
+// nodes. Only called by watchNodes, or directly to step through the polls
+// synchronously
+func (w *Watcher) reconcileOnce(ctx context.Context) error {
+	polled := w.clock.Now()
+	nodes, err := w.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: w.nodeSelector})
+	if err != nil {
+		return err
+	}
+
+	var upcoming map[string]bool
+	if w.preSilenceWindow > 0 {
+		upcoming = w.upcomingNodes(nodes.Items, w.clock.Now())
+	}
+	machines := w.machineNodes(ctx)
+
+	existing := make(map[string]bool, len(nodes.Items))
+	rolling := make(map[string]bool)
+	updating := make(map[string]int)
+	for _, node := range nodes.Items {
+		existing[node.Name] = true
+		if pool := NodePool(&node); pool != "" {
+			// Pools without updating nodes are exported with 0
+			count := updating[pool]
+			if nodeUpdating(&node) {
+				count++
+			}
+			updating[pool] = count
+		}
+		drain := nodeDrainState(&node)
+		state, exists := node.Annotations[MachineConfigStateAnnotation]
+		// Reboots are announced by a taint, or by kured on non-OpenShift nodes
+		isTainted := hasRollingTaint(node.Spec.Taints, w.rollingTaints) || w.kuredRebooting(&node)
+		// The host goes down for planned cloud maintenance, announced ahead by the cloud agent
+		isTainted = isTainted || w.cloudMaintenance(&node, w.clock.Now())
+
+		// if machine-config is working or tainted , it's rolling
+		isUpdating := exists && state == MachineConfigStateWorking
+		if w.preRolling && configPending(&node) {
+			// Silence ahead of the drain instead of reacting once Working appears
+			isUpdating = true
+		}
+		if IsWindows(&node) {
+			// Windows nodes are updated by the WMCO instead of the MCD
+			isUpdating = windowsUpdating(&node)
+			isTainted = isTainted || windowsRebooting(&node)
+		}
+		if upcoming[node.Name] {
+			// Silenced ahead of the MCO picking the node, as part of the pool update
+			isUpdating = true
+		}
+		// The node's machine is being replaced or provisioned by the Machine API
+		machinePhase := machines[node.Name]
+		isRolling := isUpdating || isTainted || machinePhase != ""
+		if w.detectDrains && !isRolling && w.drainDetected(ctx, &node) {
+			// Drains outside the MCO are reported as draining for the drain kind and status
+			isRolling = true
+			if drain == DrainNone {
+				drain = Draining
+			}
+		}
+		if w.settling(node.Name, isRolling, w.clock.Now()) {
+			isRolling = true
+		}
+		if isRolling && w.ignored(&node) {
+			// Opted out, a silenced node is unsilenced right away
+			klog.V(2).Infof("Ignoring rollout of node %s, it's annotated with %s", node.Name, IgnoreAnnotation)
+			delete(w.settleSince, node.Name)
+			isRolling = false
+		}
+		w.statuses.update(node.Name, isRolling, drain, w.clock.Now())
+		if isRolling {
+			rolling[node.Name] = true
+		}
 
-			for _, node := range nodes.Items {
-				state, exists := node.Annotations[MachineConfigStateAnnotation]
-				// TODO: also consider another annotation used for manual node reboots
-				isTainted := containTaint(node.Spec.Taints, "wait-for-runc")
-
-				// if machine-config is working or tainted , it's rolling
-				isRolling := (exists && state == MachineConfigStateWorking) || (isTainted)
-
-				// Get previous state with type-safe handling
-				prevState, _ := w.previousStates.LoadOrStore(node.Name, false)
-				wasRolling, ok := prevState.(bool)
-				if !ok {
-					wasRolling = false
-					klog.Warningf("Invalid state type for node %s, resetting to false", node.Name)
-				}
-
-				// Only send state changes
-				if isRolling != wasRolling {
-					w.previousStates.Store(node.Name, isRolling)
-					w.stateCh <- NodeState{
-						Name:      node.Name,
-						IsRolling: isRolling,
-					}
-					klog.Infof("Node %s state changed: rolling=%v", node.Name, isRolling)
-
-					// no longer need to track
-					if !isRolling {
-						w.previousStates.Delete(node.Name)
-					}
-				}
+		// Get previous state with type-safe handling
+		prevState, _ := w.previousStates.LoadOrStore(node.Name, false)
+		wasRolling, ok := prevState.(bool)
+		if !ok {
+			wasRolling = false
+			klog.Warningf("Invalid state type for node %s, resetting to false", node.Name)
+		}
+
+		// Only send state changes
+		if isRolling != wasRolling {
+			w.previousStates.Store(node.Name, isRolling)
+			changed := NodeState{
+				Name:           node.Name,
+				IsRolling:      isRolling,
+				Updating:       isUpdating,
+				Windows:        IsWindows(&node),
+				Drain:          drain,
+				Pool:           NodePool(&node),
+				MachinePhase:   machinePhase,
+				OSImage:        node.Status.NodeInfo.OSImage,
+				KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+			}
+			traceState(ctx, &changed, polled)
+			w.observeRollout(node.Name, changed.Pool, isRolling, polled)
+			w.stateCh <- changed
+			klog.InfoS("Node state changed", "node", node.Name, "rolling", isRolling, "pool", NodePool(&node))
+
+			// no longer need to track
+			if !isRolling {
+				w.previousStates.Delete(node.Name)
 			}
 		}
 	}
+	w.forgetDeleted(ctx, existing, polled)
+	w.setUpdatingNodes(updating)
+	if w.pollHandler != nil {
+		w.pollHandler(ctx, rolling)
+	}
+	w.lastPoll.Store(w.clock.Now().UnixNano())
+	return nil
 }
 
-func containTaint(taints []corev1.Taint, taintName string) bool {
+// hasRollingTaint reports whether any of the node's taints is selected by rolling
+func hasRollingTaint(taints []corev1.Taint, rolling []config.Taint) bool {
 	for _, t := range taints {
-		if t.Key == taintName {
-			return true
+		for _, r := range rolling {
+			if r.Matches(t) {
+				return true
+			}
 		}
 	}
 	return false
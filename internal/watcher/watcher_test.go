@@ -0,0 +1,250 @@
+package watcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/config"
+)
+
+// testWatcher steps a watcher through its polls with a fake clientset and clock
+type testWatcher struct {
+	t      *testing.T
+	w      *Watcher
+	client *fake.Clientset
+	clock  *clocktesting.FakeClock
+}
+
+func newTestWatcher(t *testing.T, settleTime time.Duration, nodes ...*corev1.Node) *testWatcher {
+	client := fake.NewSimpleClientset()
+	for _, node := range nodes {
+		if _, err := client.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Failed to create node %s: %v", node.Name, err)
+		}
+	}
+	clock := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := NewWatcher(client, time.Second)
+	w.SetClock(clock)
+	w.SetSettleTime(settleTime)
+	return &testWatcher{t: t, w: w, client: client, clock: clock}
+}
+
+// poll runs one poll and returns the states it queued
+func (tw *testWatcher) poll() []NodeState {
+	tw.t.Helper()
+	if err := tw.w.reconcileOnce(context.Background()); err != nil {
+		tw.t.Fatalf("Poll failed: %v", err)
+	}
+	var states []NodeState
+	for {
+		select {
+		case state := <-tw.w.StateChannel():
+			states = append(states, state)
+		default:
+			return states
+		}
+	}
+}
+
+// update changes a node through the fake clientset
+func (tw *testWatcher) update(name string, change func(node *corev1.Node)) {
+	tw.t.Helper()
+	ctx := context.Background()
+	node, err := tw.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		tw.t.Fatalf("Failed to get node %s: %v", name, err)
+	}
+	change(node)
+	if _, err := tw.client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		tw.t.Fatalf("Failed to update node %s: %v", name, err)
+	}
+}
+
+func (tw *testWatcher) expectNone(states []NodeState) {
+	tw.t.Helper()
+	if len(states) != 0 {
+		tw.t.Fatalf("Expected no state change, got %+v", states)
+	}
+}
+
+func (tw *testWatcher) expectRolling(states []NodeState, name string, rolling bool) NodeState {
+	tw.t.Helper()
+	if len(states) != 1 {
+		tw.t.Fatalf("Expected one state change of node %s, got %+v", name, states)
+	}
+	if states[0].Name != name || states[0].IsRolling != rolling {
+		tw.t.Fatalf("Expected node %s to be rolling=%t, got %+v", name, rolling, states[0])
+	}
+	return states[0]
+}
+
+func newNode(name, state string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name: name,
+		Annotations: map[string]string{
+			MachineConfigStateAnnotation: state,
+			CurrentConfigAnnotation:      "rendered-worker-0123",
+		},
+	}}
+}
+
+func setState(state string) func(node *corev1.Node) {
+	return func(node *corev1.Node) {
+		node.Annotations[MachineConfigStateAnnotation] = state
+	}
+}
+
+func TestReconcileWorkingToDone(t *testing.T) {
+	tw := newTestWatcher(t, 0, newNode("worker-0", MachineConfigStateDone))
+	tw.expectNone(tw.poll())
+
+	tw.update("worker-0", setState(MachineConfigStateWorking))
+	state := tw.expectRolling(tw.poll(), "worker-0", true)
+	if !state.Updating || state.Pool != "worker" {
+		t.Errorf("Expected an update of pool worker, got %+v", state)
+	}
+	tw.expectNone(tw.poll())
+
+	tw.update("worker-0", setState(MachineConfigStateDone))
+	tw.expectRolling(tw.poll(), "worker-0", false)
+	tw.expectNone(tw.poll())
+}
+
+func TestReconcileSettleTime(t *testing.T) {
+	tw := newTestWatcher(t, time.Minute, newNode("worker-0", MachineConfigStateWorking))
+	tw.expectRolling(tw.poll(), "worker-0", true)
+
+	// Done isn't reported until the node looked done for the settle time
+	tw.update("worker-0", setState(MachineConfigStateDone))
+	tw.expectNone(tw.poll())
+	tw.clock.Step(59 * time.Second)
+	tw.expectNone(tw.poll())
+	tw.clock.Step(time.Second)
+	tw.expectRolling(tw.poll(), "worker-0", false)
+}
+
+func TestReconcileSettleTimeFlap(t *testing.T) {
+	tw := newTestWatcher(t, time.Minute, newNode("worker-0", MachineConfigStateWorking))
+	tw.expectRolling(tw.poll(), "worker-0", true)
+
+	// Briefly looking done doesn't end the rollout
+	tw.update("worker-0", setState(MachineConfigStateDone))
+	tw.expectNone(tw.poll())
+	tw.clock.Step(30 * time.Second)
+	tw.update("worker-0", setState(MachineConfigStateWorking))
+	tw.expectNone(tw.poll())
+
+	// Settling starts over once the node looks done again
+	tw.clock.Step(time.Minute)
+	tw.update("worker-0", setState(MachineConfigStateDone))
+	tw.expectNone(tw.poll())
+	tw.clock.Step(time.Minute)
+	tw.expectRolling(tw.poll(), "worker-0", false)
+}
+
+func TestReconcileRollingTaint(t *testing.T) {
+	tw := newTestWatcher(t, 0, newNode("worker-0", MachineConfigStateDone))
+	tw.expectNone(tw.poll())
+
+	tw.update("worker-0", func(node *corev1.Node) {
+		node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{Key: "wait-for-runc", Effect: corev1.TaintEffectNoSchedule})
+	})
+	state := tw.expectRolling(tw.poll(), "worker-0", true)
+	if state.Updating {
+		t.Errorf("Expected a tainted node not to be updating, got %+v", state)
+	}
+	tw.expectNone(tw.poll())
+
+	tw.update("worker-0", func(node *corev1.Node) {
+		node.Spec.Taints = nil
+	})
+	tw.expectRolling(tw.poll(), "worker-0", false)
+}
+
+func TestReconcileConfiguredRollingTaint(t *testing.T) {
+	tw := newTestWatcher(t, 0, newNode("worker-0", MachineConfigStateDone))
+	tw.w.SetRollingTaints([]config.Taint{{Key: "reboot", Effect: corev1.TaintEffectNoExecute}})
+
+	// The default taint and other effects no longer mark the node as rolling
+	tw.update("worker-0", func(node *corev1.Node) {
+		node.Spec.Taints = []corev1.Taint{
+			{Key: "wait-for-runc", Effect: corev1.TaintEffectNoSchedule},
+			{Key: "reboot", Effect: corev1.TaintEffectNoSchedule},
+		}
+	})
+	tw.expectNone(tw.poll())
+
+	tw.update("worker-0", func(node *corev1.Node) {
+		node.Spec.Taints = []corev1.Taint{{Key: "reboot", Effect: corev1.TaintEffectNoExecute}}
+	})
+	tw.expectRolling(tw.poll(), "worker-0", true)
+
+	tw.update("worker-0", func(node *corev1.Node) {
+		node.Spec.Taints = nil
+	})
+	tw.expectRolling(tw.poll(), "worker-0", false)
+}
+
+func TestReconcileUnauthorizedIgnore(t *testing.T) {
+	node := newNode("worker-0", MachineConfigStateWorking)
+	node.Annotations[IgnoreAnnotation] = "true"
+	tw := newTestWatcher(t, 0, node)
+	keys := map[string][][]byte{"sre": {[]byte("secret")}}
+	signed, err := authz.NewSigned(keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.w.SetAuthorizer(signed)
+	tw.expectRolling(tw.poll(), "worker-0", true)
+
+	tw.update("worker-0", func(node *corev1.Node) {
+		object := authz.Object{Kind: "Node", Name: "worker-0"}
+		node.Annotations[IgnoreAnnotation+authz.SignatureSuffix] = authz.Sign("sre", keys["sre"][0], object, IgnoreAnnotation, "true")
+	})
+	tw.expectRolling(tw.poll(), "worker-0", false)
+}
+
+func TestReconcilePollHandler(t *testing.T) {
+	tw := newTestWatcher(t, 0, newNode("worker-0", MachineConfigStateWorking), newNode("worker-1", MachineConfigStateDone))
+	var polled map[string]bool
+	tw.w.SetPollHandler(func(_ context.Context, rolling map[string]bool) {
+		polled = rolling
+	})
+
+	tw.expectRolling(tw.poll(), "worker-0", true)
+	if len(polled) != 1 || !polled["worker-0"] {
+		t.Fatalf("Expected worker-0 to be polled as rolling, got %v", polled)
+	}
+
+	// Reported after every poll, not only on changes
+	tw.update("worker-0", setState(MachineConfigStateDone))
+	tw.expectRolling(tw.poll(), "worker-0", false)
+	tw.expectNone(tw.poll())
+	if polled == nil || len(polled) != 0 {
+		t.Fatalf("Expected no node to be polled as rolling, got %v", polled)
+	}
+}
+
+func TestEndingWithinNeedsHistory(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rollout := &poolRollout{updating: map[string]time.Time{"worker-0": now.Add(-time.Minute)}}
+	// Without a finished node the end of the update is unknown
+	if rollout.endingWithin(time.Hour, now) {
+		t.Fatal("Expected a rollout without history not to be ending")
+	}
+
+	rollout.durations = []time.Duration{10 * time.Minute}
+	if !rollout.endingWithin(10*time.Minute, now) {
+		t.Error("Expected the rollout to end within its average update time")
+	}
+	if rollout.endingWithin(5*time.Minute, now) {
+		t.Error("Expected the rollout not to end within 5m")
+	}
+}
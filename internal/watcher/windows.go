@@ -0,0 +1,37 @@
+package watcher
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// OSLabel is the well-known label holding the operating system of a node
+	OSLabel = "kubernetes.io/os"
+	// WindowsPool is the pool Windows nodes are reported in, they aren't part of a MachineConfigPool
+	WindowsPool = "windows"
+
+	// WMCOVersionAnnotation holds the WMCO version a Windows node is configured with
+	WMCOVersionAnnotation = "windowsmachineconfig.openshift.io/version"
+	// WMCODesiredVersionAnnotation holds the WMCO version a Windows node is being upgraded to
+	WMCODesiredVersionAnnotation = "windowsmachineconfig.openshift.io/desired-version"
+	// WMCORebootAnnotation is set by the WMCO while a Windows node waits for a reboot
+	WMCORebootAnnotation = "windowsmachineconfig.openshift.io/reboot-required"
+)
+
+// IsWindows reports whether the node is a Windows worker
+func IsWindows(node *corev1.Node) bool {
+	return node.Labels[OSLabel] == "windows"
+}
+
+// windowsUpdating reports whether the WMCO is upgrading a Windows node. The
+// WMCO doesn't use the MCO state annotation, it sets the desired version and
+// updates the configured version once the node is done
+func windowsUpdating(node *corev1.Node) bool {
+	desired, ok := node.Annotations[WMCODesiredVersionAnnotation]
+	return ok && desired != "" && desired != node.Annotations[WMCOVersionAnnotation]
+}
+
+// windowsRebooting reports whether the WMCO is about to reboot a Windows node
+func windowsRebooting(node *corev1.Node) bool {
+	return node.Annotations[WMCORebootAnnotation] == "true"
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/klog/v2"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"rollout-helper/internal/alertmanager"
+	amfake "rollout-helper/internal/alertmanager/fake"
+	"rollout-helper/internal/config"
+	"rollout-helper/internal/state"
+	"rollout-helper/internal/watcher"
+)
+
+const (
+	// lifecycleNode is the node the scenarios roll
+	lifecycleNode = "lifecycle-node"
+	// lifecycleNamespace and lifecycleConfigMap hold the state shared by the
+	// helpers of a scenario
+	lifecycleNamespace = "rollout-helper"
+	lifecycleConfigMap = "rollout-helper-state"
+	// lifecyclePollInterval is how far the clock is stepped between polls
+	lifecyclePollInterval = 30 * time.Second
+)
+
+// lifecycleEnv is the fake Alertmanager, cluster and clock of a scenario.
+// Helpers started on it share them like the instances of a restarted helper
+type lifecycleEnv struct {
+	t         *testing.T
+	am        *amfake.Server
+	clientset *fake.Clientset
+	clock     *clocktesting.FakeClock
+	// store is the state ConfigMap, nil for stateless scenarios
+	store state.Store
+}
+
+// lifecycleHelper is an instance of the helper whose watcher is stepped
+// through its polls by the scenario
+type lifecycleHelper struct {
+	env     *lifecycleEnv
+	manager *alertmanager.SilenceManager
+	watcher *watcher.Watcher
+}
+
+// TestLifecycle drives the silence manager and the node watcher through node
+// rollouts and helper restarts against a fake Alertmanager and cluster, and
+// verifies the silences in Alertmanager after every step. Scenarios don't
+// share state, a failed one doesn't skip the others
+func TestLifecycle(t *testing.T) {
+	if !testing.Verbose() {
+		klog.SetLogger(logr.Discard())
+	}
+
+	t.Run("silence-rolling", func(t *testing.T) {
+		env := newLifecycleEnv(t, false)
+		h := env.start()
+		defer h.stop()
+
+		ids := h.rollNode()
+		if active := env.am.ActiveSilences(); active != len(ids) {
+			t.Fatalf("Expected the %d silences of node %s to be active, got %d", len(ids), lifecycleNode, active)
+		}
+	})
+
+	t.Run("unsilence-done", func(t *testing.T) {
+		env := newLifecycleEnv(t, false)
+		h := env.start()
+		defer h.stop()
+
+		ids := h.rollNode()
+		env.setMachineConfigState(watcher.MachineConfigStateDone)
+		h.expectChange(false)
+		h.expectUnsilenced(ids)
+	})
+
+	t.Run("node-deleted", func(t *testing.T) {
+		env := newLifecycleEnv(t, false)
+		h := env.start()
+		defer h.stop()
+
+		ids := h.rollNode()
+		if err := env.clientset.CoreV1().Nodes().Delete(context.Background(), lifecycleNode, metav1.DeleteOptions{}); err != nil {
+			t.Fatalf("Failed to delete node %s: %v", lifecycleNode, err)
+		}
+		if changed := h.poll(); len(changed) != 1 || !changed[0].Deleted {
+			t.Fatalf("Expected node %s to be reported deleted, got %+v", lifecycleNode, changed)
+		}
+		h.expectUnsilenced(ids)
+	})
+
+	t.Run("restart-while-rolling", func(t *testing.T) {
+		testRestartWhileRolling(newLifecycleEnv(t, false))
+	})
+
+	// A restarted helper without a state ConfigMap recovers its silences from Alertmanager
+	t.Run("restart-without-state", func(t *testing.T) {
+		testRestartWhileRolling(newLifecycleEnv(t, true))
+	})
+}
+
+// testRestartWhileRolling restarts the helper while the node rolls, the next
+// one has to take the silences over instead of creating others, and delete
+// them once the node is done
+func testRestartWhileRolling(env *lifecycleEnv) {
+	t := env.t
+	first := env.start()
+	ids := first.rollNode()
+	first.stop()
+
+	second := env.start()
+	defer second.stop()
+	if restored := second.expectSilenced(); fmt.Sprint(restored) != fmt.Sprint(ids) {
+		t.Fatalf("Expected the silences %v to be restored, got %v", ids, restored)
+	}
+
+	// The new watcher reports the rollout again, it must not add silences
+	second.expectChange(true)
+	if active := env.am.ActiveSilences(); active != len(ids) {
+		t.Fatalf("Expected the %d restored silences to be active, got %d", len(ids), active)
+	}
+
+	env.setMachineConfigState(watcher.MachineConfigStateDone)
+	second.expectChange(false)
+	second.expectUnsilenced(ids)
+}
+
+func newLifecycleEnv(t *testing.T, stateless bool) *lifecycleEnv {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        lifecycleNode,
+			Annotations: map[string]string{watcher.MachineConfigStateAnnotation: watcher.MachineConfigStateDone},
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	// The fake clientset denies access reviews, grant them like a correctly set up cluster
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		return true, &authorizationv1.SelfSubjectAccessReview{Status: authorizationv1.SubjectAccessReviewStatus{Allowed: true}}, nil
+	})
+
+	env := &lifecycleEnv{
+		t:         t,
+		am:        amfake.NewServer(0),
+		clientset: clientset,
+		clock:     clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	t.Cleanup(env.am.Close)
+	if !stateless {
+		env.store = state.NewConfigMapStore(clientset, lifecycleNamespace, lifecycleConfigMap)
+	}
+	return env
+}
+
+// start creates a helper, which restores the silences of the previous one
+func (e *lifecycleEnv) start() *lifecycleHelper {
+	client := alertmanager.NewClient([]string{e.am.URL()}, "")
+	manager := alertmanager.NewSilenceManager(client, e.clientset, &config.Config{}, e.store, alertmanager.Options{SilenceDuration: time.Hour})
+
+	nodeWatcher := watcher.NewWatcher(e.clientset, lifecyclePollInterval)
+	nodeWatcher.SetClock(e.clock)
+	// Changes are reported on the next poll, the scenarios don't flap
+	nodeWatcher.SetSettleTime(0)
+	return &lifecycleHelper{env: e, manager: manager, watcher: nodeWatcher}
+}
+
+// stop shuts a helper down, keeping its silences for the next one
+func (h *lifecycleHelper) stop() {
+	h.manager.Shutdown(context.Background(), alertmanager.ShutdownKeep)
+}
+
+// setMachineConfigState sets the machine-config state of the node
+func (e *lifecycleEnv) setMachineConfigState(value string) {
+	e.t.Helper()
+	ctx := context.Background()
+	node, err := e.clientset.CoreV1().Nodes().Get(ctx, lifecycleNode, metav1.GetOptions{})
+	if err != nil {
+		e.t.Fatalf("Failed to get node %s: %v", lifecycleNode, err)
+	}
+	node.Annotations[watcher.MachineConfigStateAnnotation] = value
+	if _, err := e.clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		e.t.Fatalf("Failed to update node %s: %v", lifecycleNode, err)
+	}
+}
+
+// poll steps the clock to the next poll of the helper's watcher, and handles
+// the node state changes it queued like the helper does
+func (h *lifecycleHelper) poll() []watcher.NodeState {
+	t := h.env.t
+	t.Helper()
+	ctx := context.Background()
+	h.env.clock.Step(lifecyclePollInterval)
+	if err := h.watcher.Poll(ctx); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+
+	var states []watcher.NodeState
+	for {
+		select {
+		case changed := <-h.watcher.StateChannel():
+			var err error
+			if changed.Deleted {
+				err = h.manager.HandleNodeDeleted(ctx, changed.Name)
+			} else {
+				err = h.manager.HandleNodeState(ctx, changed.Name, changed.IsRolling, alertmanager.KindOf(changed))
+			}
+			if err != nil {
+				t.Fatalf("Failed to handle the state of node %s: %v", changed.Name, err)
+			}
+			states = append(states, changed)
+		default:
+			return states
+		}
+	}
+}
+
+// expectChange polls once and expects the node to be reported rolling or not
+func (h *lifecycleHelper) expectChange(rolling bool) {
+	h.env.t.Helper()
+	changed := h.poll()
+	if len(changed) != 1 || changed[0].Name != lifecycleNode || changed[0].IsRolling != rolling {
+		h.env.t.Fatalf("Expected node %s to be reported rolling=%t, got %+v", lifecycleNode, rolling, changed)
+	}
+}
+
+// rollNode starts a rollout of the node and returns the IDs of its silences,
+// which have to be active in Alertmanager
+func (h *lifecycleHelper) rollNode() []string {
+	h.env.t.Helper()
+	h.env.setMachineConfigState(watcher.MachineConfigStateWorking)
+	h.expectChange(true)
+	return h.expectSilenced()
+}
+
+// expectSilenced returns the IDs of the silences the helper tracks for the
+// node, there has to be at least one and all of them have to be active
+func (h *lifecycleHelper) expectSilenced() []string {
+	t := h.env.t
+	t.Helper()
+	var ids []string
+	for _, silence := range h.manager.Silences()[lifecycleNode] {
+		ids = append(ids, silence.ID)
+	}
+	if len(ids) == 0 {
+		t.Fatalf("No silences are tracked for node %s", lifecycleNode)
+	}
+	active := h.env.am.ActiveSilenceIDs()
+	for _, id := range ids {
+		if !active[id] {
+			t.Fatalf("Silence %s of node %s isn't active", id, lifecycleNode)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// expectUnsilenced verifies that the helper forgot the node and that none of
+// its silences are active anymore
+func (h *lifecycleHelper) expectUnsilenced(ids []string) {
+	t := h.env.t
+	t.Helper()
+	if tracked, ok := h.manager.Silences()[lifecycleNode]; ok {
+		t.Fatalf("%d silences are still tracked for node %s", len(tracked), lifecycleNode)
+	}
+	active := h.env.am.ActiveSilenceIDs()
+	for _, id := range ids {
+		if active[id] {
+			t.Fatalf("Silence %s of node %s is still active", id, lifecycleNode)
+		}
+	}
+	if len(active) > 0 {
+		t.Fatalf("%d silences are still active", len(active))
+	}
+}
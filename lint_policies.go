@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"rollout-helper/internal/config/scheme"
+	"rollout-helper/internal/lint"
+)
+
+// runLintPolicies checks the silence policies of a configuration file for
+// common mistakes, for the CI of the configuration repository. It exits with
+// 1 if a finding fails the lint and with 2 on invalid usage or input
+func runLintPolicies(args []string) {
+	fs := flag.NewFlagSet("lint-policies", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to the configuration file with silence policies")
+	rulesPath := fs.String("rules", "", "Path to a dump of the alert rules the matcher names are checked against: the response of the Prometheus rules API, a rule file or a PrometheusRule")
+	extraLabels := fs.String("extra-labels", "", "Comma-separated labels alerts get outside their rules, e.g. by external labels or relabeling")
+	clusterLabel := fs.String("cluster-label", "cluster", "Label every policy needs a matcher on when clusters share an Alertmanager, empty skips the check")
+	strict := fs.Bool("strict", false, "Fail on warnings as well")
+	output := fs.String("output", "table", "Output format: table or json")
+	fs.Parse(args)
+
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "--config is required")
+		os.Exit(2)
+	}
+	if err := validateOutput(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	options := lint.Options{ClusterLabel: *clusterLabel}
+	if *rulesPath != "" {
+		labels, err := lint.LoadRuleLabels(*rulesPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		for _, label := range strings.Split(*extraLabels, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels[label] = true
+			}
+		}
+		if *clusterLabel != "" {
+			labels[*clusterLabel] = true
+		}
+		options.Labels = labels
+	}
+
+	var findings []lint.Finding
+	if cfg, err := scheme.Load(*configPath); err != nil {
+		// Mistakes the helper refuses to start with
+		findings = []lint.Finding{{Severity: lint.SeverityError, Check: "config", Message: err.Error()}}
+	} else {
+		findings = lint.Lint(cfg, options)
+	}
+
+	if *output == "json" {
+		if findings == nil {
+			findings = []lint.Finding{}
+		}
+		writeJSON(os.Stdout, findings)
+	} else {
+		writeFindings(findings)
+	}
+
+	if lint.HasErrors(findings) || *strict && len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// writeFindings prints a table of the findings and a summary
+func writeFindings(findings []lint.Finding) {
+	if len(findings) == 0 {
+		fmt.Println("No findings")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tCHECK\tPOLICY\tPOOL\tFINDING\tSUGGESTION")
+	errors := 0
+	for _, finding := range findings {
+		if finding.Severity == lint.SeverityError {
+			errors++
+		}
+		pool := finding.Pool
+		if pool == "" {
+			pool = "-"
+		}
+		policy := finding.Policy
+		if policy == "" {
+			policy = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", finding.Severity, finding.Check, policy, pool, finding.Message, finding.Suggestion)
+	}
+	w.Flush()
+	fmt.Printf("\n%d errors, %d warnings\n", errors, len(findings)-errors)
+}
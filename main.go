@@ -2,55 +2,309 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
 	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/audit"
+	"rollout-helper/internal/authz"
+	"rollout-helper/internal/config"
+	configscheme "rollout-helper/internal/config/scheme"
+	"rollout-helper/internal/grafana"
+	"rollout-helper/internal/heartbeat"
+	"rollout-helper/internal/logging"
+	"rollout-helper/internal/loki"
+	"rollout-helper/internal/maintenance"
+	"rollout-helper/internal/metrics"
+	"rollout-helper/internal/notify"
+	"rollout-helper/internal/policy"
+	"rollout-helper/internal/prometheus"
+	"rollout-helper/internal/routing"
+	"rollout-helper/internal/scope"
+	"rollout-helper/internal/server"
+	"rollout-helper/internal/slo"
+	"rollout-helper/internal/state"
+	"rollout-helper/internal/tracing"
+	"rollout-helper/internal/verify"
+	"rollout-helper/internal/version"
 	"rollout-helper/internal/watcher"
 )
 
 var (
-	alertManagerURL = flag.String("alertmanager-url", "", "AlertManager URL")
-	kubeconfig      = flag.String("kubeconfig", "", "Path to kubeconfig file")
-	noAlertManager  = flag.Bool("no-alertmanager", false, "Run without AlertManager, just log state events")
+	alertManagerURL  stringList
+	lifecycleHeaders stringList
+	alertManagerMode = flag.String("alertmanager-mode", string(alertmanager.ModeFailover), "How multiple AlertManager URLs are used: failover or broadcast")
+	kubeconfig       = flag.String("kubeconfig", "", "Path to kubeconfig file")
+	noAlertManager   = flag.Bool("no-alertmanager", false, "Run without AlertManager, just log state events")
+	configFile       = flag.String("config", "", "Path to the configuration file with additional silence policies")
+	pollInterval     = flag.Duration("poll-interval", 30*time.Second, "Interval between node state checks")
+	stateConfigMap   = flag.String("state-configmap", "", "Name of the ConfigMap used to persist silence state across restarts")
+	rollbackFile     = flag.String("rollback-file", "", "Path of a shell script kept up to date to expire every silence of the helper, for manual cleanup")
+	rollbackCM       = flag.String("rollback-configmap", "", "Name of a ConfigMap in the state namespace the rollback script is kept in, for manual cleanup")
+	stateNamespace   = flag.String("state-namespace", "", "Namespace of the state ConfigMap, defaults to the pod namespace")
+	logFormat        = flag.String("log-format", logging.FormatText, "Format of the logs: text, or json with the fields of structured messages like node, silenceID, action and duration")
+	otlpEndpoint     = flag.String("otlp-endpoint", "", "OTLP/HTTP collector the spans of the silence pipeline are exported to, e.g. http://otel-collector:4318. Empty disables tracing")
+	traceSampling    = flag.Float64("trace-sample-ratio", 1, "Ratio of node state changes which are traced, between 0 and 1")
+	listenAddress    = flag.String("listen-address", ":8080", "Address to serve health and metrics endpoints on")
+	adminAPI         = flag.Bool("admin-api", false, "Serve the admin API to list, create and remove silences and force a reconcile, authorized by RBAC rules on nonResourceURLs")
+	suppressionMode  = flag.String("suppression-mode", string(alertmanager.SuppressionSilences), "How the alerts of rolling nodes are suppressed: silences, or inhibition by a NodeRolling alert per node and an inhibition rule in Alertmanager")
+	silenceDuration  = flag.Duration("silence-duration", 90*time.Minute, "Default duration of created silences")
+	amMaxRetries     = flag.Int("alertmanager-max-retries", alertmanager.DefaultRetryPolicy.MaxRetries, "Number of retries of failed Alertmanager requests")
+	amRetryBackoff   = flag.Duration("alertmanager-retry-backoff", alertmanager.DefaultRetryPolicy.InitialBackoff, "Wait before the first retry of a failed Alertmanager request, doubled on each retry")
+	amBreakerRatio   = flag.Float64("alertmanager-breaker-ratio", alertmanager.DefaultBreakerPolicy.FailureRatio, "Share of failed Alertmanager requests within a minute which stops sending them for a while, 0 disables the circuit breaker")
+	amBreakerOpen    = flag.Duration("alertmanager-breaker-open-duration", alertmanager.DefaultBreakerPolicy.OpenDuration, "How long no Alertmanager requests are sent once the circuit breaker opened, before one tests whether it recovered")
+	amConcurrency    = flag.Int("alertmanager-concurrency", alertmanager.DefaultRequestLimits.Concurrency, "Maximum Alertmanager requests in flight, and how many silence groups of a node are created at once. 0 is unbounded")
+	amRateLimit      = flag.Float64("alertmanager-rate-limit", alertmanager.DefaultRequestLimits.RatePerSecond, "Average Alertmanager requests per second and endpoint, 0 is unlimited")
+	amBurst          = flag.Int("alertmanager-burst", alertmanager.DefaultRequestLimits.Burst, "Alertmanager requests sent to an endpoint at once before --alertmanager-rate-limit applies")
+	amTLS            = tlsFlags(flag.CommandLine)
+	amProxy          = proxyFlag(flag.CommandLine)
+	amHTTP           = httpFlags(flag.CommandLine)
+	amTenancy        = tenancyFlags(flag.CommandLine)
+	saToken          = flag.Bool("alertmanager-sa-token", false, "Authenticate to AlertManager with the pod's service account token instead of ALERTMNGR_TOKEN")
+	saTokenAudience  = flag.String("alertmanager-sa-token-audience", "", "Audience of the service account tokens requested for AlertManager, implies --alertmanager-sa-token")
+	tokenFile        = flag.String("alertmanager-token-file", "", "Path to a file with the AlertManager token, read again when it changes. Takes precedence over ALERTMNGR_TOKEN")
+	notifyWebhook    = flag.String("notify-webhook-url", "", "URL notifications about rollouts and failures are posted to as JSON")
+	notifyRate       = flag.Int("notify-rate-limit", 10, "Maximum notifications per minute and sink")
+	notifyDigest     = flag.Duration("notify-digest-window", time.Minute, "How often digests of rolling pools are sent or updated")
+	notifyStuck      = flag.Duration("notify-stuck-after", time.Hour, "Notify about nodes rolling for longer than this, 0 disables it")
+	slackChannel     = flag.String("notify-slack-channel", "", "Slack channel notifications about rollouts and failures are posted to with the bot token in SLACK_BOT_TOKEN")
+	amExternalURL    = flag.String("alertmanager-external-url", "", "URL of the Alertmanager UI silences are linked to in notifications, defaults to the first --alertmanager-url")
+	lifecycleURL     = flag.String("lifecycle-webhook-url", "", "URL every silence lifecycle event is posted to on its own, e.g. for chatops")
+	lifecycleTmpl    = flag.String("lifecycle-webhook-template", "", "Path to a Go template rendering the body of lifecycle webhook requests, the event as JSON by default")
+	lifecycleEvents  = flag.String("lifecycle-webhook-events", strings.Join(notify.DefaultLifecycleReasons, ","), "Comma-separated reasons of the events posted to the lifecycle webhook")
+	poolProgress     = flag.Bool("pool-progress", true, "Track the progress of MachineConfigPools from their status for notifications and the pool_rollout_progress metric")
+	grafanaURL       = flag.String("grafana-url", "", "URL of a Grafana the rollouts of nodes are annotated in, with the service account token in GRAFANA_TOKEN")
+	grafanaDashboard = flag.String("grafana-dashboard-uid", "", "UID of the dashboard Grafana annotations are shown on, organization wide by default")
+	grafanaTags      = flag.String("grafana-tags", "", "Comma-separated tags added to every Grafana annotation, e.g. the cluster name")
+	heartbeatEvery   = flag.Duration("heartbeat-interval", time.Minute, "How often the helper proves it's working by rollout_helper_heartbeat_timestamp_seconds and the heartbeat alert, 0 disables it")
+	heartbeatAlert   = flag.Bool("heartbeat-alert", false, "Post the RolloutHelperHeartbeat alert to Alertmanager every --heartbeat-interval, for a dead man's switch")
+	heartbeatLabels  = flag.String("heartbeat-labels", "", "Comma-separated name=value labels added to the heartbeat alert, e.g. cluster=prod-1")
+	metricsPushURL   = flag.String("metrics-push-url", "", "URL the metrics are pushed to, for clusters whose Prometheus can't scrape the helper. Authenticated with METRICS_PUSH_TOKEN if set")
+	metricsPushMode  = flag.String("metrics-push-mode", "remote-write", "How metrics are pushed to --metrics-push-url: remote-write or pushgateway")
+	metricsPushEvery = flag.Duration("metrics-push-interval", 30*time.Second, "How often the metrics are pushed to --metrics-push-url")
+	metricsPushJob   = flag.String("metrics-push-job", "rollout-helper", "Job label of the pushed metrics, the instance label is the pod name")
+	sloConfigMap     = flag.String("slo-windows-configmap", "", "Name of a ConfigMap the maintenance windows of rolling nodes and pools are written to, for SLO tooling")
+	sloNamespace     = flag.String("slo-windows-namespace", "", "Namespace of the SLO windows ConfigMap, defaults to the pod namespace")
+	sloWebhook       = flag.String("slo-windows-url", "", "URL the maintenance windows of rolling nodes and pools are posted to as JSON whenever they change")
+	sloRetention     = flag.Duration("slo-windows-retention", 7*24*time.Hour, "How long finished maintenance windows are kept in the published records")
+	auditSize        = flag.Int("silence-history-size", 20, "How many silence actions are kept per node for /api/v1/history, for --slo-windows-retention")
+	auditConfigMap   = flag.String("silence-history-configmap", "", "Name of a ConfigMap in the pod namespace the silence actions of nodes are kept in across restarts")
+	annotationAuth   = authzFlags(flag.CommandLine)
+	scopeNamespaces  = flag.String("namespaces", "", "Comma-separated namespaces pods, daemonsets, MaintenanceWindows and AlertmanagerConfigs are listed in, for namespace-scoped permissions. All namespaces if empty")
+	discoverDS       = flag.Bool("discover-daemonsets", false, "Also silence the pods of DaemonSets annotated with rollout-helper.snappcloud.io/silence=true")
+	versionGuard     = flag.Bool("version-guard", true, "Hold off on silence changes while an older instance of another version shares the state ConfigMap, e.g. during a rolling deploy")
+	prometheusURL    = flag.String("prometheus-url", "", "Prometheus or Thanos querier queried for the scrape targets of nodes after their rollout, with the token in PROMETHEUS_TOKEN or the service account token")
+	targetsTimeout   = flag.Duration("unsilence-targets-timeout", 0, "How long the silences of a node which finished rolling are kept until its silenced scrape targets are up in --prometheus-url. 0 disables waiting")
+	unsilenceDelay   = flag.Duration("unsilence-delay", 0, "How long silences are kept after a node finished rolling, for alerts which fire a few more scrape intervals")
+	verifyRollouts   = flag.Bool("verify-rollouts", false, "Keep the silences of a node which finished rolling until it's Ready, the pods of --verify-daemonsets run on it and its --verify-scrape-jobs targets are up")
+	verifyTimeout    = flag.Duration("verify-timeout", 10*time.Minute, "How long a node may fail --verify-rollouts before its silences are deleted anyway and the failure is reported")
+	verifyDS         = flag.String("verify-daemonsets", strings.Join(verify.DefaultDaemonSets, ","), "Comma-separated namespace/name of the DaemonSets whose pods have to be running and ready on a node after its rollout")
+	verifyJobs       = flag.String("verify-scrape-jobs", strings.Join(verify.DefaultScrapeJobs, ","), "Comma-separated jobs whose targets on a node have to be up after its rollout")
+	gcInterval       = flag.Duration("gc-interval", 10*time.Minute, "How often helper-owned silences of nodes which aren't rolling are deleted, including tracked nodes whose rollout ended unnoticed. 0 disables it")
+	gcGrace          = flag.Duration("gc-grace-period", 10*time.Minute, "How long silences are kept before the garbage collection or the reconciliation may delete them, and how long the garbage collection waits after a start")
+	shutdownTimeout  = flag.Duration("shutdown-timeout", 25*time.Second, "How long pending node state changes and silence requests are waited for on SIGTERM, keep it below the pod's termination grace period")
+	shutdownSilences = flag.String("shutdown-silences", string(alertmanager.ShutdownKeep), "What happens to the silences of tracked nodes on shutdown: keep persists them for the next instance, delete expires them")
+	cleanupShutdown  = flag.Bool("cleanup-on-shutdown", false, "Delete the silences created by the helper on graceful termination, so a restart never leaves silences behind. Shorthand for --shutdown-silences=delete")
+	reconcileEvery   = flag.Duration("reconcile-interval", 5*time.Minute, "How often silences in AlertManager are compared with the rolling nodes to recreate missing and expire orphaned ones, 0 disables it")
+	maxSilence       = flag.Duration("max-silence-duration", 4*time.Hour, "Maximum time silences of a single rollout are extended to, 0 disables extending")
+	maxRollout       = flag.Duration("max-rollout-duration", 0, "Delete the silences of a node rolling longer than this and don't create them again until its rollout ends, so its alerts fire. 0 disables it")
+	stuckThreshold   = flag.Duration("stuck-rollout-threshold", 0, "Report nodes rolling longer than this as stuck with a metric, an event and a NodeRolloutStuck alert, 0 disables it")
+	stuckAlerts      = flag.Bool("stuck-rollout-alerts", true, "Post a NodeRolloutStuck alert to Alertmanager for stuck nodes, which the helper's silences don't cover")
+	pauseOnAlerts    = flag.String("pause-pools-on-alerts", "", "Pause MachineConfigPools being updated while alerts matching these comma-separated matchers fire unsilenced, e.g. severity=\"critical\". Empty disables it")
+	pauseThreshold   = flag.Int("pause-pools-alert-threshold", 1, "Number of firing alerts matching --pause-pools-on-alerts which pause the pools being updated")
+	pauseInterval    = flag.Duration("pause-pools-interval", time.Minute, "How often the alerts of --pause-pools-on-alerts are checked")
+	policyCRD        = flag.Bool("silence-policy-crd", false, "Reconcile RolloutSilencePolicy objects into the silence policies and daemonsets")
+	maintenanceCRD   = flag.Bool("maintenance-windows", false, "Silence the nodes selected by active MaintenanceWindow objects")
+	nodeSelector     = flag.String("node-selector", "", "Label selector of the nodes whose silences are managed, e.g. node-role.kubernetes.io/worker or topology.kubernetes.io/zone=zone-a, for one instance per pool. All nodes if empty")
+	rollingTaints    = flag.String("rolling-taints", "", "Comma-separated taint keys marking a node as rolling, each optionally followed by :<effect>. Overrides rollingTaints of the configuration file")
+	kuredAnnotation  = flag.String("kured-annotation", watcher.DefaultKuredAnnotation, "Annotation kured sets on nodes it reboots, which are then considered rolling. Empty disables kured detection")
+	preRolling       = flag.Bool("pre-rolling", false, "Consider nodes rolling as soon as their desiredConfig differs from currentConfig, before the MCO starts draining them")
+	preSilence       = flag.Duration("pre-silence-window", 0, "Silence the nodes the MCO updates next this long before it's expected to pick them, based on the pool's node order. 0 disables it")
+	settleTime       = flag.Duration("settle-time", watcher.DefaultSettleTime, "How long a rolling node has to look done before its rollout ends, so a taint and the MCO state changing at different times don't end one rollout and start another")
+	cloudLead        = flag.Duration("cloud-maintenance-lead", 0, "Silence nodes this long before the planned host maintenance published by the cloud-agent subcommand starts, e.g. 15m. 0 disables it")
+	machinePhases    = flag.String("machine-phases", "", "Comma-separated Machine API phases the node of a Machine is considered rolling in, e.g. Deleting,Provisioning. Empty disables it")
+	detectDrains     = flag.Bool("detect-drains", false, "Consider cordoned nodes rolling once pods are evicted from them, for drains outside the MCO like autoscaler scale-downs")
+	poolSilences     = flag.Bool("pool-silences", false, "Cover the node silences of the rolling Linux nodes of a MachineConfigPool with a single silence, updated as nodes start and finish rolling")
+	criticalSilence  = flag.Duration("critical-pod-silence-duration", 0, "Silence pods annotated with rollout-helper.snappcloud.io/critical=true this long on the node they're moved to from a rolling node. 0 disables it")
+	evictionSilence  = flag.Duration("eviction-silence-duration", 0, "Silence the pods of the silenced daemonsets evicted from a node which isn't rolling, e.g. by a manual drain, and their replacements this long. 0 disables it")
+	catchUp          = flag.Duration("catch-up-duration", 0, "Silence all alerts of a node this long if some fired before its rollout was detected, until its regular silences take over. 0 disables it")
+	infraSilences    = flag.Bool("infra-silences", false, "Silence the alerts of platform singletons like Prometheus, the image registry and the router when their node rolls")
+	workloadSilences = flag.Bool("workload-silences", false, "Silence the workload alerts of the namespaces with pods on a rolling node, selected by --workload-namespaces and --workload-exclude-namespaces")
+	workloadAlerts   = flag.String("workload-alerts", strings.Join(alertmanager.DefaultWorkloadAlerts, ","), "Comma-separated alerts silenced by --workload-silences")
+	workloadInclude  = flag.String("workload-namespaces", "", "Comma-separated namespaces whose workload alerts are silenced, shell patterns like team-* are allowed. All if empty")
+	workloadExclude  = flag.String("workload-exclude-namespaces", strings.Join(alertmanager.DefaultWorkloadExclude, ","), "Comma-separated namespaces whose workload alerts are never silenced, shell patterns like team-* are allowed")
+	checkRouting     = flag.Bool("check-routing", false, "Warn about silence policies without a matcher on a label the AlertmanagerConfig routes match on, as their silences cover every route")
+	amConfigSecret   = flag.String("alertmanager-config-secret", "", "Secret with the Alertmanager configuration whose routes are checked as well by --check-routing, as namespace/name, e.g. openshift-monitoring/alertmanager-main")
+	builtinTargets   = flag.Bool("builtin-pod-targets", true, "Silence the pods of the built-in daemonsets, disable to only silence declared and discovered ones")
 )
 
 func main() {
-	klog.InitFlags(nil)
-	flag.Parse()
+	root := newRootCommand(time.Now())
+	if host, ok := pluginHost(os.Args[0]); ok {
+		root = newPluginCommand(host)
+	}
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// runHelper runs the rollout helper until it's terminated, with the flags
+// parsed by the root command. changed reports whether a flag was set
+func runHelper(startedAt time.Time, changed func(name string) bool) {
+	if err := logging.Setup(*logFormat); err != nil {
+		klog.Fatalf("Invalid --log-format: %v", err)
+	}
+	if *otlpEndpoint != "" {
+		shutdownTracing, err := tracing.Setup(*otlpEndpoint, *traceSampling)
+		if err != nil {
+			klog.Fatalf("Invalid --otlp-endpoint: %v", err)
+		}
+		defer func() {
+			flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancelFlush()
+			if err := shutdownTracing(flushCtx); err != nil {
+				klog.Errorf("Failed to flush spans: %v", err)
+			}
+		}()
+	}
 
-	if !*noAlertManager && *alertManagerURL == "" {
+	if !*noAlertManager && len(alertManagerURL) == 0 {
 		klog.Fatal("alertmanager-url flag is required when not using --no-alertmanager")
 	}
+	if *amMaxRetries < 0 {
+		klog.Fatal("--alertmanager-max-retries must not be negative")
+	}
+	if *amRetryBackoff < 0 {
+		klog.Fatal("--alertmanager-retry-backoff must not be negative")
+	}
+	mode, err := alertmanager.ParseMode(*alertManagerMode)
+	if err != nil {
+		klog.Fatalf("Invalid --alertmanager-mode: %v", err)
+	}
+	shutdownAction, err := alertmanager.ParseShutdownAction(*shutdownSilences)
+	if err != nil {
+		klog.Fatalf("Invalid --shutdown-silences: %v", err)
+	}
+	if *cleanupShutdown {
+		if changed("shutdown-silences") && shutdownAction != alertmanager.ShutdownDelete {
+			klog.Fatalf("--cleanup-on-shutdown conflicts with --shutdown-silences=%s", shutdownAction)
+		}
+		shutdownAction = alertmanager.ShutdownDelete
+	}
+	suppression, err := alertmanager.ParseSuppression(*suppressionMode)
+	if err != nil {
+		klog.Fatalf("Invalid --suppression-mode: %v", err)
+	}
 
 	// Get alert manager token from environment
 	alertManagerToken := os.Getenv("ALERTMNGR_TOKEN")
-	if !*noAlertManager && alertManagerToken == "" {
-		klog.Fatal("ALERTMNGR_TOKEN environment variable is required when not using --no-alertmanager")
+	useSAToken := *saToken || *saTokenAudience != ""
+	if !*noAlertManager && alertManagerToken == "" && *tokenFile == "" && !useSAToken {
+		klog.Fatal("ALERTMNGR_TOKEN environment variable, --alertmanager-token-file or --alertmanager-sa-token is required when not using --no-alertmanager")
 	}
 
-	// Create Kubernetes client
-	var config *rest.Config
-	var err error
-	if *kubeconfig != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	} else {
-		config, err = rest.InClusterConfig()
+	requestLimits := alertmanager.RequestLimits{Concurrency: *amConcurrency, RatePerSecond: *amRateLimit, Burst: *amBurst}
+	if err := requestLimits.Validate(); err != nil {
+		klog.Fatalf("Invalid Alertmanager request limits: %v", err)
 	}
-	if err != nil {
-		klog.Fatalf("Failed to create k8s config: %v", err)
+
+	// Load optional configuration file
+	cfg := &config.Config{}
+	if *configFile != "" {
+		loaded, err := configscheme.Load(*configFile)
+		if err != nil {
+			klog.Fatalf("Failed to load config: %v", err)
+		}
+		cfg = loaded
+	}
+
+	metrics.ConfigHash.Set(float64(cfg.Hash()))
+	klog.Infof("Rollout helper %s (commit %s, %s)", version.Version, version.Revision(), version.GoVersion)
+
+	if err := config.ValidateDuration(*silenceDuration); err != nil {
+		klog.Fatalf("Invalid --silence-duration: %v", err)
+	}
+
+	// The flag takes precedence over the configuration file, both default to watcher.DefaultRollingTaints
+	taints := cfg.RollingTaints
+	if *rollingTaints != "" {
+		if taints, err = config.ParseTaints(*rollingTaints); err != nil {
+			klog.Fatalf("Invalid --rolling-taints: %v", err)
+		}
+	}
+
+	namespaces := scope.Parse(*scopeNamespaces)
+	if !namespaces.All() {
+		klog.Infof("Listing namespaced objects in %s only", strings.Join(namespaces, ", "))
+	}
+
+	var selector labels.Selector
+	if *nodeSelector != "" {
+		if selector, err = labels.Parse(*nodeSelector); err != nil {
+			klog.Fatalf("Invalid --node-selector: %v", err)
+		}
+		klog.Infof("Managing the silences of nodes matching %s only", selector)
+	}
+
+	var workloads *alertmanager.WorkloadSelector
+	if *workloadSilences {
+		workloads = &alertmanager.WorkloadSelector{
+			Alerts:  splitList(*workloadAlerts),
+			Include: splitList(*workloadInclude),
+			Exclude: splitList(*workloadExclude),
+		}
+		if err := workloads.Validate(); err != nil {
+			klog.Fatalf("Invalid workload silences: %v", err)
+		}
+		for _, alert := range workloads.Alerts {
+			if cfg.Protected(config.AlertNameLabel, alert, false) != "" {
+				klog.Fatalf("Invalid --workload-alerts: %s is a protected alert", alert)
+			}
+		}
+	}
+
+	var promClient *prometheus.Client
+	if *prometheusURL != "" {
+		if promClient, err = prometheus.NewClient(*prometheusURL, os.Getenv("PROMETHEUS_TOKEN")); err != nil {
+			klog.Fatalf("Invalid --prometheus-url: %v", err)
+		}
+	}
+	if *targetsTimeout > 0 && promClient == nil {
+		klog.Fatal("--unsilence-targets-timeout requires --prometheus-url")
+	}
+	verifyOptions := verify.Options{
+		DaemonSets: splitList(*verifyDS),
+		Prometheus: promClient,
+		ScrapeJobs: splitList(*verifyJobs),
+	}
+	if *verifyRollouts {
+		if err := verifyOptions.Validate(); err != nil {
+			klog.Fatalf("Invalid rollout verification: %v", err)
+		}
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	// Create Kubernetes client
+	clientset, err := newClientset(*kubeconfig)
 	if err != nil {
-		klog.Fatalf("Failed to create k8s client: %v", err)
+		klog.Fatal(err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -60,25 +314,445 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
+	// Record events on nodes
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	defer broadcaster.Shutdown()
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "rollout-helper"})
+
+	// Track the progress of MachineConfigPools
+	var progress *watcher.ProgressTracker
+	if *poolProgress {
+		progressClient, err := newDynamicClient(*kubeconfig)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		progress = watcher.NewProgressTracker(progressClient, *pollInterval)
+		progress.Start(ctx)
+	}
+
+	// Notify about rollouts and failures
+	var notifier *notify.Pipeline
+	if *notifyWebhook != "" || *slackChannel != "" {
+		if *notifyRate <= 0 {
+			klog.Fatal("--notify-rate-limit must be positive")
+		}
+		notifier = notify.NewPipeline(*notifyDigest)
+		if *notifyWebhook != "" {
+			notifier.AddSink(notify.NewWebhookSink(*notifyWebhook), *notifyRate)
+		}
+		if *slackChannel != "" {
+			token := os.Getenv("SLACK_BOT_TOKEN")
+			if token == "" {
+				klog.Fatal("SLACK_BOT_TOKEN environment variable is required with --notify-slack-channel")
+			}
+			notifier.AddSink(notify.NewSlackSink(token, *slackChannel), *notifyRate)
+		}
+		notifier.SetEventSource(notify.KubernetesEvents(clientset, namespaces))
+		notifier.SetStuckAfter(*notifyStuck)
+		if progress != nil {
+			notifier.SetProgressSource(func(pool string) (int64, int64, bool) {
+				p, ok := progress.Progress(pool)
+				return p.Updated, p.Total, ok
+			})
+		}
+	}
+
+	// Post silence lifecycle events for chatops
+	var lifecycle *notify.LifecycleWebhook
+	if *lifecycleURL != "" {
+		lifecycle = notify.NewLifecycleWebhook(*lifecycleURL)
+		if *lifecycleTmpl != "" {
+			text, err := os.ReadFile(*lifecycleTmpl)
+			if err != nil {
+				klog.Fatalf("Failed to read lifecycle webhook template: %v", err)
+			}
+			if err := lifecycle.SetTemplate(string(text)); err != nil {
+				klog.Fatal(err)
+			}
+		}
+		if err := lifecycle.SetHeaders(lifecycleHeaders); err != nil {
+			klog.Fatalf("Invalid lifecycle webhook header: %v", err)
+		}
+		lifecycle.SetReasons(strings.Split(*lifecycleEvents, ","))
+		lifecycle.Start(ctx)
+	}
+
+	// Annotate rollouts in Grafana dashboards
+	var annotator *grafana.Annotator
+	if *grafanaURL != "" {
+		token := os.Getenv("GRAFANA_TOKEN")
+		if token == "" {
+			klog.Fatal("GRAFANA_TOKEN environment variable is required with --grafana-url")
+		}
+		annotator = grafana.NewAnnotator(*grafanaURL, token)
+		annotator.SetDashboard(*grafanaDashboard)
+		if *grafanaTags != "" {
+			annotator.SetTags(strings.Split(*grafanaTags, ","))
+		}
+		annotator.Start(ctx)
+	}
+
+	// Push metrics for clusters whose Prometheus can't scrape the helper
+	if *metricsPushURL != "" {
+		if *metricsPushEvery <= 0 {
+			klog.Fatal("--metrics-push-interval must be positive")
+		}
+		token := os.Getenv("METRICS_PUSH_TOKEN")
+		var pusher metrics.Pusher
+		switch *metricsPushMode {
+		case "remote-write":
+			pusher = metrics.NewRemoteWrite(*metricsPushURL, *metricsPushJob, instanceID(), token)
+		case "pushgateway":
+			pusher = metrics.NewPushGateway(*metricsPushURL, *metricsPushJob, instanceID(), token)
+		default:
+			klog.Fatalf("Invalid --metrics-push-mode %q, expected remote-write or pushgateway", *metricsPushMode)
+		}
+		metrics.StartPushing(ctx, *metricsPushEvery, pusher)
+	}
+
+	// Record maintenance windows for SLO tooling and the history API
+	var windows *slo.Recorder
+	var history *slo.MemorySink
+	if *sloConfigMap != "" || *sloWebhook != "" || *adminAPI {
+		windows = slo.NewRecorder(*sloRetention)
+		if *sloConfigMap != "" {
+			namespace := *sloNamespace
+			if namespace == "" {
+				namespace = state.CurrentNamespace()
+			}
+			windows.AddSink(slo.NewConfigMapSink(clientset, namespace, *sloConfigMap))
+		}
+		if *sloWebhook != "" {
+			windows.AddSink(slo.NewWebhookSink(*sloWebhook))
+		}
+		if *adminAPI {
+			history = slo.NewMemorySink()
+			windows.AddSink(history)
+		}
+		windows.Start(ctx)
+	}
+
+	// Record the silence actions of nodes for postmortems
+	var silenceHistory *audit.Log
+	if *auditConfigMap != "" || *adminAPI {
+		if *auditSize <= 0 {
+			klog.Fatal("--silence-history-size must be positive")
+		}
+		silenceHistory = audit.NewLog(*auditSize, *sloRetention)
+		if *auditConfigMap != "" {
+			silenceHistory.SetConfigMap(clientset, state.CurrentNamespace(), *auditConfigMap)
+		}
+		silenceHistory.Start(ctx)
+	}
+
+	authorizer, err := annotationAuth.Authorizer()
+	if err != nil {
+		klog.Fatalf("Failed to configure annotation authorization: %v", err)
+	}
+
 	// Initialize components
 	var silenceManager *alertmanager.SilenceManager
+	var inhibitor *alertmanager.Inhibitor
+	var heartbeatClient *alertmanager.Client
 	if !*noAlertManager {
-		alertManagerClient := alertmanager.NewClient(*alertManagerURL, alertManagerToken)
-		silenceManager = alertmanager.NewSilenceManager(alertManagerClient, clientset)
+		var store state.Store
+		var instances state.Registry
+		var rollback []state.RollbackWriter
+		if *rollbackFile != "" {
+			rollback = append(rollback, state.NewRollbackFile(*rollbackFile))
+		}
+		if *rollbackCM != "" {
+			namespace := *stateNamespace
+			if namespace == "" {
+				namespace = state.CurrentNamespace()
+			}
+			rollback = append(rollback, state.NewRollbackConfigMap(clientset, namespace, *rollbackCM))
+		}
+		if *stateConfigMap != "" {
+			namespace := *stateNamespace
+			if namespace == "" {
+				namespace = state.CurrentNamespace()
+			}
+			configMapStore := state.NewConfigMapStore(clientset, namespace, *stateConfigMap)
+			store = configMapStore
+			if *versionGuard {
+				instances = configMapStore
+			}
+		}
+
+		alertManagerClient := alertmanager.NewClient(alertManagerURL, alertManagerToken)
+		alertManagerClient.SetMode(mode)
+		alertManagerClient.SetRequestLimits(requestLimits)
+		alertManagerClient.SetAudit(silenceHistory)
+		alertManagerClient.SetExtraMatchers(cfg.ExtraMatchers)
+		protected := cfg.ProtectedAlerts
+		if *stuckThreshold > 0 && *stuckAlerts {
+			// The silences of a stuck node must not hide its alert
+			protected = append(append([]string(nil), protected...), alertmanager.StuckAlertName)
+		}
+		alertManagerClient.SetProtectedAlerts(protected)
+		if useSAToken {
+			var serviceAccount string
+			if *saTokenAudience != "" {
+				if serviceAccount, err = alertmanager.CurrentServiceAccount(); err != nil {
+					klog.Fatalf("Failed to determine service account: %v", err)
+				}
+			}
+			if err := alertManagerClient.SetServiceAccountToken(clientset, state.CurrentNamespace(), serviceAccount, *saTokenAudience); err != nil {
+				klog.Fatalf("Failed to get service account token for Alertmanager: %v", err)
+			}
+		} else if *tokenFile != "" {
+			if err := alertManagerClient.SetTokenFile(*tokenFile); err != nil {
+				klog.Fatalf("Failed to read Alertmanager token: %v", err)
+			}
+		}
+		if err := alertManagerClient.SetHTTPOptions(*amHTTP); err != nil {
+			klog.Fatalf("Invalid Alertmanager HTTP options: %v", err)
+		}
+		if err := amTenancy.apply(alertManagerClient, cfg.Tenants()...); err != nil {
+			klog.Fatalf("Invalid --alertmanager-header: %v", err)
+		}
+		if amTLS.Enabled() {
+			if err := alertManagerClient.SetTLS(*amTLS); err != nil {
+				klog.Fatalf("Failed to configure Alertmanager TLS: %v", err)
+			}
+		}
+		if *amProxy != "" {
+			if err := alertManagerClient.SetProxy(*amProxy); err != nil {
+				klog.Fatalf("Invalid --alertmanager-proxy-url: %v", err)
+			}
+		}
+		alertManagerClient.SetRetryPolicy(alertmanager.RetryPolicy{
+			MaxRetries:     *amMaxRetries,
+			InitialBackoff: *amRetryBackoff,
+		})
+		breaker := alertmanager.DefaultBreakerPolicy
+		breaker.FailureRatio = *amBreakerRatio
+		breaker.OpenDuration = *amBreakerOpen
+		alertManagerClient.SetBreakerPolicy(breaker)
+		alertManagerClient.Start(ctx)
+		heartbeatClient = alertManagerClient
+		if suppression == alertmanager.SuppressionInhibition {
+			inhibitor = alertmanager.NewInhibitor(alertManagerClient)
+			inhibitor.Start(ctx)
+		} else {
+			var verifier *verify.Verifier
+			if *verifyRollouts {
+				verifier = verify.NewVerifier(clientset, verifyOptions)
+			}
+			silenceManager = alertmanager.NewSilenceManager(alertManagerClient, clientset, cfg, store, alertmanager.Options{
+				SilenceDuration:            *silenceDuration,
+				MaxSilenceDuration:         *maxSilence,
+				MaxRolloutDuration:         *maxRollout,
+				Recorder:                   recorder,
+				Notifier:                   notifier,
+				Lifecycle:                  lifecycle,
+				DiscoverDaemonSets:         *discoverDS,
+				DisableBuiltinTargets:      !*builtinTargets,
+				DisableInfraSilences:       !*infraSilences,
+				Workloads:                  workloads,
+				NodeSelector:               selector,
+				CatchUpDuration:            *catchUp,
+				CriticalPodSilenceDuration: *criticalSilence,
+				EvictionSilenceDuration:    *evictionSilence,
+				PoolSilences:               *poolSilences,
+				Namespaces:                 namespaces,
+				UnsilenceDelay:             *unsilenceDelay,
+				Verifier:                   verifier,
+				VerifyTimeout:              *verifyTimeout,
+				Prometheus:                 promClient,
+				TargetsTimeout:             *targetsTimeout,
+				ReconcileInterval:          *reconcileEvery,
+				GCInterval:                 *gcInterval,
+				GCGracePeriod:              *gcGrace,
+				Authorizer:                 authorizer,
+				Rollback:                   rollback,
+				Audit:                      silenceHistory,
+				Instances:                  instances,
+				Instance: state.Instance{
+					ID:        instanceID(),
+					Version:   version.Version + "+" + version.Revision(),
+					StartedAt: startedAt,
+				},
+			})
+			var dynamicClient dynamic.Interface
+			if *policyCRD || *maintenanceCRD || *checkRouting {
+				if dynamicClient, err = newDynamicClient(*kubeconfig); err != nil {
+					klog.Fatal(err)
+				}
+			}
+			if *policyCRD {
+				policy.NewController(dynamicClient, clientset, silenceManager).Start(ctx)
+			}
+			if *maintenanceCRD {
+				controller := maintenance.NewController(dynamicClient, clientset, silenceManager)
+				controller.SetNamespaces(namespaces)
+				controller.Start(ctx)
+			}
+			if *checkRouting {
+				checker := routing.NewChecker(clientset, dynamicClient, *amConfigSecret, silenceManager.Config)
+				checker.SetNamespaces(namespaces)
+				checker.Start(ctx)
+			}
+			silenceManager.Start(ctx)
+			if notifier != nil {
+				externalURL := *amExternalURL
+				if externalURL == "" {
+					externalURL = alertManagerURL[0]
+				}
+				notifier.SetSilenceSource(func(node string) []notify.Link {
+					var links []notify.Link
+					for _, silence := range silenceManager.Silences()[node] {
+						text := silence.Policy
+						if text == "" {
+							text = string(silence.Kind)
+						}
+						if link := alertmanager.SilenceURL(externalURL, amTenancy.tenant, silence.ID); link != "" {
+							links = append(links, notify.Link{Text: text, URL: link})
+						}
+					}
+					return links
+				})
+			}
+			if logs := cfg.LogAlerts; logs != nil && logs.Ruler != "" {
+				go checkLokiRules(ctx, logs)
+			}
+		}
+	}
+	// Report rollouts which take longer than they should, e.g. a stuck drain
+	var stuck *alertmanager.StuckDetector
+	if *stuckThreshold > 0 {
+		var stuckClient *alertmanager.Client
+		if *stuckAlerts {
+			stuckClient = heartbeatClient
+		}
+		stuck = alertmanager.NewStuckDetector(*stuckThreshold, stuckClient, recorder)
+		stuck.Start(ctx)
+	}
+
+	// Stop the rollout of pools while it breaks the cluster
+	if *pauseOnAlerts != "" {
+		if heartbeatClient == nil {
+			klog.Fatal("--pause-pools-on-alerts requires Alertmanager")
+		}
+		options := alertmanager.PauseOptions{Filters: splitList(*pauseOnAlerts), Threshold: *pauseThreshold, Interval: *pauseInterval}
+		if err := options.Validate(); err != nil {
+			klog.Fatalf("Invalid --pause-pools-on-alerts: %v", err)
+		}
+		pauseClient, err := newDynamicClient(*kubeconfig)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		alertmanager.NewPoolPauser(heartbeatClient, pauseClient, recorder, options).Start(ctx)
+	}
+
+	nodeWatcher := watcher.NewWatcher(clientset, *pollInterval)
+	if len(taints) > 0 {
+		nodeWatcher.SetRollingTaints(taints)
 	}
-	nodeWatcher := watcher.NewWatcher(clientset)
+	nodeWatcher.SetKuredAnnotation(*kuredAnnotation)
+	nodeWatcher.SetPreRolling(*preRolling)
+	nodeWatcher.SetPreSilenceWindow(*preSilence)
+	nodeWatcher.SetDetectDrains(*detectDrains)
+	nodeWatcher.SetNamespaces(namespaces)
+	if selector != nil {
+		nodeWatcher.SetNodeSelector(selector.String())
+	}
+	nodeWatcher.SetSettleTime(*settleTime)
+	nodeWatcher.SetCloudMaintenanceLead(*cloudLead)
+	nodeWatcher.SetAuthorizer(authorizer)
+	if *machinePhases != "" {
+		machineClient, err := newDynamicClient(*kubeconfig)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		nodeWatcher.SetMachinePhases(machineClient, strings.Split(*machinePhases, ","))
+	}
+	if silenceManager != nil {
+		// Rollouts which ended while the helper was down aren't reported as changes
+		nodeWatcher.SetPollHandler(silenceManager.PruneRollouts)
+	}
+	httpServer := server.New(*listenAddress)
+	// One authorizer admits the requests of the override, admin and history endpoints
+	apiAuthorizer := server.NewAuthorizer(clientset)
+	status := server.StatusSource{Nodes: nodeWatcher.Statuses}
+	if silenceManager != nil {
+		status.Silences = silenceManager.Silences
+		status.InaccessibleNamespaces = silenceManager.InaccessibleNamespaces
+		status.ForceUnsilenced = silenceManager.ForceUnsilenced
+		status.Escalated = silenceManager.Escalated
+		status.Verifying = silenceManager.Verifying
+		status.Maintenance = silenceManager.Maintenance
+		status.Circuit = silenceManager.Circuit
+		httpServer.HandleOverrides(silenceManager, apiAuthorizer)
+		httpServer.HandleExplain(silenceManager)
+		if *adminAPI {
+			httpServer.HandleAdmin(silenceManager, apiAuthorizer)
+		}
+	}
+	if history != nil {
+		httpServer.HandleHistory(history.Windows, silenceHistory.Entries, apiAuthorizer)
+	}
+	httpServer.HandleStatus(status)
+	httpServer.Start(ctx)
 
-	// Start the watcher
-	nodeWatcher.Start(ctx)
+	// Prove the helper works while the nodes are polled and their changes handled
+	if *heartbeatEvery > 0 {
+		beat := heartbeat.New(*heartbeatEvery, func() bool {
+			return time.Since(nodeWatcher.LastPoll()) < *pollInterval*3
+		})
+		if *heartbeatAlert {
+			labels, err := parseLabels(*heartbeatLabels)
+			if err != nil {
+				klog.Fatalf("Invalid --heartbeat-labels: %v", err)
+			}
+			if heartbeatClient == nil {
+				klog.Fatal("--heartbeat-alert needs an Alertmanager, it can't be used with --no-alertmanager")
+			}
+			beat.SetAlert(heartbeatClient, labels)
+		}
+		beat.Start(ctx)
+	}
 
-	// Process node state changes
+	// Start the notifier once its sources are set, then the watcher
+	if notifier != nil {
+		notifier.Start(ctx)
+	}
+	// The watcher stops first on shutdown, so the changes it queued are handled
+	watcherCtx, stopWatcher := context.WithCancel(ctx)
+	defer stopWatcher()
+	nodeWatcher.Start(watcherCtx)
+
+	// Process node state changes until the watcher closed the channel
+	drained := make(chan struct{})
 	go func() {
+		defer close(drained)
 		for state := range nodeWatcher.StateChannel() {
+			kind := notify.KindRolloutFinished
+			if state.IsRolling {
+				kind = notify.KindRolloutStarted
+			}
+			notifier.Notify(notify.Event{Kind: kind, Node: state.Name, Pool: state.Pool, OSImage: state.OSImage, KubeletVersion: state.KubeletVersion})
+			windows.Observe(state.Name, state.Pool, state.IsRolling, slo.Versions{OSImage: state.OSImage, KubeletVersion: state.KubeletVersion})
+			annotator.Observe(state.Name, state.Pool, state.IsRolling)
+			stuck.Observe(state.Name, state.Pool, state.IsRolling && !state.Deleted)
+
+			// Continue the trace the watcher started for the change
+			stateCtx := trace.ContextWithSpanContext(ctx, state.SpanContext)
 			if *noAlertManager {
-				klog.Infof("Node state change - Node: %s, IsRolling: %v", state.Name, state.IsRolling)
+				klog.InfoS("Node state change", "node", state.Name, "rolling", state.IsRolling, "drain", state.Drain)
+			} else if inhibitor != nil {
+				if err := inhibitor.HandleNodeState(stateCtx, state.Name, state.IsRolling && !state.Deleted, alertmanager.KindOf(state)); err != nil {
+					klog.ErrorS(err, "Failed to handle node state", "node", state.Name, "rolling", state.IsRolling)
+				}
+			} else if state.Deleted {
+				if err := silenceManager.HandleNodeDeleted(stateCtx, state.Name); err != nil {
+					klog.ErrorS(err, "Failed to handle node deletion", "node", state.Name)
+				}
 			} else {
-				if err := silenceManager.HandleNodeState(ctx, state.Name, state.IsRolling); err != nil {
-					klog.Errorf("Failed to handle node state for %s: %v", state.Name, err)
+				if err := silenceManager.HandleNodeState(stateCtx, state.Name, state.IsRolling, alertmanager.KindOf(state)); err != nil {
+					klog.ErrorS(err, "Failed to handle node state", "node", state.Name, "rolling", state.IsRolling)
 				}
 			}
 		}
@@ -89,4 +763,231 @@ func main() {
 	// Wait for termination signal
 	<-sigCh
 	klog.Info("Shutting down...")
+	shutdown(cancel, stopWatcher, drained, silenceManager, shutdownAction)
+}
+
+// shutdown stops the watcher, handles the node state changes it queued and
+// flushes the silences within --shutdown-timeout. The remaining loops are
+// cancelled last, so requests in flight complete
+func shutdown(cancel, stopWatcher context.CancelFunc, drained <-chan struct{}, silenceManager *alertmanager.SilenceManager, action alertmanager.ShutdownAction) {
+	defer cancel()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancelShutdown()
+
+	stopWatcher()
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		klog.Warning("Timed out handling the pending node state changes")
+	}
+	if silenceManager != nil {
+		silenceManager.Shutdown(shutdownCtx, action)
+	}
+	klog.Info("Shutdown complete")
+}
+
+// parseLabels parses comma-separated name=value labels
+func parseLabels(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, label := range strings.Split(value, ",") {
+		if label = strings.TrimSpace(label); label == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(label, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid label %q, expected name=value", label)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// splitList returns the non-empty items of a comma-separated list
+func splitList(value string) []string {
+	var list stringList
+	list.Set(value)
+	return list
+}
+
+// newRESTConfig loads the kubeconfig at path, or the in-cluster configuration if path is empty
+func newRESTConfig(path string) (*rest.Config, error) {
+	var restConfig *rest.Config
+	var err error
+	if path != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", path)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s config: %w", err)
+	}
+	return restConfig, nil
+}
+
+// newClientset creates a Kubernetes client from the kubeconfig at path, or
+// from the in-cluster configuration if path is empty
+func newClientset(path string) (*kubernetes.Clientset, error) {
+	restConfig, err := newRESTConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	return clientset, nil
+}
+
+// newDynamicClient creates a client for the helper's custom resources
+func newDynamicClient(path string) (dynamic.Interface, error) {
+	restConfig, err := newRESTConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return client, nil
+}
+
+// stringList is a flag which may be repeated and holds comma-separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// repeatedList is a flag which may be repeated, unlike stringList its values
+// may contain commas
+type repeatedList []string
+
+func (l *repeatedList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *repeatedList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// tlsFlags registers the Alertmanager TLS flags on fs
+func tlsFlags(fs *flag.FlagSet) *alertmanager.TLSOptions {
+	options := &alertmanager.TLSOptions{}
+	fs.StringVar(&options.CAFile, "alertmanager-ca-file", "", "Path to a CA bundle used to verify AlertManager, in addition to the system CAs")
+	fs.StringVar(&options.CertFile, "alertmanager-cert-file", "", "Path to the client certificate for mTLS with AlertManager")
+	fs.StringVar(&options.KeyFile, "alertmanager-key-file", "", "Path to the key of the client certificate")
+	fs.BoolVar(&options.InsecureSkipVerify, "insecure-skip-verify", false, "Skip verification of the AlertManager server certificate")
+	return options
+}
+
+// proxyFlag registers the Alertmanager proxy flag on fs
+func proxyFlag(fs *flag.FlagSet) *string {
+	return fs.String("alertmanager-proxy-url", "", "Proxy AlertManager is reached through, e.g. http://proxy:3128, instead of the one selected by HTTPS_PROXY, HTTP_PROXY and NO_PROXY")
+}
+
+// httpFlags registers the Alertmanager timeout and connection flags on fs
+func httpFlags(fs *flag.FlagSet) *alertmanager.HTTPOptions {
+	options := &alertmanager.HTTPOptions{}
+	fs.DurationVar(&options.Timeout, "alertmanager-timeout", alertmanager.DefaultHTTPOptions.Timeout, "Timeout of a single AlertManager request attempt, including reading the response")
+	fs.IntVar(&options.MaxIdleConns, "alertmanager-max-idle-conns", alertmanager.DefaultHTTPOptions.MaxIdleConns, "Idle connections kept open per AlertManager URL for later requests, 0 closes every connection after its request")
+	fs.DurationVar(&options.IdleConnTimeout, "alertmanager-idle-conn-timeout", alertmanager.DefaultHTTPOptions.IdleConnTimeout, "How long idle AlertManager connections are kept open, 0 keeps them until AlertManager closes them")
+	fs.DurationVar(&options.KeepAlive, "alertmanager-keepalive", alertmanager.DefaultHTTPOptions.KeepAlive, "Interval of TCP keep-alive probes on AlertManager connections, negative disables them")
+	return options
+}
+
+// tenancyOptions selects the headers and tenant of Alertmanager requests
+type tenancyOptions struct {
+	headers repeatedList
+	tenant  string
+}
+
+// tenancyFlags registers the Alertmanager header and tenant flags on fs
+func tenancyFlags(fs *flag.FlagSet) *tenancyOptions {
+	options := &tenancyOptions{}
+	fs.Var(&options.headers, "alertmanager-header", "Header of AlertManager requests as \"Name: value\", may be repeated. Values are expanded from the environment")
+	fs.StringVar(&options.tenant, "alertmanager-tenant", "", "Tenant of a multi-tenant AlertManager sent as X-Scope-OrgID, e.g. of Mimir. Policies may create their silences in other tenants")
+	return options
+}
+
+// apply configures client with the options, silences are also listed in tenants
+func (o *tenancyOptions) apply(client *alertmanager.Client, tenants ...string) error {
+	if err := client.SetHeaders(o.headers); err != nil {
+		return err
+	}
+	client.SetTenant(o.tenant)
+	client.AddTenants(tenants...)
+	return nil
+}
+
+// authzOptions selects how annotations changing what is silenced are authorized
+type authzOptions struct {
+	keysFile string
+	groups   string
+}
+
+// authzFlags registers the annotation authorization flags on fs
+func authzFlags(fs *flag.FlagSet) *authzOptions {
+	options := &authzOptions{}
+	fs.StringVar(&options.keysFile, "annotation-keys-file", "", "Path to a file with \"<group> <key>\" lines. The policies, silence, critical, ignore and cloud maintenance annotations are only honored if signed with one of the keys")
+	fs.StringVar(&options.groups, "annotation-groups", "", "Comma-separated groups of --annotation-keys-file whose signed annotations are honored, all if empty")
+	return options
+}
+
+// Authorizer returns the configured authorizer, nil if every annotation is honored
+func (o *authzOptions) Authorizer() (authz.Authorizer, error) {
+	if o.keysFile == "" {
+		if o.groups != "" {
+			return nil, errors.New("--annotation-groups requires --annotation-keys-file")
+		}
+		return nil, nil
+	}
+	keys, err := authz.LoadKeys(o.keysFile)
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, group := range strings.Split(o.groups, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return authz.NewSigned(keys, groups)
+}
+
+// checkLokiRules warns about Loki alert rules whose alerts won't be matched by
+// the log alert silences
+func checkLokiRules(ctx context.Context, logs *config.LogAlerts) {
+	nonConforming, err := loki.CheckRules(ctx, logs)
+	if err != nil {
+		klog.Warningf("Failed to verify the Loki alert rules: %v", err)
+		return
+	}
+	for _, rule := range nonConforming {
+		klog.Warningf("Alerts of Loki rule %s won't be silenced on rolling nodes", rule)
+	}
+	klog.Infof("Verified the Loki alert rules, %d don't follow the label conventions", len(nonConforming))
+}
+
+// instanceID identifies this helper among the instances sharing the state
+// ConfigMap, the pod name in a cluster
+func instanceID() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return fmt.Sprintf("pid-%d", os.Getpid())
 }
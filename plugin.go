@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// pluginName is the name kubectl and oc run the binary by as a plugin, e.g.
+// `oc rollouthelper status` runs kubectl-rollouthelper from the PATH
+const pluginName = "rollouthelper"
+
+// pluginHost returns the CLI which runs the binary as a plugin, by the name
+// it was invoked with, e.g. kubectl for kubectl-rollouthelper
+func pluginHost(argv0 string) (string, bool) {
+	host, name, ok := strings.Cut(filepath.Base(argv0), "-")
+	if !ok || name != pluginName || (host != "kubectl" && host != "oc") {
+		return "", false
+	}
+	return host, true
+}
+
+// newPluginCommand returns the command line of the binary run as a plugin
+// of host, which drives the helper running in the cluster through its admin
+// API instead of running it
+func newPluginCommand(host string) *cobra.Command {
+	client := &adminClient{forward: &portForward{}}
+	displayName := host + " " + pluginName
+	root := &cobra.Command{
+		Use:          pluginName,
+		Short:        "Drive the rollout helper running in the cluster",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		Annotations:  map[string]string{cobra.CommandDisplayNameAnnotation: displayName},
+	}
+	client.addFlags(root.PersistentFlags())
+
+	root.AddCommand(
+		newStatusCommand(client),
+		newSilenceCommand(client),
+		newUnsilenceCommand(client),
+		newForceUnsilenceCommand(client),
+		newHistoryCommand(client),
+	)
+	for _, cmd := range root.Commands() {
+		cmd.Example = strings.ReplaceAll(cmd.Example, "rollout-helper ", displayName+" ")
+	}
+	return root
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// portForward reaches the admin API of the helper running in the cluster
+// through a port-forward to one of its pods, like `oc port-forward`. The API
+// server's service proxy can't be used, it drops the bearer token the admin
+// API authorizes callers by
+type portForward struct {
+	namespace string
+	selector  string
+	port      int
+	// stop ends the port-forward, nil until it's started
+	stop chan struct{}
+}
+
+// addFlags registers the flags selecting the pod to forward to
+func (f *portForward) addFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&f.namespace, "namespace", "n", "snappcloud-tools", "Namespace the helper runs in")
+	flags.StringVarP(&f.selector, "selector", "l", "app=rollout-helper", "Label selector of the helper's pods")
+	flags.IntVar(&f.port, "port", 8080, "Port of the helper's --listen-address")
+}
+
+// start forwards a local port to a ready pod of the helper and returns the
+// URL of the local end
+func (f *portForward) start(kubeconfig string) (string, error) {
+	restConfig, err := loadKubeconfig(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to create k8s client: %w", err)
+	}
+	pod, err := f.readyPod(context.Background(), clientset)
+	if err != nil {
+		return "", err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to create port-forward transport: %w", err)
+	}
+	url := clientset.CoreV1().RESTClient().Post().Resource("pods").Namespace(f.namespace).Name(pod).SubResource("portforward").URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	f.stop = make(chan struct{})
+	ready := make(chan struct{})
+	forwarder, err := portforward.New(dialer, []string{fmt.Sprintf("0:%d", f.port)}, f.stop, ready, io.Discard, os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to port-forward to pod %s: %w", pod, err)
+	}
+	failed := make(chan error, 1)
+	go func() {
+		failed <- forwarder.ForwardPorts()
+	}()
+	select {
+	case <-ready:
+	case err := <-failed:
+		return "", fmt.Errorf("failed to port-forward to pod %s: %w", pod, err)
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		return "", fmt.Errorf("failed to get the forwarded port: %v", err)
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", ports[0].Local), nil
+}
+
+// readyPod returns the name of a ready pod of the helper
+func (f *portForward) readyPod(ctx context.Context, client kubernetes.Interface) (string, error) {
+	pods, err := client.CoreV1().Pods(f.namespace).List(ctx, metav1.ListOptions{LabelSelector: f.selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the pods of the helper: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				return pod.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no ready pod of the helper matches %s in namespace %s", f.selector, f.namespace)
+}
+
+// close ends the port-forward, if it was started
+func (f *portForward) close() {
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"rollout-helper/internal/authz"
+)
+
+// runSignAnnotation prints the signature annotation honoring an annotation
+// when the helper runs with --annotation-keys-file
+func runSignAnnotation(args []string) {
+	fs := flag.NewFlagSet("sign-annotation", flag.ExitOnError)
+	keysFile := fs.String("keys-file", "", "Path to a file with \"<group> <key>\" lines, the first key of the group is used")
+	group := fs.String("group", "", "Group to sign as, defaults to the only group of the keys file")
+	kind := fs.String("kind", "Node", "Kind of the annotated object: Node, DaemonSet or Pod")
+	namespace := fs.String("namespace", "", "Namespace of the annotated DaemonSet or pods")
+	name := fs.String("name", "", "Name of the annotated object, * for the critical annotation of the pods of a namespace")
+	annotation := fs.String("annotation", "", "The annotation to sign, as <key>=<value>")
+	fs.Parse(args)
+
+	key, value, ok := strings.Cut(*annotation, "=")
+	if *keysFile == "" || *name == "" || !ok {
+		fmt.Fprintln(os.Stderr, "Usage: rollout-helper sign-annotation --keys-file FILE --name NAME --annotation KEY=VALUE [--kind DaemonSet|Pod --namespace NS] [--group GROUP]")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	if (*kind != "Node") != (*namespace != "") {
+		fmt.Fprintln(os.Stderr, "--namespace is required for DaemonSets and pods and not allowed for nodes")
+		os.Exit(2)
+	}
+
+	signingGroup, signingKey, err := loadSigningKey(*keysFile, *group)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	object := authz.Object{Kind: *kind, Namespace: *namespace, Name: *name}
+	fmt.Printf("%s%s=%s\n", key, authz.SignatureSuffix, authz.Sign(signingGroup, signingKey, object, key, value))
+}
+
+// loadSigningKey returns the group to sign as and its first key, group may be
+// empty if the keys file has a single group
+func loadSigningKey(keysFile, group string) (string, []byte, error) {
+	keys, err := authz.LoadKeys(keysFile)
+	if err != nil {
+		return "", nil, err
+	}
+	if group == "" {
+		if len(keys) != 1 {
+			return "", nil, errors.New("--group is required when the keys file has several groups")
+		}
+		for name := range keys {
+			group = name
+		}
+	}
+	groupKeys, ok := keys[group]
+	if !ok {
+		return "", nil, fmt.Errorf("group %s has no key", group)
+	}
+	return group, groupKeys[0], nil
+}
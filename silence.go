@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/server"
+)
+
+// silenceOptions are the flags of the silence subcommand
+type silenceOptions struct {
+	client   *adminClient
+	duration time.Duration
+	output   string
+}
+
+// newSilenceCommand silences a node through the admin API of a running
+// helper with client, e.g. ahead of planned manual maintenance
+func newSilenceCommand(client *adminClient) *cobra.Command {
+	options := silenceOptions{client: client}
+	cmd := &cobra.Command{
+		Use:   "silence <node>",
+		Short: "Create the silences of a node for manual maintenance",
+		Long: `Create the silences the helper creates for a rolling node, for planned manual
+maintenance. They are kept until --duration passed or they are removed with
+the unsilence subcommand. A node which is already silenced keeps its
+silences as they are.`,
+		Example: `  rollout-helper silence worker-1 --duration 2h`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer client.close()
+			return runSilence(cmd.OutOrStdout(), args[0], options)
+		},
+	}
+	cmd.Flags().DurationVar(&options.duration, "duration", 0, "How long the node stays silenced, until it's unsilenced or --max-silence-duration of the helper if 0")
+	cmd.Flags().StringVarP(&options.output, "output", "o", "table", "Output format: table or json")
+	return cmd
+}
+
+func runSilence(out io.Writer, nodeName string, options silenceOptions) error {
+	if err := validateOutput(options.output); err != nil {
+		return err
+	}
+	if options.duration < 0 {
+		return fmt.Errorf("invalid duration %s", options.duration)
+	}
+	path := "/api/v1/nodes/" + url.PathEscape(nodeName) + "/silence"
+	if options.duration > 0 {
+		path += "?duration=" + url.QueryEscape(options.duration.String())
+	}
+	resp, err := options.client.do(http.MethodPost, path, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response server.SilenceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if options.output == "json" {
+		err = writeJSON(out, response)
+	} else {
+		err = writeSilences(out, map[string][]alertmanager.TrackedSilence{nodeName: response.Silences})
+	}
+	if err != nil {
+		return err
+	}
+	if !response.Complete {
+		return errors.New("some silences couldn't be created, see the logs of the helper")
+	}
+	return nil
+}
+
+// newUnsilenceCommand removes the silences of a node which isn't rolling
+// through the admin API of a running helper with client
+func newUnsilenceCommand(client *adminClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unsilence <node>",
+		Short: "Remove the silences of a node which isn't rolling",
+		Long: `Remove the silences of a node which isn't rolling, e.g. after manual
+maintenance. The silences of rolling nodes are kept, force-unsilence them
+instead.`,
+		Example: `  rollout-helper unsilence worker-1`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer client.close()
+			nodeName := args[0]
+			resp, err := client.do(http.MethodDelete, "/api/v1/nodes/"+url.PathEscape(nodeName)+"/silence", http.StatusNoContent)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			fmt.Fprintf(cmd.OutOrStdout(), "Unsilenced node %s\n", nodeName)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"rollout-helper/internal/alertmanager"
+	"rollout-helper/internal/server"
+)
+
+// statusOptions are the flags of the status subcommand
+type statusOptions struct {
+	client *adminClient
+	output string
+}
+
+// newStatusCommand lists the silences a running helper tracks through its
+// admin API with client, e.g. through `oc port-forward`
+func newStatusCommand(client *adminClient) *cobra.Command {
+	options := statusOptions{client: client}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "List the rolling nodes a running helper tracks and their silences",
+		Example: `  oc port-forward -n snappcloud-tools deploy/rollout-helper 8080 &
+  rollout-helper status`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer client.close()
+			return runStatus(cmd.OutOrStdout(), options)
+		},
+	}
+	cmd.Flags().StringVarP(&options.output, "output", "o", "table", "Output format: table or json")
+	return cmd
+}
+
+func runStatus(out io.Writer, options statusOptions) error {
+	if err := validateOutput(options.output); err != nil {
+		return err
+	}
+	resp, err := options.client.do(http.MethodGet, "/api/v1/silences", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response server.SilencesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if options.output == "json" {
+		return writeJSON(out, response)
+	}
+
+	if circuit := response.Alertmanager; circuit.State != "" && circuit.State != alertmanager.CircuitClosed {
+		fmt.Fprintf(out, "Alertmanager circuit breaker %s since %s, silences aren't managed: %s\n\n", circuit.State, circuit.Since.Local().Format(time.RFC3339), circuit.LastError)
+	}
+	if len(response.Nodes) == 0 {
+		fmt.Fprintln(out, "No nodes are tracked")
+		return nil
+	}
+	return writeSilences(out, response.Nodes)
+}
+
+// validateOutput checks the value of an --output flag
+func validateOutput(output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("invalid output format %q, expected table or json", output)
+	}
+	return nil
+}
+
+// writeJSON prints an indented response
+func writeJSON(out io.Writer, response interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(response)
+}
+
+// writeSilences prints a table of the silences of each node
+func writeSilences(out io.Writer, silences map[string][]alertmanager.TrackedSilence) error {
+	nodes := make([]string, 0, len(silences))
+	for node := range silences {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	now := time.Now()
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tKIND\tPOLICY\tSILENCE\tEXPIRES")
+	for _, node := range nodes {
+		for _, silence := range silences[node] {
+			expires := silence.ExpiresAt.Local().Format(time.RFC3339)
+			if silence.ExpiresAt.After(now) {
+				expires += fmt.Sprintf(" (in %s)", silence.ExpiresAt.Sub(now).Round(time.Minute))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", node, orNone(string(silence.Kind)), orNone(silence.Policy), silence.ID, expires)
+		}
+	}
+	return w.Flush()
+}
+
+// orNone returns s, or a dash if it's empty
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}